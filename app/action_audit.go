@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/audit"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/logs"
+	"github.com/urfave/cli/v2"
+)
+
+// auditAction handles the audit command
+func (k *KhedraApp) auditAction(c *cli.Context) error {
+	since := c.String("since")
+	if _, err := logs.ParseSince(since, time.Now()); err != nil {
+		return err
+	}
+
+	// Find the running khedra control service
+	cl, err := client.Discover()
+	if err != nil {
+		return err
+	}
+
+	page, err := cl.Audit(context.Background(), client.AuditRequest{
+		Since:  since,
+		Action: c.String("action"),
+		Limit:  c.Int("limit"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range page.Entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, e := range page.Entries {
+		fmt.Println(formatAuditEntry(e))
+	}
+	return nil
+}
+
+// formatAuditEntry renders an entry as one line: time, action, outcome, who and
+// the parameters in name order.
+func formatAuditEntry(e audit.Entry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s  %-13s %-5s %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Action, e.Outcome, e.Remote)
+	if e.Session != "" {
+		fmt.Fprintf(&sb, " session=%s", e.Session)
+	}
+	names := make([]string, 0, len(e.Params))
+	for name := range e.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, " %s=%s", name, e.Params[name])
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&sb, " error=%q", e.Error)
+	}
+	return sb.String()
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/config"
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/backup"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	sdk "github.com/TrueBlocks/trueblocks-sdk/v6"
+	"github.com/urfave/cli/v2"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// stateLocations returns where khedra keeps its state on this host for a
+// config using dataFolder.
+func stateLocations(dataFolder string) backup.Locations {
+	cfg := types.Config{General: types.General{DataFolder: utils.ResolvePath(dataFolder)}}
+	return backup.Locations{
+		Config: filepath.Dir(types.GetConfigFnNoCreate()),
+		Chifra: config.PathToRootConfig(),
+		Run:    filepath.Dir(control.Path()),
+		Index:  cfg.IndexPath(),
+		Cache:  cfg.CachePath(),
+	}
+}
+
+// backupAction handles the backup command. If the index or the cache goes in
+// the bundle, a running daemon's services are paused while it is written.
+func (k *KhedraApp) backupAction(c *cli.Context) error {
+	out := c.String("out")
+	if !c.Bool("force") {
+		if file.FileExists(out) {
+			return fmt.Errorf("%s already exists; use --force to replace it", out)
+		}
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := backup.Options{
+		Index:    c.Bool("index"),
+		Cache:    c.Bool("cache"),
+		Version:  strings.Trim(sdk.Version(), "-"),
+		Progress: bundleProgress(c.App.Writer, "added"),
+	}
+	if opts.Index || opts.Cache {
+		cl, err := client.Discover()
+		switch {
+		case errors.Is(err, client.ErrNotRunning):
+		case err != nil:
+			return err
+		default:
+			resume, err := pauseServices(ctx, cl, "backup", c.App.Writer)
+			defer resume()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(c.App.Writer, "Services paused.")
+		}
+	}
+
+	tmp := out + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	m, err := backup.Create(ctx, f, stateLocations(cfg.General.DataFolder), opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, out)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("the backup failed: %w", err)
+	}
+	fi, _ := os.Stat(out)
+	fmt.Fprintf(c.App.Writer, "Wrote %s: %d files, %s (%s compressed) of %s.\n", out, len(m.Files), sizeString(m.Bytes), sizeString(fi.Size()), strings.Join(m.Parts, ", "))
+	return nil
+}
+
+// restoreAction handles the restore command. The whole bundle is checked
+// before anything is written; then its files are put in place, config.yaml
+// and the draft are pointed at this host's folders, and trueBlocks.toml is
+// synced to match.
+func (k *KhedraApp) restoreAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("the backup file is required")
+	}
+	bundle := c.Args().First()
+	out := c.App.Writer
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Fprintf(out, "Checking %s...\n", bundle)
+	m, err := backup.Verify(ctx, bundle, nil)
+	if err != nil {
+		return err
+	}
+	printManifest(out, bundle, m)
+	if c.Bool("check") {
+		return nil
+	}
+
+	if _, err := client.Discover(); err == nil {
+		return fmt.Errorf("khedra is running; stop the daemon before restoring")
+	} else if !errors.Is(err, client.ErrNotRunning) {
+		return err
+	}
+	raw, err := backup.ReadFile(ctx, bundle, backup.PartConfig+"/config.yaml")
+	if err != nil {
+		return err
+	}
+	var saved types.Config
+	if err := yamlv2.Unmarshal(raw, &saved); err != nil {
+		return fmt.Errorf("the backup's config.yaml cannot be read: %w", err)
+	}
+
+	relocate := hostPaths(m.Home, saved.General.DataFolder, c.String("data-folder"))
+	dataFolder, logFolder := relocate(saved.General.DataFolder), relocate(saved.Logging.Folder)
+	locs := stateLocations(dataFolder)
+	if !c.Bool("force") {
+		if err := checkRestoreTargets(m, locs); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "Restoring with data folder %s and log folder %s.\n", dataFolder, logFolder)
+
+	if err := backup.Restore(ctx, bundle, m, locs, backup.RestoreOptions{Progress: bundleProgress(out, "restored")}); err != nil {
+		return fmt.Errorf("the restore did not finish, run it again: %w", err)
+	}
+	if _, _, err := install.RelocateConfig(dataFolder, logFolder, install.SourceCLI); err != nil {
+		return fmt.Errorf("cannot update config.yaml: %w", err)
+	}
+	if err := install.RelocateDraft(dataFolder, logFolder); err != nil {
+		return fmt.Errorf("cannot update the wizard's draft: %w", err)
+	}
+	for _, folder := range []string{dataFolder, logFolder} {
+		if err := os.MkdirAll(utils.ResolvePath(folder), 0o755); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("the restored config does not load on this host, fix it with khedra config edit: %w", err)
+	}
+	logger := k.logger
+	if logger == nil {
+		logger = types.NewLogger(cfg.Logging)
+	}
+	bootstrapper := NewDaemonBootstrapper(&cfg, locs.Chifra, logger)
+	bootstrapper.offline = true
+	if err := bootstrapper.EnsureConfig(); err != nil {
+		return fmt.Errorf("cannot update trueBlocks.toml: %w", err)
+	}
+
+	fmt.Fprintf(out, "Restored %d files. Start khedra with `khedra daemon`.\n", len(m.Files))
+	if !m.Has(backup.PartIndex) {
+		fmt.Fprintln(out, "The index was not in the backup; the daemon gets it as general.strategy says.")
+	}
+	return nil
+}
+
+// hostPaths returns a func that maps a path from the host a bundle was made
+// on to this host: paths in the old data folder move to newData (if given),
+// and paths in the old home folder move to this one. Others are kept.
+func hostPaths(oldHome, oldData, newData string) func(string) string {
+	home, _ := os.UserHomeDir()
+	return func(p string) string {
+		p = filepath.Clean(p)
+		if newData != "" {
+			if rest, ok := under(p, filepath.Clean(oldData)); ok {
+				return filepath.Join(utils.ResolvePath(newData), rest)
+			}
+		}
+		if strings.HasPrefix(p, "~") {
+			return p
+		}
+		if oldHome != "" && home != "" {
+			if rest, ok := under(p, filepath.Clean(oldHome)); ok {
+				return filepath.Join(home, rest)
+			}
+		}
+		return p
+	}
+}
+
+// under reports whether p is dir or in it, and its path relative to dir.
+func under(p, dir string) (string, bool) {
+	if p == dir {
+		return "", true
+	}
+	rest, ok := strings.CutPrefix(p, dir+string(filepath.Separator))
+	return rest, ok
+}
+
+// checkRestoreTargets refuses to replace an existing config, or to write the
+// index or cache into folders that already hold one.
+func checkRestoreTargets(m backup.Manifest, locs backup.Locations) error {
+	if fn := types.GetConfigFnNoCreate(); file.FileExists(fn) {
+		return fmt.Errorf("%s already exists; use --force to replace khedra's state on this host", fn)
+	}
+	for part, folder := range map[string]string{backup.PartIndex: locs.Index, backup.PartCache: locs.Cache} {
+		if !m.Has(part) {
+			continue
+		}
+		if entries, _ := os.ReadDir(folder); len(entries) > 0 {
+			return fmt.Errorf("%s is not empty; use --force to restore the %s over it", folder, part)
+		}
+	}
+	return nil
+}
+
+func printManifest(out io.Writer, bundle string, m backup.Manifest) {
+	fmt.Fprintf(out, "%s: written %s on %s", bundle, m.Created.Local().Format("2006-01-02 15:04"), m.Host)
+	if m.Version != "" {
+		fmt.Fprintf(out, " by khedra %s", m.Version)
+	}
+	fmt.Fprintf(out, ", %d files, %s of %s. All files match the manifest.\n", len(m.Files), sizeString(m.Bytes), strings.Join(m.Parts, ", "))
+}
+
+// bundleProgress prints a line at every twentieth of a backup or restore.
+func bundleProgress(out io.Writer, verb string) func(backup.Progress) {
+	last := -1
+	return func(p backup.Progress) {
+		pct := 100
+		if p.TotalBytes > 0 {
+			pct = int(p.Bytes * 100 / p.TotalBytes)
+		}
+		if pct/5 != last {
+			last = pct / 5
+			fmt.Fprintf(out, "  %s %d of %d files (%d%%)\n", verb, p.Files, p.TotalFiles, pct)
+		}
+	}
+}
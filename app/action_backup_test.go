@@ -0,0 +1,36 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostPaths(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home folder")
+	}
+	tests := []struct {
+		name    string
+		newData string
+		in      string
+		want    string
+	}{
+		{"data folder in the old home", "", "/home/old/.khedra/data", filepath.Join(home, ".khedra/data")},
+		{"log folder in the old home", "", "/home/old/.khedra/logs", filepath.Join(home, ".khedra/logs")},
+		{"outside the home is kept", "", "/mnt/big/khedra", "/mnt/big/khedra"},
+		{"a tilde is kept", "", "~/.khedra/logs", "~/.khedra/logs"},
+		{"a new data folder", "/srv/khedra", "/home/old/.khedra/data", "/srv/khedra"},
+		{"inside the old data folder", "/srv/khedra", "/home/old/.khedra/data/logs", "/srv/khedra/logs"},
+		{"others still follow the home", "/srv/khedra", "/home/old/.khedra/logs", filepath.Join(home, ".khedra/logs")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relocate := hostPaths("/home/old", "/home/old/.khedra/data", tt.newData)
+			assert.Equal(t, tt.want, relocate(tt.in))
+		})
+	}
+}
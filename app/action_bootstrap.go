@@ -0,0 +1,62 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/colors"
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/config"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/bootstrap"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chifra"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/urfave/cli/v2"
+)
+
+// bootstrapReport is what the bootstrap command prints with --json.
+type bootstrapReport struct {
+	Config string            `json:"config"`
+	Assets []bootstrap.Asset `json:"assets"`
+}
+
+// bootstrapAction handles the bootstrap command. It does what the daemon does
+// before starting its services (write trueBlocks.toml and each enabled
+// chain's assets) and reports where every asset came from.
+func (k *KhedraApp) bootstrapAction(c *cli.Context) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if c.IsSet("mirror") {
+		cfg.General.BootstrapMirror = c.String("mirror")
+	}
+
+	rootFolder := config.PathToRootConfig()
+	db := NewDaemonBootstrapper(&cfg, rootFolder, types.NewLogger(types.Logging{Level: "error"}))
+	db.offline = c.Bool("offline")
+	if err := db.EnsureConfig(); err != nil {
+		return err
+	}
+
+	report := bootstrapReport{Config: filepath.Join(rootFolder, chifra.FileName), Assets: db.assets}
+	if c.Bool("json") {
+		enc := json.NewEncoder(c.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	out := c.App.Writer
+	fmt.Fprintf(out, "chifra config  %s\n\n", report.Config)
+	fmt.Fprintf(out, "%-12s %-12s %-8s %s\n", "chain", "asset", "source", "from")
+	for _, a := range report.Assets {
+		from := a.From
+		if a.Source == bootstrap.SourceMissing {
+			from = colors.Yellow + "not found; chifra will assume an archive node" + colors.Off
+			if a.Error != "" {
+				from += " (" + a.Error + ")"
+			}
+		}
+		fmt.Fprintf(out, "%-12s %-12s %-8s %s\n", a.Chain, a.Name, a.Source, from)
+	}
+	return nil
+}
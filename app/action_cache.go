@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/cache"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/urfave/cli/v2"
+)
+
+// cacheStatsAction handles the cache stats command. A running daemon answers
+// from its latest measurement (or measures again with --refresh); otherwise
+// the cache is measured here.
+func (k *KhedraApp) cacheStatsAction(c *cli.Context) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var res client.CacheStats
+	if cl, err := client.Discover(); err == nil {
+		if res, err = cl.CacheStats(ctx, c.Bool("refresh")); err != nil {
+			var apiErr *client.Error
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 {
+				return err
+			}
+			if res, err = cl.CacheStats(ctx, true); err != nil {
+				return err
+			}
+		}
+	} else if errors.Is(err, client.ErrNotRunning) {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if res.Stats, err = cache.Scan(ctx, cfg.CachePath()); err != nil {
+			return err
+		}
+		res.Policy = cache.PolicyFrom(cfg.Cache)
+	} else {
+		return err
+	}
+
+	if c.Bool("json") {
+		return writeJSON(c.App.Writer, res)
+	}
+	printCacheStats(c.App.Writer, res)
+	return nil
+}
+
+// cachePruneAction handles the cache prune command: it brings the cache
+// within the limits in config.yaml now, in the daemon if one is running.
+func (k *KhedraApp) cachePruneAction(c *cli.Context) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	dryRun := c.Bool("dry-run")
+
+	var res cache.Result
+	if cl, err := client.Discover(); err == nil {
+		if res, err = cl.CachePrune(ctx, dryRun); err != nil {
+			return err
+		}
+	} else if errors.Is(err, client.ErrNotRunning) {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if res, err = cache.Prune(ctx, cfg.CachePath(), cache.PolicyFrom(cfg.Cache), cache.PruneOptions{DryRun: dryRun}); err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+
+	if c.Bool("json") {
+		return writeJSON(c.App.Writer, res)
+	}
+	printPruneResult(c.App.Writer, res)
+	return nil
+}
+
+func writeJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printCacheStats(out io.Writer, res client.CacheStats) {
+	s := res.Stats
+	fmt.Fprintf(out, "%s: %s in %d files (measured %s)\n", s.Path, sizeString(s.Total.Bytes), s.Total.Files, s.Scanned.Local().Format("2006-01-02 15:04"))
+	for _, ch := range s.Chains {
+		fmt.Fprintf(out, "  %-12s %10s %8d files", ch.Chain, sizeString(ch.Bytes), ch.Files)
+		if !ch.Oldest.IsZero() {
+			fmt.Fprintf(out, "  least recent use %s", ch.Oldest.Local().Format("2006-01-02"))
+		}
+		fmt.Fprintln(out)
+		kinds := make([]string, 0, len(ch.Kinds))
+		for kind := range ch.Kinds {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(out, "    %-10s %10s %8d files\n", kind, sizeString(ch.Kinds[kind].Bytes), ch.Kinds[kind].Files)
+		}
+	}
+	fmt.Fprintf(out, "Limits: %s\n", policyString(res.Policy))
+	if p := res.LastPrune; p != nil {
+		fmt.Fprintf(out, "Last prune: %s, removed %d files (%s)\n", p.Finished.Local().Format("2006-01-02 15:04"), p.Removed.Files, sizeString(p.Removed.Bytes))
+	}
+}
+
+func printPruneResult(out io.Writer, res cache.Result) {
+	if !res.Policy.Limited() {
+		fmt.Fprintln(out, "No cache limits are set (see the cache section of config.yaml); nothing was removed.")
+		return
+	}
+	verb := "Removed"
+	if res.DryRun {
+		verb = "Would remove"
+	}
+	fmt.Fprintf(out, "Limits: %s\n", policyString(res.Policy))
+	fmt.Fprintf(out, "%s %d of %d files, %s of %s.\n", verb, res.Removed.Files, res.Before.Files, sizeString(res.Removed.Bytes), sizeString(res.Before.Bytes))
+	for _, reason := range []string{cache.ReasonAge, cache.ReasonChain, cache.ReasonSize} {
+		if t, ok := res.Reasons[reason]; ok {
+			fmt.Fprintf(out, "  %-6s %8d files %10s\n", reason, t.Files, sizeString(t.Bytes))
+		}
+	}
+	if res.Errors > 0 {
+		fmt.Fprintf(out, "%d files could not be removed.\n", res.Errors)
+	}
+}
+
+func policyString(p cache.Policy) string {
+	if !p.Limited() {
+		return "none"
+	}
+	var parts []string
+	if p.MaxSize > 0 {
+		parts = append(parts, sizeString(p.MaxSize)+" in total")
+	}
+	if p.MaxChainSize > 0 {
+		parts = append(parts, sizeString(p.MaxChainSize)+" per chain")
+	}
+	if p.MaxAge > 0 {
+		parts = append(parts, fmt.Sprintf("unused for %d days", int(p.MaxAge.Hours()/24)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sizeString shows n bytes in the largest unit that keeps it at least 1,
+// counting in 1024s as the cache limits in config.yaml do.
+func sizeString(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	v, i := float64(n), 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
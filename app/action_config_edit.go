@@ -6,6 +6,7 @@ import (
 	"os/exec"
 
 	coreFile "github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 	"github.com/urfave/cli/v2"
 )
@@ -26,6 +27,7 @@ func (k *KhedraApp) configEditAction(c *cli.Context) error {
 		return nil
 	}
 	configPath := types.GetConfigFn()
+	_, _, _ = install.RecordGeneration(install.SourceManual, "") // keep the file as it was before this edit
 	cmd := exec.Command(editor, configPath)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -33,5 +35,8 @@ func (k *KhedraApp) configEditAction(c *cli.Context) error {
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to open config for editing: %w", err)
 	}
+	if _, _, err := install.RecordGeneration(install.SourceCLI, "config edit"); err != nil {
+		return fmt.Errorf("config saved but not added to its history: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	coreFile "github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/urfave/cli/v2"
+)
+
+// configHistoryAction handles the config history command
+func (k *KhedraApp) configHistoryAction(c *cli.Context) error {
+	gens, err := install.Generations()
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		for _, g := range gens {
+			if err := enc.Encode(g); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(gens) == 0 {
+		fmt.Println("No config generations recorded yet.")
+		return nil
+	}
+
+	current := ""
+	if data, err := os.ReadFile(types.GetConfigFnNoCreate()); err == nil {
+		sum := sha256.Sum256(data)
+		current = hex.EncodeToString(sum[:])
+	}
+	for _, g := range gens {
+		fmt.Println(formatGeneration(g, g.Hash == current))
+	}
+	return nil
+}
+
+// formatGeneration renders a generation as one line: id, time, source, short
+// hash and note.
+func formatGeneration(g install.Generation, current bool) string {
+	line := fmt.Sprintf("%4d  %s  %-6s %s", g.ID, g.Time.Local().Format("2006-01-02 15:04:05"), g.Source, g.Hash[:min(12, len(g.Hash))])
+	if g.Note != "" {
+		line += "  " + g.Note
+	}
+	if current {
+		line += "  (current)"
+	}
+	return line
+}
+
+// configDiffAction handles the config diff command
+func (k *KhedraApp) configDiffAction(c *cli.Context) error {
+	gen, err := generationArg(c)
+	if err != nil {
+		return err
+	}
+	diff, err := install.DiffGeneration(gen)
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		fmt.Printf("Generation %d is the same as the current config.\n", gen)
+		return nil
+	}
+	fmt.Print(diff)
+	return nil
+}
+
+// configRollbackAction handles the config rollback command
+func (k *KhedraApp) configRollbackAction(c *cli.Context) error {
+	gen, err := generationArg(c)
+	if err != nil {
+		return err
+	}
+	if !coreFile.FileExists(types.GetConfigFnNoCreate()) {
+		return fmt.Errorf("not initialized you must run `khedra init` first")
+	}
+	g, err := install.Rollback(gen, install.SourceCLI, checkConfig)
+	if err != nil {
+		return err
+	}
+	if _, err := LoadConfig(); err != nil {
+		return fmt.Errorf("config rolled back to generation %d (now generation %d) but it does not load: %w", gen, g.ID, err)
+	}
+	fmt.Printf("Config rolled back to generation %d (now generation %d).\n", gen, g.ID)
+	return nil
+}
+
+// generationArg reads the generation number given to config diff or rollback.
+func generationArg(c *cli.Context) (int, error) {
+	if c.NArg() != 1 {
+		return 0, fmt.Errorf("a generation number is required (see 'khedra config history')")
+	}
+	gen, err := strconv.Atoi(c.Args().First())
+	if err != nil || gen <= 0 {
+		return 0, fmt.Errorf("invalid generation '%s'", c.Args().First())
+	}
+	return gen, nil
+}
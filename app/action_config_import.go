@@ -0,0 +1,100 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/colors"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/urfave/cli/v2"
+)
+
+// importChifraResult is what config import-chifra prints with --json.
+type importChifraResult struct {
+	install.ChifraImport
+	Draft   string               `json:"draft"`
+	Applied bool                 `json:"applied"`
+	Errors  []install.FieldError `json:"errors,omitempty"`
+}
+
+// configImportChifraAction handles the config import-chifra command. It
+// merges chifra's trueBlocks.toml into the draft (started from the current
+// config when there is no draft), validates it, and with --apply writes it.
+func (k *KhedraApp) configImportChifraAction(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return fmt.Errorf("at most one path to a trueBlocks.toml is allowed")
+	}
+	path := c.Args().First()
+	if path == "" {
+		path = install.DefaultChifraConfig()
+	}
+
+	d, _ := install.LoadDraft()
+	if d == nil {
+		d = install.NewDraftFromConfig("import-chifra")
+	}
+	rep, err := install.ImportChifra(path, d)
+	if err != nil {
+		return err
+	}
+	if err := install.SaveDraftAtomic(d); err != nil {
+		return fmt.Errorf("cannot save the draft: %w", err)
+	}
+
+	res := importChifraResult{ChifraImport: rep, Draft: install.DraftFilePath()}
+	res.Errors = install.ValidateDraftPhase(d, "final")
+	if c.Bool("apply") && len(res.Errors) == 0 {
+		if err := install.ApplyDraft(install.SourceCLI); err != nil {
+			return err
+		}
+		res.Applied = true
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(c.App.Writer)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	} else {
+		printImportChifra(c, res)
+	}
+	if len(res.Errors) > 0 && c.Bool("apply") {
+		return cli.Exit("", exitSetupFailed)
+	}
+	return nil
+}
+
+// printImportChifra reports the import for people.
+func printImportChifra(c *cli.Context, res importChifraResult) {
+	out := c.App.Writer
+	fmt.Fprintf(out, "Imported %s\n", res.Path)
+	if res.DataFolder != "" {
+		fmt.Fprintf(out, "  data folder  %s\n", res.DataFolder)
+	}
+	for _, name := range res.Chains {
+		fmt.Fprintf(out, "  chain        %s\n", name)
+	}
+
+	if len(res.Unmapped) > 0 {
+		fmt.Fprintf(out, "\n%sNot imported:%s\n", colors.Yellow, colors.Off)
+		for _, u := range res.Unmapped {
+			fmt.Fprintf(out, "  %s = %s\n      %s\n", u.Key, u.Value, u.Reason)
+		}
+	}
+
+	fmt.Fprintln(out)
+	switch {
+	case res.Applied:
+		fmt.Fprintf(out, "%sConfiguration written to %s.%s\n", colors.Green, types.GetConfigFnNoCreate(), colors.Off)
+	case len(res.Errors) > 0:
+		fmt.Fprintf(out, "%sThe draft is not complete:%s\n", colors.Red, colors.Off)
+		for _, fe := range res.Errors {
+			fmt.Fprintf(out, "  %s\n", fe.Message)
+		}
+		fmt.Fprintf(out, "Saved to %s. Run 'khedra init' to finish it.\n", res.Draft)
+	default:
+		fmt.Fprintf(out, "Saved to %s. Run again with --apply, or 'khedra init' to review it.\n", res.Draft)
+	}
+}
@@ -1,18 +1,13 @@
 package app
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/config"
-	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
@@ -25,11 +20,12 @@ func (k *KhedraApp) daemonAction(c *cli.Context) error {
 		_ = os.Remove(control.Path())
 	}()
 
-	_ = c // linter
 	// Ensure logger is initialized for first-run case
 	if k.logger == nil {
 		k.logger = types.NewLogger(types.Logging{Level: "info"})
 	}
+	// Record every RPC request in the metrics, from the first one on
+	k.installTransport()
 
 	// On first run, start control service immediately for wizard access
 	if !install.Configured() {
@@ -38,7 +34,11 @@ func (k *KhedraApp) daemonAction(c *cli.Context) error {
 		}
 		if os.Getenv("KHEDRA_EMBED") != "1" {
 			fmt.Printf("Khedra is not configured. Please complete setup in your browser: http://localhost:%d\n", k.controlSvc.Port())
-			utils.System("open http://localhost:" + fmt.Sprintf("%d", k.controlSvc.Port()))
+			if isHeadless() {
+				fmt.Println("No browser here? Run 'khedra init --answers answers.yaml' (or 'khedra init --rpc URL') instead.")
+			} else {
+				utils.System("open http://localhost:" + fmt.Sprintf("%d", k.controlSvc.Port()))
+			}
 		}
 		// Let daemon continue to blocking loop - live-reload will handle config changes
 	}
@@ -79,9 +79,9 @@ func (k *KhedraApp) daemonAction(c *cli.Context) error {
 	os.Setenv("TB_SETTINGS_INDEXPATH", k.config.IndexPath())
 	os.Setenv("TB_SETTINGS_CACHEPATH", k.config.CachePath())
 	for key, ch := range k.config.Chains {
-		if ch.Enabled {
+		if rpcs := ch.HttpRPCs(); ch.Enabled && len(rpcs) > 0 {
 			envKey := "TB_CHAINS_" + strings.ToUpper(key) + "_RPCPROVIDER"
-			os.Setenv(envKey, ch.RPCs[0])
+			os.Setenv(envKey, rpcs[0])
 		}
 	}
 
@@ -100,15 +100,29 @@ func (k *KhedraApp) daemonAction(c *cli.Context) error {
 
 	// Initialize daemon bootstrapper
 	bootstrapper := NewDaemonBootstrapper(k.config, rootFolder, k.logger)
+	bootstrapper.prune = c.Bool("prune-chunks")
 
-	// Ensure config is created or validated
+	// Bring chifra's trueBlocks.toml in line with the config
 	if err := bootstrapper.EnsureConfig(); err != nil {
 		return err
-	} // Initialize the control service -- we need it for daemon
+	}
+	// Match each chain's index to general.strategy and general.detail
+	if err := bootstrapper.ApplyIndexPlans(); err != nil {
+		return err
+	}
+	// Keep the services' requests to each RPC within its budget; the checks
+	// above are not counted so a chain out of quota does not stop the daemon
+	k.startBudgets()
+	k.installTransport()
+	// Pause chains whose RPCs serve another chain; scraping waits for the check
+	k.startChainGuard()
+	// Initialize the control service -- we need it for daemon
 	_ = k.initializeControlSvc()
 	if err := k.serviceManager.StartAllServices(); err != nil {
 		k.logger.Panic("%s", err.Error())
 	}
+	// Measure the cache and keep it within its configured limits
+	k.startCachePruner()
 
 	// Delegate signal handling & graceful cleanup to the ServiceManager implementation.
 	k.serviceManager.HandleSignals()
@@ -116,29 +130,6 @@ func (k *KhedraApp) daemonAction(c *cli.Context) error {
 	select {} // block until ServiceManager handles signal and exits process
 }
 
-var configTmpl string = `[version]
-  current = "{{.Version}}"
-
-[settings]
-  cachePath = "{{.CachePath}}"
-  defaultChain = "mainnet"
-  indexPath = "{{.IndexPath}}"
-
-[keys]
-  [keys.etherscan]
-    apiKey = ""
-
-[chains]
-{{- range .Chains}}
-  [chains.{{.Name}}]
-    chain = "{{.Name}}"
-    chainId = "{{.ChainID}}"
-    remoteExplorer = "{{.RemoteExplorer}}"
-    rpcProvider = "{{ index .RPCs 0 }}"
-    symbol = "{{.Symbol}}"
-{{end -}}
-`
-
 /*
 
 // HandleWatch starts the monitor watcher
@@ -521,67 +512,3 @@ func (opts *MonitorsOptions) getMonitorList() []monitor.Monitor {
 			}
 
 */
-
-// TODO: Search for this function in trueblocks-core/src/apps/pkg/utils. It's identical to here.
-// TODO: Make that function public and remove this one.
-func downloadAndStore(url, filename string, dur time.Duration) ([]byte, error) {
-	if file.FileExists(filename) {
-		lastModDate, err := file.GetModTime(filename)
-		if err != nil {
-			return nil, err
-		}
-		if time.Since(lastModDate) < dur {
-			data, err := os.ReadFile(filename)
-			if err != nil {
-				return nil, err
-			}
-			return data, nil
-		}
-	}
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusNotFound {
-		// If the file doesn't exist remotely, store an empty file
-		if err := os.WriteFile(filename, []byte{}, 0o644); err != nil {
-			return nil, err
-		}
-		// Optionally update its mod time
-		_ = file.Touch(filename)
-		return []byte{}, nil
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received status %d %s for URL %s",
-			resp.StatusCode, resp.Status, url)
-	}
-
-	rawData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var prettyData []byte
-	if json.Valid(rawData) {
-		var jsonData interface{}
-		if err := json.Unmarshal(rawData, &jsonData); err != nil {
-			return nil, err
-		}
-		prettyData, err = json.MarshalIndent(jsonData, "", "  ")
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		prettyData = rawData
-	}
-
-	if err := os.WriteFile(filename, prettyData, 0o644); err != nil {
-		return nil, err
-	}
-
-	_ = file.Touch(filename)
-
-	return prettyData, nil
-}
@@ -1,15 +1,24 @@
 package app
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/bootstrap"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/budget"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chifra"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 )
 
@@ -98,143 +107,265 @@ func mockBootstrapper(rootFolder string) *DaemonBootstrapper {
 // Unit Tests for Helper Methods
 // ============================================================================
 
-func TestChainsConfigured_ValidConfig(t *testing.T) {
+func TestCreateChainConfigFolder(t *testing.T) {
 	rootFolder, cleanup := setupTestEnv(t)
 	defer cleanup()
 
 	bootstrapper := mockBootstrapper(rootFolder)
 
-	// Create a valid trueBlocks.toml with chain sections
-	configFn := filepath.Join(rootFolder, "trueBlocks.toml")
-	validConfig := `
-[chains.mainnet]
-rpcProvider = "http://localhost:8545"
-
-[chains.sepolia]
-rpcProvider = "http://localhost:8546"
-`
-	err := file.StringToAsciiFile(configFn, validConfig)
-	require.NoError(t, err)
+	// Test: create folder for mainnet chain
+	err := bootstrapper.createChainConfigFolder("mainnet")
+	assert.NoError(t, err, "Should create chain config folder successfully")
 
-	// Test: should return true for valid config
-	result := bootstrapper.chainsConfigured(configFn)
-	assert.True(t, result, "Valid config should pass validation")
+	// Verify folder exists
+	chainFolder := filepath.Join(rootFolder, "config", "mainnet")
+	exists := file.FolderExists(chainFolder)
+	assert.True(t, exists, "Chain config folder should exist")
 }
 
-func TestChainsConfigured_MissingChainSection(t *testing.T) {
+func TestCreateChainConfigFolder_Mirror(t *testing.T) {
 	rootFolder, cleanup := setupTestEnv(t)
 	defer cleanup()
 
+	mirror := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(mirror, "mainnet"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(mirror, "mainnet", "allocs.csv"), []byte("address,balance\n"), 0o644))
+
 	bootstrapper := mockBootstrapper(rootFolder)
+	bootstrapper.config.General.BootstrapMirror = mirror
+	bootstrapper.offline = true
+	require.NoError(t, bootstrapper.createChainConfigFolder("mainnet"))
+	require.NoError(t, bootstrapper.createChainConfigFolder("sepolia"))
+	require.NoError(t, bootstrapper.createChainConfigFolder("gnosis"))
+
+	require.Len(t, bootstrapper.assets, 3)
+	assert.Equal(t, bootstrap.SourceMirror, bootstrapper.assets[0].Source)
+	assert.Equal(t, "address,balance\n", file.AsciiFileToString(filepath.Join(rootFolder, "config", "mainnet", "allocs.csv")))
+	assert.Equal(t, bootstrap.SourceBundled, bootstrapper.assets[1].Source, "Offline with no mirror copy should use the bundled copy")
+	assert.Equal(t, bootstrap.SourceMissing, bootstrapper.assets[2].Source, "Offline with no mirror or bundled copy should not download")
+}
 
-	// Create config missing mainnet section
-	configFn := filepath.Join(rootFolder, "trueBlocks.toml")
-	invalidConfig := `
-[chains.sepolia]
-rpcProvider = "http://localhost:8546"
-`
-	err := file.StringToAsciiFile(configFn, invalidConfig)
-	require.NoError(t, err)
+func TestCreateChainConfigFolder_InvalidPath(t *testing.T) {
+	bootstrapper := mockBootstrapper("/dev/null/invalid")
 
-	// Test: should return false when chain section missing
-	result := bootstrapper.chainsConfigured(configFn)
-	assert.False(t, result, "Config missing enabled chain section should fail")
+	// Test: try to create folder in invalid location
+	err := bootstrapper.createChainConfigFolder("mainnet")
+	assert.Error(t, err, "Should fail to create folder in invalid location")
 }
 
-func TestChainsConfigured_EmptyFile(t *testing.T) {
+func TestEnsureConfig_Creates(t *testing.T) {
 	rootFolder, cleanup := setupTestEnv(t)
 	defer cleanup()
 
 	bootstrapper := mockBootstrapper(rootFolder)
+	require.NoError(t, bootstrapper.EnsureConfig())
 
-	// Create empty config file
 	configFn := filepath.Join(rootFolder, "trueBlocks.toml")
-	err := file.StringToAsciiFile(configFn, "")
+	cfg, err := chifra.Load(configFn)
 	require.NoError(t, err)
 
-	// Test: should return false for empty config
-	result := bootstrapper.chainsConfigured(configFn)
-	assert.False(t, result, "Empty config should fail validation")
+	// Both enabled and disabled chains appear in the config
+	v, _ := cfg.Get("chains", "mainnet", "rpcProvider")
+	assert.Equal(t, "http://localhost:8545", v)
+	v, _ = cfg.Get("chains", "sepolia", "chainId")
+	assert.Equal(t, "11155111", v)
+	v, _ = cfg.Get("settings", "indexPath")
+	assert.Equal(t, "/tmp/khedra-test/data/unchained", v)
+	_, ok := cfg.Get("keys")
+	assert.False(t, ok, "No API keys should be written")
+	assert.False(t, file.FileExists(configFn+".bak"), "A new file has nothing to back up")
+
+	// Chain config folders exist only for ENABLED chains
+	assert.True(t, file.FolderExists(filepath.Join(rootFolder, "config", "mainnet")))
+	assert.False(t, file.FolderExists(filepath.Join(rootFolder, "config", "sepolia")))
 }
 
-func TestCreateChainConfigFolder(t *testing.T) {
+func TestEnsureConfig_KeepsUserSettings(t *testing.T) {
 	rootFolder, cleanup := setupTestEnv(t)
 	defer cleanup()
 
-	bootstrapper := mockBootstrapper(rootFolder)
+	configFn := filepath.Join(rootFolder, "trueBlocks.toml")
+	original := `# my keys
+[keys.etherscan]
+  apiKey = "abc123"
 
-	// Test: create folder for mainnet chain
-	err := bootstrapper.createChainConfigFolder("mainnet")
-	assert.NoError(t, err, "Should create chain config folder successfully")
+[settings]
+  defaultChain = "sepolia"
 
-	// Verify folder exists
-	chainFolder := filepath.Join(rootFolder, "config", "mainnet")
-	exists := file.FolderExists(chainFolder)
-	assert.True(t, exists, "Chain config folder should exist")
-}
+[pinning]
+  gatewayUrl = "https://example.com/ipfs"
 
-func TestCreateChainConfigFolder_InvalidPath(t *testing.T) {
-	bootstrapper := mockBootstrapper("/dev/null/invalid")
+[chains.mainnet]
+  rpcProvider = "http://old:8545"
+  rpcProviders = ["http://old:8545", "http://older:8545"]
+  symbol = "WEI"
 
-	// Test: try to create folder in invalid location
-	err := bootstrapper.createChainConfigFolder("mainnet")
-	assert.Error(t, err, "Should fail to create folder in invalid location")
+[chains.mainnet.scrape]
+  appsPerChunk = 2000000
+
+[chains.custom]
+  chainId = "31337"
+  rpcProvider = "http://localhost:9545"
+`
+	require.NoError(t, file.StringToAsciiFile(configFn, original))
+
+	bootstrapper := mockBootstrapper(rootFolder)
+	synced := bootstrapper.syncChifraConfig(mustParse(t, original))
+	changes := synced.Diff(mustParse(t, original))
+	keys := []string{}
+	for _, c := range changes {
+		keys = append(keys, c.Key)
+	}
+	assert.Contains(t, keys, "chains.mainnet.rpcProvider")
+	assert.Contains(t, keys, "chains.sepolia.chainId")
+	assert.NotContains(t, keys, "keys.etherscan.apiKey")
+	assert.NotContains(t, keys, "chains.mainnet.symbol")
+
+	require.NoError(t, bootstrapper.EnsureConfig())
+	cfg, err := chifra.Load(configFn)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		path []string
+		want any
+	}{
+		{[]string{"keys", "etherscan", "apiKey"}, "abc123"},
+		{[]string{"pinning", "gatewayUrl"}, "https://example.com/ipfs"},
+		{[]string{"chains", "mainnet", "symbol"}, "WEI"},
+		{[]string{"chains", "mainnet", "scrape", "appsPerChunk"}, int64(2000000)},
+		{[]string{"chains", "mainnet", "rpcProvider"}, "http://localhost:8545"},
+		{[]string{"chains", "mainnet", "rpcProviders"}, []any{"http://localhost:8545"}},
+		{[]string{"chains", "custom", "rpcProvider"}, "http://localhost:9545"},
+		{[]string{"chains", "sepolia", "rpcProvider"}, "http://localhost:8546"},
+		{[]string{"settings", "defaultChain"}, "sepolia"},
+	} {
+		v, ok := cfg.Get(tt.path...)
+		assert.True(t, ok, strings.Join(tt.path, "."))
+		assert.Equal(t, tt.want, v, strings.Join(tt.path, "."))
+	}
+	assert.True(t, strings.HasPrefix(file.AsciiFileToString(configFn), "# my keys\n"), "Comments should be kept")
+	assert.Equal(t, original, file.AsciiFileToString(configFn+".bak"), "The previous file should be kept")
 }
 
-func TestCreateChifraConfig(t *testing.T) {
+func TestEnsureConfig_Unchanged(t *testing.T) {
 	rootFolder, cleanup := setupTestEnv(t)
 	defer cleanup()
 
 	bootstrapper := mockBootstrapper(rootFolder)
-
-	// Test: create chifra config from template
-	err := bootstrapper.createChifraConfig()
-	assert.NoError(t, err, "Should create chifra config successfully")
-
-	// Verify config file exists
+	require.NoError(t, bootstrapper.EnsureConfig())
 	configFn := filepath.Join(rootFolder, "trueBlocks.toml")
-	exists := file.FileExists(configFn)
-	assert.True(t, exists, "Config file should exist")
+	first := file.AsciiFileToString(configFn)
 
-	// Verify config contains chain sections (both enabled and disabled chains appear in config)
-	contents := file.AsciiFileToString(configFn)
-	assert.Contains(t, contents, "[chains.mainnet]", "Config should contain mainnet section")
-	assert.Contains(t, contents, "[chains.sepolia]", "Config should contain sepolia section (disabled chains still appear in config)")
+	require.NoError(t, bootstrapper.EnsureConfig())
+	assert.Equal(t, first, file.AsciiFileToString(configFn))
+	assert.False(t, file.FileExists(configFn+".bak"), "An up to date file should not be rewritten")
+}
+
+func TestEnsureConfig_InvalidFile(t *testing.T) {
+	rootFolder, cleanup := setupTestEnv(t)
+	defer cleanup()
 
-	// Verify chain config folders exist only for ENABLED chains
-	mainnetFolder := filepath.Join(rootFolder, "config", "mainnet")
-	assert.True(t, file.FolderExists(mainnetFolder), "Mainnet config folder should exist")
+	configFn := filepath.Join(rootFolder, "trueBlocks.toml")
+	require.NoError(t, file.StringToAsciiFile(configFn, "[chains\n"))
 
-	sepoliaFolder := filepath.Join(rootFolder, "config", "sepolia")
-	assert.False(t, file.FolderExists(sepoliaFolder), "Sepolia config folder should NOT exist (disabled chain)")
+	bootstrapper := mockBootstrapper(rootFolder)
+	assert.Error(t, bootstrapper.EnsureConfig(), "An unreadable file should not be replaced")
+	assert.Equal(t, "[chains\n", file.AsciiFileToString(configFn))
 }
 
-func TestCreateChifraConfig_EmptyConfig(t *testing.T) {
+func TestApplyIndexPlans(t *testing.T) {
 	rootFolder, cleanup := setupTestEnv(t)
 	defer cleanup()
 
-	// Create config with NO enabled chains
-	cfg := &types.Config{
-		Chains: map[string]types.Chain{
-			"mainnet": {
-				Name:    "mainnet",
-				RPCs:    []string{"http://localhost:8545"},
-				ChainID: 1,
-				Enabled: false, // Disabled
-			},
-		},
-	}
-	logger := types.NewLogger(types.Logging{Level: "error"})
-	bootstrapper := NewDaemonBootstrapper(cfg, rootFolder, logger)
-
-	// Test: should handle empty enabled chains list
-	err := bootstrapper.createChifraConfig()
-	// This might succeed with empty template - verify behavior
-	if err == nil {
-		configFn := filepath.Join(rootFolder, "trueBlocks.toml")
-		exists := file.FileExists(configFn)
-		assert.True(t, exists, "Config file should exist even with no enabled chains")
+	bootstrapper := mockBootstrapper(rootFolder)
+	bootstrapper.config.General.DataFolder = filepath.Join(rootFolder, "data")
+	indexPath := bootstrapper.config.IndexPath()
+	for _, fn := range []string{"blooms/000000000-000000099.bloom", "finalized/000000000-000000099.bin"} {
+		fn = filepath.Join(indexPath, "mainnet", fn)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0o755))
+		require.NoError(t, file.StringToAsciiFile(fn, "x"))
 	}
+
+	require.NoError(t, bootstrapper.ApplyIndexPlans())
+	mode, ok := index.ReadMode(indexPath, "mainnet")
+	require.True(t, ok, "The mode should be recorded on the first start")
+	assert.Equal(t, "index", mode.Detail)
+	_, ok = index.ReadMode(indexPath, "sepolia")
+	assert.False(t, ok, "Disabled chains should be left alone")
+
+	bootstrapper.config.General.Detail = "bloom"
+	require.NoError(t, bootstrapper.ApplyIndexPlans())
+	inv := index.Scan(indexPath, "mainnet")
+	assert.Equal(t, 1, inv.Chunks, "Chunks should be kept without --prune-chunks")
+	mode, _ = index.ReadMode(indexPath, "mainnet")
+	assert.Equal(t, "index", mode.Detail, "The change should stay pending until the chunks are removed")
+
+	bootstrapper.prune = true
+	require.NoError(t, bootstrapper.ApplyIndexPlans())
+	inv = index.Scan(indexPath, "mainnet")
+	assert.Equal(t, 0, inv.Chunks, "Chunks with blooms should be removed when switching to bloom")
+	assert.Equal(t, 1, inv.Blooms)
+	mode, _ = index.ReadMode(indexPath, "mainnet")
+	assert.Equal(t, "bloom", mode.Detail)
+}
+
+func TestScraperInitModes(t *testing.T) {
+	cfg := types.NewConfig()
+	cfg.General.Strategy, cfg.General.Detail = "download", "bloom"
+	cfg.Chains["polygon"] = types.Chain{Name: "polygon", ChainID: 137, RPCs: []string{"http://localhost:8547"}, Enabled: true}
+	sf := NewServiceFactory(&cfg, types.NewLogger(types.Logging{Level: "error"}), nil)
+	s := sf.createScraperService(cfg.Services["scraper"])
+
+	assert.Equal(t, index.InitBlooms, s.initMode("mainnet"))
+	assert.Equal(t, index.InitNone, s.initMode("polygon"), "A chain with no published index should be built from the RPC")
+}
+
+func TestStartChainGuard(t *testing.T) {
+	// A Sepolia endpoint configured for mainnet, which answers once released
+	release := make(chan struct{})
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xaa36a7"}`))
+	}))
+	t.Cleanup(node.Close)
+	cfg := types.NewConfig()
+	ch := cfg.Chains["mainnet"]
+	ch.RPCs = []string{node.URL}
+	cfg.Chains["mainnet"] = ch
+	k := &KhedraApp{config: &cfg, logger: types.NewLogger(types.Logging{Level: "error"}), chainPauses: control.NewChainPauses()}
+
+	k.startChainGuard()
+	cause, _, paused := k.chainPauses.Paused("mainnet")
+	assert.True(t, paused, "Chains should wait for the check without holding up the daemon")
+	assert.Equal(t, control.CauseCheck, cause)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		cause, _, _ := k.chainPauses.Paused("mainnet")
+		return cause == control.CauseQuarantine
+	}, 5*time.Second, 10*time.Millisecond, "A chain whose RPC serves another chain should stay paused")
+}
+
+func TestInstallTransport(t *testing.T) {
+	defer func(rt http.RoundTripper) { http.DefaultTransport = rt }(http.DefaultTransport)
+	base := rpcBase()
+	b, _ := budget.New(base, filepath.Join(t.TempDir(), "rpc-usage.json"), nil)
+	k := &KhedraApp{}
+
+	k.installTransport()
+	assert.Equal(t, metrics.Transport{Base: base}, http.DefaultTransport, "Requests should be recorded before the budgets start")
+
+	k.budgets = b
+	k.installTransport()
+	k.installTransport()
+	assert.Same(t, b, http.DefaultTransport, "Installing again should replace the chain, not wrap it")
+	assert.Same(t, base, rpcBase(), "The chain should always be built over the original transport")
+}
+
+func mustParse(t *testing.T, data string) *chifra.Config {
+	cfg, err := chifra.Parse([]byte(data))
+	require.NoError(t, err)
+	return cfg
 }
 
 // ============================================================================
@@ -273,82 +404,3 @@ func TestDaemonEnvironmentSetup(t *testing.T) {
 	os.Unsetenv("TB_SETTINGS_CACHEPATH")
 	os.Unsetenv("TB_CHAINS_MAINNET_RPCPROVIDER")
 }
-
-func TestDaemonChifraConfigCreation(t *testing.T) {
-	rootFolder, cleanup := setupTestEnv(t)
-	defer cleanup()
-
-	bootstrapper := mockBootstrapper(rootFolder)
-
-	// Phase 1: Config doesn't exist
-	configFn := filepath.Join(rootFolder, "trueBlocks.toml")
-	assert.False(t, file.FileExists(configFn), "Config should not exist initially")
-
-	// Phase 2: Create config
-	err := bootstrapper.createChifraConfig()
-	assert.NoError(t, err, "Config creation should succeed")
-	assert.True(t, file.FileExists(configFn), "Config should exist after creation")
-
-	// Phase 3: Validate created config
-	result := bootstrapper.chainsConfigured(configFn)
-	assert.True(t, result, "Created config should pass validation")
-}
-
-func TestDaemonChifraConfigValidation(t *testing.T) {
-	rootFolder, cleanup := setupTestEnv(t)
-	defer cleanup()
-
-	bootstrapper := mockBootstrapper(rootFolder)
-
-	configFn := filepath.Join(rootFolder, "trueBlocks.toml")
-
-	tests := []struct {
-		name     string
-		content  string
-		expected bool
-	}{
-		{
-			name: "Valid config with all enabled chains",
-			content: `
-[chains.mainnet]
-rpcProvider = "http://localhost:8545"
-`,
-			expected: true,
-		},
-		{
-			name: "Invalid config missing enabled chain section",
-			content: `
-[settings]
-defaultChain = "mainnet"
-# Config is incomplete - no chain configurations
-`,
-			expected: false,
-		},
-		{
-			name: "Config with chain section for enabled chain",
-			content: `
-[chains.mainnet]
-rpcProvider = "http://localhost:8545"
-
-[chains.sepolia]
-rpcProvider = "http://localhost:8546"
-`,
-			expected: true,
-		},
-		{
-			name:     "Empty config",
-			content:  "",
-			expected: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := file.StringToAsciiFile(configFn, tt.content)
-			require.NoError(t, err)
-
-			result := bootstrapper.chainsConfigured(configFn)
-			assert.Equal(t, tt.expected, result, tt.name)
-		})
-	}
-}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/datamove"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/urfave/cli/v2"
+)
+
+// dataMoveAction handles the data move command. The trees are moved here; a
+// running daemon has its services paused for the move and reloads its config
+// once the new folder is in place.
+func (k *KhedraApp) dataMoveAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("the new data folder is required")
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	plan, err := datamove.NewPlan(cfg.General.DataFolder, c.Args().First())
+	if err != nil {
+		return err
+	}
+	out := c.App.Writer
+	if c.Bool("json") {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(plan); err != nil {
+			return err
+		}
+	} else {
+		printMovePlan(out, plan, c.Bool("copy"))
+	}
+	if c.Bool("dry-run") {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cl, err := client.Discover()
+	switch {
+	case errors.Is(err, client.ErrNotRunning):
+		cl = nil
+	case err != nil:
+		return err
+	default:
+		resume, err := pauseServices(ctx, cl, "data move", out)
+		defer resume()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Services paused.")
+	}
+
+	logger := k.logger
+	if logger == nil {
+		logger = types.NewLogger(cfg.Logging)
+	}
+	opts := datamove.Options{Copy: c.Bool("copy"), Progress: moveProgress(out)}
+	if err := datamove.Move(ctx, plan, opts); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("the move was interrupted; run the same command again to resume it")
+		}
+		return fmt.Errorf("the move failed, khedra still uses %s: %w", plan.From, err)
+	}
+	if err := switchDataFolder(plan.To, logger); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "khedra now uses %s.\n", plan.To)
+	if cl != nil {
+		if _, err := cl.ConfigReload(ctx); err != nil {
+			return fmt.Errorf("the daemon could not reload its config, restart it: %w", err)
+		}
+	}
+
+	if c.Bool("keep-source") {
+		fmt.Fprintf(out, "The old copy is still in %s.\n", plan.From)
+		return nil
+	}
+	return datamove.RemoveSource(plan, opts)
+}
+
+// pauseLease is how long the pauses set by pauseServices last unless renewed,
+// so the daemon resumes by itself if the command dies mid-way.
+const pauseLease = 2 * time.Minute
+
+// pauseServices pauses the daemon's running services for reason and returns
+// a func that resumes them. The pauses expire after pauseLease and are
+// renewed until then; services paused beforehand are left as they are.
+func pauseServices(ctx context.Context, cl *client.Client, reason string, out io.Writer) (func(), error) {
+	before, err := cl.Status(ctx, "")
+	if err != nil {
+		return func() {}, err
+	}
+	var running []string
+	for _, svc := range before {
+		if svc.Status == "running" {
+			running = append(running, svc.Name)
+		}
+	}
+	pause := func(ctx context.Context) error {
+		for _, name := range running {
+			if _, err := cl.Pause(ctx, client.PauseRequest{Name: name, Reason: reason, For: pauseLease}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	resume := func() {
+		close(done)
+		wg.Wait()
+		for _, name := range running {
+			if _, err := cl.Unpause(context.Background(), name); err != nil {
+				fmt.Fprintf(out, "Could not unpause %s: %v. Run `khedra unpause %s`; otherwise it resumes by itself within %s.\n", name, err, name, pauseLease)
+			}
+		}
+	}
+	if err := pause(ctx); err != nil {
+		return resume, err
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(pauseLease / 4)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				_ = pause(context.Background())
+			}
+		}
+	}()
+	return resume, nil
+}
+
+func printMovePlan(out io.Writer, plan datamove.Plan, forceCopy bool) {
+	how := "copied (checksummed) and then removed from the old folder"
+	if plan.Rename && !forceCopy {
+		how = "renamed (same filesystem)"
+	}
+	fmt.Fprintf(out, "Moving %s to %s: %d files, %.1f GB will be %s.\n", plan.From, plan.To, plan.Files, float64(plan.Bytes)/1e9, how)
+	for _, t := range plan.Trees {
+		fmt.Fprintf(out, "  %-10s %d files, %.1f GB\n", t.Name, t.Files, float64(t.Bytes)/1e9)
+	}
+	if plan.Resume > 0 {
+		fmt.Fprintf(out, "Resuming an earlier move: %d files are already copied.\n", plan.Resume)
+	}
+}
+
+// moveProgress prints a line for each tree renamed or removed and at every
+// twentieth of a copy.
+func moveProgress(out io.Writer) func(datamove.Progress) {
+	last := -1
+	return func(p datamove.Progress) {
+		if p.Phase != "copy" {
+			fmt.Fprintf(out, "  %s %s\n", p.Phase, p.File)
+			return
+		}
+		pct := 100
+		if p.TotalBytes > 0 {
+			pct = int(p.Bytes * 100 / p.TotalBytes)
+		}
+		if pct/5 != last {
+			last = pct / 5
+			fmt.Fprintf(out, "  copied %d of %d files (%d%%)\n", p.Files, p.TotalFiles, pct)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/colors"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/urfave/cli/v2"
+)
+
+// exitIndexProblems is the exit status of index verify when problems remain.
+const exitIndexProblems = 3
+
+// indexVerifyAction handles the index verify command. With a daemon running
+// the check runs there in the background and this follows it (or, with
+// --background, only starts it); otherwise it runs here.
+func (k *KhedraApp) indexVerifyAction(c *cli.Context) error {
+	req := client.IndexVerifyRequest{
+		Chains:  c.StringSlice("chain"),
+		Repair:  c.Bool("repair"),
+		Quick:   c.Bool("quick"),
+		Offline: c.Bool("offline"),
+		Gateway: c.String("gateway"),
+	}
+	out := c.App.Writer
+	printEvent := func(e client.IndexEvent) {
+		if !c.Bool("json") {
+			fmt.Fprintf(out, "%s %-10s %s\n", e.Time.Local().Format("15:04:05"), e.Chain, e.Message)
+		}
+	}
+
+	var job client.IndexJob
+	if cl, err := client.Discover(); err == nil {
+		ctx := context.Background()
+		if job, err = cl.IndexVerify(ctx, req); err != nil {
+			return err
+		}
+		if c.Bool("background") {
+			fmt.Fprintf(out, "Started job %d in the daemon. Follow it with 'khedra index status'.\n", job.ID)
+			return nil
+		}
+		if job, err = followIndexJob(ctx, cl, job, printEvent); err != nil {
+			return err
+		}
+	} else if errors.Is(err, client.ErrNotRunning) {
+		if c.Bool("background") {
+			return client.ErrNotRunning
+		}
+		cfg, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		run, err := newIndexVerifyRun(&cfg, 1, req)
+		if err != nil {
+			return err
+		}
+		run.onEvent = printEvent
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		run.run(ctx, &cfg)
+		job = run.snapshot()
+	} else {
+		return err
+	}
+	return finishIndexJob(c, job)
+}
+
+// indexStatusAction handles the index status command: it shows the daemon's
+// running or last check of the index, following it with --follow.
+func (k *KhedraApp) indexStatusAction(c *cli.Context) error {
+	cl, err := client.Discover()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	job, err := cl.IndexJob(ctx)
+	if err != nil {
+		return err
+	}
+	if c.Bool("follow") {
+		show := func(e client.IndexEvent) {
+			if !c.Bool("json") {
+				fmt.Fprintf(c.App.Writer, "%s %-10s %s\n", e.Time.Local().Format("15:04:05"), e.Chain, e.Message)
+			}
+		}
+		if job, err = followIndexJob(ctx, cl, client.IndexJob{ID: job.ID}, show); err != nil {
+			return err
+		}
+	}
+	if job.State == client.JobRunning && !c.Bool("json") {
+		for _, p := range job.Progress {
+			fmt.Fprintf(c.App.Writer, "%-10s %s: %d of %d files\n", p.Chain, p.Phase, p.Done, p.Total)
+		}
+		return nil
+	}
+	return finishIndexJob(c, job)
+}
+
+// indexCancelAction handles the index cancel command.
+func (k *KhedraApp) indexCancelAction(c *cli.Context) error {
+	cl, err := client.Discover()
+	if err != nil {
+		return err
+	}
+	job, err := cl.IndexCancel(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Canceling job %d.\n", job.ID)
+	return nil
+}
+
+// followIndexJob polls the daemon's job, passing each event newer than the
+// ones in job to show, until the job is no longer running.
+func followIndexJob(ctx context.Context, cl *client.Client, job client.IndexJob, show func(client.IndexEvent)) (client.IndexJob, error) {
+	seen := 0
+	for {
+		for _, e := range job.Events {
+			if e.Seq > seen {
+				show(e)
+				seen = e.Seq
+			}
+		}
+		if job.State != "" && job.State != client.JobRunning {
+			return job, nil
+		}
+		time.Sleep(time.Second)
+		next, err := cl.IndexJob(ctx)
+		if err != nil {
+			return job, err
+		}
+		if job.ID != 0 && next.ID != job.ID {
+			return job, fmt.Errorf("job %d was replaced by job %d", job.ID, next.ID)
+		}
+		job = next
+	}
+}
+
+// finishIndexJob prints the result of a finished job and sets the exit status:
+// exitIndexProblems if any problem was found and not fixed.
+func finishIndexJob(c *cli.Context, job client.IndexJob) error {
+	if c.Bool("json") {
+		enc := json.NewEncoder(c.App.Writer)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(job); err != nil {
+			return err
+		}
+	} else {
+		printIndexJob(c.App.Writer, job)
+	}
+	switch {
+	case job.State == client.JobFailed:
+		return fmt.Errorf("index verify failed: %s", job.Error)
+	case job.State == client.JobCanceled:
+		return cli.Exit("index verify was canceled", 1)
+	case unresolvedProblems(job) > 0:
+		return cli.Exit("", exitIndexProblems)
+	}
+	return nil
+}
+
+// unresolvedProblems counts the problems found that a repair did not fix.
+func unresolvedProblems(job client.IndexJob) int {
+	n := 0
+	for _, rep := range job.Reports {
+		n += len(rep.Problems)
+	}
+	for _, res := range job.Repairs {
+		for _, f := range res.Fixes {
+			if f.Kind != index.ProblemRebuild && (f.Action == "fetched" || f.Action == "quarantined" && f.Hash == "") {
+				n--
+			}
+		}
+	}
+	return max(n, 0)
+}
+
+func printIndexJob(out io.Writer, job client.IndexJob) {
+	fmt.Fprintln(out)
+	for _, rep := range job.Reports {
+		status := colors.Green + "ok" + colors.Off
+		if !rep.OK() {
+			status = colors.Yellow + problemSummary(rep.Problems) + colors.Off
+		}
+		fmt.Fprintf(out, "%-10s %d published files checked, %d local: %s\n", rep.Chain, rep.Checked, rep.Local, status)
+		for _, p := range rep.Problems {
+			fmt.Fprintf(out, "  %-8s %s", p.Kind, p.File)
+			if p.Detail != "" {
+				fmt.Fprintf(out, " (%s)", p.Detail)
+			}
+			fmt.Fprintln(out)
+		}
+	}
+	for _, res := range job.Repairs {
+		if res.Quarantine != "" {
+			fmt.Fprintf(out, "%-10s bad files moved to %s\n", res.Chain, res.Quarantine)
+		}
+	}
+	if job.Repair || unresolvedProblems(job) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "\nRun again with --repair to quarantine bad files and fetch them again.")
+}
@@ -0,0 +1,218 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+	"github.com/urfave/cli/v2"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// exitSetupFailed is the exit status of a headless init that did not write a config.
+const exitSetupFailed = 2
+
+// initAction handles the init command. It sets khedra up without the browser
+// wizard: answers come from the --answers file, then the environment, then the
+// command line, on top of the existing config (or the defaults). The result of
+// every wizard step is printed as JSON. Run from a terminal with none of those
+// flags, it asks the wizard's questions interactively instead.
+func (k *KhedraApp) initAction(c *cli.Context) error {
+	if err := validateFlagArgs(); err != nil {
+		return err
+	}
+
+	if !hasInitFlags(c) && isTerminal(os.Stdin) {
+		w := newTerminalWizard(os.Stdin, c.App.Writer, install.ProbeRpc)
+		w.capabilities = install.ProbeCapabilities
+		w.measure = install.MeasureChains
+		w.preflight = install.DiskPreflight
+		return w.run()
+	}
+
+	d := install.NewDraftFromConfig("headless")
+	if err := k.readInitAnswers(c, &d.Config); err != nil {
+		// Bad input is reported in the same shape as a failed step
+		return writeInitReport(c, install.Report{Phases: []install.PhaseResult{{
+			Phase:  "answers",
+			Errors: []install.FieldError{{Code: "invalid_answers", Message: err.Error()}},
+		}}})
+	}
+
+	return writeInitReport(c, install.Headless(d, install.ProbeRpc))
+}
+
+// hasInitFlags reports whether any of the headless init flags was given.
+func hasInitFlags(c *cli.Context) bool {
+	for _, name := range []string{"answers", "data-folder", "strategy", "detail", "rpc", "services"} {
+		if c.IsSet(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// readInitAnswers applies the answers file, the environment and the flags to cfg.
+func (k *KhedraApp) readInitAnswers(c *cli.Context, cfg *types.Config) error {
+	if fn := c.String("answers"); fn != "" {
+		if err := loadAnswers(cfg, fn); err != nil {
+			return err
+		}
+	}
+	if err := types.ApplyEnv(types.GetEnvironmentKeys(*cfg, types.InEnv), cfg); err != nil {
+		return err
+	}
+	return applyInitFlags(c, cfg)
+}
+
+// writeInitReport prints report as JSON and sets the exit status if it failed.
+func writeInitReport(c *cli.Context, report install.Report) error {
+	enc := json.NewEncoder(c.App.Writer)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	if !report.OK {
+		return cli.Exit("", exitSetupFailed)
+	}
+	return nil
+}
+
+// loadAnswers overlays an answers file, written like config.yaml, onto cfg.
+// Chains and services named in the file keep the settings the file leaves out.
+func loadAnswers(cfg *types.Config, fn string) error {
+	ko := koanf.New(".")
+	if err := ko.Load(file.Provider(fn), yaml.Parser()); err != nil {
+		return fmt.Errorf("failed to load answers file %s: %w", fn, err)
+	}
+
+	for _, section := range []struct {
+		path string
+		out  any
+	}{
+		{"general", &cfg.General},
+		{"logging", &cfg.Logging},
+	} {
+		if ko.Exists(section.path) {
+			if err := ko.Unmarshal(section.path, section.out); err != nil {
+				return fmt.Errorf("invalid %s section in %s: %w", section.path, fn, err)
+			}
+		}
+	}
+
+	if cfg.Chains == nil {
+		cfg.Chains = map[string]types.Chain{}
+	}
+	for _, name := range ko.MapKeys("chains") {
+		ch, ok := cfg.Chains[name]
+		if !ok {
+			ch = types.Chain{Name: name, Enabled: true}
+		}
+		if ko.Exists("chains." + name + ".rpcs") {
+			ch.RPCs = nil // replace the list rather than overwrite its first entries
+		}
+		if err := ko.Unmarshal("chains."+name, &ch); err != nil {
+			return fmt.Errorf("invalid chain %s in %s: %w", name, fn, err)
+		}
+		ch.Name = name
+		cfg.Chains[name] = ch
+	}
+
+	if cfg.Services == nil {
+		cfg.Services = map[string]types.Service{}
+	}
+	for _, name := range ko.MapKeys("services") {
+		svc, ok := cfg.Services[name]
+		if !ok {
+			svc = types.NewService(name)
+		}
+		if err := ko.Unmarshal("services."+name, &svc); err != nil {
+			return fmt.Errorf("invalid service %s in %s: %w", name, fn, err)
+		}
+		svc.Name = name
+		cfg.Services[name] = svc
+	}
+	return nil
+}
+
+// parseRPCFlag splits an --rpc value into a chain and a URL. The value is
+// chain=URL only if the text before the first = is a bare name; otherwise it
+// is a URL (whose query string may hold an =) for mainnet.
+func parseRPCFlag(v string) (name, url string, err error) {
+	name, url = "mainnet", v
+	if before, after, ok := strings.Cut(v, "="); ok && !strings.ContainsAny(before, "/?") && !strings.Contains(before, "://") {
+		name, url = strings.TrimSpace(before), after
+	}
+	url = strings.TrimSpace(url)
+	if name == "" || url == "" {
+		return "", "", fmt.Errorf("invalid --rpc %q: use a URL for mainnet or chain=URL", v)
+	}
+	return name, url, nil
+}
+
+// applyInitFlags applies the init command's flags, which win over the answers
+// file and the environment.
+func applyInitFlags(c *cli.Context, cfg *types.Config) error {
+	if v := c.String("data-folder"); v != "" {
+		cfg.General.DataFolder = v
+	}
+	if v := c.String("strategy"); v != "" {
+		cfg.General.Strategy = v
+	}
+	if v := c.String("detail"); v != "" {
+		cfg.General.Detail = v
+	}
+
+	for _, v := range c.StringSlice("rpc") {
+		name, url, err := parseRPCFlag(v)
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.Chains[name]; !ok {
+			name = chains.Normalize(name)
+		}
+		ch, ok := cfg.Chains[name]
+		if !ok {
+			ch = types.Chain{Name: name}
+			if info, ok := chains.ByName(name); ok {
+				ch.ChainID = info.ChainID
+			}
+		}
+		ch.RPCs = []string{url}
+		ch.Enabled = true
+		cfg.Chains[name] = ch
+	}
+
+	if c.IsSet("services") {
+		enabled := map[string]bool{}
+		for _, name := range c.StringSlice("services") {
+			name = strings.TrimSpace(name)
+			if _, ok := cfg.Services[name]; !ok {
+				return fmt.Errorf("invalid service name '%s'. Valid services are: scraper, monitor, api, ipfs", name)
+			}
+			enabled[name] = true
+		}
+		for name, svc := range cfg.Services {
+			svc.Enabled = enabled[name]
+			cfg.Services[name] = svc
+		}
+	}
+	return nil
+}
+
+// isHeadless reports whether the daemon should skip opening a browser for the
+// setup wizard: KHEDRA_HEADLESS is set, or (on Linux) there is no display.
+func isHeadless() bool {
+	if v := os.Getenv("KHEDRA_HEADLESS"); v != "" {
+		return v != "0" && v != "false"
+	}
+	return runtime.GOOS == "linux" && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+}
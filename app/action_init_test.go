@@ -0,0 +1,75 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func TestLoadAnswers(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "answers.yaml")
+	answers := `general:
+  dataFolder: /srv/khedra
+  strategy: scratch
+chains:
+  mainnet:
+    rpcs:
+      - https://eth.example.com
+  gnosis:
+    rpcs:
+      - https://gnosis.example.com
+    chainId: 100
+services:
+  api:
+    enabled: false
+logging:
+  level: debug
+`
+	require.NoError(t, os.WriteFile(fn, []byte(answers), 0644))
+
+	cfg := types.NewConfig()
+	cfg.Chains["mainnet"] = types.Chain{Name: "mainnet", RPCs: []string{"http://a", "http://b"}, ChainID: 1, Enabled: true}
+	require.NoError(t, loadAnswers(&cfg, fn))
+
+	assert.Equal(t, "/srv/khedra", cfg.General.DataFolder)
+	assert.Equal(t, "scratch", cfg.General.Strategy)
+	assert.Equal(t, "index", cfg.General.Detail, "settings left out keep their value")
+	assert.Equal(t, []string{"https://eth.example.com"}, cfg.Chains["mainnet"].RPCs)
+	assert.Equal(t, 1, cfg.Chains["mainnet"].ChainID)
+	assert.Equal(t, types.Chain{Name: "gnosis", RPCs: []string{"https://gnosis.example.com"}, ChainID: 100, Enabled: true}, cfg.Chains["gnosis"])
+	assert.False(t, cfg.Services["api"].Enabled)
+	assert.Equal(t, 8080, cfg.Services["api"].Port)
+	assert.Equal(t, "debug", cfg.Logging.Level)
+	assert.Equal(t, "khedra.log", cfg.Logging.Filename)
+
+	assert.Error(t, loadAnswers(&cfg, filepath.Join(t.TempDir(), "missing.yaml")))
+}
+
+func TestParseRPCFlag(t *testing.T) {
+	tests := []struct {
+		value, name, url string
+	}{
+		{"https://eth.example.com", "mainnet", "https://eth.example.com"},
+		{"gnosis=https://gnosis.example.com", "gnosis", "https://gnosis.example.com"},
+		{" sepolia = http://localhost:8545 ", "sepolia", "http://localhost:8545"},
+		{"https://eth.example.com/v3?key=abc", "mainnet", "https://eth.example.com/v3?key=abc"},
+		{"gnosis=https://gnosis.example.com?key=a=b", "gnosis", "https://gnosis.example.com?key=a=b"},
+		{"localhost:8545?key=abc", "mainnet", "localhost:8545?key=abc"},
+	}
+	for _, tt := range tests {
+		name, url, err := parseRPCFlag(tt.value)
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, tt.name, name, tt.value)
+		assert.Equal(t, tt.url, url, tt.value)
+	}
+
+	for _, bad := range []string{"", "=https://eth.example.com", "gnosis="} {
+		_, _, err := parseRPCFlag(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/urfave/cli/v2"
+)
+
+// logLevelAction handles the log-level command
+func (k *KhedraApp) logLevelAction(c *cli.Context) error {
+	component := strings.ToLower(c.String("component"))
+	if component != "" && !types.IsValidComponent(component) {
+		return fmt.Errorf("invalid component '%s'. Valid components are: %s", component, strings.Join(types.Components, ", "))
+	}
+
+	var req client.LogLevelRequest
+	if c.NArg() > 0 {
+		level := strings.ToLower(c.Args().First())
+		if !types.IsValidLevel(level) && !(component != "" && level == "default") {
+			return fmt.Errorf("invalid level '%s'. Valid levels are: debug, info, warn, error", level)
+		}
+		req = client.LogLevelRequest{Component: component, Level: level, For: c.Duration("for")}
+	} else if c.IsSet("for") || component != "" {
+		return fmt.Errorf("a level is required when using --component or --for")
+	}
+
+	// Find the running khedra control service
+	cl, err := client.Discover()
+	if err != nil {
+		return err
+	}
+
+	var resp client.LogLevels
+	if req.Level != "" {
+		resp, err = cl.SetLogLevel(context.Background(), req)
+	} else {
+		resp, err = cl.LogLevels(context.Background())
+	}
+	if err != nil {
+		return err
+	}
+	for _, lvl := range resp.Levels {
+		name := lvl.Component
+		if name == "" {
+			name = "global"
+		}
+		line := fmt.Sprintf("%-10s %s", name, lvl.Level)
+		if !lvl.Expires.IsZero() {
+			line += fmt.Sprintf(" (reverts at %s)", lvl.Expires.Local().Format(time.TimeOnly))
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevelFromRequest(t *testing.T) {
+	t.Run("Global with expiry", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/log-level?level=DEBUG&for=10m", nil)
+		component, level, d, err := logLevelFromRequest(r)
+		require.NoError(t, err)
+		assert.Equal(t, "", component)
+		assert.Equal(t, "debug", level)
+		assert.Equal(t, 10*time.Minute, d)
+	})
+
+	t.Run("Component default clears", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/log-level?level=default&component=rpc", nil)
+		component, level, _, err := logLevelFromRequest(r)
+		require.NoError(t, err)
+		assert.Equal(t, "rpc", component)
+		assert.Equal(t, "", level)
+	})
+
+	for _, bad := range []string{"", "level=debug&for=soon", "level=debug&for=-1m"} {
+		t.Run("Rejects "+bad, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/log-level?"+bad, nil)
+			_, _, _, err := logLevelFromRequest(r)
+			assert.Error(t, err)
+		})
+	}
+}
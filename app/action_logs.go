@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/logs"
+	"github.com/urfave/cli/v2"
+)
+
+// logsAction handles the logs command
+func (k *KhedraApp) logsAction(c *cli.Context) error {
+	level := c.String("level")
+	if !logs.ValidLevel(level) {
+		return fmt.Errorf("invalid level '%s'. Valid levels are: debug, info, warn, error", level)
+	}
+	since := c.String("since")
+	if _, err := logs.ParseSince(since, time.Now()); err != nil {
+		return err
+	}
+
+	// Find the running khedra control service
+	cl, err := client.Discover()
+	if err != nil {
+		return err
+	}
+
+	req := client.LogsRequest{
+		Since: since,
+		Level: level,
+		Grep:  c.String("grep"),
+		Limit: c.Int("limit"),
+	}
+	page, err := cl.Logs(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	out := c.App.Writer
+	for _, ln := range page.Lines {
+		fmt.Fprintln(out, ln.Text)
+	}
+
+	if !c.Bool("follow") {
+		return nil
+	}
+
+	// Follow: poll for lines at or after the newest one seen, skipping repeats that share its timestamp
+	var last time.Time
+	seen := map[string]bool{}
+	remember := func(lines []logs.Line) {
+		for _, ln := range lines {
+			if ln.Time.After(last) {
+				last = ln.Time
+				seen = map[string]bool{}
+			}
+			if ln.Time.Equal(last) {
+				seen[ln.Text] = true
+			}
+		}
+	}
+	remember(page.Lines)
+	if last.IsZero() {
+		last = time.Now()
+	}
+
+	req.Limit = followLimit
+	for {
+		time.Sleep(2 * time.Second)
+		req.Since = last.Format(time.RFC3339Nano)
+		lines, err := logsSince(context.Background(), cl, req)
+		if err != nil {
+			return err
+		}
+		for _, ln := range lines {
+			if ln.Time.Equal(last) && seen[ln.Text] {
+				continue
+			}
+			fmt.Fprintln(out, ln.Text)
+		}
+		remember(lines)
+	}
+}
+
+// followLimit is the largest page the server returns.
+const followLimit = 5000
+
+// logsSince returns every line req matches, oldest first, following the
+// pages' cursors back to req.Since when more lines arrived than fit a page.
+func logsSince(ctx context.Context, cl *client.Client, req client.LogsRequest) ([]logs.Line, error) {
+	var pages [][]logs.Line
+	for {
+		page, err := cl.Logs(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page.Lines)
+		if !page.More || page.Next == "" {
+			break
+		}
+		req.Until = page.Next
+	}
+	var lines []logs.Line
+	for i := len(pages) - 1; i >= 0; i-- {
+		lines = append(lines, pages[i]...)
+	}
+	return lines, nil
+}
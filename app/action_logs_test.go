@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+)
+
+func TestLogQueryFromRequest(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	t.Run("Defaults", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/logs", nil)
+		q, err := logQueryFromRequest(r, now)
+		require.NoError(t, err)
+		assert.Equal(t, 200, q.Limit)
+		assert.True(t, q.Since.IsZero())
+	})
+
+	t.Run("All parameters", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/logs?since=1h&level=WARN&grep=rpc&limit=10", nil)
+		q, err := logQueryFromRequest(r, now)
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(-time.Hour), q.Since)
+		assert.Equal(t, "warn", q.Level)
+		assert.Equal(t, "rpc", q.Grep)
+		assert.Equal(t, 10, q.Limit)
+	})
+
+	t.Run("Limit is capped", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/logs?limit=999999", nil)
+		q, err := logQueryFromRequest(r, now)
+		require.NoError(t, err)
+		assert.Equal(t, 5000, q.Limit)
+	})
+
+	for _, bad := range []string{"level=loud", "since=yesterday", "limit=-1", "limit=abc"} {
+		t.Run("Rejects "+bad, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/logs?"+bad, nil)
+			_, err := logQueryFromRequest(r, now)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLogsSince(t *testing.T) {
+	cl, k := newContractClient(t)
+
+	// Seven lines after the first, two of them sharing a second, read two at a time
+	var b strings.Builder
+	var want []string
+	for i, sec := range []int{6, 7, 7, 8, 9, 10, 11} {
+		ln := fmt.Sprintf("time=2025-01-02T03:04:%02dZ level=INFO msg=\"line %d\"", sec, i)
+		b.WriteString(ln + "\n")
+		want = append(want, ln)
+	}
+	fn := filepath.Join(k.config.Logging.Folder, k.config.Logging.Filename)
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(b.String())
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	lines, err := logsSince(context.Background(), cl, client.LogsRequest{Since: "2025-01-02T03:04:06Z", Limit: 2})
+	require.NoError(t, err)
+	got := make([]string, 0, len(lines))
+	for _, ln := range lines {
+		got = append(got, ln.Text)
+	}
+	assert.Equal(t, want, got, "every page is read, oldest first")
+}
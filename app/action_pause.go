@@ -1,16 +1,12 @@
 package app
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"strings"
-	"time"
 
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/colors"
-	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
 	"github.com/urfave/cli/v2"
 )
 
@@ -26,7 +22,7 @@ func (k *KhedraApp) pauseAction(c *cli.Context) error {
 	}
 
 	// Find the running khedra control service
-	controlURL, err := findControlServiceURL()
+	cl, err := client.Discover()
 	if err != nil {
 		return err
 	}
@@ -34,7 +30,7 @@ func (k *KhedraApp) pauseAction(c *cli.Context) error {
 	// Handle "all" service - now supported directly by the API
 	if serviceName == "all" {
 		fmt.Printf("Pausing all pausable services...\n")
-		result, err := callControlEndpoint(controlURL, "pause", "all")
+		result, err := cl.Pause(context.Background(), pauseRequest(c, "all"))
 		if err != nil {
 			return fmt.Errorf("failed to pause all services: %w", err)
 		}
@@ -44,7 +40,7 @@ func (k *KhedraApp) pauseAction(c *cli.Context) error {
 
 	// Call the pause endpoint for single service
 	fmt.Printf("Pausing service '%s'...\n", serviceName)
-	result, err := callControlEndpoint(controlURL, "pause", serviceName)
+	result, err := cl.Pause(context.Background(), pauseRequest(c, serviceName))
 	if err != nil {
 		return fmt.Errorf("failed to pause service: %w", err)
 	}
@@ -66,7 +62,7 @@ func (k *KhedraApp) unpauseAction(c *cli.Context) error {
 	}
 
 	// Find the running khedra control service
-	controlURL, err := findControlServiceURL()
+	cl, err := client.Discover()
 	if err != nil {
 		return err
 	}
@@ -74,7 +70,7 @@ func (k *KhedraApp) unpauseAction(c *cli.Context) error {
 	// Handle "all" service - now supported directly by the API
 	if serviceName == "all" {
 		fmt.Printf("Unpausing all pausable services...\n")
-		result, err := callControlEndpoint(controlURL, "unpause", "all")
+		result, err := cl.Unpause(context.Background(), "all")
 		if err != nil {
 			return fmt.Errorf("failed to unpause all services: %w", err)
 		}
@@ -84,7 +80,7 @@ func (k *KhedraApp) unpauseAction(c *cli.Context) error {
 
 	// Call the unpause endpoint for single service
 	fmt.Printf("Unpausing service '%s'...\n", serviceName)
-	result, err := callControlEndpoint(controlURL, "unpause", serviceName)
+	result, err := cl.Unpause(context.Background(), serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to unpause service: %w", err)
 	}
@@ -94,60 +90,9 @@ func (k *KhedraApp) unpauseAction(c *cli.Context) error {
 	return nil
 }
 
-// findControlServiceURL finds the URL of the running control service
-func findControlServiceURL() (string, error) {
-	ports := []string{"8338", "8337", "8336", "8335"}
-	for _, port := range ports {
-		url := "http://localhost:" + port
-		if utils.PingServer(url) {
-			return url, nil
-		}
-	}
-	return "", fmt.Errorf("khedra daemon is not running. Start it with 'khedra daemon'")
-}
-
-// callControlEndpoint makes an HTTP request to the control service
-func callControlEndpoint(baseURL, endpoint, serviceName string) ([]map[string]string, error) {
-	// Build the URL with service name parameter
-	u, err := url.Parse(baseURL + "/" + endpoint)
-	if err != nil {
-		return nil, err
-	}
-
-	query := u.Query()
-	query.Set("name", serviceName)
-	u.RawQuery = query.Encode()
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	// Make the request
-	resp, err := client.Get(u.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to control service: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Read the response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("control service returned error: %s (status %d)", string(body), resp.StatusCode)
-	}
-
-	// Parse the JSON response
-	var result []map[string]string
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return result, nil
+// pauseRequest builds a pause request for name from the --reason and --for flags
+func pauseRequest(c *cli.Context, name string) client.PauseRequest {
+	return client.PauseRequest{Name: name, Reason: c.String("reason"), For: c.Duration("for")}
 }
 
 // isValidServiceName checks if the given service name is valid and pausable
@@ -167,15 +112,15 @@ func getValidServiceNames() string {
 }
 
 // displayServiceControlResult displays the result of a pause/unpause operation
-func displayServiceControlResult(action string, results []map[string]string) {
+func displayServiceControlResult(action string, results []client.ServiceResult) {
 	if len(results) == 0 {
 		fmt.Printf("No results returned for %s operation\n", action)
 		return
 	}
 
 	for _, result := range results {
-		name := result["name"]
-		status := result["status"]
+		name := result.Name
+		status := result.Status
 
 		// Color code the status
 		var coloredStatus string
@@ -3,11 +3,18 @@ package app
 import (
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"sync"
 
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/colors"
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/logger"
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/audit"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/budget"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chainguard"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 	"github.com/TrueBlocks/trueblocks-sdk/v6/services"
 	"github.com/urfave/cli/v2"
@@ -16,9 +23,20 @@ import (
 type KhedraApp struct {
 	cli            *cli.App
 	config         *types.Config
+	configMu       sync.RWMutex // guards config once the daemon's goroutines run
 	logger         *types.CustomLogger
 	controlSvc     *services.ControlService
 	serviceManager *services.ServiceManager
+	routes         *http.ServeMux // khedra's control routes, also registered with controlSvc
+	pauses         *control.RuntimeState
+	expiries       pauseExpiries
+	auditLog       *audit.Log
+	session        *install.SessionStore // the install wizard's session
+	indexVerifier  indexVerifier         // the running or last check of the index
+	cachePruner    cachePruner           // the latest measurement of the cache
+	budgets        *budget.Budgets       // the RPC budgets, in front of http.DefaultTransport
+	chainGuard     *chainguard.Guard     // quarantines chains whose RPCs serve another chain
+	chainPauses    *control.ChainPauses  // chains the scraper leaves alone for now
 }
 
 // RestartAllServices restarts all services except the control service directly via service manager.
@@ -40,6 +58,9 @@ func (k *KhedraApp) RestartAllServices() error {
 		serviceName := result["name"]
 		status := result["status"]
 		k.logger.Info("Service restart result", "service", serviceName, "status", status)
+		if status == "restarted" {
+			serviceRestarts.Inc(serviceName)
+		}
 	}
 
 	k.logger.Info("All restartable services restarted successfully")
@@ -47,7 +68,7 @@ func (k *KhedraApp) RestartAllServices() error {
 }
 
 func NewKhedraApp() *KhedraApp {
-	k := KhedraApp{}
+	k := KhedraApp{chainPauses: control.NewChainPauses()}
 	if k.isRunning() {
 		logger.Panic(colors.BrightBlue + "khedra is already running - cannot run..." + colors.Off)
 	}
@@ -69,6 +90,19 @@ func (k *KhedraApp) isRunning() bool {
 		"--version": true,
 		"pause":     true,
 		"unpause":   true,
+		"logs":      true,
+		"log-level": true,
+		"audit":     true,
+		"index":     true,
+		"data":      true,
+		"cache":     true,
+		"backup":    true,
+	}
+
+	readOnlyConfigCmds := map[string]bool{
+		"show":    true,
+		"history": true,
+		"diff":    true,
 	}
 
 	if len(os.Args) < 2 || len(os.Args) == 2 && os.Args[1] == "config" {
@@ -78,7 +112,7 @@ func (k *KhedraApp) isRunning() bool {
 	for i, arg := range os.Args {
 		if okArgs[arg] {
 			return false
-		} else if arg == "config" && i < len(os.Args)-1 && os.Args[i+1] == "show" {
+		} else if arg == "config" && i < len(os.Args)-1 && readOnlyConfigCmds[os.Args[i+1]] {
 			return false
 		}
 	}
@@ -157,3 +157,27 @@ func extractCmdsAndFlags() (map[string]bool, map[string]bool) {
 	validCommands["help"] = true
 	return validCommands, validFlags
 }
+
+// validateFlagArgs checks the arguments of a command that takes only flags,
+// each with a value (as --flag value or --flag=value). Returns an error for
+// an unknown flag or any argument that is not a flag's value.
+func validateFlagArgs() error {
+	_, validFlags := extractCmdsAndFlags()
+	if len(os.Args) < 3 {
+		return nil
+	}
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(args[i], "=")
+		if !strings.HasPrefix(name, "-") {
+			return fmt.Errorf("unexpected argument '%s'", args[i])
+		}
+		if !validFlags[name] {
+			return fmt.Errorf("flag '%s' not found", name)
+		}
+		if !hasValue {
+			i++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/audit"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/logs"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// maxAuditBody is how much of a response audited keeps to find its error.
+const maxAuditBody = 4096
+
+// auditRecorder remembers the status and the start of the body written by a handler.
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *auditRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *auditRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if room := maxAuditBody - r.body.Len(); room > 0 {
+		r.body.Write(b[:min(room, len(b))])
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// audited records each request to h in the audit log under action. If methods
+// are given, only requests using one of them are recorded.
+func (k *KhedraApp) audited(action string, h http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(methods) > 0 && !slices.Contains(methods, r.Method) {
+			h(w, r)
+			return
+		}
+		rec := &auditRecorder{ResponseWriter: w}
+		h(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		k.recordAudit(r, action, rec.status, responseError(rec.status, rec.body.Bytes()))
+	}
+}
+
+// responseError returns the error a JSON response reports: its error field, or
+// a refusal when it says ok is false. Anything below 400 without one succeeded.
+func responseError(status int, body []byte) string {
+	var resp struct {
+		Error string `json:"error"`
+		OK    *bool  `json:"ok"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	switch {
+	case resp.Error != "":
+		return resp.Error
+	case status >= http.StatusBadRequest:
+		if msg := strings.TrimSpace(string(body)); msg != "" && !strings.HasPrefix(msg, "{") {
+			return msg
+		}
+		return http.StatusText(status)
+	case resp.OK != nil && !*resp.OK:
+		return "refused"
+	}
+	return ""
+}
+
+// recordAudit writes one audit entry for r. A failure to write is logged but
+// does not affect the request.
+func (k *KhedraApp) recordAudit(r *http.Request, action string, status int, errMsg string) {
+	if k.auditLog == nil {
+		return
+	}
+	params := r.Form
+	if params == nil {
+		params = r.URL.Query()
+	}
+	redacted := audit.Redact(params)
+	delete(redacted, "session")
+	if len(redacted) == 0 {
+		redacted = nil
+	}
+
+	e := audit.Entry{
+		Time:     time.Now().UTC(),
+		Endpoint: r.URL.Path,
+		Method:   r.Method,
+		Remote:   r.RemoteAddr,
+		Session:  k.requestSession(r),
+		Action:   action,
+		Params:   redacted,
+		Outcome:  audit.OutcomeOk,
+		Status:   status,
+		Error:    errMsg,
+	}
+	if errMsg != "" {
+		e.Outcome = audit.OutcomeError
+	}
+	if err := k.auditLog.Record(e); err != nil {
+		k.logger.Component(types.ComponentControl).Warn("Could not write audit entry", "action", action, "error", err)
+	}
+}
+
+// requestSession returns the install session a request names, falling back to
+// the session the wizard currently holds.
+func (k *KhedraApp) requestSession(r *http.Request) string {
+	if s := strings.TrimSpace(r.Header.Get("X-Khedra-Session")); s != "" {
+		return s
+	}
+	if s := strings.TrimSpace(r.FormValue("session")); s != "" {
+		return s
+	}
+	if k.session != nil {
+		id, _ := k.session.Get()
+		return id
+	}
+	return ""
+}
+
+// auditQueryFromRequest reads the since, until, action and limit query
+// parameters of an /audit request.
+func auditQueryFromRequest(r *http.Request, now time.Time) (audit.Query, error) {
+	const defaultLimit = 100
+	const maxLimit = 5000
+
+	v := r.URL.Query()
+	q := audit.Query{
+		Action: strings.TrimSpace(v.Get("action")),
+		Limit:  defaultLimit,
+	}
+	var err error
+	if q.Since, err = logs.ParseSince(v.Get("since"), now); err != nil {
+		return audit.Query{}, err
+	}
+	if q.Until, q.Skip, err = logs.ParseUntil(v.Get("until"), now); err != nil {
+		return audit.Query{}, err
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return audit.Query{}, fmt.Errorf("invalid limit %q", s)
+		}
+		q.Limit = min(n, maxLimit)
+	}
+	return q, nil
+}
+
+// handleAudit serves /audit: a filtered, paginated view of the audit log.
+func (k *KhedraApp) handleAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q, err := auditQueryFromRequest(r, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+		return
+	}
+	page, err := k.auditLog.Read(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/cache"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// cachePruneInterval is how often the daemon measures the cache and, if
+// limits are set, prunes it.
+const cachePruneInterval = time.Hour
+
+// errPruneRunning is returned when the cache is already being measured or pruned.
+var errPruneRunning = errors.New("the cache is already being pruned")
+
+// cachePruner holds the daemon's latest measurement of the cache and its last
+// prune. Only one scan or prune runs at a time.
+type cachePruner struct {
+	mu      sync.Mutex
+	stats   cache.Stats
+	last    *cache.Result
+	running bool
+}
+
+// snapshot returns the latest stats and the last prune (nil if none).
+func (p *cachePruner) snapshot() (cache.Stats, *cache.Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats, p.last
+}
+
+// exclusive runs f unless a scan or prune is already running.
+func (p *cachePruner) exclusive(f func() error) error {
+	p.mu.Lock()
+	if p.running {
+		p.mu.Unlock()
+		return errPruneRunning
+	}
+	p.running = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.running = false
+		p.mu.Unlock()
+	}()
+	return f()
+}
+
+// run prunes the cache to cfg's limits (or, with dryRun, only reports what
+// would go) and keeps what remains as the latest stats.
+func (p *cachePruner) run(ctx context.Context, cfg *types.Config, dryRun bool) (cache.Result, error) {
+	var res cache.Result
+	err := p.exclusive(func() error {
+		var err error
+		res, err = cache.Prune(ctx, cfg.CachePath(), cache.PolicyFrom(cfg.Cache), cache.PruneOptions{DryRun: dryRun})
+		if err != nil || dryRun {
+			return err
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.stats = res.After
+		if res.Policy.Limited() {
+			p.last = &res
+		}
+		return nil
+	})
+	return res, err
+}
+
+// scan measures the cache without pruning it.
+func (p *cachePruner) scan(ctx context.Context, cfg *types.Config) error {
+	return p.exclusive(func() error {
+		s, err := cache.Scan(ctx, cfg.CachePath())
+		if err != nil {
+			return err
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.stats = s
+		return nil
+	})
+}
+
+// startCachePruner measures the cache now and then prunes it every
+// cachePruneInterval, reading the limits from the config each time. A run is
+// skipped while every service is paused, as `data move` and `backup` leave
+// them while they copy or hash the cache.
+func (k *KhedraApp) startCachePruner() {
+	go func() {
+		for {
+			if k.servicesPaused() {
+				k.logger.Debug("Services are paused, not pruning the cache")
+				time.Sleep(cachePruneInterval)
+				continue
+			}
+			cfg := k.currentConfig()
+			res, err := k.cachePruner.run(context.Background(), cfg, false)
+			switch {
+			case errors.Is(err, errPruneRunning):
+			case err != nil:
+				k.logger.Warn("Cache prune failed", "path", cfg.CachePath(), "error", err)
+			case res.Removed.Files > 0:
+				k.logger.Info("Cache pruned", "files", res.Removed.Files, "bytes", res.Removed.Bytes, "remaining", res.After.Total.Bytes)
+			}
+			time.Sleep(cachePruneInterval)
+		}
+	}()
+}
+
+// servicesPaused reports whether every service that can pause is paused.
+func (k *KhedraApp) servicesPaused() bool {
+	if k.serviceManager == nil {
+		return false
+	}
+	results, err := k.serviceManager.IsPaused("all")
+	if err != nil {
+		return false
+	}
+	paused := false
+	for _, result := range results {
+		switch result["status"] {
+		case "paused":
+			paused = true
+		case "not pausable":
+		default:
+			return false
+		}
+	}
+	return paused
+}
+
+// handleCacheStats serves /cache/stats: the latest measurement of the cache
+// and the last prune, measuring it first with refresh=true.
+func (k *KhedraApp) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("refresh") == "true" {
+		if err := k.cachePruner.scan(r.Context(), k.currentConfig()); err != nil {
+			writeCacheError(w, err)
+			return
+		}
+	}
+	stats, last := k.cachePruner.snapshot()
+	if stats.Scanned.IsZero() {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: "the cache has not been measured yet; try again with refresh=true"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(client.CacheStats{Stats: stats, Policy: cache.PolicyFrom(k.currentConfig().Cache), LastPrune: last})
+}
+
+// handleCachePrune serves /cache/prune: it prunes the cache to the configured
+// limits now, or with dry_run=true reports what would be removed.
+func (k *KhedraApp) handleCachePrune(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	res, err := k.cachePruner.run(r.Context(), k.currentConfig(), r.URL.Query().Get("dry_run") == "true")
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func writeCacheError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, errPruneRunning) {
+		status = http.StatusConflict
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chainguard"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// chainCheckInterval is how often the daemon checks that each chain's RPCs
+// still serve that chain.
+const chainCheckInterval = 10 * time.Minute
+
+// chainCheckTimeout is the longest one check of every chain's RPCs may take.
+const chainCheckTimeout = time.Minute
+
+// startChainGuard checks every enabled chain's RPCs against its chain ID,
+// pausing a chain whose RPCs serve another chain. The check runs in the
+// background so the control service is not held up; the chains are paused
+// until it ends, so the scraper does not reach a wrong chain first. It then
+// checks again every chainCheckInterval; reloadConfig applies later changes.
+func (k *KhedraApp) startChainGuard() {
+	g := chainguard.New(k.logger.Component(types.ComponentRpc))
+	g.PauseChains(k.chainPauses)
+	g.Configure(k.config.Chains)
+	k.chainGuard = g
+
+	var checked []string
+	for name, ch := range k.config.Chains {
+		if ch.Enabled {
+			k.chainPauses.Pause(name, control.CauseCheck, control.Pause{Reason: "checking that its RPCs serve this chain"})
+			checked = append(checked, name)
+		}
+	}
+	go func() {
+		k.checkChains()
+		for _, name := range checked {
+			k.chainPauses.Unpause(name, control.CauseCheck)
+		}
+		g.Run(context.Background(), chainCheckInterval)
+	}()
+}
+
+// checkChains checks every enabled chain's RPCs once, giving up after
+// chainCheckTimeout.
+func (k *KhedraApp) checkChains() {
+	ctx, cancel := context.WithTimeout(context.Background(), chainCheckTimeout)
+	defer cancel()
+	k.chainGuard.Check(ctx)
+}
@@ -30,10 +30,29 @@ func initCli(k *KhedraApp) *cli.App {
 		Usage:   "A tool to index, monitor, serve, and share blockchain data",
 		Version: sdk.Version(),
 		Commands: []*cli.Command{
+			{
+				Name:         "init",
+				Usage:        "Sets up Khedra without the browser wizard (for servers and provisioning tools)",
+				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "answers", Usage: "YAML file with the settings to use, written like config.yaml"},
+					&cli.StringFlag{Name: "data-folder", Usage: "folder for the index and caches"},
+					&cli.StringFlag{Name: "strategy", Usage: "how to build the index (download, scratch)"},
+					&cli.StringFlag{Name: "detail", Usage: "how much of the index to keep (index, bloom)"},
+					&cli.StringSliceFlag{Name: "rpc", Usage: "RPC for mainnet, or chain=URL for another chain (repeatable)"},
+					&cli.StringSliceFlag{Name: "services", Usage: "enable only these services (scraper, monitor, api, ipfs)"},
+				},
+				Action: func(c *cli.Context) error {
+					return k.initAction(c)
+				},
+			},
 			{
 				Name:         "daemon",
 				Usage:        "Runs Khedra's services",
 				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "prune-chunks", Usage: "delete the index chunks that are not needed after changing detail from index to bloom"},
+				},
 				Action: func(c *cli.Context) error {
 					if err := validateArgs(1, 1); err != nil {
 						return err
@@ -79,13 +98,197 @@ func initCli(k *KhedraApp) *cli.App {
 							return k.configShowAction(c)
 						},
 					},
+					{
+						Name:         "history",
+						Usage:        "Lists the saved generations of the configuration",
+						OnUsageError: onUsageError,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "json", Usage: "print the raw JSON generations"},
+						},
+						Action: func(c *cli.Context) error {
+							return k.configHistoryAction(c)
+						},
+					},
+					{
+						Name:         "diff",
+						Usage:        "Shows the changes from a generation to the current configuration",
+						ArgsUsage:    "<generation>",
+						OnUsageError: onUsageError,
+						Action: func(c *cli.Context) error {
+							return k.configDiffAction(c)
+						},
+					},
+					{
+						Name:         "rollback",
+						Usage:        "Restores a generation as the current configuration",
+						ArgsUsage:    "<generation>",
+						OnUsageError: onUsageError,
+						Action: func(c *cli.Context) error {
+							return k.configRollbackAction(c)
+						},
+					},
+					{
+						Name:         "import-chifra",
+						Usage:        "Imports chains and paths from chifra's trueBlocks.toml into the draft",
+						ArgsUsage:    "[path]",
+						OnUsageError: onUsageError,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "apply", Usage: "write the configuration if the imported draft is valid"},
+							&cli.BoolFlag{Name: "json", Usage: "print the import report as JSON"},
+						},
+						Action: func(c *cli.Context) error {
+							return k.configImportChifraAction(c)
+						},
+					},
 				},
 				OnUsageError: onUsageError,
 			},
+			{
+				Name:         "bootstrap",
+				Usage:        "Writes chifra's config and per-chain files and reports where each came from",
+				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "offline", Usage: "never download from GitHub; use only the mirror and the bundled files"},
+					&cli.StringFlag{Name: "mirror", Usage: "folder or http(s) base URL laid out as <chain>/allocs.csv (overrides general.bootstrapMirror)"},
+					&cli.BoolFlag{Name: "json", Usage: "print the report as JSON"},
+				},
+				Action: func(c *cli.Context) error {
+					return k.bootstrapAction(c)
+				},
+			},
+			{
+				Name:  "index",
+				Usage: "Checks and repairs the Unchained Index",
+				Subcommands: []*cli.Command{
+					{
+						Name:         "verify",
+						Usage:        "Checks each chain's blooms and chunks against its manifest",
+						OnUsageError: onUsageError,
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{Name: "chain", Usage: "check only this chain (repeatable); every enabled chain by default"},
+							&cli.BoolFlag{Name: "repair", Usage: "quarantine bad and extra files, fetch published ones again and let the scraper rebuild local ones"},
+							&cli.BoolFlag{Name: "quick", Usage: "compare sizes only, without hashing"},
+							&cli.BoolFlag{Name: "offline", Usage: "with --repair, quarantine but fetch nothing; the scraper fetches missing files when it starts"},
+							&cli.StringFlag{Name: "gateway", Usage: "IPFS gateway to fetch files from"},
+							&cli.BoolFlag{Name: "background", Usage: "start the check in the running daemon and return"},
+							&cli.BoolFlag{Name: "json", Usage: "print the result as JSON"},
+						},
+						Action: func(c *cli.Context) error {
+							return k.indexVerifyAction(c)
+						},
+					},
+					{
+						Name:         "status",
+						Usage:        "Shows the daemon's running or last check of the index",
+						OnUsageError: onUsageError,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "follow", Aliases: []string{"f"}, Usage: "follow a running check until it finishes"},
+							&cli.BoolFlag{Name: "json", Usage: "print the job as JSON"},
+						},
+						Action: func(c *cli.Context) error {
+							return k.indexStatusAction(c)
+						},
+					},
+					{
+						Name:         "cancel",
+						Usage:        "Stops the daemon's running check of the index",
+						OnUsageError: onUsageError,
+						Action: func(c *cli.Context) error {
+							return k.indexCancelAction(c)
+						},
+					},
+				},
+				OnUsageError: onUsageError,
+			},
+			{
+				Name:  "cache",
+				Usage: "Reports and limits the size of chifra's cache",
+				Subcommands: []*cli.Command{
+					{
+						Name:         "stats",
+						Usage:        "Shows how much each chain holds in the cache",
+						OnUsageError: onUsageError,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "refresh", Usage: "measure the cache again instead of using the daemon's latest measurement"},
+							&cli.BoolFlag{Name: "json", Usage: "print the stats as JSON"},
+						},
+						Action: func(c *cli.Context) error {
+							return k.cacheStatsAction(c)
+						},
+					},
+					{
+						Name:         "prune",
+						Usage:        "Removes the least recently used cache files until the cache is within its limits",
+						OnUsageError: onUsageError,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "dry-run", Usage: "show what would be removed without removing it"},
+							&cli.BoolFlag{Name: "json", Usage: "print the result as JSON"},
+						},
+						Action: func(c *cli.Context) error {
+							return k.cachePruneAction(c)
+						},
+					},
+				},
+				OnUsageError: onUsageError,
+			},
+			{
+				Name:  "data",
+				Usage: "Manages the data folder holding the index and the cache",
+				Subcommands: []*cli.Command{
+					{
+						Name:         "move",
+						Usage:        "Moves the index and the cache to a new data folder and points khedra at it",
+						ArgsUsage:    "<folder>",
+						OnUsageError: onUsageError,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "keep-source", Usage: "leave the old copy in place after a copy"},
+							&cli.BoolFlag{Name: "copy", Usage: "copy even when the data could be renamed"},
+							&cli.BoolFlag{Name: "dry-run", Usage: "show what would be moved and exit"},
+							&cli.BoolFlag{Name: "json", Usage: "print the plan as JSON"},
+						},
+						Action: func(c *cli.Context) error {
+							return k.dataMoveAction(c)
+						},
+					},
+				},
+				OnUsageError: onUsageError,
+			},
+			{
+				Name:         "backup",
+				Usage:        "Writes khedra's config and state, and optionally the index and cache, to a bundle",
+				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "out", Usage: "the bundle to write (e.g. khedra.tar.zst)", Required: true},
+					&cli.BoolFlag{Name: "index", Usage: "include the Unchained Index"},
+					&cli.BoolFlag{Name: "cache", Usage: "include the whole cache (the monitors are always included)"},
+					&cli.BoolFlag{Name: "force", Usage: "replace the bundle if it exists"},
+				},
+				Action: func(c *cli.Context) error {
+					return k.backupAction(c)
+				},
+			},
+			{
+				Name:         "restore",
+				Usage:        "Checks a bundle written by khedra backup and restores it on this host",
+				ArgsUsage:    "<bundle>",
+				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "data-folder", Usage: "the data folder to use on this host (defaults to the bundle's, moved to this home folder)"},
+					&cli.BoolFlag{Name: "check", Usage: "check the bundle and exit"},
+					&cli.BoolFlag{Name: "force", Usage: "replace an existing config, index or cache"},
+				},
+				Action: func(c *cli.Context) error {
+					return k.restoreAction(c)
+				},
+			},
 			{
 				Name:         "pause",
 				Usage:        "Pause the given service (one of scraper, monitor, all)",
 				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "reason", Usage: "note shown on the dashboard while the service is paused"},
+					&cli.DurationFlag{Name: "for", Usage: "unpause automatically after this long (e.g. 2h); pauses otherwise last until unpaused"},
+				},
 				Action: func(c *cli.Context) error {
 					return k.pauseAction(c)
 				},
@@ -98,6 +301,48 @@ func initCli(k *KhedraApp) *cli.App {
 					return k.unpauseAction(c)
 				},
 			},
+			{
+				Name:         "logs",
+				Usage:        "Show recent log lines from the running daemon",
+				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "follow", Aliases: []string{"f"}, Usage: "keep polling for new lines"},
+					&cli.StringFlag{Name: "level", Usage: "minimum level to show (debug, info, warn, error)"},
+					&cli.StringFlag{Name: "since", Usage: "only lines newer than a duration (1h) or RFC3339 time"},
+					&cli.StringFlag{Name: "grep", Usage: "only lines containing this text (case-insensitive)"},
+					&cli.IntFlag{Name: "limit", Value: 50, Usage: "maximum number of lines to show"},
+				},
+				Action: func(c *cli.Context) error {
+					return k.logsAction(c)
+				},
+			},
+			{
+				Name:         "log-level",
+				Usage:        "Show or change the running daemon's log level",
+				ArgsUsage:    "[debug|info|warn|error]",
+				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "component", Usage: "change only this component (control, scraper, monitor, install, rpc); use level 'default' to clear"},
+					&cli.DurationFlag{Name: "for", Usage: "revert to the previous level after this long (e.g. 10m)"},
+				},
+				Action: func(c *cli.Context) error {
+					return k.logLevelAction(c)
+				},
+			},
+			{
+				Name:         "audit",
+				Usage:        "Show recent control actions recorded by the running daemon",
+				OnUsageError: onUsageError,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "since", Usage: "only actions newer than a duration (24h) or RFC3339 time"},
+					&cli.StringFlag{Name: "action", Usage: "only this action (pause, unpause, restart, chain_add, chain_remove, log_level, wizard_reset, config_apply, config_rollback, config_reload, index_verify, cache_prune)"},
+					&cli.IntFlag{Name: "limit", Value: 50, Usage: "maximum number of actions to show"},
+					&cli.BoolFlag{Name: "json", Usage: "print the raw JSON entries"},
+				},
+				Action: func(c *cli.Context) error {
+					return k.auditAction(c)
+				},
+			},
 		},
 		OnUsageError: onUsageError,
 		CommandNotFound: func(c *cli.Context, command string) {
@@ -111,6 +356,12 @@ func initCli(k *KhedraApp) *cli.App {
 			showError(c, true, err)
 		},
 		ExitErrHandler: func(c *cli.Context, err error) {
+			if exitErr, ok := err.(cli.ExitCoder); ok {
+				if exitErr.Error() != "" {
+					showError(c, false, err)
+				}
+				os.Exit(exitErr.ExitCode())
+			}
 			if err != nil {
 				showError(c, true, err)
 			}
@@ -3,6 +3,7 @@ package app
 import (
 	"fmt"
 
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/audit"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 )
@@ -12,6 +13,12 @@ func LoadConfig() (types.Config, error) {
 	return loader.Load()
 }
 
+// checkConfig reports whether data would load as config.yaml.
+func checkConfig(data []byte) error {
+	_, err := NewConfigLoader().LoadData(data)
+	return err
+}
+
 func (k *KhedraApp) loadConfigIfInitialized() error {
 	if !install.Configured() {
 		return fmt.Errorf("not initialized you must run `khedra init` first")
@@ -23,3 +30,41 @@ func (k *KhedraApp) loadConfigIfInitialized() error {
 
 	return nil
 }
+
+// reloadConfig loads config.yaml into the running app after it was rewritten
+// (by the wizard or a rollback), reopening the logger and audit log it names.
+// Services pick the change up on their next iteration.
+func (k *KhedraApp) reloadConfig() error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	k.configMu.Lock()
+	k.config = &cfg
+	k.configMu.Unlock()
+	if k.logger != nil {
+		k.logger = k.logger.Reload(cfg.Logging)
+	} else {
+		k.logger = types.NewLogger(cfg.Logging)
+	}
+	if k.auditLog != nil {
+		_ = k.auditLog.Close()
+	}
+	k.auditLog = audit.New(cfg.Logging.Folder, cfg.Logging.Audit)
+	if k.budgets != nil {
+		k.budgets.Configure(cfg.Chains)
+	}
+	if k.chainGuard != nil {
+		k.chainGuard.Configure(cfg.Chains)
+		go k.checkChains()
+	}
+	return nil
+}
+
+// currentConfig returns the config for goroutines that run while
+// reloadConfig may replace it.
+func (k *KhedraApp) currentConfig() *types.Config {
+	k.configMu.RLock()
+	defer k.configMu.RUnlock()
+	return k.config
+}
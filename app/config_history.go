@@ -0,0 +1,96 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+)
+
+// generationFromRequest reads the gen parameter of a /config/diff or
+// /config/rollback request.
+func generationFromRequest(r *http.Request) (int, error) {
+	s := r.FormValue("gen")
+	gen, err := strconv.Atoi(s)
+	if err != nil || gen <= 0 {
+		return 0, fmt.Errorf("invalid generation %q", s)
+	}
+	return gen, nil
+}
+
+// writeGenerationError reports err as JSON: 404 for an unknown generation,
+// 500 for anything else.
+func writeGenerationError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, install.ErrNoGeneration):
+		status = http.StatusNotFound
+	case errors.Is(err, install.ErrInvalidGeneration):
+		status = http.StatusBadRequest
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+}
+
+// handleConfigHistory serves /config/history: the kept generations of config.yaml.
+func (k *KhedraApp) handleConfigHistory(w http.ResponseWriter, r *http.Request) {
+	_ = r
+	w.Header().Set("Content-Type", "application/json")
+	gens, err := install.Generations()
+	if err != nil {
+		writeGenerationError(w, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(client.ConfigHistory{Generations: gens})
+}
+
+// handleConfigDiff serves /config/diff: the changes from a generation to the
+// current config.yaml.
+func (k *KhedraApp) handleConfigDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	gen, err := generationFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+		return
+	}
+	diff, err := install.DiffGeneration(gen)
+	if err != nil {
+		writeGenerationError(w, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(client.ConfigDiff{Generation: gen, Diff: diff})
+}
+
+// handleConfigRollback serves /config/rollback: it restores a generation as
+// config.yaml and reloads it.
+func (k *KhedraApp) handleConfigRollback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	gen, err := generationFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+		return
+	}
+	g, err := install.Rollback(gen, install.SourceAPI, checkConfig)
+	if err != nil {
+		writeGenerationError(w, err)
+		return
+	}
+	before := ""
+	if k.config != nil {
+		before = k.config.General.DataFolder
+	}
+	if err := k.reloadConfig(); err != nil {
+		writeGenerationError(w, fmt.Errorf("config rolled back to generation %d but could not be loaded: %w", gen, err))
+		return
+	}
+	if k.config.General.DataFolder != before {
+		k.useDataFolder()
+	}
+	_ = json.NewEncoder(w).Encode(client.ConfigRollbackResult{Generation: g})
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 
@@ -25,34 +26,62 @@ func (cl *ConfigLoader) Load() (types.Config, error) {
 		return types.Config{}, fmt.Errorf("failed to load file configuration: %w", err)
 	}
 
-	if err := cl.applyEnvironment(&cfg); err != nil {
-		return types.Config{}, fmt.Errorf("failed to apply environment configuration: %w", err)
+	if err := cl.finish(&cfg); err != nil {
+		return types.Config{}, err
 	}
 
-	if err := cl.cleanup(&cfg); err != nil {
-		return types.Config{}, fmt.Errorf("failed to finalize configuration: %w", err)
+	if err := cl.initializeFolders(cfg); err != nil {
+		return types.Config{}, fmt.Errorf("failed to initialize folders: %w", err)
 	}
 
-	if err := cl.validate(cfg); err != nil {
-		return types.Config{}, fmt.Errorf("validation error: %w", err)
+	return cfg, nil
+}
+
+// LoadData loads data as Load loads config.yaml, without creating the
+// folders it names, so a config can be checked before it is written.
+func (cl *ConfigLoader) LoadData(data []byte) (types.Config, error) {
+	cfg, err := cl.loadFrom(bytesProvider(data), "data")
+	if err != nil {
+		return types.Config{}, fmt.Errorf("failed to load file configuration: %w", err)
 	}
 
-	if err := cl.initializeFolders(cfg); err != nil {
-		return types.Config{}, fmt.Errorf("failed to initialize folders: %w", err)
+	if err := cl.finish(&cfg); err != nil {
+		return types.Config{}, err
 	}
 
 	return cfg, nil
 }
 
+// finish applies the environment to a loaded config, cleans it up and
+// validates it.
+func (cl *ConfigLoader) finish(cfg *types.Config) error {
+	if err := cl.applyEnvironment(cfg); err != nil {
+		return fmt.Errorf("failed to apply environment configuration: %w", err)
+	}
+
+	if err := cl.cleanup(cfg); err != nil {
+		return fmt.Errorf("failed to finalize configuration: %w", err)
+	}
+
+	if err := cl.validate(*cfg); err != nil {
+		return fmt.Errorf("validation error: %w", err)
+	}
+
+	return nil
+}
+
 func (cl *ConfigLoader) loadFromFile() (types.Config, error) {
-	fileK := koanf.New(".")
 	fn := types.GetConfigFn()
 	if coreFile.FileSize(fn) == 0 || len(coreFile.AsciiFileToString(fn)) == 0 {
 		return types.Config{}, fmt.Errorf("config file is empty: %s", fn)
 	}
+	return cl.loadFrom(file.Provider(fn), fn)
+}
 
-	if err := fileK.Load(file.Provider(fn), MyParser()); err != nil {
-		return types.Config{}, fmt.Errorf("failed to load file config %s: %w", fn, err)
+func (cl *ConfigLoader) loadFrom(p koanf.Provider, name string) (types.Config, error) {
+	fileK := koanf.New(".")
+	if err := fileK.Load(p, MyParser()); err != nil {
+		return types.Config{}, fmt.Errorf("failed to load file config %s: %w", name, err)
 	}
 
 	fileCfg := types.NewConfig()
@@ -73,6 +102,17 @@ func (cl *ConfigLoader) loadFromFile() (types.Config, error) {
 	return fileCfg, nil
 }
 
+// bytesProvider is a koanf provider for config data held in memory.
+type bytesProvider []byte
+
+func (b bytesProvider) ReadBytes() ([]byte, error) {
+	return b, nil
+}
+
+func (b bytesProvider) Read() (map[string]interface{}, error) {
+	return nil, errors.New("bytesProvider does not support Read()")
+}
+
 func (cl *ConfigLoader) applyEnvironment(cfg *types.Config) error {
 	keys := types.GetEnvironmentKeys(*cfg, types.InEnv)
 	return types.ApplyEnv(keys, cfg)
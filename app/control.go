@@ -2,6 +2,7 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -10,7 +11,6 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -18,10 +18,16 @@ import (
 	"time"
 
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
-	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
-	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/audit"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/budget"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/cache"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chainguard"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/logs"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 	"github.com/TrueBlocks/trueblocks-sdk/v6/services"
 )
@@ -41,40 +47,52 @@ func (k *KhedraApp) initializeControlSvc() error {
 
 	// ----------------------------------------------------------------------------------
 	// Write initial control metadata (port from config); ignore errors (best-effort)
-	k.controlSvc = services.NewControlService(k.logger.GetLogger())
+	k.controlSvc = services.NewControlService(k.logger.Component(types.ComponentControl))
 	meta := control.NewMetadata(k.controlSvc.Port(), k.config.Version())
 	_ = control.Write(meta)
 
+	// Pauses survive restarts; a damaged state file is reported and replaced
+	pauses, err := control.OpenRuntimeState(control.PausesPath(), k.logger.Component(types.ComponentControl))
+	if err != nil {
+		k.logger.Component(types.ComponentControl).Warn("Could not read saved pause state", "path", control.PausesPath(), "error", err)
+	}
+	k.pauses = pauses
+	k.auditLog = audit.New(k.config.Logging.Folder, k.config.Logging.Audit)
+
 	// Create all services using factory
-	factory := NewServiceFactory(k.config, k.logger)
+	factory := NewServiceFactory(k.config, k.logger, k.pauses)
+	factory.chainPauses = k.chainPauses
 	activeServices := factory.CreateAllServices(k.controlSvc)
 
 	k.serviceManager = services.NewServiceManager(activeServices, k.logger.GetLogger())
 	k.controlSvc.AttachServiceManager(k.serviceManager)
+	k.schedulePauseExpiries()
 
 	// Add handlers AFTER serviceManager is created so dashboard state handler can access it
 	_ = k.addHandlers()
+	k.registerMetrics()
 
-	k.logger.Info("Control service initialized", "services", len(activeServices))
+	k.logger.Component(types.ComponentControl).Info("Control service initialized", "services", len(activeServices))
 	return nil
 }
 
 func (k *KhedraApp) addHandlers() error {
-	k.logger.Info("Adding control handlers")
+	k.logger.Component(types.ComponentControl).Info("Adding control handlers")
 
 	// ----------------------------------------------------------------------------------
 	// Session store shared across state handler (placeholder; expanded later with inactivity logic)
 	installSession := install.NewSessionStore()
+	k.session = installSession
 
 	// ----------------------------------------------------------------------------------
 	// Install state handler
-	k.controlSvc.AddHandler("/install/state", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/install/state", func(w http.ResponseWriter, r *http.Request) {
 		install.Handler(installSession, k.config.Version(), install.Configured())(w, r)
 	})
 
 	// ----------------------------------------------------------------------------------
 	// Download current config (final if present, else synthesize from draft)
-	k.controlSvc.AddHandler("/config.yaml", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/config.yaml", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/x-yaml; charset=utf-8")
 		w.Header().Set("Cache-Control", "no-cache")
 		cfgFn := types.GetConfigFnNoCreate()
@@ -120,7 +138,7 @@ func (k *KhedraApp) addHandlers() error {
 
 	// ----------------------------------------------------------------------------------
 	// /install/rpc-test
-	k.controlSvc.AddHandler("/install/rpc-test", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/install/rpc-test", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		if r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -174,7 +192,7 @@ func (k *KhedraApp) addHandlers() error {
 				ra = 1
 			}
 			w.WriteHeader(http.StatusTooManyRequests)
-			_ = json.NewEncoder(w).Encode(map[string]any{"error": "rate_limited", "retryAfterSec": ra})
+			_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: "rate_limited", RetryAfterSec: ra})
 			return
 		}
 		url := strings.TrimSpace(r.URL.Query().Get("rpc"))
@@ -189,17 +207,17 @@ func (k *KhedraApp) addHandlers() error {
 				url = ch.RPCs[0]
 			}
 		}
-		res, err := rpc.PingRpc(url)
+		res, err := metrics.PingRpc(url)
 		if err != nil {
-			k.logger.Debug("RPC ping failed", "url", url, "error", err)
+			k.logger.Component(types.ComponentRpc).Debug("RPC ping failed", "url", url, "error", err)
 		}
-		payload := map[string]any{
-			"ok":            res.OK,
-			"chainId":       res.ChainID,
-			"chainName":     res.ChainName,
-			"clientVersion": res.ClientVersion,
-			"error":         res.Error,
-			"latencyMs":     res.LatencyMS,
+		payload := client.RpcTestResult{
+			OK:            res.OK,
+			ChainID:       res.ChainID,
+			ChainName:     res.ChainName,
+			ClientVersion: res.ClientVersion,
+			Error:         res.Error,
+			LatencyMS:     res.LatencyMS,
 		}
 		if !res.OK {
 			w.WriteHeader(http.StatusBadGateway)
@@ -209,21 +227,26 @@ func (k *KhedraApp) addHandlers() error {
 
 	// ----------------------------------------------------------------------------------
 	// /install/rpc_probe
-	k.controlSvc.AddHandler("/install/rpc_probe", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/install/rpc_probe", func(w http.ResponseWriter, r *http.Request) {
 		if !rpcProbeDeprecLogged {
-			k.logger.Warn("/install/rpc_probe is deprecated; use /install/rpc-test")
+			k.logger.Component(types.ComponentInstall).Warn("/install/rpc_probe is deprecated; use /install/rpc-test")
 			rpcProbeDeprecLogged = true
 		}
 		install.RpcProbeHandler(w, r) // legacy full response for backward compatibility
 	})
 
+	// ----------------------------------------------------------------------------------
+	// /install/rpc_capabilities: which features (archive, traces, batching...) an RPC supports
+	k.addHandler("/install/rpc_capabilities", install.RpcCapabilitiesHandler)
+	k.addHandler("/install/preflight", install.PreflightHandler)
+
 	// ----------------------------------------------------------------------------------
 	// Dashboard state endpoint (initial minimal implementation per spec)
-	k.controlSvc.AddHandler("/dashboard/state", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/dashboard/state", func(w http.ResponseWriter, r *http.Request) {
 		_ = r
 		w.Header().Set("Content-Type", "application/json")
 		// Build services slice, sorted alphabetically for stable UI
-		var servicesJSON []map[string]any
+		var servicesJSON []client.DashboardService
 		var names []string
 		for name := range k.config.Services {
 			names = append(names, name)
@@ -246,15 +269,21 @@ func (k *KhedraApp) addHandlers() error {
 					}
 				}
 			}
-			servicesJSON = append(servicesJSON, map[string]any{
-				"name":     name,
-				"state":    state,
-				"pausable": true, // all services now show pause/unpause button
-				"port":     svc.Port,
-			})
+			entry := client.DashboardService{
+				Name:     name,
+				State:    state,
+				Pausable: true, // all services now show pause/unpause button
+				Port:     svc.Port,
+			}
+			if p, ok := k.pauses.Info(name); ok && state == "paused" {
+				entry.PauseReason = p.Reason
+				entry.PausedUntil = p.Until
+			}
+			servicesJSON = append(servicesJSON, entry)
 		}
-		// Chains slice
-		var chainsJSON []map[string]any
+		// Chains slice, with each chain's share of the cache
+		cacheStats, lastPrune := k.cachePruner.snapshot()
+		var chainsJSON []client.DashboardChain
 		for name, ch := range k.config.Chains {
 			if !ch.Enabled {
 				continue
@@ -264,134 +293,202 @@ func (k *KhedraApp) addHandlers() error {
 				rpc = ch.RPCs[0]
 			}
 			// Default blank chain info (no height fetch)
-			entry := map[string]any{
-				"name":    name,
-				"enabled": ch.Enabled,
-				"rpc":     rpc,
+			entry := client.DashboardChain{
+				Name:       name,
+				Enabled:    ch.Enabled,
+				Rpc:        rpc,
+				CacheBytes: cacheStats.Chain(name).Bytes,
+			}
+			if k.budgets != nil {
+				entry.OutOfQuota = k.budgets.Refused(name)
+			}
+			if k.chainGuard != nil {
+				if ev, ok := k.chainGuard.Quarantined(name); ok {
+					entry.Quarantine = ev.Message
+				}
 			}
 			chainsJSON = append(chainsJSON, entry)
 		}
-		paths := map[string]string{
-			"data":  k.config.IndexPath(),
-			"cache": k.config.CachePath(),
-			"logs":  k.config.Logging.Folder,
+		paths := client.DashboardPaths{
+			Data:  k.config.IndexPath(),
+			Cache: k.config.CachePath(),
+			Logs:  k.config.Logging.Folder,
 		}
-		// Optimized log tail: only attempt when logging to file enabled
+		// Log tail: only attempt when logging to file enabled
 		var logTail []string
 		logToFile := k.config.Logging.ToFile
 		if logToFile {
 			logFile := filepath.Join(k.config.Logging.Folder, k.config.Logging.Filename)
 			if file.FileExists(logFile) {
-				// Efficient tail read of last 15 non-empty lines without loading entire file
-				if f, err := os.Open(logFile); err == nil {
-					defer f.Close()
-					// Seek from end in chunks
-					const maxLines = 15
-					const chunkSize = 8 * 1024
-					var (
-						pos  int64
-						buf  []byte
-						stat os.FileInfo
-					)
-					if stat, err = f.Stat(); err == nil {
-						pos = stat.Size()
-						var collected []string
-						rem := ""
-						for pos > 0 && len(collected) < maxLines {
-							readSize := chunkSize
-							if pos-int64(readSize) < 0 {
-								readSize = int(pos)
-							}
-							pos -= int64(readSize)
-							_, _ = f.Seek(pos, 0)
-							buf = make([]byte, readSize)
-							if _, err := f.Read(buf); err != nil {
-								break
-							}
-							chunk := string(buf) + rem
-							parts := strings.Split(chunk, "\n")
-							// Last element may be partial; keep as rem for next iteration
-							rem = parts[0]
-							for i := len(parts) - 1; i >= 1 && len(collected) < maxLines; i-- { // skip parts[0] (carried)
-								ln := strings.TrimSpace(parts[i])
-								if ln != "" {
-									collected = append(collected, ln)
-								}
-							}
-						}
-						// collected currently newest-first; reverse
-						for i := len(collected) - 1; i >= 0; i-- {
-							logTail = append(logTail, collected[i])
-						}
-					}
-				}
+				logTail, _ = logs.TailFile(logFile, 15)
 			}
 		}
-		pausedSummary := map[string]any{"paused": []string{}, "totalPausable": 0}
 		var paused []string
-		// Query ServiceManager for actual paused services
-		if k.serviceManager != nil {
-			for name := range k.config.Services {
-				if results, err := k.serviceManager.IsPaused(name); err == nil && len(results) > 0 {
-					if results[0]["status"] == "paused" {
-						paused = append(paused, name)
-					}
-				}
+		for _, svc := range servicesJSON {
+			if svc.State == "paused" {
+				paused = append(paused, svc.Name)
 			}
 		}
-		sort.Strings(paused)
-		pausedSummary["paused"] = paused
-		pausedSummary["totalPausable"] = len(k.config.Services)
-		resp := map[string]any{
-			"version":         k.config.Version(),
-			"services":        servicesJSON,
-			"chains":          chainsJSON,
-			"paths":           paths,
-			"logTail":         logTail,
-			"logToFile":       logToFile,
-			"loggingFilename": k.config.Logging.Filename,
-			"pausedSummary":   pausedSummary,
-			"schema":          1,
+		policy := cache.PolicyFrom(k.config.Cache)
+		cacheJSON := client.DashboardCache{
+			Bytes:        cacheStats.Total.Bytes,
+			Files:        cacheStats.Total.Files,
+			MaxSize:      policy.MaxSize,
+			MaxChainSize: policy.MaxChainSize,
+			Scanned:      cacheStats.Scanned,
+		}
+		if lastPrune != nil {
+			cacheJSON.LastPrune, cacheJSON.LastFreed = lastPrune.Finished, lastPrune.Removed.Bytes
+		}
+		var budgets []budget.Status
+		if k.budgets != nil {
+			budgets = k.budgets.Status()
+		}
+		var chainEvents []chainguard.Event
+		if k.chainGuard != nil {
+			chainEvents = k.chainGuard.Events()
+		}
+		resp := client.DashboardState{
+			Version:         k.config.Version(),
+			Services:        servicesJSON,
+			Chains:          chainsJSON,
+			Paths:           paths,
+			LogTail:         logTail,
+			LogToFile:       logToFile,
+			LoggingFilename: k.config.Logging.Filename,
+			PausedSummary:   client.PausedSummary{Paused: paused, TotalPausable: len(k.config.Services)},
+			Cache:           cacheJSON,
+			Budgets:         budgets,
+			ChainEvents:     chainEvents,
+			Schema:          1,
 		}
 		enc := json.NewEncoder(w)
 		_ = enc.Encode(resp)
 	})
 
+	// ----------------------------------------------------------------------------------
+	// /logs: filtered, paginated view of the log file and its rotated backups
+	k.addHandler("/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !k.config.Logging.ToFile {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: "logs are not being written to file"})
+			return
+		}
+		q, err := logQueryFromRequest(r, time.Now())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+			return
+		}
+		page, err := logs.Read(k.config.Logging.Folder, k.config.Logging.Filename, q)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	})
+
+	// ----------------------------------------------------------------------------------
+	// Service control (counted versions of the SDK's /status, /pause, ...)
+	k.addServiceHandlers()
+
+	// ----------------------------------------------------------------------------------
+	// /metrics: Prometheus text exposition format
+	k.addHandler("/metrics", metrics.Default.Handler())
+
+	// ----------------------------------------------------------------------------------
+	// /log-level: GET reports the running levels, POST changes one (optionally for a while)
+	k.addHandler("/log-level", k.audited("log_level", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			component, level, d, err := logLevelFromRequest(r)
+			if err == nil {
+				err = k.logger.SetLogLevel(component, level, d)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: "method not allowed"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(client.LogLevels{Levels: k.logger.LogLevels()})
+	}, http.MethodPost))
+
+	// ----------------------------------------------------------------------------------
+	// /audit: filtered, paginated view of the audit log
+	k.addHandler("GET /audit", k.handleAudit)
+
+	// ----------------------------------------------------------------------------------
+	// /config/history, /config/diff, /config/rollback: generations of config.yaml
+	k.addHandler("GET /config/history", k.handleConfigHistory)
+	k.addHandler("GET /config/diff", k.handleConfigDiff)
+	k.addHandler("POST /config/rollback", k.audited("config_rollback", k.handleConfigRollback))
+
+	// ----------------------------------------------------------------------------------
+	// /config/reload: load config.yaml again after it was changed on disk
+	k.addHandler("POST /config/reload", k.audited("config_reload", k.handleConfigReload))
+
+	// ----------------------------------------------------------------------------------
+	// /cache/stats, /cache/prune: the size of the cache and its limits
+	k.addHandler("GET /cache/stats", k.handleCacheStats)
+	k.addHandler("POST /cache/prune", k.audited("cache_prune", k.handleCachePrune))
+
+	// ----------------------------------------------------------------------------------
+	// /rpc/budgets: each RPC's rate and daily quota, and today's usage
+	k.addHandler("GET /rpc/budgets", k.handleRpcBudgets)
+
+	// ----------------------------------------------------------------------------------
+	// /index/verify: check (and optionally repair) the index in the background
+	k.addHandler("GET /index/verify", k.handleIndexVerify)
+	k.addHandler("POST /index/verify", k.audited("index_verify", k.handleIndexVerify))
+	k.addHandler("POST /index/verify/cancel", k.audited("index_verify", k.handleIndexVerifyCancel))
+
 	// ----------------------------------------------------------------------------------
 	// Dynamic chain add/remove endpoints for new UI
-	k.controlSvc.AddHandler("/install/chain_add", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/install/chain_add", k.audited("chain_add", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		rpcURL := strings.TrimSpace(r.URL.Query().Get("rpc"))
 		if rpcURL == "" {
 			w.WriteHeader(http.StatusBadRequest)
-			_, _ = w.Write([]byte(`{"error":"missing rpc"}`))
+			_ = json.NewEncoder(w).Encode(client.ChainAddResult{Error: "missing rpc"})
 			return
 		}
 		// Probe JSON directly (reachability assumed if returns)
-		res, err := rpc.PingRpc(rpcURL)
+		res, err := metrics.PingRpc(rpcURL)
 		if err != nil {
-			k.logger.Debug("RPC ping failed during chain add", "url", rpcURL, "error", err)
+			k.logger.Component(types.ComponentRpc).Debug("RPC ping failed during chain add", "url", rpcURL, "error", err)
 		}
 		if !res.OK || res.ChainID == "" {
+			msg := res.Error
+			if msg == "" {
+				msg = "rpc did not report a chain id"
+			}
 			w.WriteHeader(http.StatusBadGateway)
-			b, _ := json.Marshal(res)
-			_, _ = w.Write(b)
+			_ = json.NewEncoder(w).Encode(client.ChainAddResult{Error: msg, Probe: res})
 			return
 		}
-		// Validate that chainId exists in local ChainList; reject if unknown
+		// Validate that chainId exists in the chain catalog; reject if unknown
 		cidStr := strings.TrimPrefix(strings.ToLower(res.ChainID), "0x")
 		cidNum, errParse := strconv.ParseUint(cidStr, 16, 64)
 		if errParse != nil {
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			fmt.Fprintf(w, `{"ok":false,"error":"invalid chainId %s"}`, res.ChainID)
+			_ = json.NewEncoder(w).Encode(client.ChainAddResult{Error: fmt.Sprintf("invalid chainId %s", res.ChainID), Probe: res})
 			return
 		}
-		if utils.GetChainListItem("~/.khedra", int(cidNum)) == nil {
+		if _, ok := chains.ByID(int(cidNum)); !ok {
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			fmt.Fprintf(w, `{"ok":false,"error":"unknown chainId %s not found in chain list"}`, res.ChainID)
+			_ = json.NewEncoder(w).Encode(client.ChainAddResult{Error: fmt.Sprintf("unknown chainId %s not found in chain list", res.ChainID), Probe: res})
 			return
 		}
-		// Load draft and append / replace chain keyed by chain name or fallback numeric id
+		// Load draft and append / replace chain keyed by its canonical catalog name
 		draft, _ := install.LoadDraft()
 		if draft == nil {
 			draft = install.NewDraftFromConfig("")
@@ -399,31 +496,7 @@ func (k *KhedraApp) addHandlers() error {
 		if draft.Config.Chains == nil {
 			draft.Config.Chains = map[string]types.Chain{}
 		}
-		name := res.ChainName
-		// Prefer canonical chain list name if available (ensures consistency)
-		if item := utils.GetChainListItem("~/.khedra", int(cidNum)); item != nil && item.Name != "" {
-
-			toKey := func(s string) string {
-				reg, _ := regexp.Compile("[^a-zA-Z0-9_.-]+")
-				return reg.ReplaceAllString(strings.TrimSpace(s), "_")
-			}
-			name = toKey(item.Name)
-		}
-		if name == "" { // attempt to map via KnownChains by id first
-			for _, kc := range install.KnownChains() {
-				if uint64(kc.ChainID) == cidNum {
-					name = kc.Name
-					break
-				}
-			}
-			if name == "" { // fallback synthetic
-				name = fmt.Sprintf("chain-%d", cidNum)
-			}
-		}
-		if cidNum == 1 && name != "mainnet" {
-			name = "mainnet"
-		}
-		name = strings.ToLower(name)
+		name := chains.NameFor(int(cidNum))
 		ch, exists := draft.Config.Chains[name]
 		if !exists {
 			ch = types.NewChain(name, int(cidNum))
@@ -438,28 +511,31 @@ func (k *KhedraApp) addHandlers() error {
 		draft.Config.Chains[name] = ch
 		if err := install.SaveDraftAtomic(draft); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			_, _ = w.Write([]byte(`{"ok":false,"error":"save failed"}`))
+			_ = json.NewEncoder(w).Encode(client.ChainAddResult{Error: "save failed"})
 			return
 		}
+		// The chain is added even if the RPC lacks a required capability; the result warns instead
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		caps := install.ProbeCapabilities(ctx, rpcURL)
 		// Create response with RPC validity
-		chainWithStatus := map[string]any{
-			"name":     ch.Name,
-			"chainId":  ch.ChainID,
-			"rpcs":     ch.RPCs,
-			"enabled":  ch.Enabled,
-			"rpcValid": true, // If we got here, probe was successful so RPC is valid
+		chainWithStatus := &client.ChainStatus{
+			Name:     ch.Name,
+			ChainID:  ch.ChainID,
+			RPCs:     ch.RPCs,
+			Enabled:  ch.Enabled,
+			RpcValid: true, // If we got here, probe was successful so RPC is valid
 		}
-		b, _ := json.Marshal(map[string]any{"ok": true, "chain": chainWithStatus, "probe": res})
-		_, _ = w.Write(b)
-	})
+		_ = json.NewEncoder(w).Encode(client.ChainAddResult{OK: true, Chain: chainWithStatus, Probe: res, Capabilities: &caps})
+	}))
 
 	// ----------------------------------------------------------------------------------
 	// /isntall/chain_remove
-	k.controlSvc.AddHandler("/install/chain_remove", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/install/chain_remove", k.audited("chain_remove", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		name := strings.TrimSpace(r.URL.Query().Get("name"))
 		if name == "" || name == "mainnet" {
-			_, _ = w.Write([]byte(`{"ok":false}`))
+			_ = json.NewEncoder(w).Encode(client.OKResponse{OK: false})
 			return
 		}
 		draft, _ := install.LoadDraft()
@@ -467,12 +543,12 @@ func (k *KhedraApp) addHandlers() error {
 			delete(draft.Config.Chains, name)
 			_ = install.SaveDraftAtomic(draft)
 		}
-		_, _ = w.Write([]byte(`{"ok":true}`))
-	})
+		_ = json.NewEncoder(w).Encode(client.OKResponse{OK: true})
+	}))
 
 	// ----------------------------------------------------------------------------------
 	// Simple ping endpoint to verify new binary deployed
-	k.controlSvc.AddHandler("/install/ping", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/install/ping", func(w http.ResponseWriter, r *http.Request) {
 		_ = r
 		_, _ = w.Write([]byte("pong"))
 	})
@@ -480,7 +556,7 @@ func (k *KhedraApp) addHandlers() error {
 	// ----------------------------------------------------------------------------------
 
 	// Unified live-update endpoint for config feedback (draft or real)
-	k.controlSvc.AddHandler("/live-update/config", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/live-update/config", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 		// Handle POST requests to update draft config
@@ -555,10 +631,11 @@ func (k *KhedraApp) addHandlers() error {
 		// Calculate estimates for the config response
 		var meta map[string]any
 		if configStruct, ok := cfg.(types.Config); ok {
-			diskGB, hours := install.EstimateIndex(configStruct.General.Strategy, configStruct.General.Detail)
+			est := install.EstimateIndex(configStruct.General.Strategy, configStruct.General.Detail, install.CachedChainInputs(configStruct))
 			meta = map[string]any{
-				"EstDiskGB": diskGB,
-				"EstHours":  hours,
+				"EstDiskGB": int(math.Ceil(est.DiskGB.Expected)),
+				"EstHours":  int(math.Ceil(est.Hours.Expected)),
+				"Estimate":  est,
 			}
 		}
 
@@ -583,7 +660,7 @@ func (k *KhedraApp) addHandlers() error {
 
 	// ----------------------------------------------------------------------------------
 	// SetRootHandler
-	k.controlSvc.SetRootHandler(func(w http.ResponseWriter, r *http.Request) {
+	k.controlSvc.SetRootHandler(countRequests("/", func(w http.ResponseWriter, r *http.Request) {
 		configured := install.Configured()
 
 		// Determine persistent embed preference: query param overrides and sets cookie; cookie persists.
@@ -647,15 +724,21 @@ func (k *KhedraApp) addHandlers() error {
 			http.SetCookie(w, &http.Cookie{Name: "KHEDRA_WIZARD_STEP", Value: step, Path: "/", Expires: time.Now().Add(ttl)})
 		}
 
-		// Resume wizard based on cookie if user lands on root/dashboard.
+		// Resume wizard based on cookie if user lands on root/dashboard. Without a
+		// cookie (e.g. setup was started with 'khedra init'), resume at the draft's step.
 		if r.URL.Path == "/" || r.URL.Path == "/dashboard" {
+			step := ""
 			if c, err := r.Cookie("KHEDRA_WIZARD_STEP"); err == nil {
-				step := c.Value
-				if _, ok := allowedWizardStepSet[step]; ok {
-					http.Redirect(w, r, buildURL("/install/"+step), http.StatusFound)
-					return
+				step = c.Value
+			} else if !configured {
+				if d, _ := install.LoadDraft(); d != nil {
+					step = d.Meta.Step
 				}
 			}
+			if _, ok := allowedWizardStepSet[step]; ok {
+				http.Redirect(w, r, buildURL("/install/"+step), http.StatusFound)
+				return
+			}
 		}
 
 		// Intercept install flow OR redirect root if not configured; otherwise serve dashboard
@@ -690,7 +773,7 @@ func (k *KhedraApp) addHandlers() error {
 				files := []string{"templates/base.html", "templates/progress.html", "templates/" + tmplName}
 				tmpl, err := loadTemplates(files...)
 				if err != nil {
-					k.logger.Error("template parse failed", "err", err, "tmpl", tmplName)
+					k.logger.Component(types.ComponentInstall).Error("template parse failed", "err", err, "tmpl", tmplName)
 					w.WriteHeader(http.StatusInternalServerError)
 					_, _ = w.Write([]byte("template error: " + err.Error()))
 					return
@@ -754,7 +837,7 @@ func (k *KhedraApp) addHandlers() error {
 					if takeover {
 						w.Header().Set("X-Khedra-Session-Takeover", "1")
 						if prevID != "" && prevID != current { // log only when a real replacement happened
-							k.logger.Warn("session takeover", "prevSession", prevID, "prevLast", prevLast.UTC().Format(time.RFC3339), "newSession", current, "remote", r.RemoteAddr)
+							k.logger.Component(types.ComponentInstall).Warn("session takeover", "prevSession", prevID, "prevLast", prevLast.UTC().Format(time.RFC3339), "newSession", current, "remote", r.RemoteAddr)
 						}
 					}
 				} else if r.Method == http.MethodPost { // missing token on mutating request
@@ -767,9 +850,9 @@ func (k *KhedraApp) addHandlers() error {
 
 			switch r.Method {
 			case http.MethodPost:
-				k.logger.Info("install POST", "path", r.URL.Path, "ts", time.Now().Format(time.RFC3339))
+				k.logger.Component(types.ComponentInstall).Info("install POST", "path", r.URL.Path, "ts", time.Now().Format(time.RFC3339))
 			case http.MethodGet:
-				k.logger.Info("install GET", "path", r.URL.Path, "ts", time.Now().Format(time.RFC3339))
+				k.logger.Component(types.ComponentInstall).Info("install GET", "path", r.URL.Path, "ts", time.Now().Format(time.RFC3339))
 			}
 
 			// normalize trailing slash (except root and /install/ which maps to welcome)
@@ -783,7 +866,7 @@ func (k *KhedraApp) addHandlers() error {
 				if r.Method == http.MethodPost || r.Method == http.MethodGet { // accept both for simplicity
 					if dpath := install.DraftFilePath(); dpath != "" {
 						if err := os.Remove(dpath); err != nil && !os.IsNotExist(err) {
-							k.logger.Warn("failed removing draft on reset", "err", err, "file", dpath)
+							k.logger.Component(types.ComponentInstall).Warn("failed removing draft on reset", "err", err, "file", dpath)
 						}
 					}
 					// Also remove any previous yaml backup to avoid confusion (best effort)
@@ -792,6 +875,7 @@ func (k *KhedraApp) addHandlers() error {
 					_ = os.Remove(prev)
 					// Reset wizard cookie to welcome
 					setWizardStepCookie("welcome", 7*24*time.Hour)
+					k.recordAudit(r, "wizard_reset", http.StatusSeeOther, "")
 					http.Redirect(w, r, buildURL("/install/welcome", "reset", "1"), http.StatusSeeOther)
 					return
 				}
@@ -811,11 +895,12 @@ func (k *KhedraApp) addHandlers() error {
 			// Welcome
 			if r.URL.Path == "/install" || r.URL.Path == "/install/" || r.URL.Path == "/install/welcome" {
 				if r.Method == http.MethodPost {
-					k.logger.Info("welcome submit", "remote", r.RemoteAddr, "ua", r.UserAgent())
+					k.logger.Component(types.ComponentInstall).Info("welcome submit", "remote", r.RemoteAddr, "ua", r.UserAgent())
+					_ = install.MarkStep("paths")
 					http.Redirect(w, r, buildURL("/install/paths"), http.StatusSeeOther)
 					return
 				}
-				k.logger.Info("welcome view", "remote", r.RemoteAddr, "ua", r.UserAgent())
+				k.logger.Component(types.ComponentInstall).Info("welcome view", "remote", r.RemoteAddr, "ua", r.UserAgent())
 				serveStep(0, "welcome.html", map[string]any{"Reset": r.URL.Query().Get("reset")})
 				return
 			}
@@ -842,6 +927,12 @@ func (k *KhedraApp) addHandlers() error {
 						serveStep(1, "paths.html", map[string]any{"DataFolder": draft.Config.General.DataFolder, "Errors": ferrs})
 						return
 					}
+					// Preflight errors block the step; warnings were shown while editing and allow it
+					if pf := install.DiskPreflight(draft); pf.Blocking() {
+						serveStep(1, "paths.html", map[string]any{"DataFolder": draft.Config.General.DataFolder, "Errors": pf.FieldErrors(), "Preflight": pf})
+						return
+					}
+					_ = install.MarkStep("chains")
 					http.Redirect(w, r, buildURL("/install/chains"), http.StatusSeeOther)
 					return
 				}
@@ -877,36 +968,30 @@ func (k *KhedraApp) addHandlers() error {
 					if draft == nil {
 						draft = install.NewDraftFromConfig("")
 					}
-					install.UpdateIndexStrategy(draft, strategy, detail)
+					install.UpdateIndexStrategy(draft, strategy, detail, install.CachedChainInputs(draft.Config))
 					if err := install.SaveDraftAtomic(draft); err == nil {
 						install.ClearCorruptionFlag()
 					}
 					ferrs := install.ValidateDraftPhase(draft, "step:index")
 					if len(ferrs) > 0 {
-						serveStep(3, "index.html", map[string]any{"Strategy": strategy, "Detail": detail, "Disk": draft.Meta.EstDiskGB, "Hours": draft.Meta.EstHours, "Errors": ferrs})
+						serveStep(3, "index.html", map[string]any{"Strategy": strategy, "Detail": detail, "Estimate": draft.Meta.Estimate, "Errors": ferrs})
 						return
 					}
+					_ = install.MarkStep("services")
 					http.Redirect(w, r, buildURL("/install/services"), http.StatusSeeOther)
 					return
 				}
 				draft, _ := install.LoadDraft()
-				strategy := "download"
-				detail := "index"
-				if draft != nil {
-					if draft.Config.General.Strategy != "" {
-						strategy = draft.Config.General.Strategy
-					}
-					if draft.Config.General.Detail != "" {
-						detail = draft.Config.General.Detail
-					}
-				}
-				disk, hours := 0, 0
-				if draft != nil && draft.Meta.EstDiskGB > 0 && draft.Meta.EstHours > 0 {
-					disk, hours = draft.Meta.EstDiskGB, draft.Meta.EstHours
-				} else {
-					disk, hours = install.EstimateIndex(strategy, detail)
+				if draft == nil {
+					draft = install.NewDraftFromConfig("")
 				}
-				serveStep(3, "index.html", map[string]any{"Strategy": strategy, "Detail": detail, "Disk": disk, "Hours": hours})
+				strategy := orDefault(draft.Config.General.Strategy, "download")
+				detail := orDefault(draft.Config.General.Detail, "index")
+				// Measure head blocks and RPC throughput so the estimates reflect the chosen chains
+				ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+				est := install.EstimateIndex(strategy, detail, install.MeasureChains(ctx, draft.Config))
+				cancel()
+				serveStep(3, "index.html", map[string]any{"Strategy": strategy, "Detail": detail, "Estimate": est})
 				return
 			}
 
@@ -927,17 +1012,10 @@ func (k *KhedraApp) addHandlers() error {
 						draft.Config.Chains = map[string]types.Chain{}
 					}
 					if action == "add" {
-						name := strings.TrimSpace(r.FormValue("chain_to_add"))
-						if install.IsKnownChain(name) {
+						if info, ok := chains.ByName(r.FormValue("chain_to_add")); ok {
+							name := info.Name
 							if _, exists := draft.Config.Chains[name]; !exists {
-								var cid int
-								for _, kc := range install.KnownChains() {
-									if kc.Name == name {
-										cid = kc.ChainID
-										break
-									}
-								}
-								ch := types.NewChain(name, cid)
+								ch := types.NewChain(name, info.ChainID)
 								if name != "mainnet" {
 									ch.Enabled = false
 								}
@@ -974,6 +1052,7 @@ func (k *KhedraApp) addHandlers() error {
 						// ONLY validate when trying to proceed to next step (Next button)
 						ferrs := install.ValidateDraftPhase(draft, "step:chains")
 						if len(ferrs) == 0 {
+							_ = install.MarkStep("index")
 							http.Redirect(w, r, buildURL("/install/index"), http.StatusSeeOther)
 							return
 						}
@@ -988,10 +1067,10 @@ func (k *KhedraApp) addHandlers() error {
 					existing[name] = true
 					chainRows = append(chainRows, ch)
 				}
-				var addable []install.KnownChain
-				for _, kc := range install.KnownChains() {
-					if !existing[kc.Name] {
-						addable = append(addable, kc)
+				var addable []chains.Info
+				for _, info := range chains.Featured() {
+					if !existing[info.Name] && !info.Deprecated {
+						addable = append(addable, info)
 					}
 				}
 				sort.Slice(chainRows, func(i, j int) bool { return chainRows[i].ChainID < chainRows[j].ChainID })
@@ -1058,6 +1137,7 @@ func (k *KhedraApp) addHandlers() error {
 						serveStep(4, "services.html", map[string]any{"Services": servicesMap, "Errors": ferrs})
 						return
 					}
+					_ = install.MarkStep("logging")
 					http.Redirect(w, r, buildURL("/install/logging"), http.StatusSeeOther)
 					return
 				}
@@ -1128,6 +1208,7 @@ func (k *KhedraApp) addHandlers() error {
 						serveStep(5, "logging.html", map[string]any{"Level": lg.Level, "ToFile": lg.ToFile, "Folder": lg.Folder, "Filename": lg.Filename, "MaxSize": lg.MaxSize, "MaxBackups": lg.MaxBackups, "MaxAge": lg.MaxAge, "Compress": lg.Compress, "Errors": ferrs})
 						return
 					}
+					_ = install.MarkStep("summary")
 					http.Redirect(w, r, buildURL("/install/summary"), http.StatusSeeOther)
 					return
 				}
@@ -1154,18 +1235,18 @@ func (k *KhedraApp) addHandlers() error {
 			// Summary step (validate & apply)
 			if r.URL.Path == "/install/summary" {
 				if r.Method == http.MethodPost {
-					if err := install.ApplyDraft(); err != nil {
+					if err := install.ApplyDraft(install.SourceWizard); err != nil {
+						k.recordAudit(r, "config_apply", http.StatusOK, err.Error())
 						draft, _ := install.LoadDraft()
 						ferrs := install.ValidateDraftPhase(draft, "final")
 						serveStep(6, "summary.html", map[string]any{"Draft": draft, "Errors": ferrs, "Error": err.Error()})
 						return
 					}
-					if cfg, err := LoadConfig(); err != nil {
-						k.logger.Error("Failed to reload config after applying draft", "error", err)
+					k.recordAudit(r, "config_apply", http.StatusSeeOther, "")
+					if err := k.reloadConfig(); err != nil {
+						k.logger.Component(types.ComponentInstall).Error("Failed to reload config after applying draft", "error", err)
 					} else {
-						k.config = &cfg
-						k.logger = types.NewLogger(cfg.Logging)
-						k.logger.Info("Config reloaded after install wizard completion. Services will pick up changes naturally.")
+						k.logger.Component(types.ComponentInstall).Info("Config reloaded after install wizard completion. Services will pick up changes naturally.")
 					}
 
 					// NOTE: Skip service restart to avoid disrupting the control service.
@@ -1179,7 +1260,13 @@ func (k *KhedraApp) addHandlers() error {
 				}
 				draft, _ := install.LoadDraft()
 				ferrs := install.ValidateDraftPhase(draft, "final")
-				serveStep(6, "summary.html", map[string]any{"Draft": draft, "Errors": ferrs})
+				data := map[string]any{"Draft": draft, "Errors": ferrs}
+				if draft != nil {
+					g := draft.Config.General
+					data["Estimate"] = install.EstimateIndex(g.Strategy, g.Detail, install.CachedChainInputs(draft.Config))
+					data["IndexChanges"] = install.IndexChanges(draft.Config, install.CachedChainInputs(draft.Config))
+				}
+				serveStep(6, "summary.html", data)
 				return
 			}
 
@@ -1191,7 +1278,7 @@ func (k *KhedraApp) addHandlers() error {
 			}
 		}
 
-		k.logger.Debug("root handler", "configured", configured, "path", r.URL.Path)
+		k.logger.Component(types.ComponentControl).Debug("root handler", "configured", configured, "path", r.URL.Path)
 		// If configured and hitting root or /dashboard, render dashboard
 		if configured && (r.URL.Path == "/" || r.URL.Path == "/dashboard") {
 			// Prepare debug JSON for dashboard if debug enabled
@@ -1211,7 +1298,7 @@ func (k *KhedraApp) addHandlers() error {
 			files := []string{"templates/base.html", "templates/progress.html", "templates/dashboard.html"}
 			tmpl, err := loadTemplates(files...)
 			if err != nil {
-				k.logger.Error("template parse failed", "err", err, "tmpl", "dashboard.html")
+				k.logger.Component(types.ComponentControl).Error("template parse failed", "err", err, "tmpl", "dashboard.html")
 				w.WriteHeader(http.StatusInternalServerError)
 				_, _ = w.Write([]byte("template error: " + err.Error()))
 				return
@@ -1235,11 +1322,11 @@ func (k *KhedraApp) addHandlers() error {
 
 		// Fallback
 		k.controlSvc.DefaultRootHandler()(w, r)
-	})
+	}))
 
 	// ----------------------------------------------------------------------------------
 	// Control info endpoint returning metadata
-	k.controlSvc.AddHandler("/control/info", func(w http.ResponseWriter, r *http.Request) {
+	k.addHandler("/control/info", func(w http.ResponseWriter, r *http.Request) {
 		_ = r
 		w.Header().Set("Content-Type", "application/json")
 		var regenerated bool
@@ -1253,13 +1340,66 @@ func (k *KhedraApp) addHandlers() error {
 				meta, _ = control.Read()
 			}
 		}
-		payload := map[string]any{
-			"ok":          true,
-			"metadata":    meta,
-			"regenerated": regenerated,
+		payload := client.ControlInfo{
+			OK:          true,
+			Metadata:    meta,
+			Regenerated: regenerated,
 		}
 		_ = json.NewEncoder(w).Encode(payload)
 	})
 
 	return nil
 }
+
+// logQueryFromRequest builds a log query from the since, until, level, grep and limit
+// query parameters. since and until accept a duration (1h) or an RFC3339 timestamp,
+// and until also a page's next cursor.
+func logQueryFromRequest(r *http.Request, now time.Time) (logs.Query, error) {
+	const defaultLimit = 200
+	const maxLimit = 5000
+
+	v := r.URL.Query()
+	q := logs.Query{
+		Level: strings.ToLower(strings.TrimSpace(v.Get("level"))),
+		Grep:  v.Get("grep"),
+		Limit: defaultLimit,
+	}
+	if !logs.ValidLevel(q.Level) {
+		return logs.Query{}, fmt.Errorf("invalid level %q (use debug, info, warn or error)", q.Level)
+	}
+	var err error
+	if q.Since, err = logs.ParseSince(v.Get("since"), now); err != nil {
+		return logs.Query{}, err
+	}
+	if q.Until, q.Skip, err = logs.ParseUntil(v.Get("until"), now); err != nil {
+		return logs.Query{}, err
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return logs.Query{}, fmt.Errorf("invalid limit %q", s)
+		}
+		q.Limit = min(n, maxLimit)
+	}
+	return q, nil
+}
+
+// logLevelFromRequest reads the level, component and for query parameters of a
+// /log-level change. A component's level may be "default" to remove its override.
+func logLevelFromRequest(r *http.Request) (component, level string, d time.Duration, err error) {
+	v := r.URL.Query()
+	component = strings.ToLower(strings.TrimSpace(v.Get("component")))
+	level = strings.ToLower(strings.TrimSpace(v.Get("level")))
+	if level == "" {
+		return "", "", 0, fmt.Errorf("level is required")
+	}
+	if component != "" && level == "default" {
+		level = ""
+	}
+	if s := v.Get("for"); s != "" {
+		if d, err = time.ParseDuration(s); err != nil || d <= 0 {
+			return "", "", 0, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+	return component, level, d, nil
+}
@@ -0,0 +1,663 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/audit"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/budget"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/cache"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chainguard"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// newContractClient serves the real control handlers and returns a client for them.
+func newContractClient(t *testing.T) (*client.Client, *KhedraApp) {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("KHEDRA_RUN_DIR", filepath.Join(tmp, "run"))
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", filepath.Join(tmp, "config.yaml"))
+
+	cfg := types.NewConfig()
+	for _, name := range []string{"api", "ipfs"} {
+		svc := cfg.Services[name]
+		svc.Enabled = false
+		cfg.Services[name] = svc
+	}
+	cfg.General.DataFolder = filepath.Join(tmp, "data")
+	cfg.Logging.Folder = filepath.Join(tmp, "logs")
+	cfg.Logging.ToFile = true
+	require.NoError(t, os.MkdirAll(cfg.Logging.Folder, 0755))
+	logLine := "time=2025-01-02T03:04:05Z level=INFO msg=\"hello\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Logging.Folder, cfg.Logging.Filename), []byte(logLine), 0644))
+
+	return startContractApp(t, &cfg)
+}
+
+// startContractApp initializes a new app for cfg, as a daemon restart would, and
+// serves its control handlers.
+func startContractApp(t *testing.T, cfg *types.Config) (*client.Client, *KhedraApp) {
+	t.Helper()
+	k := &KhedraApp{config: cfg}
+	require.NoError(t, k.initializeControlSvc())
+	srv := httptest.NewServer(k.routes)
+	t.Cleanup(srv.Close)
+	return client.New(srv.URL), k
+}
+
+func TestControlContract_Services(t *testing.T) {
+	cl, _ := newContractClient(t)
+	ctx := context.Background()
+
+	results, err := cl.Status(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, results, client.ServiceResult{Name: "scraper", Status: "running"})
+
+	results, err = cl.Pause(ctx, client.PauseRequest{Name: "scraper"})
+	require.NoError(t, err)
+	assert.Equal(t, []client.ServiceResult{{Name: "scraper", Status: "paused"}}, results)
+
+	state, err := cl.DashboardState(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, state.PausedSummary.Paused, "scraper")
+	for _, svc := range state.Services {
+		if svc.Name == "scraper" {
+			assert.Equal(t, "paused", svc.State)
+		}
+	}
+	assert.Equal(t, 1, state.Schema)
+
+	results, err = cl.Unpause(ctx, "scraper")
+	require.NoError(t, err)
+	assert.Equal(t, "scraper", results[0].Name)
+
+	_, err = cl.Pause(ctx, client.PauseRequest{Name: "nonexistent"})
+	var apiErr *client.Error
+	require.True(t, errors.As(err, &apiErr), "expected *client.Error, got %v", err)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestControlContract_PausePersists(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+
+	_, err := cl.Pause(ctx, client.PauseRequest{Name: "scraper", Reason: "maintenance", For: time.Hour})
+	require.NoError(t, err)
+
+	state, err := cl.DashboardState(ctx)
+	require.NoError(t, err)
+	for _, svc := range state.Services {
+		if svc.Name == "scraper" {
+			assert.Equal(t, "maintenance", svc.PauseReason)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), svc.PausedUntil, time.Minute)
+		}
+	}
+
+	// A restarted daemon starts the scraper paused
+	cl2, _ := startContractApp(t, k.config)
+	results, err := cl2.Status(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, results, client.ServiceResult{Name: "scraper", Status: "paused"})
+
+	// Unpausing clears the saved pause, so the next start runs it again
+	_, err = cl2.Unpause(ctx, "scraper")
+	require.NoError(t, err)
+	cl3, _ := startContractApp(t, k.config)
+	results, err = cl3.Status(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, results, client.ServiceResult{Name: "scraper", Status: "running"})
+
+	_, err = cl3.Pause(ctx, client.PauseRequest{Name: "scraper", For: -time.Minute})
+	assert.NoError(t, err, "a non-positive duration is not sent")
+}
+
+func TestControlContract_PostPausePersists(t *testing.T) {
+	cl, k := newContractClient(t)
+
+	resp, err := http.Post(cl.BaseURL+"/pause?name=scraper&reason=disk", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	p, ok := k.pauses.Info("scraper")
+	assert.True(t, ok, "a POSTed pause is saved like a GET")
+	assert.Equal(t, "disk", p.Reason)
+
+	resp, err = http.Post(cl.BaseURL+"/unpause?name=scraper", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, k.pauses.IsPaused("scraper"))
+}
+
+func TestControlContract_PauseServices(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+	_, err := cl.Pause(ctx, client.PauseRequest{Name: "monitor", Reason: "mine"})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	resume, err := pauseServices(ctx, cl, "backup", &out)
+	require.NoError(t, err)
+	scraper, ok := k.pauses.Info("scraper")
+	require.True(t, ok)
+	assert.Equal(t, "backup", scraper.Reason)
+	assert.WithinDuration(t, time.Now().Add(pauseLease), scraper.Until, time.Minute, "the pause expires unless renewed")
+	monitor, _ := k.pauses.Info("monitor")
+	assert.Equal(t, control.Pause{Reason: "mine", Since: monitor.Since}, monitor, "a service paused beforehand is left alone")
+
+	resume()
+	assert.Empty(t, out.String())
+	_, ok = k.pauses.Info("scraper")
+	assert.False(t, ok)
+	_, ok = k.pauses.Info("monitor")
+	assert.True(t, ok)
+}
+
+func TestPauseExpiry(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+
+	_, err := cl.Pause(ctx, client.PauseRequest{Name: "scraper", For: 50 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		results, err := cl.Status(ctx, "scraper")
+		return err == nil && !k.pauses.IsPaused("scraper") && len(results) > 0 &&
+			results[len(results)-1] == client.ServiceResult{Name: "scraper", Status: "running"}
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestPauseFromRequest(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := httptest.NewRequest(http.MethodGet, "/pause?name=scraper&reason=+maintenance+&for=2h", nil)
+	p, err := pauseFromRequest(r, now)
+	require.NoError(t, err)
+	assert.Equal(t, "maintenance", p.Reason)
+	assert.Equal(t, now.Add(2*time.Hour), p.Until)
+
+	for _, bad := range []string{"for=soon", "for=-1h", "for=0s"} {
+		_, err := pauseFromRequest(httptest.NewRequest(http.MethodGet, "/pause?"+bad, nil), now)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestControlContract_Install(t *testing.T) {
+	cl, _ := newContractClient(t)
+	ctx := context.Background()
+
+	st, err := cl.InstallState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, st.Schema)
+
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+
+	res, err := cl.RpcTest(ctx, client.RpcTestRequest{Rpc: good.URL, Session: "contract"})
+	require.NoError(t, err)
+	assert.True(t, res.OK)
+	assert.Equal(t, "0x1", res.ChainID)
+
+	res, err = cl.RpcTest(ctx, client.RpcTestRequest{Rpc: bad.URL, Session: "contract"})
+	require.NoError(t, err, "a failed probe is reported in the result")
+	assert.False(t, res.OK)
+	assert.NotEmpty(t, res.Error)
+
+	_, err = cl.ChainAdd(ctx, bad.URL)
+	var apiErr *client.Error
+	require.True(t, errors.As(err, &apiErr), "expected *client.Error, got %v", err)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+
+	assert.Error(t, cl.ChainRemove(ctx, "mainnet"))
+	assert.NoError(t, cl.ChainRemove(ctx, "gnosis"))
+
+	info, err := cl.ControlInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, info.OK)
+}
+
+func TestControlContract_Logging(t *testing.T) {
+	cl, _ := newContractClient(t)
+	ctx := context.Background()
+
+	page, err := cl.Logs(ctx, client.LogsRequest{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Lines, 1)
+	assert.Contains(t, page.Lines[0].Text, "hello")
+
+	_, err = cl.Logs(ctx, client.LogsRequest{Level: "loud"})
+	assert.ErrorContains(t, err, "invalid level")
+
+	levels, err := cl.SetLogLevel(ctx, client.LogLevelRequest{Component: "rpc", Level: "debug"})
+	require.NoError(t, err)
+	assert.Contains(t, levels.Levels, types.LevelSetting{Component: "rpc", Level: "debug"})
+
+	levels, err = cl.LogLevels(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "info", levels.Levels[0].Level)
+}
+
+func TestControlContract_Audit(t *testing.T) {
+	cl, _ := newContractClient(t)
+	ctx := context.Background()
+
+	_, err := cl.Pause(ctx, client.PauseRequest{Name: "scraper", Reason: "maintenance"})
+	require.NoError(t, err)
+	_, err = cl.Status(ctx, "scraper")
+	require.NoError(t, err)
+	_, err = cl.LogLevels(ctx)
+	require.NoError(t, err)
+	_, err = cl.SetLogLevel(ctx, client.LogLevelRequest{Level: "loud"})
+	require.Error(t, err)
+	_, err = cl.ChainAdd(ctx, "http://127.0.0.1:1/v3/secret-key")
+	require.Error(t, err)
+
+	page, err := cl.Audit(ctx, client.AuditRequest{})
+	require.NoError(t, err)
+	var actions []string
+	for _, e := range page.Entries {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{"pause", "log_level", "chain_add"}, actions, "reads are not audited")
+
+	pause := page.Entries[0]
+	assert.Equal(t, "/pause", pause.Endpoint)
+	assert.Equal(t, audit.OutcomeOk, pause.Outcome)
+	assert.Equal(t, map[string]string{"name": "scraper", "reason": "maintenance"}, pause.Params)
+	assert.NotEmpty(t, pause.Remote)
+
+	assert.Equal(t, audit.OutcomeError, page.Entries[1].Outcome)
+	assert.Equal(t, http.StatusBadRequest, page.Entries[1].Status)
+	assert.Equal(t, "http://127.0.0.1:1/"+audit.Redacted, page.Entries[2].Params["rpc"])
+
+	page, err = cl.Audit(ctx, client.AuditRequest{Action: "pause", Since: "1h"})
+	require.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
+
+	_, err = cl.Audit(ctx, client.AuditRequest{Limit: -1, Since: "yesterday"})
+	assert.ErrorContains(t, err, "invalid time")
+}
+
+func TestControlContract_AuditPost(t *testing.T) {
+	cl, _ := newContractClient(t)
+	ctx := context.Background()
+
+	for _, path := range []string{"/pause?name=monitor", "/unpause?name=monitor"} {
+		resp, err := http.Post(cl.BaseURL+path, "", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	page, err := cl.Audit(ctx, client.AuditRequest{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2, "POSTed pauses and unpauses are audited")
+	assert.Equal(t, "pause", page.Entries[0].Action)
+	assert.Equal(t, http.MethodPost, page.Entries[0].Method)
+	assert.Equal(t, map[string]string{"name": "monitor"}, page.Entries[0].Params)
+	assert.Equal(t, "unpause", page.Entries[1].Action)
+}
+
+func TestControlContract_ConfigHistory(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+
+	history, err := cl.ConfigHistory(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, history.Generations)
+
+	fn := types.GetConfigFnNoCreate()
+	require.NoError(t, k.config.WriteToFile(fn))
+	_, _, err = install.RecordGeneration(install.SourceWizard, "")
+	require.NoError(t, err)
+	edited := *k.config
+	edited.Logging.Level = "debug"
+	require.NoError(t, edited.WriteToFile(fn))
+	_, _, err = install.RecordGeneration(install.SourceCLI, "config edit")
+	require.NoError(t, err)
+
+	history, err = cl.ConfigHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, history.Generations, 2)
+	assert.Equal(t, 2, history.Generations[0].ID, "newest first")
+	assert.Equal(t, install.SourceCLI, history.Generations[0].Source)
+
+	diff, err := cl.ConfigDiff(ctx, 1)
+	require.NoError(t, err)
+	assert.Contains(t, diff.Diff, `+  level: "debug"`)
+
+	_, err = cl.ConfigDiff(ctx, 9)
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	res, err := cl.ConfigRollback(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Generation.ID)
+	assert.Equal(t, install.SourceAPI, res.Generation.Source)
+	assert.Equal(t, "info", k.config.Logging.Level, "the daemon reloads the restored config")
+
+	page, err := cl.Audit(ctx, client.AuditRequest{Action: "config_rollback"})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, map[string]string{"gen": "1"}, page.Entries[0].Params)
+
+	// A generation that would not load is not restored
+	current, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	edited.Logging.Level = "loud"
+	require.NoError(t, edited.WriteToFile(fn))
+	_, _, err = install.RecordGeneration(install.SourceCLI, "config edit")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fn, current, 0o600))
+	_, _, err = install.RecordGeneration(install.SourceCLI, "")
+	require.NoError(t, err)
+	_, err = cl.ConfigRollback(ctx, 4)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.ErrorContains(t, err, "validation error")
+	after, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal(t, string(current), string(after))
+}
+
+func TestControlContract_ConfigReload(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+	t.Setenv("TB_SETTINGS_INDEXPATH", k.config.IndexPath())
+	t.Setenv("TB_SETTINGS_CACHEPATH", k.config.CachePath())
+
+	// khedra data move rewrites config.yaml and then asks the daemon to reload it
+	require.NoError(t, k.config.WriteToFile(types.GetConfigFnNoCreate()))
+	moved := filepath.Join(filepath.Dir(k.config.General.DataFolder), "moved")
+	require.NoError(t, os.MkdirAll(moved, 0755))
+	_, _, err := install.SetDataFolder(moved, install.SourceCLI)
+	require.NoError(t, err)
+
+	res, err := cl.ConfigReload(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, moved, res.DataFolder)
+	assert.Equal(t, moved, k.config.General.DataFolder)
+	assert.Equal(t, filepath.Join(moved, "unchained"), os.Getenv("TB_SETTINGS_INDEXPATH"), "chifra follows the new folder")
+	assert.Equal(t, filepath.Join(moved, "cache"), os.Getenv("TB_SETTINGS_CACHEPATH"))
+
+	page, err := cl.Audit(ctx, client.AuditRequest{Action: "config_reload"})
+	require.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
+}
+
+func TestControlContract_RpcCapabilities(t *testing.T) {
+	cl, _ := newContractClient(t)
+	ctx := context.Background()
+
+	// A node that answers every single call but no batches
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer node.Close()
+
+	caps, err := cl.RpcCapabilities(ctx, node.URL)
+	require.NoError(t, err)
+	assert.Empty(t, caps.Missing())
+	assert.Empty(t, caps.Warnings)
+	for _, f := range caps.Features {
+		if f.Name == install.FeatureBatch {
+			assert.Equal(t, install.CapabilityFail, f.Status)
+		} else {
+			assert.Equal(t, install.CapabilityPass, f.Status, f.Name)
+		}
+	}
+
+	_, err = cl.RpcCapabilities(ctx, "ftp://node.example")
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestControlContract_IndexVerify(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+
+	_, err := cl.IndexJob(ctx)
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	_, err = cl.IndexVerify(ctx, client.IndexVerifyRequest{Chains: []string{"nowhere"}})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+	// One published chunk whose bloom has gone missing
+	folder := index.ChainFolder(k.config.IndexPath(), "mainnet")
+	data := []byte("chunk")
+	hash, err := index.ReaderCID(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(folder, "finalized"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(folder, "finalized", "000000000-000000099.bin"), data, 0644))
+	man, _ := json.Marshal(index.Manifest{Chain: "mainnet", Chunks: []index.ManifestChunk{
+		{Range: "000000000-000000099", BloomHash: "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH", IndexHash: hash, IndexSize: int64(len(data))},
+	}})
+	require.NoError(t, os.WriteFile(index.ManifestPath(k.config.IndexPath(), "mainnet"), man, 0644))
+
+	job, err := cl.IndexVerify(ctx, client.IndexVerifyRequest{Chains: []string{"mainnet"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, job.ID)
+	assert.Equal(t, []string{"mainnet"}, job.Chains)
+
+	require.Eventually(t, func() bool {
+		job, err = cl.IndexJob(ctx)
+		return err == nil && job.State != client.JobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, client.JobDone, job.State)
+	require.Len(t, job.Reports, 1)
+	require.Len(t, job.Reports[0].Problems, 1)
+	assert.Equal(t, index.ProblemMissing, job.Reports[0].Problems[0].Kind)
+	assert.NotEmpty(t, job.Events)
+	require.Len(t, job.Progress, 1)
+	assert.Equal(t, 2, job.Progress[0].Done)
+
+	_, err = cl.IndexCancel(ctx)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+
+	page, err := cl.Audit(ctx, client.AuditRequest{Action: "index_verify"})
+	require.NoError(t, err)
+	assert.Len(t, page.Entries, 3, "starts and cancels are audited, refused ones too")
+
+	// A repair unpauses the scraper only if nobody paused it meanwhile
+	run := &indexVerifyRun{}
+	repair := control.Pause{Reason: "index repair (job 2)", Since: time.Now().UTC()}
+	_, err = k.serviceManager.Pause("scraper")
+	require.NoError(t, err)
+	k.recordPause("scraper", repair)
+	_, err = cl.Pause(ctx, client.PauseRequest{Name: "scraper", Reason: "maintenance"})
+	require.NoError(t, err)
+	k.endRepairPause(run, repair)
+	info, ok := k.pauses.Info("scraper")
+	require.True(t, ok)
+	assert.Equal(t, "maintenance", info.Reason)
+
+	_, err = cl.Unpause(ctx, "scraper")
+	require.NoError(t, err)
+	_, _ = k.serviceManager.Pause("scraper")
+	k.recordPause("scraper", repair)
+	k.endRepairPause(run, repair)
+	_, ok = k.pauses.Info("scraper")
+	assert.False(t, ok)
+	results, err := cl.Status(ctx, "scraper")
+	require.NoError(t, err)
+	assert.Contains(t, results, client.ServiceResult{Name: "scraper", Status: "running"})
+}
+
+func TestControlContract_Cache(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+
+	_, err := cl.CacheStats(ctx, false)
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode, "nothing is known before the first measurement")
+
+	// Two files of 600 KB for mainnet, the older one used a week ago
+	const size = 600 * 1024
+	for i, age := range []time.Duration{7 * 24 * time.Hour, time.Hour} {
+		fn := filepath.Join(k.config.CachePath(), "mainnet", "blocks", fmt.Sprintf("%d.bin", i))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		require.NoError(t, os.WriteFile(fn, make([]byte, size), 0644))
+		used := time.Now().Add(-age)
+		require.NoError(t, os.Chtimes(fn, used, used))
+	}
+
+	stats, err := cl.CacheStats(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*size), stats.Stats.Chain("mainnet").Bytes)
+	assert.False(t, stats.Policy.Limited())
+	assert.Nil(t, stats.LastPrune)
+
+	state, err := cl.DashboardState(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, state.Cache)
+	assert.Equal(t, int64(2*size), state.Cache.Bytes)
+	for _, ch := range state.Chains {
+		if ch.Name == "mainnet" {
+			assert.Equal(t, int64(2*size), ch.CacheBytes)
+		}
+	}
+
+	k.config.Cache.MaxChainSize = 1
+	res, err := cl.CachePrune(ctx, true)
+	require.NoError(t, err)
+	assert.True(t, res.DryRun)
+	assert.Equal(t, 1, res.Removed.Files)
+	assert.FileExists(t, filepath.Join(k.config.CachePath(), "mainnet", "blocks", "0.bin"), "a dry run removes nothing")
+
+	res, err = cl.CachePrune(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Reasons[cache.ReasonChain].Files)
+	assert.NoFileExists(t, filepath.Join(k.config.CachePath(), "mainnet", "blocks", "0.bin"), "the least recently used file goes first")
+	assert.FileExists(t, filepath.Join(k.config.CachePath(), "mainnet", "blocks", "1.bin"))
+
+	stats, err = cl.CacheStats(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), stats.Stats.Total.Bytes)
+	require.NotNil(t, stats.LastPrune)
+	assert.Equal(t, int64(size), stats.LastPrune.Removed.Bytes)
+
+	page, err := cl.Audit(ctx, client.AuditRequest{Action: "cache_prune"})
+	require.NoError(t, err)
+	assert.Len(t, page.Entries, 2)
+
+	// The periodic prune waits while `data move` or `backup` holds every service
+	_, err = cl.Unpause(ctx, "all")
+	require.NoError(t, err)
+	assert.False(t, k.servicesPaused())
+	_, err = cl.Pause(ctx, client.PauseRequest{Name: "scraper"})
+	require.NoError(t, err)
+	assert.False(t, k.servicesPaused(), "one paused service does not stop the pruner")
+	_, err = cl.Pause(ctx, client.PauseRequest{Name: "all"})
+	require.NoError(t, err)
+	assert.True(t, k.servicesPaused())
+}
+
+func TestControlContract_RpcBudgets(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+
+	list, err := cl.RpcBudgets(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list, "no budgets before the daemon starts them")
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	t.Cleanup(node.Close)
+	ch := k.config.Chains["mainnet"]
+	ch.RPCs = []string{node.URL}
+	ch.Budgets = []types.RPCBudget{{RPC: node.URL, MaxRPS: 100, DailyQuota: 1}}
+	k.config.Chains["mainnet"] = ch
+
+	k.budgets, err = budget.New(http.DefaultTransport, control.BudgetsPath(), nil)
+	require.NoError(t, err)
+	k.budgets.Configure(k.config.Chains)
+	rpc := &http.Client{Transport: k.budgets}
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := rpc.Post(node.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, want, resp.StatusCode, "request %d", i)
+	}
+
+	list, err = cl.RpcBudgets(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "mainnet", list[0].Chain)
+	assert.Equal(t, int64(1), list[0].Today)
+	assert.Equal(t, int64(1), list[0].Refused)
+	assert.True(t, list[0].Exhausted)
+
+	state, err := cl.DashboardState(ctx)
+	require.NoError(t, err)
+	assert.Len(t, state.Budgets, 1)
+	for _, c := range state.Chains {
+		assert.Equal(t, c.Name == "mainnet", c.OutOfQuota, c.Name)
+	}
+}
+
+func TestControlContract_ChainQuarantine(t *testing.T) {
+	cl, k := newContractClient(t)
+	ctx := context.Background()
+
+	// A Sepolia endpoint configured for mainnet
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xaa36a7"}`))
+	}))
+	t.Cleanup(node.Close)
+	ch := k.config.Chains["mainnet"]
+	ch.RPCs = []string{node.URL}
+	k.config.Chains["mainnet"] = ch
+
+	k.chainGuard = chainguard.New(nil)
+	k.chainGuard.Configure(k.config.Chains)
+	k.chainGuard.Check(ctx)
+
+	state, err := cl.DashboardState(ctx)
+	require.NoError(t, err)
+	require.Len(t, state.ChainEvents, 1)
+	assert.Equal(t, "mainnet", state.ChainEvents[0].Chain)
+	assert.True(t, state.ChainEvents[0].Quarantined)
+	for _, c := range state.Chains {
+		if c.Name == "mainnet" {
+			assert.Contains(t, c.Quarantine, "expects chain ID 1 but")
+		} else {
+			assert.Empty(t, c.Quarantine, c.Name)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// addHandler registers a control endpoint and counts its requests for /metrics.
+// The endpoint is also added to k.routes, which serves khedra's own routes
+// without the SDK listener (the contract tests use it).
+func (k *KhedraApp) addHandler(pattern string, h http.HandlerFunc) {
+	counted := countRequests(pattern, h)
+	k.controlSvc.AddHandler(pattern, counted)
+	if k.routes == nil {
+		k.routes = http.NewServeMux()
+	}
+	k.routes.HandleFunc(pattern, counted)
+}
+
+// addServiceHandlers takes over the SDK's service endpoints (/status, /isPaused,
+// /pause, /unpause and /restart). The SDK registers them without a method, so
+// these GET and POST routes are more specific and win. The responses match the
+// SDK's, and routing them here lets khedra count requests and restarts, save
+// pauses and audit the requests that change something.
+func (k *KhedraApp) addServiceHandlers() {
+	routes := []struct {
+		path    string
+		verb    string
+		quiet   bool
+		op      func(name string) ([]map[string]string, error)
+		defName string
+	}{
+		{"/status", "status", true, func(n string) ([]map[string]string, error) { return k.serviceManager.IsPaused(n) }, ""},
+		{"/isPaused", "status", true, func(n string) ([]map[string]string, error) { return k.serviceManager.IsPaused(n) }, ""},
+		{"/pause", "pause", false, func(n string) ([]map[string]string, error) { return k.serviceManager.Pause(n) }, ""},
+		{"/unpause", "unpause", false, func(n string) ([]map[string]string, error) { return k.serviceManager.Unpause(n) }, ""},
+		{"/restart", "restart", false, func(n string) ([]map[string]string, error) { return k.serviceManager.Restart(n) }, "all"},
+	}
+
+	for _, rt := range routes {
+		h := func(w http.ResponseWriter, r *http.Request) {
+			log := k.logger.Component(types.ComponentControl)
+			w.Header().Set("Content-Type", "application/json")
+
+			name := r.URL.Query().Get("name")
+			if name == "" {
+				name = rt.defName
+			}
+			if rt.quiet {
+				log.Debug("Received "+rt.verb+" request", "service", name, "remote_addr", r.RemoteAddr)
+			} else {
+				log.Info("Received "+rt.verb+" request", "service", name, "remote_addr", r.RemoteAddr)
+			}
+
+			var pause control.Pause
+			if rt.verb == "pause" {
+				var err error
+				if pause, err = pauseFromRequest(r, time.Now()); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+					return
+				}
+			}
+
+			if k.serviceManager == nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: "Service manager not attached"})
+				return
+			}
+
+			results, err := rt.op(name)
+			if err != nil {
+				log.Error("Service "+rt.verb+" request failed", "service", name, "error", err.Error())
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+				return
+			}
+
+			out := make([]client.ServiceResult, 0, len(results))
+			for _, result := range results {
+				out = append(out, client.ServiceResult{Name: result["name"], Status: result["status"]})
+				if !rt.quiet {
+					log.Info("Service "+rt.verb+" result", "service", result["name"], "status", result["status"])
+				}
+				switch {
+				case rt.verb == "restart" && result["status"] == "restarted":
+					serviceRestarts.Inc(result["name"])
+				case rt.verb == "pause" && strings.HasSuffix(result["status"], "paused"):
+					k.recordPause(result["name"], pause)
+				case rt.verb == "unpause" && (result["status"] == "unpaused" || result["status"] == "already running"):
+					k.recordUnpause(result["name"])
+				}
+			}
+			_ = json.NewEncoder(w).Encode(out)
+		}
+		if !rt.quiet {
+			h = k.audited(rt.verb, h)
+		}
+		k.addHandler("GET "+rt.path, h)
+		k.addHandler("POST "+rt.path, h)
+	}
+}
+
+// pauseFromRequest reads the optional reason and for (a duration) query
+// parameters of a /pause request.
+func pauseFromRequest(r *http.Request, now time.Time) (control.Pause, error) {
+	v := r.URL.Query()
+	p := control.Pause{Reason: strings.TrimSpace(v.Get("reason"))}
+	if s := v.Get("for"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return control.Pause{}, fmt.Errorf("invalid duration %q", s)
+		}
+		p.Until = now.Add(d).UTC()
+	}
+	return p, nil
+}
+
+// pauseExpiries holds a timer for each pause that has an expiry.
+type pauseExpiries struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// recordPause saves a pause so it survives a restart and schedules its expiry.
+func (k *KhedraApp) recordPause(name string, p control.Pause) {
+	k.pauses.PauseWith(p, name)
+	k.schedulePauseExpiry(name, p)
+}
+
+// recordUnpause forgets a saved pause and cancels its expiry.
+func (k *KhedraApp) recordUnpause(name string) {
+	k.pauses.Unpause(name)
+	k.schedulePauseExpiry(name, control.Pause{})
+}
+
+// schedulePauseExpiries starts timers for the saved pauses that have an expiry.
+func (k *KhedraApp) schedulePauseExpiries() {
+	for name, p := range k.pauses.Pauses() {
+		k.schedulePauseExpiry(name, p)
+	}
+}
+
+// schedulePauseExpiry replaces name's expiry timer with one for p (none if p
+// has no expiry).
+func (k *KhedraApp) schedulePauseExpiry(name string, p control.Pause) {
+	k.expiries.mu.Lock()
+	defer k.expiries.mu.Unlock()
+	if t := k.expiries.timers[name]; t != nil {
+		t.Stop()
+		delete(k.expiries.timers, name)
+	}
+	if p.Until.IsZero() {
+		return
+	}
+	if k.expiries.timers == nil {
+		k.expiries.timers = map[string]*time.Timer{}
+	}
+	k.expiries.timers[name] = time.AfterFunc(time.Until(p.Until), func() {
+		k.expirePause(name, p.Until)
+	})
+}
+
+// expirePause unpauses name if the pause that expired is still the current one.
+func (k *KhedraApp) expirePause(name string, until time.Time) {
+	if cur, ok := k.pauses.Info(name); !ok || !cur.Until.Equal(until) {
+		return
+	}
+	log := k.logger.Component(types.ComponentControl)
+	results, err := k.serviceManager.Unpause(name)
+	if err != nil {
+		log.Error("Could not unpause service after pause expired", "service", name, "error", err.Error())
+		return
+	}
+	for _, result := range results {
+		log.Info("Pause expired", "service", result["name"], "status", result["status"])
+	}
+	k.pauses.Unpause(name)
+}
@@ -1,15 +1,16 @@
 package app
 
 import (
-	"bytes"
 	"fmt"
-	"html/template"
-	"net/url"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/bootstrap"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chifra"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 )
 
@@ -18,6 +19,9 @@ type DaemonBootstrapper struct {
 	config     *types.Config
 	rootFolder string
 	logger     *types.CustomLogger
+	offline    bool              // never download bootstrap assets from GitHub
+	prune      bool              // delete the chunks an index plan no longer wants
+	assets     []bootstrap.Asset // where each chain's bootstrap assets came from
 }
 
 // NewDaemonBootstrapper creates a new bootstrapper instance
@@ -47,105 +51,157 @@ func (db *DaemonBootstrapper) ValidateEnvironment() error {
 	return nil
 }
 
-// EnsureConfig creates or validates the chifra config file
+// EnsureConfig brings chifra's trueBlocks.toml in line with khedra's config,
+// creating it if needed. khedra owns the paths and each chain's name, id and
+// RPCs, and sets the default chain only if the file has none; everything else
+// in the file belongs to the user and is kept. Only the lines of changed keys
+// are rewritten, so comments and order survive. Each change is logged, and the
+// previous file is kept as trueBlocks.toml.bak.
 func (db *DaemonBootstrapper) EnsureConfig() error {
-	configFn := filepath.Join(db.rootFolder, "trueBlocks.toml")
-
-	if file.FileExists(configFn) {
-		db.logger.Info("Config file found", "fn", configFn)
-		if !db.chainsConfigured(configFn) {
-			db.logger.Error("Config file not configured", "fn", configFn)
-			return fmt.Errorf("config file not configured")
-		}
-		return nil
-	}
-
-	db.logger.Warn("Config file not found", "fn", configFn)
-	if err := db.createChifraConfig(); err != nil {
-		db.logger.Error("Error creating config file", "error", err)
-		return err
-	}
-
-	return nil
-}
-
-// chainsConfigured validates that all enabled chains have config sections
-func (db *DaemonBootstrapper) chainsConfigured(configFn string) bool {
-	chainStr := db.config.EnabledChains()
-	chains := strings.Split(chainStr, ",")
-
-	db.logger.Info("chifra config loaded")
-	db.logger.Info("checking", "configFile", configFn, "nChains", len(chains))
-
-	contents := file.AsciiFileToString(configFn)
-	for _, chain := range chains {
-		search := "[chains." + chain + "]"
-		if !strings.Contains(contents, search) {
-			msg := fmt.Sprintf("config file {%s} does not contain {%s}", configFn, search)
-			db.logger.Error(msg)
-			return false
-		}
-	}
-	return true
-}
-
-// createChifraConfig generates a new trueBlocks.toml config file
-func (db *DaemonBootstrapper) createChifraConfig() error {
+	configFn := filepath.Join(db.rootFolder, chifra.FileName)
 	if err := file.EstablishFolder(db.rootFolder); err != nil {
 		return err
 	}
 
-	chainStr := db.config.EnabledChains()
-	chains := strings.Split(chainStr, ",")
-	for _, chain := range chains {
+	enabled := strings.Split(db.config.EnabledChains(), ",")
+	sort.Strings(enabled)
+	db.assets = nil
+	for _, chain := range enabled {
+		if chain == "" {
+			continue
+		}
 		if err := db.createChainConfigFolder(chain); err != nil {
 			return err
 		}
 	}
 
-	tmpl, err := template.New("tmpl").Parse(configTmpl)
+	existing, err := chifra.Load(configFn)
 	if err != nil {
+		db.logger.Error("Cannot read config file; not changing it", "fn", configFn, "error", err)
 		return err
 	}
+	synced := db.syncChifraConfig(existing)
+	changes := synced.Diff(existing)
+	if len(changes) == 0 {
+		db.logger.Info("Config file up to date", "fn", configFn)
+		return nil
+	}
 
-	var buf bytes.Buffer
-	if err = tmpl.Execute(&buf, db.config); err != nil {
+	if file.FileExists(configFn) {
+		if _, err := file.Copy(configFn+".bak", configFn); err != nil {
+			return fmt.Errorf("cannot back up %s: %w", configFn, err)
+		}
+	}
+	kept, err := synced.Save(configFn)
+	if err != nil {
+		db.logger.Error("Error writing config file", "fn", configFn, "error", err)
 		return err
 	}
-	if len(buf.String()) == 0 {
-		return fmt.Errorf("empty config file")
+	if !kept {
+		db.logger.Warn("Config file rewritten without its comments or key order; the original is in the backup", "fn", configFn, "backup", configFn+".bak")
+	}
+	for _, c := range changes {
+		db.logger.Info("Config file changed", "fn", configFn, "change", c.String())
 	}
+	return nil
+}
 
-	configFn := filepath.Join(db.rootFolder, "trueBlocks.toml")
-	err = file.StringToAsciiFile(configFn, buf.String())
-	if err != nil {
-		return err
+// syncChifraConfig returns a copy of cfg with the khedra-managed keys set.
+// Symbols and explorers are only filled in when the file has none.
+func (db *DaemonBootstrapper) syncChifraConfig(cfg *chifra.Config) *chifra.Config {
+	out := cfg.Clone()
+	out.SetDefault(db.config.Version(), "version", "current")
+	out.Set(db.config.CachePath(), "settings", "cachePath")
+	out.Set(db.config.IndexPath(), "settings", "indexPath")
+	out.SetDefault("mainnet", "settings", "defaultChain")
+
+	for name, ch := range db.config.Chains {
+		// chifra speaks HTTP only; khedra keeps the WebSocket RPCs to itself
+		httpRPCs := ch.HttpRPCs()
+		if len(httpRPCs) == 0 {
+			continue
+		}
+		out.Set(name, "chains", name, "chain")
+		out.Set(strconv.Itoa(ch.ChainID), "chains", name, "chainId")
+		out.Set(httpRPCs[0], "chains", name, "rpcProvider")
+		// chifra prefers rpcProviders over rpcProvider when both are present
+		if _, ok := out.Get("chains", name, "rpcProviders"); ok || len(httpRPCs) > 1 {
+			rpcs := make([]any, 0, len(httpRPCs))
+			for _, rpc := range httpRPCs {
+				rpcs = append(rpcs, rpc)
+			}
+			out.Set(rpcs, "chains", name, "rpcProviders")
+		}
+		if v := ch.RemoteExplorer(); v != "Unknown" {
+			out.SetDefault(v, "chains", name, "remoteExplorer")
+		}
+		if v := ch.Symbol(); v != "Unknown" {
+			out.SetDefault(v, "chains", name, "symbol")
+		}
+	}
+	return out
+}
+
+// ApplyIndexPlans brings each enabled chain's index in line with the
+// configured strategy and detail before the scraper starts: it logs what will
+// be downloaded, built or deleted and records the new mode. Chunks that are no
+// longer wanted are removed, each one logged, only if db.prune is set (daemon
+// --prune-chunks); otherwise the plan is left pending and logged again at the
+// next start.
+func (db *DaemonBootstrapper) ApplyIndexPlans() error {
+	log := db.logger.Component(types.ComponentScraper)
+	for _, p := range install.PlanIndex(*db.config, install.CachedChainInputs(*db.config)) {
+		if !p.Changed() {
+			log.Info("Index mode unchanged", "chain", p.Chain, "mode", p.To.String())
+			continue
+		}
+		from := "none"
+		if p.From != nil {
+			from = p.From.String()
+		}
+		log.Info("Index mode changed", "chain", p.Chain, "from", from, "to", p.To.String(), "initMode", p.InitMode)
+		for _, step := range p.Steps {
+			log.Info("Index plan", "chain", p.Chain, "step", step)
+		}
+		if len(p.Delete) > 0 && !db.prune {
+			log.Warn("Not deleting chunks the new index mode does not need; restart the daemon with --prune-chunks to remove them",
+				"chain", p.Chain, "chunks", len(p.Delete), "gb", fmt.Sprintf("%.1f", float64(p.DeleteBytes)/1e9))
+			continue
+		}
+		removed := func(fn string) { log.Info("Removed index chunk", "chain", p.Chain, "file", fn) }
+		if err := install.ApplyIndexPlan(db.config.IndexPath(), p, removed); err != nil {
+			return fmt.Errorf("cannot apply the index plan for %s: %w", p.Chain, err)
+		}
 	}
-	db.logger.Info("Created config file", "configFile", configFn, "nChains", len(chains))
 	return nil
 }
 
-// createChainConfigFolder creates the chain-specific config folder and downloads allocs.csv
+// createChainConfigFolder creates the chain-specific config folder and fills
+// in its bootstrap assets (allocs.csv) from the folder itself, the configured
+// mirror, the copies bundled into khedra or GitHub, in that order.
 func (db *DaemonBootstrapper) createChainConfigFolder(chain string) error {
 	chainConfig := filepath.Join(db.rootFolder, "config", chain)
 	if err := file.EstablishFolder(chainConfig); err != nil {
 		return fmt.Errorf("failed to create folder %s: %w", chainConfig, err)
 	}
 
-	baseURL := "https://raw.githubusercontent.com/TrueBlocks/trueblocks-core/refs/heads/master/src/other/install/per-chain"
-	allocURL, err := url.JoinPath(baseURL, chain, "allocs.csv")
+	assets, err := bootstrap.Fetch(chain, chainConfig, bootstrap.Options{
+		Mirror:  db.config.General.BootstrapMirror,
+		Offline: db.offline,
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to write bootstrap assets to %s: %w", chainConfig, err)
 	}
-	allocFn := filepath.Join(chainConfig, "allocs.csv")
-	dur := 100 * 365 * 24 * time.Hour // 100 years
-	if _, err := downloadAndStore(allocURL, allocFn, dur); err != nil {
-		db.logger.Warn(fmt.Errorf("failed to download and store allocs.csv for chain %s: %w", chain, err).Error())
-		// It's not an error to not have an allocation file. IsArchiveNode assumes archive if not present.
-		return nil
+	for _, a := range assets {
+		switch a.Source {
+		case bootstrap.SourceMissing:
+			// chifra assumes an archive node when it has no allocations
+			db.logger.Warn("Bootstrap asset not found; chifra will assume an archive node", "chain", chain, "asset", a.Name, "error", a.Error)
+		case bootstrap.SourceCached:
+		default:
+			db.logger.Progress("Bootstrap asset", "chain", chain, "asset", a.Name, "source", a.Source, "from", a.From)
+		}
 	}
-	db.logger.Progress("Creating chain config", "chainConfig", allocFn)
-	db.logger.Progress("Creating chain config", "source", allocURL)
-
+	db.assets = append(db.assets, assets...)
 	return nil
 }
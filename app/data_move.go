@@ -0,0 +1,66 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/config"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// switchDataFolder points config.yaml and chifra's trueBlocks.toml at a new
+// data folder once its trees are in place. If trueBlocks.toml cannot be
+// synced, config.yaml is put back so the two never disagree.
+func switchDataFolder(folder string, logger *types.CustomLogger) error {
+	original, _, err := install.SetDataFolder(folder, install.SourceCLI)
+	if err != nil {
+		return fmt.Errorf("cannot update config.yaml: %w", err)
+	}
+	cfg, err := LoadConfig()
+	if err == nil {
+		bootstrapper := NewDaemonBootstrapper(&cfg, config.PathToRootConfig(), logger)
+		bootstrapper.offline = true
+		err = bootstrapper.EnsureConfig()
+	}
+	if err != nil {
+		if rerr := install.RestoreConfig(original, install.SourceCLI); rerr != nil {
+			return fmt.Errorf("cannot update trueBlocks.toml (%w) or put back config.yaml: %v", err, rerr)
+		}
+		return fmt.Errorf("cannot update trueBlocks.toml, config.yaml was put back: %w", err)
+	}
+	return nil
+}
+
+// useDataFolder points chifra, which the services run on, at the configured
+// index and cache folders.
+func (k *KhedraApp) useDataFolder() {
+	os.Setenv("TB_SETTINGS_INDEXPATH", k.config.IndexPath())
+	os.Setenv("TB_SETTINGS_CACHEPATH", k.config.CachePath())
+	config.ReloadConfig()
+}
+
+// handleConfigReload serves /config/reload: it loads config.yaml again after
+// a change made on disk (such as khedra data move) and, if the data folder
+// changed, points chifra at the new one.
+func (k *KhedraApp) handleConfigReload(w http.ResponseWriter, r *http.Request) {
+	_ = r
+	w.Header().Set("Content-Type", "application/json")
+	before := ""
+	if k.config != nil {
+		before = k.config.General.DataFolder
+	}
+	if err := k.reloadConfig(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: fmt.Sprintf("config could not be loaded: %s", err)})
+		return
+	}
+	if folder := k.config.General.DataFolder; folder != before {
+		k.useDataFolder()
+		k.logger.Info("Data folder changed", "from", before, "to", folder)
+	}
+	_ = json.NewEncoder(w).Encode(client.ConfigReloadResult{DataFolder: k.config.General.DataFolder})
+}
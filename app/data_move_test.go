@@ -0,0 +1,48 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chifra"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func TestSwitchDataFolder(t *testing.T) {
+	rootFolder, cleanup := setupTestEnv(t)
+	defer cleanup()
+	fn := filepath.Join(rootFolder, "config.yaml")
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", fn)
+
+	cfg := types.NewConfig()
+	cfg.General.DataFolder = filepath.Join(rootFolder, "old")
+	cfg.Logging.Folder = filepath.Join(rootFolder, "logs")
+	moved := filepath.Join(rootFolder, "moved")
+	for _, dir := range []string{cfg.General.DataFolder, cfg.Logging.Folder, moved} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	require.NoError(t, cfg.WriteToFile(fn))
+	logger := types.NewLogger(types.Logging{Level: "error"})
+
+	require.NoError(t, switchDataFolder(moved, logger))
+	loaded, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, moved, loaded.General.DataFolder)
+	toml, err := chifra.Load(filepath.Join(rootFolder, chifra.FileName))
+	require.NoError(t, err)
+	v, _ := toml.Get("settings", "indexPath")
+	assert.Equal(t, filepath.Join(moved, "unchained"), v)
+	v, _ = toml.Get("settings", "cachePath")
+	assert.Equal(t, filepath.Join(moved, "cache"), v)
+
+	// If trueBlocks.toml cannot be updated, config.yaml is put back
+	before := file.AsciiFileToString(fn)
+	require.NoError(t, os.WriteFile(filepath.Join(rootFolder, chifra.FileName), []byte("not [toml"), 0o644))
+	require.Error(t, switchDataFolder(cfg.General.DataFolder, logger))
+	assert.Equal(t, before, file.AsciiFileToString(fn))
+}
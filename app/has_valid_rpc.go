@@ -4,8 +4,10 @@ import (
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 )
 
+// HasValidRpc reports whether any of the chain's HTTP RPCs, the ones chifra
+// scrapes through, answers.
 func HasValidRpc(ch *types.Chain, tries int) bool {
-	for _, rpc := range ch.RPCs {
+	for _, rpc := range ch.HttpRPCs() {
 		if err := types.TryConnect(ch.Name, rpc, tries); err == nil {
 			return true
 		}
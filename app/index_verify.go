@@ -0,0 +1,305 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/client"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// maxIndexEvents is how many events a job keeps; older ones are dropped.
+const maxIndexEvents = 500
+
+// indexVerifyRun is one check of the index. The daemon runs it in the
+// background and serves snapshots of it; the CLI runs it in the foreground
+// when no daemon is running.
+type indexVerifyRun struct {
+	mu      sync.Mutex
+	job     client.IndexJob
+	req     client.IndexVerifyRequest
+	cancel  context.CancelFunc
+	onEvent func(client.IndexEvent) // called for each event, if set
+	seq     int
+}
+
+// newIndexVerifyRun checks req against cfg and prepares a run. No chains in
+// req means every enabled chain.
+func newIndexVerifyRun(cfg *types.Config, id int, req client.IndexVerifyRequest) (*indexVerifyRun, error) {
+	chains := req.Chains
+	if len(chains) == 0 {
+		for name, ch := range cfg.Chains {
+			if ch.Enabled {
+				chains = append(chains, name)
+			}
+		}
+		slices.Sort(chains)
+	}
+	for _, name := range chains {
+		if _, ok := cfg.Chains[name]; !ok {
+			return nil, fmt.Errorf("chain %q is not configured", name)
+		}
+	}
+	req.Chains = chains
+	return &indexVerifyRun{
+		req: req,
+		job: client.IndexJob{
+			ID:       id,
+			State:    client.JobRunning,
+			Chains:   chains,
+			Repair:   req.Repair,
+			Quick:    req.Quick,
+			Progress: []index.Progress{},
+			Events:   []client.IndexEvent{},
+			Reports:  []index.Report{},
+		},
+	}, nil
+}
+
+func (r *indexVerifyRun) event(chain, format string, args ...any) {
+	r.mu.Lock()
+	r.seq++
+	e := client.IndexEvent{Seq: r.seq, Time: time.Now().UTC(), Chain: chain, Message: fmt.Sprintf(format, args...)}
+	r.job.Events = append(r.job.Events, e)
+	if len(r.job.Events) > maxIndexEvents {
+		r.job.Events = r.job.Events[len(r.job.Events)-maxIndexEvents:]
+	}
+	onEvent := r.onEvent
+	r.mu.Unlock()
+	if onEvent != nil {
+		onEvent(e)
+	}
+}
+
+// progress keeps the latest progress of each chain and adds an event at
+// every tenth of the way.
+func (r *indexVerifyRun) progress(p index.Progress) {
+	r.mu.Lock()
+	i := slices.IndexFunc(r.job.Progress, func(q index.Progress) bool { return q.Chain == p.Chain })
+	if i < 0 {
+		r.job.Progress = append(r.job.Progress, p)
+	} else {
+		r.job.Progress[i] = p
+	}
+	r.mu.Unlock()
+	if p.Total > 0 && p.Done < p.Total && p.Done*10/p.Total != (p.Done-1)*10/p.Total {
+		r.event(p.Chain, "%s: %d of %d files", p.Phase, p.Done, p.Total)
+	}
+}
+
+// snapshot returns a copy of the job that is safe to encode.
+func (r *indexVerifyRun) snapshot() client.IndexJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.job
+	job.Progress = slices.Clone(job.Progress)
+	job.Events = slices.Clone(job.Events)
+	job.Reports = slices.Clone(job.Reports)
+	job.Repairs = slices.Clone(job.Repairs)
+	return job
+}
+
+func (r *indexVerifyRun) running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.job.State == client.JobRunning
+}
+
+// run checks, and with req.Repair repairs, each chain's index in turn.
+func (r *indexVerifyRun) run(ctx context.Context, cfg *types.Config) {
+	r.mu.Lock()
+	r.job.Started = time.Now().UTC()
+	r.mu.Unlock()
+
+	err := r.verifyChains(ctx, cfg)
+
+	r.mu.Lock()
+	r.job.Finished = time.Now().UTC()
+	switch {
+	case errors.Is(err, context.Canceled):
+		r.job.State = client.JobCanceled
+	case err != nil:
+		r.job.State, r.job.Error = client.JobFailed, err.Error()
+	default:
+		r.job.State = client.JobDone
+	}
+	state := r.job.State
+	r.mu.Unlock()
+	if err != nil && state == client.JobFailed {
+		r.event("", "failed: %s", err)
+	} else {
+		r.event("", "%s", state)
+	}
+}
+
+func (r *indexVerifyRun) verifyChains(ctx context.Context, cfg *types.Config) error {
+	indexPath := cfg.IndexPath()
+	for _, chain := range r.req.Chains {
+		bloomsOnly := cfg.General.Detail == "bloom"
+		if m, ok := index.ReadMode(indexPath, chain); ok {
+			bloomsOnly = m.Detail == "bloom"
+		}
+		r.event(chain, "verifying %s", index.ChainFolder(indexPath, chain))
+		rep, err := index.Verify(ctx, indexPath, chain, index.VerifyOptions{BloomsOnly: bloomsOnly, Quick: r.req.Quick, Progress: r.progress})
+		if err != nil {
+			return fmt.Errorf("%s: %w", chain, err)
+		}
+		if !rep.Manifest {
+			r.event(chain, "no manifest; only the locally built files were checked")
+		}
+		r.event(chain, "checked %d published and %d local files: %s", rep.Checked, rep.Local, problemSummary(rep.Problems))
+		r.mu.Lock()
+		r.job.Reports = append(r.job.Reports, rep)
+		r.mu.Unlock()
+
+		if !r.req.Repair || rep.OK() {
+			continue
+		}
+		res, err := index.Repair(ctx, indexPath, rep, index.RepairOptions{Gateway: r.req.Gateway, Offline: r.req.Offline, Progress: r.progress})
+		r.mu.Lock()
+		r.job.Repairs = append(r.job.Repairs, res)
+		r.mu.Unlock()
+		for _, f := range res.Fixes {
+			if f.Error != "" {
+				r.event(chain, "%s %s: %s (%s)", f.Action, f.File, f.Kind, f.Error)
+			} else {
+				r.event(chain, "%s %s: %s", f.Action, f.File, f.Kind)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", chain, err)
+		}
+	}
+	return nil
+}
+
+// problemSummary counts problems by kind, e.g. "2 missing, 1 hash".
+func problemSummary(problems []index.Problem) string {
+	if len(problems) == 0 {
+		return "no problems"
+	}
+	var kinds []string
+	counts := map[string]int{}
+	for _, p := range problems {
+		if counts[p.Kind] == 0 {
+			kinds = append(kinds, p.Kind)
+		}
+		counts[p.Kind]++
+	}
+	parts := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[k], k))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// indexVerifier holds the daemon's running or last check of the index.
+type indexVerifier struct {
+	mu   sync.Mutex
+	last *indexVerifyRun
+}
+
+// handleIndexVerify serves /index/verify: GET returns the running or last
+// check, POST starts one in the background.
+func (k *KhedraApp) handleIndexVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	v := &k.indexVerifier
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		if v.last == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: "the index has not been verified since the daemon started"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(v.last.snapshot())
+		return
+	}
+
+	if v.last != nil && v.last.running() {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: fmt.Sprintf("job %d is still running", v.last.snapshot().ID)})
+		return
+	}
+	q := r.URL.Query()
+	req := client.IndexVerifyRequest{
+		Chains:  q["chain"],
+		Repair:  q.Get("repair") == "true",
+		Quick:   q.Get("quick") == "true",
+		Offline: q.Get("offline") == "true",
+		Gateway: q.Get("gateway"),
+	}
+	id := 1
+	if v.last != nil {
+		id = v.last.snapshot().ID + 1
+	}
+	cfg := k.currentConfig()
+	run, err := newIndexVerifyRun(cfg, id, req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	log := k.logger.Component(types.ComponentScraper)
+	run.onEvent = func(e client.IndexEvent) {
+		log.Info("Index verify", "job", id, "chain", e.Chain, "event", e.Message)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run.cancel = cancel
+	v.last = run
+	run.event("", "started (repair %t, quick %t)", req.Repair, req.Quick)
+
+	go func() {
+		defer cancel()
+		// Files are moved and fetched under the scraper, so it is paused for a repair
+		if req.Repair && k.serviceManager != nil {
+			if res, err := k.serviceManager.IsPaused("scraper"); err == nil && len(res) > 0 && res[0]["status"] == "running" {
+				pause := control.Pause{Reason: fmt.Sprintf("index repair (job %d)", id), Since: time.Now().UTC()}
+				_, _ = k.serviceManager.Pause("scraper")
+				k.recordPause("scraper", pause)
+				run.event("", "scraper paused for the repair")
+				defer k.endRepairPause(run, pause)
+			}
+		}
+		run.run(ctx, cfg)
+	}()
+	_ = json.NewEncoder(w).Encode(run.snapshot())
+}
+
+// endRepairPause unpauses the scraper after a repair, unless it was paused
+// again (or unpaused) by someone else while the repair ran.
+func (k *KhedraApp) endRepairPause(run *indexVerifyRun, pause control.Pause) {
+	if cur, ok := k.pauses.Info("scraper"); !ok || cur.Reason != pause.Reason || !cur.Since.Equal(pause.Since) {
+		run.event("", "scraper left as it is: its pause changed during the repair")
+		return
+	}
+	_, _ = k.serviceManager.Unpause("scraper")
+	k.recordUnpause("scraper")
+	run.event("", "scraper unpaused")
+}
+
+// handleIndexVerifyCancel serves /index/verify/cancel.
+func (k *KhedraApp) handleIndexVerifyCancel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	v := &k.indexVerifier
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.last == nil || !v.last.running() {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: "no check of the index is running"})
+		return
+	}
+	v.last.cancel()
+	_ = json.NewEncoder(w).Encode(v.last.snapshot())
+}
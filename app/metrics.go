@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/disk"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/jsonrpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
+)
+
+var (
+	controlRequests = metrics.Default.NewCounter("khedra_control_requests_total",
+		"Requests served by the control service, by route and status code.", "path", "code")
+	serviceRestarts = metrics.Default.NewCounter("khedra_service_restarts_total",
+		"Services restarted through the control service, by service.", "service")
+	serviceUp = metrics.Default.NewGauge("khedra_service_up",
+		"1 if the service is running under the daemon, 0 if it is configured but not started.", "service")
+	servicePaused = metrics.Default.NewGauge("khedra_service_paused",
+		"1 if the service is paused, by service.", "service")
+	chainHead = metrics.Default.NewGauge("khedra_chain_head_block",
+		"Latest block reported by the chain's first RPC.", "chain")
+	chainIndexed = metrics.Default.NewGauge("khedra_chain_indexed_block",
+		"Latest block covered by the chain's index (finalized chunks or staging).", "chain")
+	chainBehind = metrics.Default.NewGauge("khedra_chain_blocks_behind",
+		"Head block minus last indexed block.", "chain")
+	dataFolderBytes = metrics.Default.NewGauge("khedra_data_folder_bytes",
+		"Bytes used under the data folder, by folder. Refreshed in the background.", "folder")
+	filesystemSize = metrics.Default.NewGauge("khedra_data_filesystem_size_bytes",
+		"Size of the filesystem holding the data folder.")
+	filesystemFree = metrics.Default.NewGauge("khedra_data_filesystem_free_bytes",
+		"Free space on the filesystem holding the data folder.")
+	buildInfo = metrics.Default.NewGauge("khedra_build_info",
+		"Always 1; the version label identifies the running build.", "version")
+)
+
+const (
+	headCacheTTL    = 10 * time.Second
+	headTimeout     = 5 * time.Second
+	dirSizeInterval = 10 * time.Minute
+)
+
+var (
+	metricsApp  atomic.Pointer[KhedraApp]
+	metricsOnce sync.Once
+	heads       headCache
+	dirSizes    dirSizeCache
+)
+
+// registerMetrics points the /metrics collectors at k. Collectors are added to
+// the registry once per process; later calls only swap the app they read from.
+func (k *KhedraApp) registerMetrics() {
+	metricsApp.Store(k)
+	metricsOnce.Do(func() {
+		metrics.Default.OnCollect(func() {
+			if app := metricsApp.Load(); app != nil {
+				app.collectMetrics()
+			}
+		})
+	})
+}
+
+// collectMetrics refreshes the gauges that mirror daemon state.
+func (k *KhedraApp) collectMetrics() {
+	if k.config == nil {
+		return
+	}
+
+	buildInfo.Reset()
+	buildInfo.Set(1, k.config.Version())
+
+	serviceUp.Reset()
+	servicePaused.Reset()
+	running := map[string]bool{}
+	if k.serviceManager != nil {
+		if results, err := k.serviceManager.IsPaused(""); err == nil {
+			for _, result := range results {
+				name := result["name"]
+				running[name] = true
+				serviceUp.Set(1, name)
+				switch result["status"] {
+				case "paused":
+					servicePaused.Set(1, name)
+				case "running":
+					servicePaused.Set(0, name)
+				}
+			}
+		}
+	}
+	for name := range k.config.Services {
+		if !running[name] {
+			serviceUp.Set(0, name)
+		}
+	}
+
+	chainHead.Reset()
+	chainIndexed.Reset()
+	chainBehind.Reset()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for name, ch := range k.config.Chains {
+		if !ch.Enabled {
+			continue
+		}
+		indexed, haveIndexed := index.LatestBlock(k.config.IndexPath(), name)
+		if haveIndexed {
+			chainIndexed.Set(float64(indexed), name)
+		}
+		if len(ch.RPCs) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(name, rpcURL string) {
+			defer wg.Done()
+			head, ok := heads.get(name, rpcURL)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			chainHead.Set(float64(head), name)
+			if haveIndexed && head >= indexed {
+				chainBehind.Set(float64(head-indexed), name)
+			}
+		}(name, ch.RPCs[0])
+	}
+	wg.Wait()
+
+	if u, err := disk.Stat(k.config.General.DataFolder); err == nil {
+		filesystemSize.Set(float64(u.Total))
+		filesystemFree.Set(float64(u.Free))
+	}
+	dataFolderBytes.Reset()
+	for folder, size := range dirSizes.get(map[string]string{
+		"index": k.config.IndexPath(),
+		"cache": k.config.CachePath(),
+	}) {
+		dataFolderBytes.Set(float64(size), folder)
+	}
+}
+
+// headCache remembers each chain's head block briefly so frequent scrapes do
+// not turn into a stream of RPC calls.
+type headCache struct {
+	mu      sync.Mutex
+	entries map[string]headEntry
+}
+
+type headEntry struct {
+	rpc   string
+	block uint64
+	ok    bool
+	at    time.Time
+}
+
+func (c *headCache) get(chain, rpcURL string) (uint64, bool) {
+	c.mu.Lock()
+	e, found := c.entries[chain]
+	c.mu.Unlock()
+	if found && e.rpc == rpcURL && time.Since(e.at) < headCacheTTL {
+		return e.block, e.ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), headTimeout)
+	defer cancel()
+	block, err := jsonrpc.Uint64(ctx, rpcURL, "eth_blockNumber")
+	e = headEntry{rpc: rpcURL, block: block, ok: err == nil, at: time.Now()}
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[string]headEntry{}
+	}
+	c.entries[chain] = e
+	c.mu.Unlock()
+	return e.block, e.ok
+}
+
+// dirSizeCache walks the data folders in the background because a large
+// cache can take minutes to measure.
+type dirSizeCache struct {
+	mu      sync.Mutex
+	sizes   map[string]int64
+	at      time.Time
+	running bool
+}
+
+func (c *dirSizeCache) get(folders map[string]string) map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running && time.Since(c.at) > dirSizeInterval {
+		c.running = true
+		go func() {
+			sizes := map[string]int64{}
+			for name, path := range folders {
+				if n, err := disk.DirSize(path); err == nil {
+					sizes[name] = n
+				}
+			}
+			c.mu.Lock()
+			c.sizes, c.at, c.running = sizes, time.Now(), false
+			c.mu.Unlock()
+		}()
+	}
+	ret := make(map[string]int64, len(c.sizes))
+	for k, v := range c.sizes {
+		ret[k] = v
+	}
+	return ret
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// countRequests wraps h so that each request is counted under route.
+func countRequests(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		h(rec, r)
+		controlRequests.Inc(route, strconv.Itoa(rec.code))
+	}
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func TestCountRequests(t *testing.T) {
+	before := controlRequests.Value("/test-count", "404")
+	h := countRequests("/test-count", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test-count", nil))
+	assert.Equal(t, before+1, controlRequests.Value("/test-count", "404"))
+}
+
+func TestServiceRoutesOverrideSdk(t *testing.T) {
+	// The SDK registers /pause without a method; khedra's GET route must win.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("sdk")) })
+	mux.HandleFunc("GET /pause", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("khedra")) })
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pause?name=scraper", nil))
+	assert.Equal(t, "khedra", rec.Body.String())
+}
+
+func TestCollectMetrics(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x190"}`))
+	}))
+	defer node.Close()
+
+	cfg := types.NewConfig()
+	cfg.General.DataFolder = t.TempDir()
+	cfg.Chains = map[string]types.Chain{
+		"testchain": {Name: "testchain", RPCs: []string{node.URL}, Enabled: true},
+	}
+	staging := filepath.Join(cfg.IndexPath(), "testchain", "staging")
+	require.NoError(t, os.MkdirAll(staging, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(staging, "000000000-000000300.txt"), nil, 0644))
+
+	defer func(rt http.RoundTripper) { http.DefaultTransport = rt }(http.DefaultTransport)
+	k := &KhedraApp{config: &cfg}
+	k.installTransport()
+	k.registerMetrics()
+	t.Cleanup(func() { metricsApp.Store(nil) })
+
+	var sb strings.Builder
+	require.NoError(t, metrics.Default.Write(&sb))
+	out := sb.String()
+	assert.Contains(t, out, `khedra_chain_head_block{chain="testchain"} 400`)
+	assert.Contains(t, out, `khedra_chain_indexed_block{chain="testchain"} 300`)
+	assert.Contains(t, out, `khedra_chain_blocks_behind{chain="testchain"} 100`)
+	assert.Contains(t, out, `khedra_service_up{service="scraper"} 0`)
+	assert.Contains(t, out, `khedra_rpc_request_duration_seconds_count{endpoint="`+node.URL+`",method="eth_blockNumber"}`)
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/budget"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// startBudgets sets up the RPC budgets, which installTransport puts in front
+// of every RPC request, and saves the usage periodically and on shutdown. It
+// is done once, as the services start; reloadConfig applies later changes to
+// the budgets.
+func (k *KhedraApp) startBudgets() {
+	logger := k.logger.Component(types.ComponentRpc)
+	b, err := budget.New(sendTransport(), control.BudgetsPath(), logger)
+	if err != nil {
+		logger.Warn("Could not read saved RPC usage", "path", control.BudgetsPath(), "error", err)
+	}
+	b.PauseChains(k.chainPauses)
+	if k.config != nil {
+		b.Configure(k.config.Chains)
+	}
+	k.budgets = b
+
+	// The service manager exits the process on the same signals, so the
+	// save here is best effort; Run also saves every budget.SaveInterval.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer stop()
+		b.Run(ctx)
+	}()
+}
+
+// handleRpcBudgets serves /rpc/budgets: the budget of every RPC of the chains
+// with budgets, and their usage.
+func (k *KhedraApp) handleRpcBudgets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	status := []budget.Status{}
+	if k.budgets != nil {
+		status = k.budgets.Status()
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
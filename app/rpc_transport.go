@@ -0,0 +1,32 @@
+package app
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
+)
+
+// rpcBase is the transport http.DefaultTransport held before khedra replaced
+// it, which every request finally goes out through.
+var rpcBase = sync.OnceValue(func() http.RoundTripper { return http.DefaultTransport })
+
+// sendTransport is what a request goes through once khedra lets it go: the
+// RPC metrics, then rpcBase. The budgets send their requests on through it, so
+// a request they refuse or reroute is recorded as what was really sent.
+func sendTransport() http.RoundTripper {
+	return metrics.Transport{Base: rpcBase()}
+}
+
+// installTransport makes http.DefaultTransport, which chifra and khedra send
+// their RPC requests through, the chain of khedra's transports: the RPC
+// budgets, once started, in front of sendTransport. The chain is built here
+// and nowhere else, and always over rpcBase, so installing it again replaces
+// it rather than wrapping it once more.
+func (k *KhedraApp) installTransport() {
+	var rt http.RoundTripper = sendTransport()
+	if k.budgets != nil {
+		rt = k.budgets
+	}
+	http.DefaultTransport = rt
+}
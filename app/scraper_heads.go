@@ -0,0 +1,284 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/logger"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
+	sdk "github.com/TrueBlocks/trueblocks-sdk/v6"
+)
+
+// caughtUpDistance is how far behind the head a chain's staging may be for
+// the chain to count as caught up (the SDK's own threshold).
+const caughtUpDistance = 28 + 4
+
+// Bounds of the wait before a dropped newHeads subscription is retried. The
+// wait doubles after each failure and starts over once a subscription holds.
+var (
+	headRetryMin = 5 * time.Second
+	headRetryMax = time.Minute
+)
+
+// headSource is where the scraper hears about a chain's new blocks: its
+// WebSocket RPCs, tried in turn, and the chain ID they must serve.
+type headSource struct {
+	rpcs    []string
+	chainID uint64
+}
+
+// wakeups collects the chains that have a new block waiting to be scraped.
+type wakeups struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	signal  chan struct{}
+}
+
+func newWakeups() *wakeups {
+	return &wakeups{pending: map[string]bool{}, signal: make(chan struct{}, 1)}
+}
+
+// add marks chain as having a new block.
+func (w *wakeups) add(chain string) {
+	w.mu.Lock()
+	w.pending[chain] = true
+	w.mu.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the chains marked since the last take, in the order of chains.
+func (w *wakeups) take(chains []string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var woken []string
+	for _, chain := range chains {
+		if w.pending[chain] {
+			woken = append(woken, chain)
+		}
+	}
+	w.pending = map[string]bool{}
+	return woken
+}
+
+// Process scrapes every chain in turn, as the SDK's scraper does, but waits
+// for the next round in a way that can be cut short: a chain whose WebSocket
+// RPC announces a new block is scraped as soon as it does. Chains without one,
+// or whose subscription has dropped, are polled every sleep seconds.
+//
+// Process and scrapeOnce mirror ScrapeService.Process and scrapeOneChain in
+// services/service_scraper.go of the SDK at v6.7.0; check them against it when
+// the SDK is upgraded.
+func (s *scrapeService) Process(ready chan bool) error {
+	ctx := s.context()
+	s.log.Info("Starting scraper process", "sleep", s.sleep, "targets", s.chains, "newHeads", len(s.heads))
+	for _, chain := range s.chains {
+		if src, ok := s.heads[chain]; ok {
+			go s.watchHeads(ctx, chain, src)
+		}
+	}
+	ready <- true
+
+	for runCount := 0; ; {
+		if s.IsPaused() {
+			if !sleepCtx(ctx, 2*time.Second) {
+				return s.stopped()
+			}
+			continue
+		}
+		if !s.scrapeChains(s.chains) {
+			if !sleepCtx(ctx, time.Second) {
+				return s.stopped()
+			}
+			continue
+		}
+		if runCount%5 == 0 || s.sleep > 10*time.Second {
+			s.log.Info("All chains caught up")
+		}
+		runCount++
+		if !s.waitForBlocks(ctx) {
+			return s.stopped()
+		}
+	}
+}
+
+// waitForBlocks waits out the sleep, scraping chains that announce a new
+// block meanwhile. It returns early if one of them is behind, and false if ctx
+// ends.
+func (s *scrapeService) waitForBlocks(ctx context.Context) bool {
+	timer := time.NewTimer(s.sleep)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-s.wake.signal:
+			if s.IsPaused() {
+				return true
+			}
+			if woken := s.wake.take(s.chains); len(woken) > 0 && !s.scrapeChains(woken) {
+				return true
+			}
+		}
+	}
+}
+
+// scrapeChains scrapes each of chains once and reports whether all of them
+// are caught up. Chains that fail are logged and do not count as behind, nor
+// do paused chains, which are skipped.
+func (s *scrapeService) scrapeChains(chains []string) bool {
+	caughtUp := true
+	for _, chain := range chains {
+		if s.IsPaused() {
+			return true
+		}
+		if cause, p, paused := s.paused.Paused(chain); paused {
+			s.log.Debug("Chain paused; not scraping it", "chain", chain, "cause", cause, "reason", p.Reason, "until", p.Until)
+			continue
+		}
+		staged, err := s.scrape(chain)
+		if err != nil {
+			s.log.Warn("Error scraping chain", "chain", chain, "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if staged > caughtUpDistance {
+			caughtUp = false
+		}
+	}
+	return caughtUp
+}
+
+func (s *scrapeService) stopped() error {
+	s.log.Info("Scrape service process stopping due to context cancellation")
+	return nil
+}
+
+// Cleanup stops Process and the newHeads listeners, then the SDK's service.
+func (s *scrapeService) Cleanup() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.mu.Unlock()
+	s.ScrapeService.Cleanup()
+}
+
+// context returns the context Process runs under until the next Cleanup.
+func (s *scrapeService) context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+	return s.ctx
+}
+
+// watchHeads keeps a newHeads subscription open on one of the chain's
+// WebSocket RPCs, waking the scraper for each block, until ctx ends. While
+// the subscription is down the chain is polled, and it is retried with a
+// growing wait.
+func (s *scrapeService) watchHeads(ctx context.Context, chain string, src headSource) {
+	wait := headRetryMin
+	for attempt := 0; ; attempt++ {
+		rpc := src.rpcs[attempt%len(src.rpcs)]
+		subscribed, err := s.listenHeads(ctx, chain, rpc, src.chainID)
+		if ctx.Err() != nil {
+			return
+		}
+		if subscribed {
+			wait = headRetryMin
+		}
+		s.log.Warn("New block subscription is down; polling until it is back", "chain", chain,
+			"endpoint", metrics.Endpoint(rpc), "error", err, "retryIn", wait)
+		if !sleepCtx(ctx, wait) {
+			return
+		}
+		wait = min(2*wait, headRetryMax)
+	}
+}
+
+// listenHeads subscribes to rpc's new blocks and wakes the scraper for chain
+// on each one until the connection ends. It reports whether the subscription
+// was made.
+func (s *scrapeService) listenHeads(ctx context.Context, chain, rpc string, chainID uint64) (bool, error) {
+	c, err := wsrpc.Dial(ctx, rpc)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	if got, err := c.Uint64(ctx, "eth_chainId"); err != nil {
+		return false, err
+	} else if got != chainID {
+		return false, fmt.Errorf("the RPC serves chain ID %d, not %d", got, chainID)
+	}
+	heads, err := c.NewHeads(ctx)
+	if err != nil {
+		return false, err
+	}
+	s.log.Info("Listening for new blocks", "chain", chain, "endpoint", metrics.Endpoint(rpc))
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case h, ok := <-heads:
+			if !ok {
+				return true, c.Err()
+			}
+			s.log.Debug("New block", "chain", chain, "number", h.Number)
+			s.wake.add(chain)
+		}
+	}
+}
+
+// scrapeOnce runs one round of the SDK's scraper on chain, returning how
+// many blocks its staging is behind the head. It is the SDK's scrapeOneChain
+// (see Process).
+func (s *scrapeService) scrapeOnce(chain string) (int, error) {
+	defer func() {
+		logger.SetLoggerWriter(io.Discard)
+		_ = os.Setenv("TB_SCRAPE_HEADLESS", "")
+	}()
+	logger.SetLoggerWriter(os.Stderr)
+	_ = os.Setenv("TB_SCRAPE_HEADLESS", "true")
+
+	opts := sdk.ScrapeOptions{
+		BlockCnt: uint64(s.blockCnt),
+		Globals: sdk.Globals{
+			Chain: chain,
+		},
+	}
+	msg, meta, err := opts.ScrapeRunOnce()
+	if err != nil {
+		return 0, err
+	}
+	if len(msg) > 0 {
+		s.log.Info(msg[0].String())
+	}
+	if meta == nil {
+		return 0, nil
+	}
+	return int(meta.Latest) - int(meta.Staging), nil
+}
+
+// sleepCtx waits for d and reports whether ctx is still live.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc/wsrpctest"
+)
+
+// startScraper runs a scraper for mainnet, with wsURL as its WebSocket RPC
+// and a stand-in for the SDK's scrape, and returns the chains it scrapes as
+// it scrapes them. The scraper stops when the test ends.
+func startScraper(t *testing.T, wsURL string, sleep time.Duration) <-chan string {
+	t.Helper()
+	cfg := types.NewConfig()
+	ch := cfg.Chains["mainnet"]
+	ch.RPCs = append(ch.RPCs, wsURL)
+	cfg.Chains["mainnet"] = ch
+	sf := NewServiceFactory(&cfg, types.NewLogger(types.Logging{Level: "error"}), nil)
+	s := sf.createScraperService(cfg.Services["scraper"])
+	s.Unpause()
+	s.sleep = sleep
+
+	scraped := make(chan string, 100)
+	s.scrape = func(chain string) (int, error) {
+		scraped <- chain
+		return 0, nil
+	}
+	ready := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		_ = s.Process(ready)
+		close(done)
+	}()
+	<-ready
+	t.Cleanup(func() {
+		s.Cleanup()
+		<-done
+	})
+	return scraped
+}
+
+// scrapedWithin empties scraped and then reports whether a scrape follows
+// within d.
+func scrapedWithin(scraped <-chan string, d time.Duration) bool {
+	for len(scraped) > 0 {
+		<-scraped
+	}
+	select {
+	case <-scraped:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func TestScraper_WakesOnNewHead(t *testing.T) {
+	node := wsrpctest.NewNode(1)
+	defer node.Close()
+	scraped := startScraper(t, node.URL, time.Hour)
+
+	require.Equal(t, "mainnet", <-scraped, "the first round scrapes every chain")
+	require.Eventually(t, func() bool { return node.Subscribers() == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, scrapedWithin(scraped, 200*time.Millisecond), "a caught up chain waits for its next block")
+
+	node.Head(100)
+	assert.True(t, scrapedWithin(scraped, 5*time.Second), "a new block should wake the scraper")
+}
+
+func TestScraper_PollsWhenSubscriptionDrops(t *testing.T) {
+	defer func(min time.Duration) { headRetryMin = min }(headRetryMin)
+	headRetryMin = 50 * time.Millisecond
+
+	node := wsrpctest.NewNode(1)
+	defer node.Close()
+	scraped := startScraper(t, node.URL, 300*time.Millisecond)
+	require.Eventually(t, func() bool { return node.Subscribers() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	node.Close()
+	assert.True(t, scrapedWithin(scraped, 2*time.Second), "without a subscription the chain is polled")
+	assert.True(t, scrapedWithin(scraped, 2*time.Second), "and keeps being polled")
+}
+
+func TestScraper_ResubscribesAfterDrop(t *testing.T) {
+	defer func(min time.Duration) { headRetryMin = min }(headRetryMin)
+	headRetryMin = 50 * time.Millisecond
+
+	node := wsrpctest.NewNode(1)
+	defer node.Close()
+	scraped := startScraper(t, node.URL, time.Hour)
+	require.Eventually(t, func() bool { return node.Subscribers() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	node.Drop()
+	require.Eventually(t, func() bool { return node.Subscribers() == 1 }, 5*time.Second, 10*time.Millisecond,
+		"the listener should subscribe again")
+	node.Head(101)
+	assert.True(t, scrapedWithin(scraped, 5*time.Second), "blocks announced after the reconnect should wake the scraper")
+}
+
+func TestScraper_IgnoresWrongChain(t *testing.T) {
+	node := wsrpctest.NewNode(11155111)
+	defer node.Close()
+	startScraper(t, node.URL, time.Hour)
+
+	require.Eventually(t, func() bool { return slices.Contains(node.Methods(), "eth_chainId") }, 5*time.Second, 10*time.Millisecond,
+		"the listener should check the RPC's chain ID")
+	assert.Equal(t, 0, node.Subscribers(), "an RPC serving another chain must not drive the scraper")
+	assert.NotContains(t, node.Methods(), "eth_subscribe")
+}
+
+func TestScraper_SkipsPausedChain(t *testing.T) {
+	cfg := types.NewConfig()
+	sf := NewServiceFactory(&cfg, types.NewLogger(types.Logging{Level: "error"}), nil)
+	sf.chainPauses = control.NewChainPauses()
+	s := sf.createScraperService(cfg.Services["scraper"])
+	s.Unpause()
+	var scraped []string
+	s.scrape = func(chain string) (int, error) {
+		scraped = append(scraped, chain)
+		return 1000, nil
+	}
+
+	sf.chainPauses.Pause("mainnet", control.CauseQuota, control.Pause{Until: time.Now().Add(time.Hour)})
+	assert.True(t, s.scrapeChains([]string{"mainnet"}), "a paused chain does not count as behind")
+	assert.Empty(t, scraped, "a paused chain is not scraped")
+
+	sf.chainPauses.Unpause("mainnet", control.CauseQuota)
+	assert.False(t, s.scrapeChains([]string{"mainnet"}))
+	assert.Equal(t, []string{"mainnet"}, scraped, "the chain is scraped again once unpaused")
+}
@@ -1,8 +1,17 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 	"github.com/TrueBlocks/trueblocks-sdk/v6/services"
 )
@@ -11,13 +20,19 @@ import (
 type ServiceFactory struct {
 	config *types.Config
 	logger *types.CustomLogger
+	pauses *control.RuntimeState
+
+	// chainPauses (which may be nil) holds single chains back from scraping
+	chainPauses *control.ChainPauses
 }
 
-// NewServiceFactory creates a new service factory
-func NewServiceFactory(config *types.Config, logger *types.CustomLogger) *ServiceFactory {
+// NewServiceFactory creates a new service factory. Services recorded as paused
+// in pauses (which may be nil) start paused.
+func NewServiceFactory(config *types.Config, logger *types.CustomLogger, pauses *control.RuntimeState) *ServiceFactory {
 	return &ServiceFactory{
 		config: config,
 		logger: logger,
+		pauses: pauses,
 	}
 }
 
@@ -47,28 +62,153 @@ func (sf *ServiceFactory) CreateAllServices(controlSvc *services.ControlService)
 		}
 	}
 
+	sf.applyPauses(activeServices)
 	return activeServices
 }
 
-// createScraperService creates and configures the scraper service
-func (sf *ServiceFactory) createScraperService(svc types.Service) *services.ScrapeService {
+// applyPauses re-applies pauses that were in effect when the daemon last stopped
+func (sf *ServiceFactory) applyPauses(activeServices []services.Servicer) {
+	if sf.pauses == nil {
+		return
+	}
+	for _, svc := range activeServices {
+		pauser, ok := svc.(services.Pauser)
+		if !ok {
+			continue
+		}
+		if p, paused := sf.pauses.Info(svc.Name()); paused {
+			pauser.Pause()
+			sf.logger.Component(types.ComponentControl).Info("Service paused from saved state",
+				"service", svc.Name(), "reason", p.Reason, "until", p.Until)
+		}
+	}
+}
+
+// createScraperService creates and configures the scraper service. Each
+// chain is initialized by the mode its index plan gives it from
+// general.strategy and general.detail: download the full index, download the
+// blooms only, or build everything locally (chains with no published index
+// are always built locally).
+func (sf *ServiceFactory) createScraperService(svc types.Service) *scrapeService {
 	chains := strings.Split(strings.ReplaceAll(sf.config.EnabledChains(), " ", ""), ",")
-	scraperSvc := services.NewScrapeService(
-		sf.logger.GetLogger(),
-		"all",
-		chains,
-		sf.config.Services["scraper"].Sleep,
-		sf.config.Services["scraper"].BatchSize,
-	)
+	initModes := install.InitModes(*sf.config, install.CachedChainInputs(*sf.config))
+	log := sf.logger.Component(types.ComponentScraper)
+	scraperSvc := &scrapeService{
+		// the SDK's initialization is run per mode by Initialize
+		ScrapeService: services.NewScrapeService(
+			log,
+			index.InitNone,
+			chains,
+			sf.config.Services["scraper"].Sleep,
+			sf.config.Services["scraper"].BatchSize,
+		),
+		initModes: initModes,
+		indexPath: sf.config.IndexPath(),
+		chains:    chains,
+		log:       log,
+		every:     progressInterval,
+		sleep:     time.Duration(sf.config.Services["scraper"].Sleep) * time.Second,
+		blockCnt:  sf.config.Services["scraper"].BatchSize,
+		heads:     map[string]headSource{},
+		wake:      newWakeups(),
+		paused:    sf.chainPauses,
+	}
+	scraperSvc.scrape = scraperSvc.scrapeOnce
+	for _, name := range chains {
+		ch := sf.config.Chains[name]
+		if rpcs := ch.WebSocketRPCs(); len(rpcs) > 0 {
+			scraperSvc.heads[name] = headSource{rpcs: rpcs, chainID: uint64(ch.ChainID)}
+		}
+	}
 	if !svc.Enabled {
 		scraperSvc.Pause()
 	}
 	return scraperSvc
 }
 
+// progressInterval is how often index progress is logged while the scraper
+// initializes.
+const progressInterval = 30 * time.Second
+
+// scrapeService is the SDK's scrape service with progress reports while it
+// downloads the index, which can take hours and is otherwise silent, and a
+// Process that scrapes a chain as soon as its WebSocket RPC announces a block.
+type scrapeService struct {
+	*services.ScrapeService
+	initModes map[string]string // by chain
+	indexPath string
+	chains    []string
+	log       *slog.Logger
+	every     time.Duration
+	sleep     time.Duration
+	blockCnt  int
+	heads     map[string]headSource           // chains with a WebSocket RPC
+	wake      *wakeups                        // chains with a new block to scrape
+	paused    *control.ChainPauses            // chains not to scrape for now
+	scrape    func(chain string) (int, error) // one round on chain; blocks behind the head
+	mu        sync.Mutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// Initialize runs the SDK's initialization once for each init mode, on the
+// chains planned with it, logging what is on disk for each chain every
+// s.every until it finishes. Chains built locally need none.
+func (s *scrapeService) Initialize() error {
+	byMode := map[string][]string{}
+	for _, chain := range s.chains {
+		if mode := s.initMode(chain); mode != index.InitNone {
+			byMode[mode] = append(byMode[mode], chain)
+		}
+	}
+	if len(byMode) == 0 {
+		return s.ScrapeService.Initialize()
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.reportProgress("Index download progress")
+			}
+		}
+	}()
+	var err error
+	for _, mode := range []string{index.InitAll, index.InitBlooms} {
+		if chains := byMode[mode]; len(chains) > 0 {
+			svc := services.NewScrapeService(s.log, mode, chains, int(s.sleep/time.Second), s.blockCnt)
+			err = errors.Join(err, svc.Initialize())
+		}
+	}
+	close(done)
+	s.reportProgress("Index download finished")
+	return err
+}
+
+// initMode returns the mode chain's index is initialized with.
+func (s *scrapeService) initMode(chain string) string {
+	if mode, ok := s.initModes[chain]; ok {
+		return mode
+	}
+	return index.InitNone
+}
+
+// reportProgress logs each chain's inventory.
+func (s *scrapeService) reportProgress(msg string) {
+	for _, chain := range s.chains {
+		inv := index.Scan(s.indexPath, chain)
+		s.log.Info(msg, "chain", chain, "mode", s.initMode(chain), "blooms", inv.Blooms, "chunks", inv.Chunks,
+			"gb", fmt.Sprintf("%.2f", float64(inv.BloomBytes+inv.ChunkBytes)/1e9), "latestBlock", inv.LatestBlock)
+	}
+}
+
 // createMonitorService creates and configures the monitor service
 func (sf *ServiceFactory) createMonitorService(svc types.Service) *services.MonitorService {
-	monitorSvc := services.NewMonitorService(nil)
+	monitorSvc := services.NewMonitorService(sf.logger.Component(types.ComponentMonitor))
 	if !svc.Enabled {
 		monitorSvc.Pause()
 	}
@@ -0,0 +1,504 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/colors"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"golang.org/x/term"
+)
+
+// errWizardQuit is returned when the user leaves the terminal wizard early.
+var errWizardQuit = errors.New("setup stopped; your answers are saved, run 'khedra init' again to resume")
+
+// terminalWizard is the terminal version of the browser install wizard. It
+// walks the same steps, saves the same install.Draft after every step and
+// validates each step the same way, so setup started in one can be finished
+// in the other.
+type terminalWizard struct {
+	in           *bufio.Reader
+	out          io.Writer
+	probe        install.Prober
+	capabilities func(ctx context.Context, rpcUrl string) install.Capabilities    // nil skips the capability check
+	measure      func(ctx context.Context, cfg types.Config) []install.ChainInput // nil estimates from recent measurements only
+	preflight    func(d *install.Draft) install.Preflight                         // nil skips the disk preflight
+}
+
+func newTerminalWizard(in io.Reader, out io.Writer, probe install.Prober) *terminalWizard {
+	return &terminalWizard{in: bufio.NewReader(in), out: out, probe: probe}
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// run walks the wizard from the draft's saved step (or the beginning) to the
+// summary, where the draft is applied. It returns errWizardQuit if the user
+// types q or the input ends.
+func (w *terminalWizard) run() error {
+	d, err := install.LoadDraft()
+	if err != nil || d == nil {
+		d = install.NewDraftFromConfig("terminal-" + install.RandString(8))
+		if err := install.SaveDraftAtomic(d); err != nil {
+			return err
+		}
+	}
+
+	step := "welcome"
+	if i := install.StepIndex(d.Meta.Step); i > 0 {
+		resume, err := w.confirm(fmt.Sprintf("Setup was started earlier. Resume at the %s step?", d.Meta.Step), true)
+		if err != nil {
+			return err
+		}
+		if resume {
+			step = d.Meta.Step
+		}
+	}
+
+	for step != "" {
+		w.heading(step)
+		var next string
+		switch step {
+		case "welcome":
+			next, err = w.welcome()
+		case "paths":
+			next, err = w.paths(d)
+		case "chains":
+			next, err = w.chains(d)
+		case "index":
+			next, err = w.index(d)
+		case "services":
+			next, err = w.services(d)
+		case "logging":
+			next, err = w.logging(d)
+		case "summary":
+			return w.summary(d)
+		}
+		if err != nil {
+			return err
+		}
+		if next == step {
+			continue // step failed validation; ask again
+		}
+		d.Meta.Step = next
+		if err := install.SaveDraftAtomic(d); err != nil {
+			return err
+		}
+		step = next
+	}
+	return nil
+}
+
+func (w *terminalWizard) heading(step string) {
+	i := install.StepIndex(step)
+	fmt.Fprintf(w.out, "\n%s[%d/%d] %s%s\n", colors.BrightBlue, i+1, len(install.StepOrder), strings.ToUpper(step[:1])+step[1:], colors.Off)
+}
+
+// finish validates d for step and returns the step to show next: the following
+// step if d is valid, otherwise step again after printing the problems.
+func (w *terminalWizard) finish(d *install.Draft, step string, extra ...install.FieldError) string {
+	errs := append(install.ValidateDraftPhase(d, "step:"+step), extra...)
+	if len(errs) == 0 {
+		return install.NextStep(step)
+	}
+	w.printErrors(errs)
+	return step
+}
+
+func (w *terminalWizard) printErrors(errs []install.FieldError) {
+	for _, fe := range errs {
+		fmt.Fprintf(w.out, "%s  ✗ %s%s\n", colors.Red, fe.Message, colors.Off)
+	}
+}
+
+func (w *terminalWizard) welcome() (string, error) {
+	fmt.Fprintln(w.out, "This sets up khedra in a few steps: where to keep data, which chains to index,")
+	fmt.Fprintln(w.out, "how to build the index, which services to run and how to log. Press Enter to")
+	fmt.Fprintln(w.out, "accept the value in brackets, or type q to stop (your answers are kept).")
+	if _, err := w.ask("Press Enter to begin", ""); err != nil {
+		return "", err
+	}
+	return "paths", nil
+}
+
+func (w *terminalWizard) paths(d *install.Draft) (string, error) {
+	v, err := w.ask("Data folder (index and caches, may reach 200GB)", d.Config.General.DataFolder)
+	if err != nil {
+		return "", err
+	}
+	d.Config.General.DataFolder = v
+	if w.preflight == nil || len(install.ValidateDraftPhase(d, "step:paths")) > 0 {
+		return w.finish(d, "paths"), nil
+	}
+	pf := w.preflight(d)
+	for _, c := range pf.Checks {
+		switch c.Severity {
+		case install.SeverityOK:
+			fmt.Fprintf(w.out, "%s  ✔ %s%s\n", colors.Green, c.Message, colors.Off)
+		case install.SeverityWarning:
+			fmt.Fprintf(w.out, "%s  ! %s%s\n", colors.Yellow, c.Message, colors.Off)
+		}
+	}
+	return w.finish(d, "paths", pf.FieldErrors()...), nil
+}
+
+func (w *terminalWizard) chains(d *install.Draft) (string, error) {
+	if d.Config.Chains == nil {
+		d.Config.Chains = map[string]types.Chain{}
+	}
+	for _, name := range chainOrder(d) {
+		ch := d.Config.Chains[name]
+		if name != "mainnet" {
+			enabled, err := w.confirm("Index "+name+"?", ch.Enabled)
+			if err != nil {
+				return "", err
+			}
+			ch.Enabled = enabled
+		}
+		if ch.Enabled || name == "mainnet" {
+			rpc, err := w.ask("RPC for "+name, firstRpc(ch.RPCs))
+			if err != nil {
+				return "", err
+			}
+			ch.RPCs = setFirstRpc(ch.RPCs, rpc)
+		}
+		d.Config.Chains[name] = ch
+	}
+
+	for {
+		var addable []string
+		for _, info := range chains.Featured() {
+			if _, ok := d.Config.Chains[info.Name]; !ok && !info.Deprecated {
+				addable = append(addable, info.Name)
+			}
+		}
+		if len(addable) == 0 {
+			break
+		}
+		name, err := w.ask("Add a chain ("+strings.Join(addable, ", ")+") or press Enter to continue", "")
+		if err != nil {
+			return "", err
+		}
+		if name == "" {
+			break
+		}
+		info, ok := chains.ByName(name)
+		if !ok {
+			fmt.Fprintf(w.out, "  unknown chain %q\n", name)
+			continue
+		}
+		if _, ok := d.Config.Chains[info.Name]; ok {
+			fmt.Fprintf(w.out, "  %s is already configured\n", info.Name)
+			continue
+		}
+		name = info.Name
+		if len(info.RPCs) > 0 {
+			fmt.Fprintf(w.out, "  public RPCs for %s: %s (fine for testing, too slow to build an index)\n", name, strings.Join(info.RPCs, ", "))
+		}
+		rpc, err := w.ask("RPC for "+name, "")
+		if err != nil {
+			return "", err
+		}
+		ch := types.NewChain(name, info.ChainID)
+		ch.RPCs = []string{rpc}
+		d.Config.Chains[name] = ch
+	}
+
+	if errs := install.ValidateDraftPhase(d, "step:chains"); len(errs) > 0 {
+		w.printErrors(errs)
+		return "chains", nil
+	}
+	fmt.Fprintln(w.out, "Checking RPCs...")
+	probeErrs := install.ProbeChains(d, w.probe)
+	for _, name := range chainOrder(d) {
+		if ch := d.Config.Chains[name]; ch.Enabled {
+			fmt.Fprintf(w.out, "  %s: chain ID %d\n", name, ch.ChainID)
+			if w.capabilities != nil && len(probeErrs) == 0 {
+				w.printCapabilities(w.capabilities(context.Background(), firstRpc(ch.RPCs)))
+			}
+		}
+	}
+	return w.finish(d, "chains", probeErrs...), nil
+}
+
+// printCapabilities shows an RPC's capability matrix. A missing feature only
+// warns; the chain can still be used.
+func (w *terminalWizard) printCapabilities(caps install.Capabilities) {
+	for _, f := range caps.Features {
+		mark, color := "✔", colors.Green
+		if f.Status != install.CapabilityPass {
+			mark, color = "✕", colors.Yellow
+			if f.Required {
+				color = colors.Red
+			}
+		}
+		req := ""
+		if f.Required {
+			req = " (required)"
+		}
+		fmt.Fprintf(w.out, "    %s%s %-12s %5dms%s%s\n", color, mark, f.Name, f.LatencyMS, req, colors.Off)
+	}
+	for _, warning := range caps.Warnings {
+		fmt.Fprintf(w.out, "    %sWarning: %s%s\n", colors.Yellow, warning, colors.Off)
+	}
+}
+
+func (w *terminalWizard) index(d *install.Draft) (string, error) {
+	strategy, err := w.choose("Build the index by (download) fetching it from IPFS or (scratch) scraping it yourself", []string{"download", "scratch"}, orDefault(d.Config.General.Strategy, "download"))
+	if err != nil {
+		return "", err
+	}
+	detail, err := w.choose("Keep the (index) full index or only (bloom) the bloom filters", []string{"index", "bloom"}, orDefault(d.Config.General.Detail, "index"))
+	if err != nil {
+		return "", err
+	}
+	inputs := install.CachedChainInputs(d.Config)
+	if w.measure != nil {
+		fmt.Fprintln(w.out, "  Measuring head blocks and RPC throughput...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		inputs = w.measure(ctx, d.Config)
+		cancel()
+	}
+	install.UpdateIndexStrategy(d, strategy, detail, inputs)
+	w.printEstimate(d.Meta.Estimate, true)
+	w.printIndexChanges(install.IndexChanges(d.Config, inputs))
+	return w.finish(d, "index"), nil
+}
+
+// printIndexChanges shows what the daemon will do to indexes that already
+// exist when the strategy or detail changes.
+func (w *terminalWizard) printIndexChanges(plans []install.IndexPlan) {
+	for _, p := range plans {
+		fmt.Fprintf(w.out, "  %s%s: index changes from %s to %s at the next start%s\n", colors.Yellow, p.Chain, p.From, p.To, colors.Off)
+		for _, step := range p.Steps {
+			fmt.Fprintf(w.out, "    - %s\n", step)
+		}
+	}
+}
+
+// printEstimate shows the disk and time estimate, per chain if perChain is
+// set, as expected values with their range.
+func (w *terminalWizard) printEstimate(est *install.IndexEstimate, perChain bool) {
+	if est == nil {
+		return
+	}
+	if perChain {
+		for _, c := range est.Chains {
+			head := strconv.FormatUint(c.HeadBlock, 10)
+			if !c.HeadKnown {
+				head += "?"
+			}
+			fmt.Fprintf(w.out, "  %-10s %-8s head %-11s %s GB, %s hours\n", c.Chain, c.Strategy, head, c.DiskGB, c.Hours)
+			for _, note := range c.Notes {
+				fmt.Fprintf(w.out, "    %s%s%s\n", colors.Yellow, note, colors.Off)
+			}
+		}
+	}
+	fmt.Fprintf(w.out, "  Estimate:    %s GB of disk and %s hours (expected, with range)\n", est.DiskGB, est.Hours)
+}
+
+func (w *terminalWizard) services(d *install.Draft) (string, error) {
+	for _, name := range []string{"scraper", "monitor", "api", "ipfs"} {
+		svc, ok := d.Config.Services[name]
+		if !ok {
+			svc = types.NewService(name)
+		}
+		enabled, err := w.confirm("Run the "+name+" service?", svc.Enabled)
+		if err != nil {
+			return "", err
+		}
+		svc.Enabled = enabled
+		if enabled && svc.Port != 0 {
+			v, err := w.ask("  "+name+" port", strconv.Itoa(svc.Port))
+			if err != nil {
+				return "", err
+			}
+			if port, err := strconv.Atoi(v); err == nil {
+				svc.Port = port
+			}
+		}
+		d.Config.Services[name] = svc
+	}
+	return w.finish(d, "services"), nil
+}
+
+func (w *terminalWizard) logging(d *install.Draft) (string, error) {
+	lg := &d.Config.Logging
+	level, err := w.choose("Log level", []string{"debug", "info", "warn", "error"}, orDefault(lg.Level, "info"))
+	if err != nil {
+		return "", err
+	}
+	lg.Level = level
+	if lg.ToFile, err = w.confirm("Also write logs to a file?", lg.ToFile); err != nil {
+		return "", err
+	}
+	if lg.ToFile {
+		if lg.Folder, err = w.ask("  Log folder", lg.Folder); err != nil {
+			return "", err
+		}
+		if lg.Filename, err = w.ask("  Log file name", lg.Filename); err != nil {
+			return "", err
+		}
+	}
+	return w.finish(d, "logging"), nil
+}
+
+// summary shows the answers and, once confirmed, applies the draft as the
+// browser wizard's summary step does.
+func (w *terminalWizard) summary(d *install.Draft) error {
+	g := d.Config.General
+	fmt.Fprintf(w.out, "  Data folder: %s\n", g.DataFolder)
+	fmt.Fprintf(w.out, "  Index:       %s (%s)\n", g.Strategy, g.Detail)
+	for _, name := range chainOrder(d) {
+		if ch := d.Config.Chains[name]; ch.Enabled {
+			fmt.Fprintf(w.out, "  Chain:       %s (%d) %s\n", name, ch.ChainID, firstRpc(ch.RPCs))
+		}
+	}
+	var enabled []string
+	for name, svc := range d.Config.Services {
+		if svc.Enabled {
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+	fmt.Fprintf(w.out, "  Services:    %s\n", strings.Join(enabled, ", "))
+	est := install.EstimateIndex(g.Strategy, g.Detail, install.CachedChainInputs(d.Config))
+	w.printEstimate(&est, false)
+	w.printIndexChanges(install.IndexChanges(d.Config, install.CachedChainInputs(d.Config)))
+	fmt.Fprintf(w.out, "  Logging:     %s", d.Config.Logging.Level)
+	if d.Config.Logging.ToFile {
+		fmt.Fprintf(w.out, " to %s/%s", d.Config.Logging.Folder, d.Config.Logging.Filename)
+	}
+	fmt.Fprintln(w.out)
+
+	if errs := install.ValidateDraftPhase(d, "final"); len(errs) > 0 {
+		w.printErrors(errs)
+		return fmt.Errorf("setup is not complete; run 'khedra init' again to fix it")
+	}
+	ok, err := w.confirm("Write this configuration?", true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errWizardQuit
+	}
+	if err := install.ApplyDraft(install.SourceCLI); err != nil {
+		return err
+	}
+	fmt.Fprintf(w.out, "%sConfiguration written to %s. Start khedra with 'khedra daemon'.%s\n", colors.Green, types.GetConfigFnNoCreate(), colors.Off)
+	return nil
+}
+
+// ask prints a prompt with its default and returns the trimmed answer (or the
+// default for an empty answer).
+func (w *terminalWizard) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", prompt)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		fmt.Fprintln(w.out)
+		return "", errWizardQuit
+	}
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "q":
+		return "", errWizardQuit
+	case line == "":
+		return def, nil
+	}
+	return line, nil
+}
+
+// confirm asks a yes or no question.
+func (w *terminalWizard) confirm(prompt string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		v, err := w.ask(prompt+" ("+hint+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(v) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// choose asks for one of options.
+func (w *terminalWizard) choose(prompt string, options []string, def string) (string, error) {
+	for {
+		v, err := w.ask(prompt+" ("+strings.Join(options, "/")+")", def)
+		if err != nil {
+			return "", err
+		}
+		for _, o := range options {
+			if strings.EqualFold(v, o) {
+				return o, nil
+			}
+		}
+		fmt.Fprintf(w.out, "  choose one of %s\n", strings.Join(options, ", "))
+	}
+}
+
+// chainOrder lists the draft's chains with mainnet first, then by chain ID.
+func chainOrder(d *install.Draft) []string {
+	names := make([]string, 0, len(d.Config.Chains))
+	for name := range d.Config.Chains {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := d.Config.Chains[names[i]], d.Config.Chains[names[j]]
+		if (names[i] == "mainnet") != (names[j] == "mainnet") {
+			return names[i] == "mainnet"
+		}
+		if a.ChainID != b.ChainID {
+			return a.ChainID < b.ChainID
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func firstRpc(rpcs []string) string {
+	if len(rpcs) == 0 {
+		return ""
+	}
+	return rpcs[0]
+}
+
+func setFirstRpc(rpcs []string, rpc string) []string {
+	if len(rpcs) == 0 {
+		return []string{rpc}
+	}
+	rpcs[0] = rpc
+	return rpcs
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
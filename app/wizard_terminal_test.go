@@ -0,0 +1,113 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func mainnetProber(url string) rpc.PingResult {
+	if url == "http://eth.example" {
+		return rpc.PingResult{URL: url, OK: true, ChainID: "0x1"}
+	}
+	return rpc.PingResult{URL: url, Error: "connection refused"}
+}
+
+func TestTerminalWizard(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", filepath.Join(tmp, "config.yaml"))
+
+	input := strings.Join([]string{
+		"",                         // welcome
+		filepath.Join(tmp, "data"), // data folder
+		"http://down.example",      // mainnet RPC, fails the probe
+		"",                         // no extra chain
+		"http://eth.example",       // mainnet RPC again
+		"",                         // no extra chain
+		"scratch", "bloom",         // index
+		"", "", "n", "", "", // scraper, monitor, api (off), ipfs and its port
+		"warn", "y", // log level, to file
+		filepath.Join(tmp, "logs"), // log folder
+		"",                         // log file name
+		"y",                        // write it
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+	w := newTerminalWizard(strings.NewReader(input), &out, mainnetProber)
+	w.capabilities = func(_ context.Context, rpcUrl string) install.Capabilities {
+		return install.Capabilities{URL: rpcUrl, Features: []install.Capability{
+			{Name: install.FeatureArchive, Required: true, Status: install.CapabilityFail},
+		}, Warnings: []string{"not an archive node"}}
+	}
+	w.preflight = func(d *install.Draft) install.Preflight {
+		return install.Preflight{Checks: []install.PreflightCheck{
+			{Name: install.CheckFreeSpace, Severity: install.SeverityWarning, Message: "10 GB free; the index needs more"},
+		}}
+	}
+	w.measure = func(_ context.Context, cfg types.Config) []install.ChainInput {
+		return []install.ChainInput{{Name: "mainnet", ChainID: 1, HeadBlock: 20_000_000, CallsPerSec: 300}}
+	}
+	require.NoError(t, w.run())
+	assert.Contains(t, out.String(), "chain mainnet RPC did not answer")
+	assert.Contains(t, out.String(), "Warning: not an archive node", "a missing capability warns but does not stop setup")
+	assert.Contains(t, out.String(), "mainnet    scratch  head 20000000")
+	assert.Contains(t, out.String(), "Estimate:")
+	assert.Contains(t, out.String(), "! 10 GB free", "a preflight warning is shown but does not stop setup")
+
+	cfg := types.NewConfig()
+	require.NoError(t, loadAnswers(&cfg, types.GetConfigFnNoCreate()))
+	assert.Equal(t, filepath.Join(tmp, "data"), cfg.General.DataFolder)
+	assert.Equal(t, []string{"http://eth.example"}, cfg.Chains["mainnet"].RPCs)
+	assert.Equal(t, "scratch", cfg.General.Strategy)
+	assert.Equal(t, "bloom", cfg.General.Detail)
+	assert.False(t, cfg.Services["api"].Enabled)
+	assert.True(t, cfg.Services["ipfs"].Enabled)
+	assert.Equal(t, "warn", cfg.Logging.Level)
+	assert.True(t, cfg.Logging.ToFile)
+	_, err := os.Stat(install.DraftFilePath())
+	assert.True(t, os.IsNotExist(err), "the draft is removed once applied")
+}
+
+func TestTerminalWizard_Resume(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", filepath.Join(tmp, "config.yaml"))
+
+	// Stop partway through, as if the terminal was closed
+	input := strings.Join([]string{"", filepath.Join(tmp, "data")}, "\n") + "\n"
+	err := newTerminalWizard(strings.NewReader(input), &bytes.Buffer{}, mainnetProber).run()
+	require.ErrorIs(t, err, errWizardQuit)
+
+	d, err := install.LoadDraft()
+	require.NoError(t, err)
+	assert.Equal(t, "chains", d.Meta.Step, "the draft remembers the next step")
+	assert.Equal(t, filepath.Join(tmp, "data"), d.Config.General.DataFolder)
+
+	// The browser wizard records its progress the same way
+	require.NoError(t, install.MarkStep("index"))
+
+	input = strings.Join([]string{
+		"",     // resume
+		"", "", // index
+		"", "", "", "", "", "", // services and ports
+		"", "", // logging
+		"y", // write it
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	require.NoError(t, newTerminalWizard(strings.NewReader(input), &out, mainnetProber).run())
+	assert.Contains(t, out.String(), "Resume at the index step?")
+	assert.NotContains(t, out.String(), "Data folder (index")
+
+	cfg := types.NewConfig()
+	require.NoError(t, loadAnswers(&cfg, types.GetConfigFnNoCreate()))
+	assert.Equal(t, filepath.Join(tmp, "data"), cfg.General.DataFolder)
+}
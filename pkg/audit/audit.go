@@ -0,0 +1,239 @@
+// Package audit keeps an append-only JSONL record of actions taken through the
+// control service, such as pausing a service or applying a new configuration.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/logs"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// Outcomes recorded in Entry.Outcome.
+const (
+	OutcomeOk    = "ok"
+	OutcomeError = "error"
+)
+
+// Entry is one audited action.
+type Entry struct {
+	Time     time.Time         `json:"time"`
+	Endpoint string            `json:"endpoint"`
+	Method   string            `json:"method"`
+	Remote   string            `json:"remote"`
+	Session  string            `json:"session,omitempty"`
+	Action   string            `json:"action"`
+	Params   map[string]string `json:"params,omitempty"`
+	Outcome  string            `json:"outcome"`
+	Status   int               `json:"status"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Query selects entries. Zero values disable the corresponding filter.
+type Query struct {
+	Since  time.Time // only entries at or after this time
+	Until  time.Time // only entries strictly before this time (paging cursor)
+	Skip   int       // if set, entries at exactly Until are kept too, except the newest Skip of them
+	Action string    // only entries with this action
+	Limit  int       // maximum number of entries (newest win)
+}
+
+// Page is a slice of matching entries (oldest first) plus a cursor for older
+// results, in the same shape as logs.Page.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	More    bool    `json:"more"`
+	Next    string  `json:"next,omitempty"`
+}
+
+// Log appends entries to a rotated JSONL file.
+type Log struct {
+	mu       sync.Mutex
+	folder   string
+	filename string
+	out      *lumberjack.Logger
+}
+
+// New returns a Log writing to cfg.Filename in folder. Zero values in cfg are
+// replaced by their defaults.
+func New(folder string, cfg types.AuditLog) *Log {
+	cfg = cfg.Resolved()
+	return &Log{
+		folder:   folder,
+		filename: cfg.Filename,
+		out: &lumberjack.Logger{
+			Filename:   filepath.Join(folder, cfg.Filename),
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+			Compress:   cfg.Compress,
+		},
+	}
+}
+
+// Record appends e to the log, filling in its time if it is zero.
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(l.folder, 0o755); err != nil {
+		return err
+	}
+	_, err = l.out.Write(append(b, '\n'))
+	return err
+}
+
+// Read returns the newest entries across the log and its backups that match q.
+// A log that has not been written yet is empty.
+func (l *Log) Read(q Query) (Page, error) {
+	files, err := logs.Files(l.folder, l.filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Page{Entries: []Entry{}}, nil
+		}
+		return Page{}, err
+	}
+
+	var newestFirst []Entry
+	more := false
+	done := false
+	skipped := 0
+	for i := len(files) - 1; i >= 0 && !done; i-- {
+		lines, err := logs.ReadLines(files[i])
+		if err != nil {
+			return Page{}, fmt.Errorf("reading %s: %w", files[i], err)
+		}
+		for j := len(lines) - 1; j >= 0; j-- {
+			var e Entry
+			if err := json.Unmarshal([]byte(lines[j]), &e); err != nil {
+				continue
+			}
+			if !q.Until.IsZero() && !logs.Before(e.Time, q.Until, q.Skip) {
+				continue
+			}
+			if !q.Since.IsZero() && e.Time.Before(q.Since) {
+				// files are chronological, so nothing older can match
+				done = true
+				break
+			}
+			if q.Action != "" && e.Action != q.Action {
+				continue
+			}
+			if q.Skip > 0 && e.Time.Equal(q.Until) && skipped < q.Skip {
+				skipped++ // returned on the previous page
+				continue
+			}
+			if q.Limit > 0 && len(newestFirst) >= q.Limit {
+				more = true
+				done = true
+				break
+			}
+			newestFirst = append(newestFirst, e)
+		}
+	}
+
+	page := Page{Entries: make([]Entry, 0, len(newestFirst)), More: more}
+	for i := len(newestFirst) - 1; i >= 0; i-- {
+		page.Entries = append(page.Entries, newestFirst[i])
+	}
+	if more && len(page.Entries) > 0 {
+		oldest := page.Entries[0].Time
+		n := 0
+		for n < len(page.Entries) && page.Entries[n].Time.Equal(oldest) {
+			n++
+		}
+		page.Next = logs.NextCursor(oldest, n, q.Until, q.Skip)
+	}
+	return page, nil
+}
+
+// Close closes the current log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.Close()
+}
+
+// Redacted replaces values that must not be written to the audit log.
+const Redacted = "[redacted]"
+
+var secretWords = []string{"key", "token", "secret", "password", "passwd", "auth"}
+
+// Redact flattens request parameters into a map safe to record. Values of
+// parameters whose names look like credentials are replaced, and URLs are
+// reduced to scheme and host because providers often embed API keys in the
+// path or query.
+func Redact(params map[string][]string) map[string]string {
+	if len(params) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(params))
+	for k, vals := range params {
+		if isSecret(k) {
+			out[k] = Redacted
+			continue
+		}
+		cleaned := make([]string, 0, len(vals))
+		for _, v := range vals {
+			cleaned = append(cleaned, redactValue(v))
+		}
+		out[k] = strings.Join(cleaned, ",")
+	}
+	return out
+}
+
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range secretWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue reduces each URL found in v (values may hold a comma separated
+// list of RPCs) to its scheme and host.
+func redactValue(v string) string {
+	if !strings.Contains(v, "://") {
+		return v
+	}
+	parts := strings.Split(v, ",")
+	for i, p := range parts {
+		parts[i] = redactUrl(strings.TrimSpace(p))
+	}
+	return strings.Join(parts, ",")
+}
+
+func redactUrl(s string) string {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok {
+		return s
+	}
+	host, tail := rest, ""
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		host, tail = rest[:i], rest[i:]
+	}
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	if strings.Trim(tail, "/") != "" {
+		return scheme + "://" + host + "/" + Redacted
+	}
+	return scheme + "://" + host
+}
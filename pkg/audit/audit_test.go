@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/logs"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	l := New(dir, types.AuditLog{})
+	defer l.Close()
+
+	page, err := l.Read(Query{})
+	if err != nil || len(page.Entries) != 0 {
+		t.Fatalf("expected an empty page before the first write, got %+v (%v)", page, err)
+	}
+
+	base := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	actions := []string{"pause", "unpause", "pause", "config_apply"}
+	for i, action := range actions {
+		e := Entry{Time: base.Add(time.Duration(i) * time.Minute), Action: action, Outcome: OutcomeOk}
+		if err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit.jsonl")); err != nil {
+		t.Fatalf("expected the default file name: %v", err)
+	}
+
+	page, err = l.Read(Query{Action: "pause"})
+	if err != nil || len(page.Entries) != 2 || !page.Entries[0].Time.Equal(base) {
+		t.Fatalf("unexpected action filter result %+v (%v)", page, err)
+	}
+
+	page, err = l.Read(Query{Since: base.Add(2 * time.Minute)})
+	if err != nil || len(page.Entries) != 2 || page.Entries[1].Action != "config_apply" {
+		t.Fatalf("unexpected since filter result %+v (%v)", page, err)
+	}
+
+	page, err = l.Read(Query{Limit: 3})
+	if err != nil || len(page.Entries) != 3 || !page.More || page.Entries[0].Action != "unpause" {
+		t.Fatalf("unexpected first page %+v (%v)", page, err)
+	}
+	until, skip, _ := logs.ParseUntil(page.Next, time.Now())
+	page, err = l.Read(Query{Until: until, Skip: skip, Limit: 3})
+	if err != nil || len(page.Entries) != 1 || page.More || page.Entries[0].Action != "pause" {
+		t.Fatalf("unexpected second page %+v (%v)", page, err)
+	}
+}
+
+func TestRead_PagesThroughSharedTimestamps(t *testing.T) {
+	l := New(t.TempDir(), types.AuditLog{})
+	defer l.Close()
+
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	stamps := []time.Time{at, at.Add(time.Millisecond), at.Add(time.Millisecond), at.Add(time.Millisecond), at.Add(time.Millisecond), at.Add(2 * time.Millisecond)}
+	for i, ts := range stamps {
+		if err := l.Record(Entry{Time: ts, Action: fmt.Sprintf("action%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	q := Query{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > len(stamps) {
+			t.Fatal("paging does not end")
+		}
+		page, err := l.Read(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := len(page.Entries) - 1; i >= 0; i-- {
+			got = append(got, page.Entries[i].Action)
+		}
+		if !page.More {
+			break
+		}
+		if q.Until, q.Skip, err = logs.ParseUntil(page.Next, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"action5", "action4", "action3", "action2", "action1", "action0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected every entry once, newest first (%v), got %v", want, got)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	got := Redact(map[string][]string{
+		"name":     {"scraper"},
+		"apiKey":   {"abc123"},
+		"Password": {"hunter2"},
+		"rpc":      {"https://user:pw@eth.example.com/v3/abc123"},
+		"rpcs":     {"http://localhost:8545, https://node.example.com/?key=abc"},
+		"plain":    {"https://node.example.com/"},
+	})
+	want := map[string]string{
+		"name":     "scraper",
+		"apiKey":   Redacted,
+		"Password": Redacted,
+		"rpc":      "https://eth.example.com/" + Redacted,
+		"rpcs":     "http://localhost:8545,https://node.example.com/" + Redacted,
+		"plain":    "https://node.example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Redact() = %v, want %v", got, want)
+	}
+	if Redact(nil) != nil {
+		t.Fatal("expected nil for no parameters")
+	}
+}
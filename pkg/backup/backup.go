@@ -0,0 +1,509 @@
+// Package backup writes khedra's state to a bundle (a zstd compressed tar
+// file) and restores it, possibly on another host. A bundle holds the config,
+// the wizard's draft, chifra's config, the monitors' watchlists and the
+// daemon's saved state, and optionally the index and the cache. Its last entry
+// is a manifest with the SHA-256 of every file, so a bundle is checked in full
+// before anything is restored.
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// Schema is the version of the bundle layout.
+	Schema = 1
+	// ManifestName is the bundle's last entry.
+	ManifestName = "manifest.json"
+)
+
+// Parts of a bundle. Each file is stored as <part>/<path in the part's folder>.
+const (
+	PartConfig   = "config"   // config.yaml, the wizard's draft and the config's generations
+	PartChifra   = "chifra"   // trueBlocks.toml and chifra's per-chain config
+	PartRun      = "run"      // the daemon's saved state, such as paused services
+	PartMonitors = "monitors" // each chain's monitors (the watchlists) from the cache
+	PartIndex    = "index"    // the Unchained Index
+	PartCache    = "cache"    // the whole cache, which includes the monitors
+)
+
+// Locations are the folders a bundle is taken from or restored to.
+type Locations struct {
+	Config string `json:"config"` // the folder holding config.yaml
+	Chifra string `json:"chifra"` // chifra's root config folder
+	Run    string `json:"run"`    // the daemon's run folder
+	Index  string `json:"index"`  // <dataFolder>/unchained
+	Cache  string `json:"cache"`  // <dataFolder>/cache
+}
+
+// root returns the folder holding a part.
+func (l Locations) root(part string) string {
+	switch part {
+	case PartConfig:
+		return l.Config
+	case PartChifra:
+		return l.Chifra
+	case PartRun:
+		return l.Run
+	case PartIndex:
+		return l.Index
+	case PartCache, PartMonitors:
+		return l.Cache
+	}
+	return ""
+}
+
+// File is one file in a bundle.
+type File struct {
+	Name string      `json:"name"`
+	Size int64       `json:"size"`
+	Mode fs.FileMode `json:"mode"`
+	Hash string      `json:"sha256"`
+}
+
+// Manifest describes a bundle.
+type Manifest struct {
+	Schema  int       `json:"schema"`
+	Created time.Time `json:"created"`
+	Version string    `json:"version,omitempty"` // of the khedra that wrote it
+	Host    string    `json:"host,omitempty"`
+	Home    string    `json:"home,omitempty"` // the home folder on that host
+	Sources Locations `json:"sources"`        // where the parts were on that host
+	Parts   []string  `json:"parts"`
+	Files   []File    `json:"files"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// Has reports whether the bundle holds a part.
+func (m Manifest) Has(part string) bool {
+	for _, p := range m.Parts {
+		if p == part {
+			return true
+		}
+	}
+	return false
+}
+
+// Progress reports on a backup, a check or a restore.
+type Progress struct {
+	Files      int    `json:"files"`
+	TotalFiles int    `json:"totalFiles"`
+	Bytes      int64  `json:"bytes"`
+	TotalBytes int64  `json:"totalBytes"`
+	File       string `json:"file"`
+}
+
+// Options control Create.
+type Options struct {
+	// Index and Cache add the index and the whole cache to the bundle.
+	Index bool
+	Cache bool
+	// Version is recorded in the manifest.
+	Version string
+	// Progress, if set, is called after each file.
+	Progress func(Progress)
+}
+
+// member is a file to be put in a bundle.
+type member struct {
+	name string // in the bundle
+	path string // on disk
+	info fs.FileInfo
+}
+
+// collect lists the files of a part.
+func collect(locs Locations, part string) ([]member, error) {
+	root := locs.root(part)
+	if root == "" {
+		return nil, nil
+	}
+	// The config and chifra folders may also hold the data folder, so only
+	// the named files and folders at their top are taken.
+	var keep func(rel string) bool
+	var folders map[string]bool
+	switch part {
+	case PartConfig:
+		folders = map[string]bool{"generations": true}
+		keep = func(rel string) bool {
+			return rel == "config.yaml" || rel == "config.draft.json" || strings.HasPrefix(rel, "generations/")
+		}
+	case PartChifra:
+		folders = map[string]bool{"config": true}
+		keep = func(rel string) bool {
+			return rel == "trueBlocks.toml" || strings.HasPrefix(rel, "config/")
+		}
+	case PartRun:
+		keep = func(rel string) bool {
+			return rel != "control.json" // belongs to the process that wrote it
+		}
+	case PartMonitors:
+		keep = func(rel string) bool {
+			parts := strings.Split(rel, "/")
+			return len(parts) > 2 && parts[1] == "monitors"
+		}
+	default:
+		keep = func(string) bool { return true }
+	}
+
+	var members []member
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if folders != nil && rel != "." && !strings.Contains(rel, "/") && !folders[rel] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if strings.HasSuffix(rel, ".tmp") || strings.HasSuffix(rel, ".part") || !keep(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		members = append(members, member{name: part + "/" + rel, path: p, info: info})
+		return nil
+	})
+	sort.Slice(members, func(i, j int) bool { return members[i].name < members[j].name })
+	return members, err
+}
+
+// Create writes a bundle of the state at locs to w and returns its manifest.
+// The config comes first, so reading it back from a bundle is quick.
+func Create(ctx context.Context, w io.Writer, locs Locations, opts Options) (Manifest, error) {
+	m := Manifest{Schema: Schema, Created: time.Now().UTC(), Version: opts.Version, Sources: locs, Files: []File{}}
+	m.Host, _ = os.Hostname()
+	m.Home, _ = os.UserHomeDir()
+	m.Parts = []string{PartConfig, PartChifra, PartRun}
+	if opts.Index {
+		m.Parts = append(m.Parts, PartIndex)
+	}
+	if opts.Cache {
+		m.Parts = append(m.Parts, PartCache)
+	} else {
+		m.Parts = append(m.Parts, PartMonitors)
+	}
+
+	var members []member
+	var total int64
+	for _, part := range m.Parts {
+		list, err := collect(locs, part)
+		if err != nil {
+			return m, err
+		}
+		for _, mem := range list {
+			total += mem.info.Size()
+		}
+		members = append(members, list...)
+	}
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return m, err
+	}
+	tw := tar.NewWriter(zw)
+	p := Progress{TotalFiles: len(members), TotalBytes: total}
+	for _, mem := range members {
+		if err := ctx.Err(); err != nil {
+			return m, err
+		}
+		f, err := addFile(tw, mem)
+		if err != nil {
+			return m, fmt.Errorf("cannot add %s: %w", mem.path, err)
+		}
+		m.Files = append(m.Files, f)
+		m.Bytes += f.Size
+		p.Files++
+		p.Bytes += f.Size
+		p.File = f.Name
+		if opts.Progress != nil {
+			opts.Progress(p)
+		}
+	}
+
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	hdr := &tar.Header{Name: ManifestName, Mode: 0o644, Size: int64(len(raw)), ModTime: m.Created, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return m, err
+	}
+	if _, err := tw.Write(raw); err != nil {
+		return m, err
+	}
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	return m, zw.Close()
+}
+
+// addFile copies one file into the bundle, hashing it on the way. A file
+// that changes size while it is read fails the backup rather than storing
+// a torn copy.
+func addFile(tw *tar.Writer, mem member) (File, error) {
+	f := File{Name: mem.name, Size: mem.info.Size(), Mode: mem.info.Mode().Perm()}
+	in, err := os.Open(mem.path)
+	if err != nil {
+		return f, err
+	}
+	defer in.Close()
+	hdr := &tar.Header{Name: mem.name, Mode: int64(f.Mode), Size: f.Size, ModTime: mem.info.ModTime(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return f, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tw, h), io.LimitReader(in, f.Size))
+	if err != nil {
+		return f, err
+	}
+	if n != f.Size {
+		return f, fmt.Errorf("the file changed while it was read")
+	}
+	f.Hash = hex.EncodeToString(h.Sum(nil))
+	return f, nil
+}
+
+// walk calls fn for each file in the bundle at fn, in order, and returns the
+// manifest. fn gets the file's header and its contents, which it may leave
+// unread.
+func walk(ctx context.Context, bundle string, fn func(hdr *tar.Header, r io.Reader) error) (Manifest, error) {
+	var m Manifest
+	in, err := os.Open(bundle)
+	if err != nil {
+		return m, err
+	}
+	defer in.Close()
+	zr, err := zstd.NewReader(in)
+	if err != nil {
+		return m, fmt.Errorf("%s is not a khedra backup: %w", bundle, err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	found := false
+	for {
+		if err := ctx.Err(); err != nil {
+			return m, err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return m, fmt.Errorf("%s is damaged: %w", bundle, err)
+		}
+		if found {
+			return m, fmt.Errorf("%s is damaged: %s follows the manifest", bundle, hdr.Name)
+		}
+		if hdr.Name == ManifestName {
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return m, fmt.Errorf("%s has an unreadable manifest: %w", bundle, err)
+			}
+			found = true
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return m, err
+		}
+	}
+	if !found {
+		return m, fmt.Errorf("%s has no manifest; it is incomplete or not a khedra backup", bundle)
+	}
+	if m.Schema != Schema {
+		return m, fmt.Errorf("%s was written with bundle schema %d; this khedra reads schema %d", bundle, m.Schema, Schema)
+	}
+	return m, nil
+}
+
+// Verify reads the whole bundle and checks every file against the manifest:
+// each is present once, with the recorded size and hash, and nothing else is.
+func Verify(ctx context.Context, bundle string, progress func(Progress)) (Manifest, error) {
+	seen := map[string]File{}
+	var p Progress
+	m, err := walk(ctx, bundle, func(hdr *tar.Header, r io.Reader) error {
+		if _, dup := seen[hdr.Name]; dup {
+			return fmt.Errorf("%s holds %s twice", bundle, hdr.Name)
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, r)
+		if err != nil {
+			return fmt.Errorf("cannot read %s from %s: %w", hdr.Name, bundle, err)
+		}
+		seen[hdr.Name] = File{Name: hdr.Name, Size: n, Hash: hex.EncodeToString(h.Sum(nil))}
+		p.Files++
+		p.Bytes += n
+		p.File = hdr.Name
+		if progress != nil {
+			progress(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return m, err
+	}
+	if len(seen) != len(m.Files) {
+		return m, fmt.Errorf("%s holds %d files but its manifest lists %d", bundle, len(seen), len(m.Files))
+	}
+	for _, f := range m.Files {
+		got, ok := seen[f.Name]
+		switch {
+		case !ok:
+			return m, fmt.Errorf("%s is missing %s", bundle, f.Name)
+		case got.Size != f.Size || got.Hash != f.Hash:
+			return m, fmt.Errorf("%s does not match its manifest: %s is damaged", bundle, f.Name)
+		}
+		if _, _, err := splitName(f.Name); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// ReadFile returns one file from the bundle without checking it. Files
+// near the front, such as config/config.yaml, are found quickly.
+func ReadFile(ctx context.Context, bundle, name string) ([]byte, error) {
+	var data []byte
+	errFound := errors.New("found")
+	_, err := walk(ctx, bundle, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name != name {
+			return nil
+		}
+		var err error
+		if data, err = io.ReadAll(r); err != nil {
+			return err
+		}
+		return errFound
+	})
+	if errors.Is(err, errFound) {
+		return data, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s holds no %s: %w", bundle, name, fs.ErrNotExist)
+}
+
+func knownPart(part string) bool {
+	switch part {
+	case PartConfig, PartChifra, PartRun, PartMonitors, PartIndex, PartCache:
+		return true
+	}
+	return false
+}
+
+// splitName splits a name in the bundle into its part and its path in the
+// part's folder, refusing names that would land outside that folder.
+func splitName(name string) (string, string, error) {
+	part, rel, ok := strings.Cut(name, "/")
+	clean := path.Clean(rel)
+	if !ok || !knownPart(part) || clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", "", fmt.Errorf("the bundle holds an unexpected file %q", name)
+	}
+	return part, clean, nil
+}
+
+// target maps a name in the bundle to a path under locs.
+func target(locs Locations, name string) (string, error) {
+	part, rel, err := splitName(name)
+	if err != nil {
+		return "", err
+	}
+	root := locs.root(part)
+	if root == "" {
+		return "", fmt.Errorf("there is nowhere to restore %s to", part)
+	}
+	return filepath.Join(root, filepath.FromSlash(rel)), nil
+}
+
+// RestoreOptions control Restore.
+type RestoreOptions struct {
+	// Progress, if set, is called after each file.
+	Progress func(Progress)
+}
+
+// Restore writes the files of a bundle checked by Verify (m is its manifest)
+// to locs. Each file is written beside its target, checked against the
+// manifest again and then renamed into place, replacing what was there.
+func Restore(ctx context.Context, bundle string, m Manifest, locs Locations, opts RestoreOptions) error {
+	want := make(map[string]File, len(m.Files))
+	for _, f := range m.Files {
+		want[f.Name] = f
+	}
+	p := Progress{TotalFiles: len(m.Files), TotalBytes: m.Bytes}
+	_, err := walk(ctx, bundle, func(hdr *tar.Header, r io.Reader) error {
+		f, ok := want[hdr.Name]
+		if !ok {
+			return fmt.Errorf("%s changed since it was checked: %s is not in its manifest", bundle, hdr.Name)
+		}
+		dst, err := target(locs, f.Name)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(dst, f, r); err != nil {
+			return err
+		}
+		p.Files++
+		p.Bytes += f.Size
+		p.File = f.Name
+		if opts.Progress != nil {
+			opts.Progress(p)
+		}
+		return nil
+	})
+	return err
+}
+
+func writeFile(dst string, f File, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	mode := f.Mode.Perm()
+	if mode == 0 {
+		mode = 0o644
+	}
+	tmp := dst + ".part"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), r)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != f.Hash {
+		err = fmt.Errorf("%s does not match the manifest", f.Name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("cannot restore %s: %w", dst, err)
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func put(t *testing.T, fn, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fn, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, fn string) string {
+	t.Helper()
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// host lays out khedra's state under a temporary folder.
+func host(t *testing.T) Locations {
+	root := t.TempDir()
+	locs := Locations{
+		Config: filepath.Join(root, "khedra"),
+		Chifra: filepath.Join(root, "trueblocks"),
+		Run:    filepath.Join(root, "khedra", "run"),
+		Index:  filepath.Join(root, "data", "unchained"),
+		Cache:  filepath.Join(root, "data", "cache"),
+	}
+	put(t, filepath.Join(locs.Config, "config.yaml"), "general:\n  dataFolder: /old/data\n")
+	put(t, filepath.Join(locs.Config, "config.draft.json"), "{}")
+	put(t, filepath.Join(locs.Config, "generations", "index.json"), "[]")
+	put(t, filepath.Join(locs.Config, "unrelated.txt"), "not khedra's")
+	put(t, filepath.Join(locs.Chifra, "trueBlocks.toml"), "[settings]\n")
+	put(t, filepath.Join(locs.Chifra, "config", "mainnet", "allocs.csv"), "address,balance\n")
+	put(t, filepath.Join(locs.Run, "pauses.json"), "{}")
+	put(t, filepath.Join(locs.Run, "control.json"), "{}")
+	put(t, filepath.Join(locs.Index, "mainnet", "finalized", "chunk.bin"), "index")
+	put(t, filepath.Join(locs.Cache, "mainnet", "monitors", "0x01.mon.bin"), "watched")
+	put(t, filepath.Join(locs.Cache, "mainnet", "blocks", "01.bin"), "block")
+	return locs
+}
+
+func create(t *testing.T, locs Locations, opts Options) (string, Manifest) {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "khedra.tar.zst")
+	out, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	m, err := Create(context.Background(), out, locs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fn, m
+}
+
+func names(m Manifest) string {
+	var list []string
+	for _, f := range m.Files {
+		list = append(list, f.Name)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestCreate(t *testing.T) {
+	locs := host(t)
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "state only",
+			want: "config/config.draft.json,config/config.yaml,config/generations/index.json,chifra/config/mainnet/allocs.csv,chifra/trueBlocks.toml,run/pauses.json,monitors/mainnet/monitors/0x01.mon.bin",
+		},
+		{
+			name: "with the index and the cache",
+			opts: Options{Index: true, Cache: true},
+			want: "config/config.draft.json,config/config.yaml,config/generations/index.json,chifra/config/mainnet/allocs.csv,chifra/trueBlocks.toml,run/pauses.json,index/mainnet/finalized/chunk.bin,cache/mainnet/blocks/01.bin,cache/mainnet/monitors/0x01.mon.bin",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, m := create(t, locs, tt.opts)
+			if got := names(m); got != tt.want {
+				t.Fatalf("bundle holds\n%s\nexpected\n%s", got, tt.want)
+			}
+			checked, err := Verify(context.Background(), fn, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names(checked) != tt.want || checked.Sources != locs {
+				t.Fatalf("unexpected manifest %+v", checked)
+			}
+			data, err := ReadFile(context.Background(), fn, "config/config.yaml")
+			if err != nil || !strings.Contains(string(data), "/old/data") {
+				t.Fatalf("cannot read the config back: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_Damaged(t *testing.T) {
+	fn, _ := create(t, host(t), Options{})
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(t.TempDir(), "truncated.tar.zst")
+	put(t, truncated, string(data[:len(data)/2]))
+	if _, err := Verify(context.Background(), truncated, nil); err == nil {
+		t.Fatal("a truncated bundle must not verify")
+	}
+
+	notBundle := filepath.Join(t.TempDir(), "config.yaml")
+	put(t, notBundle, "general:\n")
+	if _, err := Verify(context.Background(), notBundle, nil); err == nil {
+		t.Fatal("a file that is not a bundle must not verify")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	src := host(t)
+	fn, _ := create(t, src, Options{Index: true})
+	m, err := Verify(context.Background(), fn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := Locations{Config: t.TempDir(), Chifra: t.TempDir(), Run: t.TempDir(), Index: t.TempDir(), Cache: t.TempDir()}
+	put(t, filepath.Join(dst.Run, "pauses.json"), "replaced")
+	if err := Restore(context.Background(), fn, m, dst, RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range m.Files {
+		part, rel, _ := strings.Cut(f.Name, "/")
+		if got, want := read(t, filepath.Join(dst.root(part), rel)), read(t, filepath.Join(src.root(part), rel)); got != want {
+			t.Fatalf("%s restored as %q, expected %q", f.Name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst.Cache, "mainnet", "blocks", "01.bin")); err == nil {
+		t.Fatal("the cache was not in the bundle")
+	}
+	if _, err := os.Stat(filepath.Join(dst.Run, "control.json")); err == nil {
+		t.Fatal("control.json belongs to the host that wrote it")
+	}
+}
+
+func TestTarget(t *testing.T) {
+	locs := Locations{Config: "/c", Chifra: "/t", Run: "/r", Index: "/i", Cache: "/x"}
+	for name, want := range map[string]string{
+		"config/config.yaml":            "/c/config.yaml",
+		"monitors/mainnet/monitors/a":   "/x/mainnet/monitors/a",
+		"index/mainnet/finalized/a.bin": "/i/mainnet/finalized/a.bin",
+		"config/../../etc/passwd":       "",
+		"other/file":                    "",
+		"config":                        "",
+	} {
+		got, err := target(locs, name)
+		if want == "" {
+			if err == nil {
+				t.Fatalf("%s should be refused, got %s", name, got)
+			}
+			continue
+		}
+		if err != nil || got != filepath.FromSlash(want) {
+			t.Fatalf("%s maps to %s (%v), expected %s", name, got, err, want)
+		}
+	}
+}
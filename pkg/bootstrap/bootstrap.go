@@ -0,0 +1,194 @@
+// Package bootstrap provides the per-chain files chifra expects in its config
+// folder (currently the genesis allocations in allocs.csv). Each file is taken
+// from the first place that has it: the config folder itself, a local mirror,
+// the copy bundled into the binary, or trueblocks-core on GitHub.
+package bootstrap
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//go:generate go run gen_assets.go
+
+//go:embed assets
+var bundled embed.FS
+
+// DefaultBaseURL is where trueblocks-core keeps the per-chain files.
+const DefaultBaseURL = "https://raw.githubusercontent.com/TrueBlocks/trueblocks-core/refs/heads/master/src/other/install/per-chain"
+
+// Assets are the per-chain files chifra reads from its config folder.
+var Assets = []string{"allocs.csv"}
+
+// Where an asset came from.
+const (
+	SourceCached  = "cached"  // already in the config folder
+	SourceMirror  = "mirror"  // the configured mirror folder or URL
+	SourceBundled = "bundled" // compiled into khedra
+	SourceRemote  = "remote"  // downloaded from DefaultBaseURL
+	SourceMissing = "missing" // not found anywhere
+)
+
+// Options controls where Fetch looks.
+type Options struct {
+	Mirror  string // a folder or an http(s) base URL laid out as <chain>/<asset>
+	Offline bool   // never download from DefaultBaseURL
+	BaseURL string // defaults to DefaultBaseURL
+	Client  *http.Client
+}
+
+// Asset reports where one file for one chain came from.
+type Asset struct {
+	Chain  string `json:"chain"`
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	From   string `json:"from,omitempty"`
+	Size   int    `json:"size"`
+	Error  string `json:"error,omitempty"` // the last failure, if any source failed
+}
+
+// errNotFound means a source does not have the file.
+var errNotFound = errors.New("not found")
+
+// notFoundFor is how long a 404 from DefaultBaseURL is remembered, so that
+// starting the daemon does not ask GitHub again for a file it does not have.
+var notFoundFor = 7 * 24 * time.Hour
+
+// Fetch makes sure each of the Assets for chain is in dir and reports where
+// each came from. An empty file in dir does not count, since chifra creates
+// one when it finds nothing. A 404 from DefaultBaseURL is remembered in a
+// .<asset>.notfound marker in dir for notFoundFor. A missing asset is
+// reported, not returned as an error; only failing to write dir is an error.
+func Fetch(chain, dir string, opts Options) ([]Asset, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	out := make([]Asset, 0, len(Assets))
+	for _, name := range Assets {
+		a := Asset{Chain: chain, Name: name, Path: filepath.Join(dir, name), Source: SourceMissing}
+		if fi, err := os.Stat(a.Path); err == nil && fi.Size() > 0 {
+			a.Source, a.From, a.Size = SourceCached, a.Path, int(fi.Size())
+			out = append(out, a)
+			continue
+		}
+
+		marker := filepath.Join(dir, "."+name+".notfound")
+		o := opts
+		if fi, err := os.Stat(marker); err == nil && time.Since(fi.ModTime()) < notFoundFor {
+			o.Offline = true
+		}
+		for _, src := range sources(chain, name, o) {
+			data, err := src.read()
+			if errors.Is(err, errNotFound) {
+				if src.name == SourceRemote {
+					if err := os.WriteFile(marker, []byte(src.from+"\n"), 0o644); err != nil {
+						return out, err
+					}
+				}
+				continue
+			} else if err != nil {
+				a.Error = fmt.Sprintf("%s: %v", src.from, err)
+				continue
+			}
+			if err := os.WriteFile(a.Path, data, 0o644); err != nil {
+				return out, err
+			}
+			a.Source, a.From, a.Size, a.Error = src.name, src.from, len(data), ""
+			_ = os.Remove(marker)
+			break
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+type source struct {
+	name string
+	from string
+	read func() ([]byte, error)
+}
+
+// sources lists, in order, where Fetch looks for one asset.
+func sources(chain, name string, opts Options) []source {
+	var out []source
+	if m := strings.TrimSpace(opts.Mirror); m != "" {
+		if isURL(m) {
+			u := strings.TrimRight(m, "/") + "/" + path.Join(chain, name)
+			out = append(out, source{SourceMirror, u, func() ([]byte, error) { return download(opts.Client, u) }})
+		} else {
+			fn := filepath.Join(m, chain, name)
+			out = append(out, source{SourceMirror, fn, func() ([]byte, error) { return readFile(fn) }})
+		}
+	}
+	embedded := path.Join("assets", chain, name)
+	out = append(out, source{SourceBundled, embedded, func() ([]byte, error) {
+		data, err := bundled.ReadFile(embedded)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, errNotFound
+		}
+		return data, err
+	}})
+	if !opts.Offline {
+		base := opts.BaseURL
+		if base == "" {
+			base = DefaultBaseURL
+		}
+		u := strings.TrimRight(base, "/") + "/" + path.Join(chain, name)
+		out = append(out, source{SourceRemote, u, func() ([]byte, error) { return download(opts.Client, u) }})
+	}
+	return out
+}
+
+// Bundled lists the chains that have assets compiled into khedra.
+func Bundled() []string {
+	entries, _ := bundled.ReadDir("assets")
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() {
+			out = append(out, e.Name())
+		}
+	}
+	return out
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func readFile(fn string) ([]byte, error) {
+	data, err := os.ReadFile(fn)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotFound
+	}
+	return data, err
+}
+
+// download fetches u. A 404 is errNotFound.
+func download(client *http.Client, u string) ([]byte, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, errNotFound
+	default:
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+}
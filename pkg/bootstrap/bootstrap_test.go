@@ -0,0 +1,157 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	var remoteCalls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteCalls++
+		switch r.URL.Path {
+		case "/mirror/gnosis/allocs.csv":
+			_, _ = w.Write([]byte("address,balance\n0x02,2\n"))
+		case "/core/optimism/allocs.csv":
+			_, _ = w.Write([]byte("address,balance\n0x03,3\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	mirror := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(mirror, "mainnet"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mirror, "mainnet", "allocs.csv"), []byte("address,balance\n0x01,1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		chain  string
+		opts   Options
+		source string
+		from   string
+	}{
+		{"mainnet", Options{Mirror: mirror, Offline: true}, SourceMirror, filepath.Join(mirror, "mainnet", "allocs.csv")},
+		{"gnosis", Options{Mirror: srv.URL + "/mirror/", Offline: true}, SourceMirror, srv.URL + "/mirror/gnosis/allocs.csv"},
+		{"optimism", Options{Mirror: mirror, BaseURL: srv.URL + "/core"}, SourceRemote, srv.URL + "/core/optimism/allocs.csv"},
+		{"optimism", Options{Mirror: mirror, BaseURL: srv.URL + "/core", Offline: true}, SourceMissing, ""},
+		{"sepolia", Options{Mirror: mirror, BaseURL: srv.URL + "/core"}, SourceBundled, "assets/sepolia/allocs.csv"},
+		{"base", Options{BaseURL: srv.URL + "/core"}, SourceMissing, ""},
+	}
+	for _, tt := range tests {
+		dir := filepath.Join(t.TempDir(), tt.chain)
+		assets, err := Fetch(tt.chain, dir, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(assets) != 1 || assets[0].Source != tt.source || assets[0].From != tt.from {
+			t.Fatalf("%s: expected %s from %q, got %+v", tt.chain, tt.source, tt.from, assets)
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "allocs.csv"))
+		if (tt.source == SourceMissing) != (len(data) == 0) || assets[0].Size != len(data) {
+			t.Fatalf("%s: unexpected file contents %q for %+v", tt.chain, data, assets[0])
+		}
+	}
+
+	// A file already in the folder is used as is; an empty one is not
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "allocs.csv")
+	if err := os.WriteFile(fn, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if assets, _ := Fetch("mainnet", dir, Options{Mirror: mirror, Offline: true}); assets[0].Source != SourceMirror {
+		t.Fatalf("expected an empty file to be replaced, got %+v", assets[0])
+	}
+	before := remoteCalls
+	if assets, _ := Fetch("mainnet", dir, Options{BaseURL: srv.URL}); assets[0].Source != SourceCached || remoteCalls != before {
+		t.Fatalf("expected the file in the folder to be used, got %+v", assets[0])
+	}
+}
+
+func TestFetch_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	assets, err := Fetch("gnosis", t.TempDir(), Options{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assets[0].Source != SourceMissing || !strings.Contains(assets[0].Error, "502") {
+		t.Fatalf("expected the failure to be reported, got %+v", assets[0])
+	}
+
+	if _, err := Fetch("mainnet", "/dev/null/invalid", Options{Offline: true}); err == nil {
+		t.Fatal("expected an error for a folder that cannot be created")
+	}
+}
+
+func TestFetch_RemembersNotFound(t *testing.T) {
+	var remoteCalls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteCalls++
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		if assets, _ := Fetch("base", dir, Options{BaseURL: srv.URL}); assets[0].Source != SourceMissing {
+			t.Fatalf("expected the asset to be missing, got %+v", assets[0])
+		}
+	}
+	if remoteCalls != 1 {
+		t.Fatalf("expected a 404 to be remembered, got %d requests", remoteCalls)
+	}
+
+	marker := filepath.Join(dir, ".allocs.csv.notfound")
+	old := time.Now().Add(-2 * notFoundFor)
+	if err := os.Chtimes(marker, old, old); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = Fetch("base", dir, Options{BaseURL: srv.URL})
+	if remoteCalls != 2 {
+		t.Fatalf("expected an old 404 to be asked again, got %d requests", remoteCalls)
+	}
+
+	mirror := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(mirror, "base"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mirror, "base", "allocs.csv"), []byte("address,balance\n0x01,1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if assets, _ := Fetch("base", dir, Options{Mirror: mirror, BaseURL: srv.URL}); assets[0].Source != SourceMirror {
+		t.Fatalf("a 404 should not hide the mirror, got %+v", assets[0])
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("expected the marker to be removed once the asset is found, got %v", err)
+	}
+}
+
+// TestBundled checks the assets written by gen_assets.go are compiled in.
+func TestBundled(t *testing.T) {
+	want := map[string]int{"mainnet": 8893, "sepolia": 15, "holesky": 317, "hoodi": 335}
+	if got := Bundled(); len(got) != len(want) {
+		t.Fatalf("expected %d bundled chains, got %v; run go generate ./pkg/bootstrap", len(want), got)
+	}
+	for chain, accounts := range want {
+		data, err := bundled.ReadFile("assets/" + chain + "/allocs.csv")
+		if err != nil {
+			t.Fatalf("%s: %v; run go generate ./pkg/bootstrap", chain, err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if lines[0] != "address,balance" || len(lines)-1 != accounts {
+			t.Fatalf("%s: expected a header and %d accounts, got %q and %d", chain, accounts, lines[0], len(lines)-1)
+		}
+	}
+}
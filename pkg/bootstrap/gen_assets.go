@@ -0,0 +1,44 @@
+//go:build ignore
+
+// gen_assets writes assets/<chain>/allocs.csv from the genesis allocations
+// that go-ethereum ships with, so the bundled copies can be rebuilt without
+// network access. Run it with `go generate ./pkg/bootstrap`.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core"
+)
+
+var chains = map[string]*core.Genesis{
+	"mainnet": core.DefaultGenesisBlock(),
+	"sepolia": core.DefaultSepoliaGenesisBlock(),
+	"holesky": core.DefaultHoleskyGenesisBlock(),
+	"hoodi":   core.DefaultHoodiGenesisBlock(),
+}
+
+func main() {
+	for chain, genesis := range chains {
+		lines := make([]string, 0, len(genesis.Alloc))
+		for addr, acct := range genesis.Alloc {
+			lines = append(lines, fmt.Sprintf("%s,%s", strings.ToLower(addr.Hex()), acct.Balance.String()))
+		}
+		sort.Strings(lines)
+		data := "address,balance\n" + strings.Join(lines, "\n") + "\n"
+
+		fn := filepath.Join("assets", chain, "allocs.csv")
+		if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(data), 0o644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s: %d accounts", fn, len(lines))
+	}
+}
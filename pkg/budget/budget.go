@@ -0,0 +1,468 @@
+// Package budget keeps the requests khedra sends to each RPC within the
+// limits set in the config: a rate (requests per second, with a burst) and a
+// daily quota. It is an http.RoundTripper placed in front of the transport
+// chifra and khedra use, so every request to a configured RPC passes through
+// it. Bursts wait for the rate; when an RPC's daily quota is used up, its
+// requests go to the chain's next RPC with quota left, and when none has any
+// the chain's requests are refused and the chain is paused until the quota
+// resets at midnight UTC.
+package budget
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
+	"golang.org/x/time/rate"
+)
+
+// UsageSchema is the version of the usage file.
+const UsageSchema = 1
+
+// SaveInterval is how often Run writes changed usage to disk.
+const SaveInterval = 30 * time.Second
+
+// Usage counts the requests (JSON-RPC calls; a batch counts each call) sent
+// to, or meant for, one RPC.
+type Usage struct {
+	Day       string `json:"day"`                 // the UTC date Today counts
+	Today     int64  `json:"today"`               // sent today, counted against the daily quota
+	Total     int64  `json:"total"`               // sent since the usage file was started
+	Throttled int64  `json:"throttled,omitempty"` // waited for the rate limit
+	Rerouted  int64  `json:"rerouted,omitempty"`  // meant for this RPC but sent to another as its quota was used up
+	Refused   int64  `json:"refused,omitempty"`   // meant for this RPC but refused as every RPC of the chain was out of quota
+}
+
+// Status is one RPC's budget and usage.
+type Status struct {
+	Chain      string  `json:"chain"`
+	Index      int     `json:"index"`    // in the chain's RPCs
+	Endpoint   string  `json:"endpoint"` // scheme://host, so keys in the URL are not shown
+	MaxRPS     float64 `json:"maxRps,omitempty"`
+	Burst      int     `json:"burst,omitempty"`
+	DailyQuota int64   `json:"dailyQuota,omitempty"`
+	Usage
+	Exhausted bool      `json:"exhausted"` // the daily quota is used up
+	Resets    time.Time `json:"resets"`    // when the daily quota starts again
+}
+
+type usageFile struct {
+	Schema int               `json:"schema"`
+	Usage  map[string]*Usage `json:"usage"` // by endpoint id
+}
+
+// endpoint is one configured RPC of a chain.
+type endpoint struct {
+	chain   string
+	index   int
+	id      string
+	url     *url.URL
+	budget  types.RPCBudget
+	limiter *rate.Limiter // nil without a rate
+}
+
+// Budgets applies the budgets of every enabled chain's RPCs.
+type Budgets struct {
+	base   http.RoundTripper
+	path   string
+	logger *slog.Logger
+	now    func() time.Time
+	pauses *control.ChainPauses // chains out of quota are paused here
+
+	mu      sync.Mutex
+	byURL   map[string]*endpoint   // by normalized URL
+	chains  map[string][]*endpoint // in the order of the chain's RPCs
+	usage   map[string]*Usage      // by endpoint id, kept when the config changes
+	refused map[string]bool        // chains whose RPCs are all out of quota
+	dirty   bool
+}
+
+// New returns Budgets that send requests on through base, and loads the usage
+// saved at path (a missing file is no usage). On a read error the usage starts
+// empty and the error is returned with a usable Budgets.
+func New(base http.RoundTripper, path string, logger *slog.Logger) (*Budgets, error) {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	b := &Budgets{
+		base:    base,
+		path:    path,
+		logger:  logger,
+		now:     time.Now,
+		byURL:   map[string]*endpoint{},
+		chains:  map[string][]*endpoint{},
+		usage:   map[string]*Usage{},
+		refused: map[string]bool{},
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	} else if err != nil {
+		return b, err
+	}
+	var f usageFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return b, fmt.Errorf("corrupt RPC usage %s: %w", path, err)
+	}
+	for id, u := range f.Usage {
+		b.usage[id] = u
+	}
+	return b, nil
+}
+
+// PauseChains makes b pause a chain in p while every RPC of it is out of
+// quota, so the scraper leaves it alone until the quota resets.
+func (b *Budgets) PauseChains(p *control.ChainPauses) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pauses = p
+}
+
+// endpointID identifies an RPC in the usage file without storing its URL,
+// which may hold an API key.
+func endpointID(chain, rpc string) string {
+	sum := sha256.Sum256([]byte(chain + "\n" + rpc))
+	return hex.EncodeToString(sum[:8])
+}
+
+// normalize returns the form of a URL that requests are matched on.
+func normalize(u *url.URL) string {
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + strings.TrimSuffix(u.Path, "/") + "?" + u.RawQuery
+}
+
+// Configure sets the RPCs and budgets from the config's chains. Usage is kept
+// for RPCs that are still configured.
+func (b *Budgets) Configure(chains map[string]types.Chain) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.byURL = map[string]*endpoint{}
+	b.chains = map[string][]*endpoint{}
+	for name, ch := range chains {
+		if !ch.Enabled {
+			continue
+		}
+		for i, rpc := range ch.RPCs {
+			u, err := url.Parse(rpc)
+			if err != nil || u.Host == "" || wsrpc.IsWebSocket(rpc) {
+				continue
+			}
+			e := &endpoint{chain: name, index: i, id: endpointID(name, rpc), url: u}
+			if budget, ok := ch.Budget(rpc); ok {
+				e.budget = budget
+				if budget.MaxRPS > 0 {
+					burst := budget.Burst
+					if burst == 0 {
+						burst = int(math.Ceil(budget.MaxRPS))
+					}
+					e.limiter = rate.NewLimiter(rate.Limit(budget.MaxRPS), burst)
+				}
+			}
+			b.chains[name] = append(b.chains[name], e)
+			if _, dup := b.byURL[normalize(u)]; !dup {
+				b.byURL[normalize(u)] = e
+			}
+		}
+	}
+}
+
+// Limited reports whether any RPC has a budget.
+func (b *Budgets) Limited() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, list := range b.chains {
+		if slices.ContainsFunc(list, (*endpoint).limited) {
+			return true
+		}
+	}
+	return false
+}
+
+// limited reports whether the RPC has a rate or a daily quota.
+func (e *endpoint) limited() bool {
+	return e.budget.MaxRPS > 0 || e.budget.DailyQuota > 0
+}
+
+// day returns the current UTC date and the start of the next one.
+func (b *Budgets) day() (string, time.Time) {
+	now := b.now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return now.Format(time.DateOnly), midnight.Add(24 * time.Hour)
+}
+
+// usageOf returns an endpoint's usage, starting a new day if needed. b.mu
+// must be held.
+func (b *Budgets) usageOf(e *endpoint, today string) *Usage {
+	u := b.usage[e.id]
+	if u == nil {
+		u = &Usage{Day: today}
+		b.usage[e.id] = u
+	}
+	if u.Day != today {
+		u.Day = today
+		u.Today = 0
+		b.dirty = true
+	}
+	return u
+}
+
+// pick chooses where calls meant for e go: e if it has quota left, else the
+// first of the chain's other RPCs that does. The calls are counted against
+// the chosen RPC. It returns nil if none has quota.
+func (b *Budgets) pick(e *endpoint, calls int64) *endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	today, resets := b.day()
+	order := []*endpoint{e}
+	for _, other := range b.chains[e.chain] {
+		if other != e {
+			order = append(order, other)
+		}
+	}
+	b.dirty = true
+	for _, target := range order {
+		u := b.usageOf(target, today)
+		if q := target.budget.DailyQuota; q > 0 && u.Today+calls > q {
+			continue
+		}
+		u.Today += calls
+		u.Total += calls
+		if target != e {
+			b.usageOf(e, today).Rerouted += calls
+		}
+		if b.refused[e.chain] {
+			delete(b.refused, e.chain)
+			b.pauses.Unpause(e.chain, control.CauseQuota)
+			b.logger.Info("RPC budget available again; requests resumed", "chain", e.chain, "endpoint", metrics.Endpoint(target.url.String()))
+		}
+		return target
+	}
+	b.usageOf(e, today).Refused += calls
+	if !b.refused[e.chain] {
+		b.refused[e.chain] = true
+		b.pauses.Pause(e.chain, control.CauseQuota, control.Pause{Until: resets, Reason: "every RPC is out of its daily quota"})
+		b.logger.Warn("Every RPC of the chain is out of its daily quota; the chain is paused until it resets", "chain", e.chain, "resets", resets)
+	}
+	return nil
+}
+
+// RoundTrip sends requests to a configured RPC within its budget, and other
+// requests straight on.
+func (b *Budgets) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.mu.Lock()
+	e := b.byURL[normalize(req.URL)]
+	b.mu.Unlock()
+	if e == nil {
+		return b.base.RoundTrip(req)
+	}
+
+	body, calls, err := readCalls(req)
+	if err != nil {
+		return nil, err
+	}
+	target := b.pick(e, calls)
+	if target == nil {
+		return b.refuse(req), nil
+	}
+	if err := b.wait(req.Context(), target, calls); err != nil {
+		return nil, err
+	}
+
+	out := req.Clone(req.Context())
+	if target != e {
+		out.URL = target.url
+		out.Host = ""
+	}
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		out.ContentLength = int64(len(body))
+	}
+	return b.base.RoundTrip(out)
+}
+
+// wait holds a request until the target's rate allows all its calls. A batch
+// larger than the burst is reserved in burst-sized steps, as the limiter
+// cannot reserve more than the burst at once.
+func (b *Budgets) wait(ctx context.Context, target *endpoint, calls int64) error {
+	if target.limiter == nil {
+		return nil
+	}
+	now := b.now()
+	burst := int64(max(target.limiter.Burst(), 1))
+	var reserved []*rate.Reservation
+	var delay time.Duration
+	for left := calls; left > 0; left -= burst {
+		r := target.limiter.ReserveN(now, int(min(left, burst)))
+		reserved = append(reserved, r)
+		delay = max(delay, r.DelayFrom(now))
+	}
+	if delay <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	today, _ := b.day()
+	b.usageOf(target, today).Throttled += calls
+	b.mu.Unlock()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		for i := len(reserved) - 1; i >= 0; i-- {
+			reserved[i].Cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+// readCalls reads a request's body and counts the JSON-RPC calls in it: the
+// length of a batch, otherwise one.
+func readCalls(req *http.Request) ([]byte, int64, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, 1, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if json.Unmarshal(trimmed, &batch) == nil && len(batch) > 0 {
+			return body, int64(len(batch)), nil
+		}
+	}
+	return body, 1, nil
+}
+
+// refuse answers a request without sending it, as a provider out of quota
+// would, with a JSON-RPC error saying when the quota resets.
+func (b *Budgets) refuse(req *http.Request) *http.Response {
+	_, resets := b.day()
+	msg := fmt.Sprintf("khedra: every RPC of this chain is out of its daily quota until %s", resets.Format(time.RFC3339))
+	body, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error":   map[string]any{"code": -32005, "message": msg},
+	})
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set("Retry-After", fmt.Sprint(int(math.Ceil(resets.Sub(b.now()).Seconds()))))
+	return &http.Response{
+		Status:        "429 Too Many Requests",
+		StatusCode:    http.StatusTooManyRequests,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// Refused reports whether a chain's requests are being refused because all
+// its RPCs are out of quota.
+func (b *Budgets) Refused(chain string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.refused[chain]
+}
+
+// Status lists the budget and usage of every RPC of the chains with budgets,
+// by chain and then in the order of the chain's RPCs.
+func (b *Budgets) Status() []Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	today, resets := b.day()
+	list := []Status{}
+	for _, endpoints := range b.chains {
+		if !slices.ContainsFunc(endpoints, (*endpoint).limited) {
+			continue
+		}
+		for _, e := range endpoints {
+			u := b.usageOf(e, today)
+			list = append(list, Status{
+				Chain:      e.chain,
+				Index:      e.index,
+				Endpoint:   metrics.Endpoint(e.url.String()),
+				MaxRPS:     e.budget.MaxRPS,
+				Burst:      e.budget.Burst,
+				DailyQuota: e.budget.DailyQuota,
+				Usage:      *u,
+				Exhausted:  e.budget.DailyQuota > 0 && u.Today >= e.budget.DailyQuota,
+				Resets:     resets,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Chain != list[j].Chain {
+			return list[i].Chain < list[j].Chain
+		}
+		return list[i].Index < list[j].Index
+	})
+	return list
+}
+
+// Save writes the usage to its file if it changed.
+func (b *Budgets) Save() error {
+	b.mu.Lock()
+	if !b.dirty {
+		b.mu.Unlock()
+		return nil
+	}
+	raw, err := json.MarshalIndent(usageFile{Schema: UsageSchema, Usage: b.usage}, "", "  ")
+	b.dirty = false
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o755); err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// Run saves the usage every SaveInterval until ctx is done, and once more then.
+func (b *Budgets) Run(ctx context.Context) {
+	ticker := time.NewTicker(SaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.Save(); err != nil {
+				b.logger.Warn("Cannot save RPC usage", "path", b.path, "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := b.Save(); err != nil {
+				b.logger.Warn("Cannot save RPC usage", "path", b.path, "error", err)
+			}
+		}
+	}
+}
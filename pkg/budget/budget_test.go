@@ -0,0 +1,166 @@
+package budget
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// node counts the requests it answers.
+func node(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func post(t *testing.T, b *Budgets, url, body string) int {
+	t.Helper()
+	resp, err := (&http.Client{Transport: b}).Post(url, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode
+}
+
+const call = `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+
+func TestRoundTrip_Quota(t *testing.T) {
+	a, aHits := node(t)
+	bNode, bHits := node(t)
+	other, otherHits := node(t)
+
+	b, err := New(http.DefaultTransport, filepath.Join(t.TempDir(), "rpc-usage.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Noon today, as the chain's pause expires by the wall clock
+	midnight := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	now := midnight.Add(-12 * time.Hour)
+	b.now = func() time.Time { return now }
+	pauses := control.NewChainPauses()
+	b.PauseChains(pauses)
+	b.Configure(map[string]types.Chain{
+		"mainnet": {
+			Enabled: true,
+			RPCs:    []string{a.URL, bNode.URL},
+			Budgets: []types.RPCBudget{{RPC: a.URL, DailyQuota: 3}, {RPC: bNode.URL, DailyQuota: 1}},
+		},
+	})
+	if !b.Limited() {
+		t.Fatal("expected budgets")
+	}
+
+	// A batch of two and one call use up the first RPC's quota
+	if post(t, b, a.URL, "["+call+","+call+"]") != http.StatusOK || post(t, b, a.URL, call) != http.StatusOK {
+		t.Fatal("expected the first RPC to answer")
+	}
+	// The next goes to the second RPC, and then there is nothing left
+	if post(t, b, a.URL, call) != http.StatusOK {
+		t.Fatal("expected the second RPC to answer")
+	}
+	if code := post(t, b, a.URL, call); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the request to be refused, got %d", code)
+	}
+	if aHits.Load() != 2 || bHits.Load() != 1 || !b.Refused("mainnet") {
+		t.Fatalf("unexpected hits %d, %d", aHits.Load(), bHits.Load())
+	}
+	// ...and the chain is paused until midnight UTC
+	if cause, p, ok := pauses.Paused("mainnet"); !ok || cause != control.CauseQuota || !p.Until.Equal(midnight) {
+		t.Fatalf("expected the chain to be paused for its quota, got %s %+v %v", cause, p, ok)
+	}
+	// Requests to other hosts are not counted
+	if post(t, b, other.URL, call) != http.StatusOK || otherHits.Load() != 1 {
+		t.Fatal("expected an unbudgeted request to pass")
+	}
+
+	st := b.Status()
+	if len(st) != 2 || st[0].Today != 3 || st[0].Rerouted != 1 || st[0].Refused != 1 || !st[0].Exhausted || st[1].Today != 1 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	// A new day brings the quota back
+	now = now.Add(24 * time.Hour)
+	if post(t, b, a.URL, call) != http.StatusOK || aHits.Load() != 3 || b.Refused("mainnet") {
+		t.Fatal("expected the quota to reset at midnight UTC")
+	}
+}
+
+func TestRoundTrip_Rate(t *testing.T) {
+	a, hits := node(t)
+	b, _ := New(http.DefaultTransport, filepath.Join(t.TempDir(), "rpc-usage.json"), nil)
+	b.Configure(map[string]types.Chain{
+		"mainnet": {Enabled: true, RPCs: []string{a.URL}, Budgets: []types.RPCBudget{{RPC: a.URL, MaxRPS: 20, Burst: 1}}},
+	})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		post(t, b, a.URL, call)
+	}
+	if elapsed := time.Since(start); elapsed < 120*time.Millisecond {
+		t.Fatalf("four requests at 20 per second took only %s", elapsed)
+	}
+	if st := b.Status(); hits.Load() != 4 || st[0].Throttled == 0 {
+		t.Fatalf("expected throttled requests, got %+v", st)
+	}
+}
+
+func TestRoundTrip_RateBatch(t *testing.T) {
+	a, _ := node(t)
+	b, _ := New(http.DefaultTransport, filepath.Join(t.TempDir(), "rpc-usage.json"), nil)
+	b.Configure(map[string]types.Chain{
+		"mainnet": {Enabled: true, RPCs: []string{a.URL}, Budgets: []types.RPCBudget{{RPC: a.URL, MaxRPS: 20, Burst: 2}}},
+	})
+	// A batch of six calls is reserved two at a time, so it waits for the
+	// four calls past the burst
+	batch := "[" + strings.Repeat(call+",", 5) + call + "]"
+	start := time.Now()
+	post(t, b, a.URL, batch)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("a batch of six calls at 20 per second with a burst of two took only %s", elapsed)
+	}
+}
+
+func TestSave(t *testing.T) {
+	a, _ := node(t)
+	path := filepath.Join(t.TempDir(), "run", "rpc-usage.json")
+	chains := map[string]types.Chain{
+		"mainnet": {Enabled: true, RPCs: []string{a.URL + "/key"}, Budgets: []types.RPCBudget{{RPC: a.URL + "/key", DailyQuota: 100}}},
+	}
+	b, _ := New(http.DefaultTransport, path, nil)
+	b.Configure(chains)
+	post(t, b, a.URL+"/key", call)
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil || strings.Contains(string(raw), "/key") {
+		t.Fatal("the usage file must not hold the RPC's URL")
+	}
+
+	// After a restart
+	b, err = New(http.DefaultTransport, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Configure(chains)
+	if st := b.Status(); len(st) != 1 || st[0].Today != 1 || st[0].Endpoint != a.URL {
+		t.Fatalf("usage not kept across a restart: %+v", st)
+	}
+}
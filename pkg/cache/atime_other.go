@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package cache
+
+import (
+	"io/fs"
+	"time"
+)
+
+func accessTime(fi fs.FileInfo) time.Time {
+	return fi.ModTime()
+}
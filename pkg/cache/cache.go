@@ -0,0 +1,317 @@
+// Package cache measures chifra's cache and keeps it within the limits of the
+// config's cache section by removing the least recently used files.
+package cache
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// Policy is the cache section of the config in bytes and durations. Zero
+// values mean no limit.
+type Policy struct {
+	MaxSize      int64         `json:"maxSize,omitempty"`
+	MaxChainSize int64         `json:"maxChainSize,omitempty"`
+	MaxAge       time.Duration `json:"maxAge,omitempty"`
+}
+
+// PolicyFrom converts the config's megabytes and days.
+func PolicyFrom(c types.Cache) Policy {
+	return Policy{
+		MaxSize:      int64(c.MaxSize) * 1024 * 1024,
+		MaxChainSize: int64(c.MaxChainSize) * 1024 * 1024,
+		MaxAge:       time.Duration(c.MaxAge) * 24 * time.Hour,
+	}
+}
+
+// Limited reports whether any limit is set.
+func (p Policy) Limited() bool {
+	return p.MaxSize > 0 || p.MaxChainSize > 0 || p.MaxAge > 0
+}
+
+// Tally counts files and their bytes.
+type Tally struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (t *Tally) add(size int64) {
+	t.Files++
+	t.Bytes += size
+}
+
+// ChainUsage is what one chain holds in the cache, in total and by kind of
+// data (the folders under the chain: blocks, transactions, traces, ...).
+type ChainUsage struct {
+	Chain string `json:"chain"`
+	Tally
+	Kinds  map[string]Tally `json:"kinds"`
+	Oldest time.Time        `json:"oldest,omitzero"` // least recent use of any file
+}
+
+// Stats is the content of the cache.
+type Stats struct {
+	Path    string       `json:"path"`
+	Total   Tally        `json:"total"`
+	Chains  []ChainUsage `json:"chains"`
+	Scanned time.Time    `json:"scanned"`
+}
+
+// Chain returns the usage of one chain, or an empty one.
+func (s Stats) Chain(name string) ChainUsage {
+	for _, c := range s.Chains {
+		if c.Chain == name {
+			return c
+		}
+	}
+	return ChainUsage{Chain: name, Kinds: map[string]Tally{}}
+}
+
+// file is one cached file. A file's last use is the later of its access and
+// modification times; on filesystems mounted with relatime the access time
+// is updated at most once a day, which is close enough to order evictions.
+type file struct {
+	path  string
+	chain string
+	size  int64
+	used  time.Time
+}
+
+// stateFolders are the folders under a chain in the cache that hold state
+// rather than cached data: the monitors are the users' watchlists, which
+// cannot be fetched again. They are neither measured nor pruned.
+var stateFolders = []string{"monitors"}
+
+// walk lists the regular files under each chain's folder in the cache,
+// leaving out the stateFolders.
+func walk(ctx context.Context, root string) ([]file, error) {
+	var files []file
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			rel, _ := filepath.Rel(root, path)
+			if parts := strings.Split(filepath.ToSlash(rel), "/"); len(parts) == 2 && slices.Contains(stateFolders, parts[1]) {
+				return fs.SkipDir // <chain>/monitors
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		chain, _, found := strings.Cut(filepath.ToSlash(rel), "/")
+		if !found {
+			return nil // a file at the top of the cache belongs to no chain
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		used := accessTime(fi)
+		if mt := fi.ModTime(); mt.After(used) {
+			used = mt
+		}
+		files = append(files, file{path: path, chain: chain, size: fi.Size(), used: used})
+		return nil
+	})
+	return files, err
+}
+
+// Scan measures the cache at root.
+func Scan(ctx context.Context, root string) (Stats, error) {
+	files, err := walk(ctx, root)
+	if err != nil {
+		return Stats{}, err
+	}
+	return stats(root, files), nil
+}
+
+func stats(root string, files []file) Stats {
+	s := Stats{Path: root, Chains: []ChainUsage{}, Scanned: time.Now().UTC()}
+	byChain := map[string]*ChainUsage{}
+	for _, f := range files {
+		c := byChain[f.chain]
+		if c == nil {
+			c = &ChainUsage{Chain: f.chain, Kinds: map[string]Tally{}}
+			byChain[f.chain] = c
+		}
+		rel, _ := filepath.Rel(filepath.Join(root, f.chain), f.path)
+		kind, _, found := strings.Cut(filepath.ToSlash(rel), "/")
+		if !found {
+			kind = "other"
+		}
+		t := c.Kinds[kind]
+		t.add(f.size)
+		c.Kinds[kind] = t
+		c.add(f.size)
+		s.Total.add(f.size)
+		if c.Oldest.IsZero() || f.used.Before(c.Oldest) {
+			c.Oldest = f.used
+		}
+	}
+	for _, c := range byChain {
+		s.Chains = append(s.Chains, *c)
+	}
+	sort.Slice(s.Chains, func(i, j int) bool { return s.Chains[i].Chain < s.Chains[j].Chain })
+	return s
+}
+
+// Reasons a file is removed.
+const (
+	ReasonAge   = "age"   // unused for longer than MaxAge
+	ReasonChain = "chain" // its chain is over MaxChainSize
+	ReasonSize  = "size"  // the cache is over MaxSize
+)
+
+// Result is what Prune removed, or with DryRun would remove.
+type Result struct {
+	DryRun   bool             `json:"dryRun,omitempty"`
+	Policy   Policy           `json:"policy"`
+	Before   Tally            `json:"before"`
+	Removed  Tally            `json:"removed"`
+	Reasons  map[string]Tally `json:"reasons"`
+	Chains   map[string]Tally `json:"chains"` // removed, by chain
+	Errors   int              `json:"errors,omitempty"`
+	After    Stats            `json:"after"`
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+}
+
+// PruneOptions control Prune.
+type PruneOptions struct {
+	// DryRun reports what would be removed without removing it.
+	DryRun bool
+	// Now is the time ages are measured from; the current time if zero.
+	Now time.Time
+}
+
+// Prune brings the cache at root within the policy. Files unused for longer
+// than MaxAge go first, then the least recently used files of each chain over
+// MaxChainSize, then the least recently used files of the whole cache while
+// it is over MaxSize. Folders left empty are removed.
+func Prune(ctx context.Context, root string, p Policy, opts PruneOptions) (Result, error) {
+	res := Result{DryRun: opts.DryRun, Policy: p, Reasons: map[string]Tally{}, Chains: map[string]Tally{}, Started: time.Now().UTC()}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	files, err := walk(ctx, root)
+	if err != nil {
+		return res, err
+	}
+	// Least recently used first
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+
+	removed := make([]bool, len(files))
+	chainBytes := map[string]int64{}
+	var total int64
+	for _, f := range files {
+		res.Before.add(f.size)
+		chainBytes[f.chain] += f.size
+		total += f.size
+	}
+	remove := func(i int, reason string) {
+		f := files[i]
+		removed[i] = true
+		chainBytes[f.chain] -= f.size
+		total -= f.size
+		res.Removed.add(f.size)
+		t := res.Reasons[reason]
+		t.add(f.size)
+		res.Reasons[reason] = t
+		t = res.Chains[f.chain]
+		t.add(f.size)
+		res.Chains[f.chain] = t
+	}
+
+	if p.MaxAge > 0 {
+		cutoff := now.Add(-p.MaxAge)
+		for i, f := range files {
+			if f.used.Before(cutoff) {
+				remove(i, ReasonAge)
+			}
+		}
+	}
+	if p.MaxChainSize > 0 {
+		for i, f := range files {
+			if !removed[i] && chainBytes[f.chain] > p.MaxChainSize {
+				remove(i, ReasonChain)
+			}
+		}
+	}
+	if p.MaxSize > 0 {
+		for i := range files {
+			if total <= p.MaxSize {
+				break
+			}
+			if !removed[i] {
+				remove(i, ReasonSize)
+			}
+		}
+	}
+
+	var kept []file
+	dirs := map[string]bool{}
+	for i, f := range files {
+		if !removed[i] {
+			kept = append(kept, f)
+			continue
+		}
+		if opts.DryRun {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			res.Errors++
+			kept = append(kept, f)
+			continue
+		}
+		dirs[filepath.Dir(f.path)] = true
+	}
+	if !opts.DryRun {
+		removeEmptyDirs(root, dirs)
+	}
+	res.After = stats(root, kept)
+	res.Finished = time.Now().UTC()
+	return res, nil
+}
+
+// removeEmptyDirs removes each folder in dirs, and then its parents, while
+// they are empty, stopping at root.
+func removeEmptyDirs(root string, dirs map[string]bool) {
+	list := make([]string, 0, len(dirs))
+	for d := range dirs {
+		list = append(list, d)
+	}
+	// Deepest first, so a parent is tried after its children
+	slices.SortFunc(list, func(a, b string) int { return len(b) - len(a) })
+	for _, d := range list {
+		for d != root && strings.HasPrefix(d, root) {
+			if os.Remove(d) != nil {
+				break
+			}
+			d = filepath.Dir(d)
+		}
+	}
+}
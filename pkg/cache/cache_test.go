@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// put writes size bytes at rel under root, last used daysAgo days before now.
+func put(t *testing.T, root, rel string, size, daysAgo int) {
+	t.Helper()
+	fn := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fn, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	used := now.Add(-time.Duration(daysAgo) * 24 * time.Hour)
+	if err := os.Chtimes(fn, used, used); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(root, rel string) bool {
+	_, err := os.Stat(filepath.Join(root, rel))
+	return err == nil
+}
+
+func fill(t *testing.T) string {
+	root := t.TempDir()
+	put(t, root, "mainnet/blocks/00/01.bin", 100, 40)
+	put(t, root, "mainnet/blocks/00/02.bin", 100, 10)
+	put(t, root, "mainnet/transactions/00/01.bin", 100, 5)
+	put(t, root, "mainnet/transactions/00/02.bin", 100, 1)
+	put(t, root, "gnosis/traces/00/01.bin", 100, 20)
+	put(t, root, "gnosis/traces/00/02.bin", 100, 2)
+	put(t, root, "stray.txt", 5, 0)
+	return root
+}
+
+func TestScan(t *testing.T) {
+	root := fill(t)
+	s, err := Scan(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Total != (Tally{Files: 6, Bytes: 600}) || len(s.Chains) != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	mainnet := s.Chain("mainnet")
+	if mainnet.Tally != (Tally{Files: 4, Bytes: 400}) || mainnet.Kinds["blocks"] != (Tally{Files: 2, Bytes: 200}) {
+		t.Fatalf("unexpected mainnet usage %+v", mainnet)
+	}
+	if want := now.Add(-40 * 24 * time.Hour); !mainnet.Oldest.Equal(want) {
+		t.Fatalf("oldest use %v, expected %v", mainnet.Oldest, want)
+	}
+	if s.Chain("sepolia").Files != 0 {
+		t.Fatal("an unknown chain should be empty")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		removed []string
+		reasons map[string]int
+	}{
+		{
+			name:    "no limits",
+			removed: nil,
+		},
+		{
+			name:    "age",
+			policy:  Policy{MaxAge: 15 * 24 * time.Hour},
+			removed: []string{"mainnet/blocks/00/01.bin", "gnosis/traces/00/01.bin"},
+			reasons: map[string]int{ReasonAge: 2},
+		},
+		{
+			name:    "per chain",
+			policy:  Policy{MaxChainSize: 250},
+			removed: []string{"mainnet/blocks/00/01.bin", "mainnet/blocks/00/02.bin"},
+			reasons: map[string]int{ReasonChain: 2},
+		},
+		{
+			name:    "total, least recently used first across chains",
+			policy:  Policy{MaxSize: 300},
+			removed: []string{"mainnet/blocks/00/01.bin", "gnosis/traces/00/01.bin", "mainnet/blocks/00/02.bin"},
+			reasons: map[string]int{ReasonSize: 3},
+		},
+		{
+			name:    "all three",
+			policy:  Policy{MaxAge: 30 * 24 * time.Hour, MaxChainSize: 250, MaxSize: 250},
+			removed: []string{"mainnet/blocks/00/01.bin", "mainnet/blocks/00/02.bin", "gnosis/traces/00/01.bin", "mainnet/transactions/00/01.bin"},
+			reasons: map[string]int{ReasonAge: 1, ReasonChain: 1, ReasonSize: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, dryRun := range []bool{true, false} {
+				root := fill(t)
+				res, err := Prune(context.Background(), root, tt.policy, PruneOptions{DryRun: dryRun, Now: now})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Removed.Files != len(tt.removed) || res.Before.Files != 6 || res.After.Total.Files != 6-len(tt.removed) {
+					t.Fatalf("dry run %t: unexpected result %+v", dryRun, res)
+				}
+				for reason, n := range tt.reasons {
+					if res.Reasons[reason].Files != n {
+						t.Fatalf("dry run %t: expected %d removed for %s, got %+v", dryRun, n, reason, res.Reasons)
+					}
+				}
+				for _, rel := range tt.removed {
+					if exists(root, rel) != dryRun {
+						t.Fatalf("dry run %t: %s exists %t", dryRun, rel, exists(root, rel))
+					}
+				}
+				if !exists(root, "stray.txt") {
+					t.Fatal("files outside the chain folders are not touched")
+				}
+			}
+		})
+	}
+
+	// Folders emptied by a prune are removed
+	root := fill(t)
+	if _, err := Prune(context.Background(), root, Policy{MaxAge: 15 * 24 * time.Hour}, PruneOptions{Now: now}); err != nil {
+		t.Fatal(err)
+	}
+	if exists(root, "gnosis/traces/00/01.bin") || !exists(root, "gnosis/traces/00") {
+		t.Fatal("a folder that still holds files must stay")
+	}
+	put(t, root, "sepolia/abis/x.json", 10, 100)
+	if _, err := Prune(context.Background(), root, Policy{MaxAge: 15 * 24 * time.Hour}, PruneOptions{Now: now}); err != nil {
+		t.Fatal(err)
+	}
+	if exists(root, "sepolia") || !exists(root, "") {
+		t.Fatal("empty folders should be removed up to the cache itself")
+	}
+
+	// Monitors are the users' watchlists, not cache: no limit removes them
+	root = fill(t)
+	put(t, root, "mainnet/monitors/0xf503017d7baf7fbc0fff7492b751025c6a78179b.mon.bin", 100, 400)
+	put(t, root, "mainnet/monitors/staging/0x054993ab0f2b1acc0fdc65405ee203b4271bebe6.mon.bin", 100, 400)
+	res, err := Prune(context.Background(), root, Policy{MaxSize: 1, MaxChainSize: 1, MaxAge: time.Nanosecond}, PruneOptions{Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed.Files != 6 || res.After.Total.Files != 0 {
+		t.Fatalf("expected every cache file to be removed, got %+v", res)
+	}
+	if !exists(root, "mainnet/monitors/0xf503017d7baf7fbc0fff7492b751025c6a78179b.mon.bin") || !exists(root, "mainnet/monitors/staging/0x054993ab0f2b1acc0fdc65405ee203b4271bebe6.mon.bin") {
+		t.Fatal("monitors must survive a prune")
+	}
+}
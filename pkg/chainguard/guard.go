@@ -0,0 +1,257 @@
+// Package chainguard checks that every enabled chain's RPCs serve that chain.
+// An RPC pointed at the wrong network answers like any other, and the scraper
+// would index the wrong chain into the right folder. The Guard asks each RPC
+// for its eth_chainId and quarantines a chain whose RPCs do not all report the
+// configured chain ID: the chain is paused, so the scraper leaves it alone
+// while the others go on, until a later check finds its RPCs right again.
+package chainguard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/jsonrpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
+)
+
+// MaxEvents is how many events the Guard keeps.
+const MaxEvents = 50
+
+// Event is a chain being quarantined or released.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Chain       string    `json:"chain"`
+	Endpoint    string    `json:"endpoint,omitempty"` // scheme://host of the RPC that failed the check
+	Want        uint64    `json:"want"`
+	Got         uint64    `json:"got,omitempty"`
+	Quarantined bool      `json:"quarantined"` // false when the chain is released
+	Message     string    `json:"message"`
+}
+
+// target is an enabled chain and the chain ID its RPCs must report.
+type target struct {
+	want uint64
+	rpcs []string
+}
+
+// Guard quarantines chains whose RPCs serve another chain.
+type Guard struct {
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu          sync.Mutex
+	pauses      *control.ChainPauses // quarantined chains are paused here
+	targets     map[string]target
+	quarantined map[string]Event // the event that quarantined each chain
+	events      []Event          // oldest first
+}
+
+// New returns a Guard with no chains to check.
+func New(logger *slog.Logger) *Guard {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &Guard{
+		logger:      logger,
+		now:         time.Now,
+		targets:     map[string]target{},
+		quarantined: map[string]Event{},
+	}
+}
+
+// PauseChains makes g pause a chain in p while it is quarantined, so the
+// scraper leaves it alone.
+func (g *Guard) PauseChains(p *control.ChainPauses) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pauses = p
+}
+
+// Configure sets the chains to check from the config. Chains that are no
+// longer enabled leave quarantine; the others stay as they are until the next
+// Check.
+func (g *Guard) Configure(chains map[string]types.Chain) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.targets = map[string]target{}
+	for name, ch := range chains {
+		if !ch.Enabled || ch.ChainID <= 0 {
+			continue
+		}
+		g.targets[name] = target{want: uint64(ch.ChainID), rpcs: ch.RPCs}
+	}
+	for name := range g.quarantined {
+		if _, ok := g.targets[name]; !ok {
+			delete(g.quarantined, name)
+			g.pauses.Unpause(name, control.CauseQuarantine)
+		}
+	}
+}
+
+// result is the answer of one RPC to eth_chainId.
+type result struct {
+	got uint64
+	err error
+}
+
+// Check asks every RPC of the configured chains for its chain ID. A chain
+// with an RPC that reports another chain is quarantined; a quarantined chain
+// whose RPCs all answer with the right chain ID is released. RPCs that do not
+// answer change nothing. It returns the events of this check.
+func (g *Guard) Check(ctx context.Context) []Event {
+	g.mu.Lock()
+	targets := make(map[string]target, len(g.targets))
+	for name, t := range g.targets {
+		targets[name] = t
+	}
+	g.mu.Unlock()
+
+	results := map[string][]result{}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for name, t := range targets {
+		results[name] = make([]result, len(t.rpcs))
+		for i, rpc := range t.rpcs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := chainID(ctx, rpc)
+				mu.Lock()
+				results[name][i] = result{got: got, err: err}
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var events []Event
+	for _, name := range names {
+		t := targets[name]
+		if ev, ok := g.judge(name, t, results[name]); ok {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// chainID asks rpc for its chain ID, over a WebSocket for ws:// and wss://
+// RPCs.
+func chainID(ctx context.Context, rpc string) (uint64, error) {
+	if !wsrpc.IsWebSocket(rpc) {
+		return jsonrpc.Uint64(ctx, rpc, "eth_chainId")
+	}
+	c, err := wsrpc.Dial(ctx, rpc)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	return c.Uint64(ctx, "eth_chainId")
+}
+
+// judge applies one chain's results, returning the event if its quarantine
+// changed.
+func (g *Guard) judge(name string, t target, results []result) (Event, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, quarantined := g.quarantined[name]
+	answered := true
+	for i, r := range results {
+		endpoint := metrics.Endpoint(t.rpcs[i])
+		if r.err != nil {
+			answered = false
+			g.logger.Warn("Cannot check the chain ID of an RPC", "chain", name, "endpoint", endpoint, "error", r.err)
+			continue
+		}
+		if r.got == t.want {
+			continue
+		}
+		if quarantined {
+			return Event{}, false
+		}
+		ev := Event{
+			Time:        g.now(),
+			Chain:       name,
+			Endpoint:    endpoint,
+			Want:        t.want,
+			Got:         r.got,
+			Quarantined: true,
+			Message: fmt.Sprintf("chain %s expects chain ID %d but %s reports %d (%s); the chain is quarantined until its RPCs are fixed",
+				name, t.want, endpoint, r.got, chains.NameFor(int(r.got))),
+		}
+		g.logger.Error("RPC serves the wrong chain; chain quarantined", "chain", name, "endpoint", endpoint, "want", t.want, "got", r.got)
+		g.record(ev)
+		g.quarantined[name] = ev
+		g.pauses.Pause(name, control.CauseQuarantine, control.Pause{Reason: ev.Message})
+		return ev, true
+	}
+	if !quarantined || !answered {
+		return Event{}, false
+	}
+	ev := Event{
+		Time:    g.now(),
+		Chain:   name,
+		Want:    t.want,
+		Message: fmt.Sprintf("every RPC of chain %s reports chain ID %d again; the chain is released", name, t.want),
+	}
+	g.logger.Info("RPCs serve the right chain again; chain released", "chain", name, "chainId", t.want)
+	g.record(ev)
+	delete(g.quarantined, name)
+	g.pauses.Unpause(name, control.CauseQuarantine)
+	return ev, true
+}
+
+// record keeps ev among the latest MaxEvents. g.mu must be held.
+func (g *Guard) record(ev Event) {
+	g.events = append(g.events, ev)
+	if len(g.events) > MaxEvents {
+		g.events = g.events[len(g.events)-MaxEvents:]
+	}
+}
+
+// Quarantined returns the event that quarantined a chain, if it is.
+func (g *Guard) Quarantined(chain string) (Event, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ev, ok := g.quarantined[chain]
+	return ev, ok
+}
+
+// Events returns the latest events, newest first.
+func (g *Guard) Events() []Event {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list := make([]Event, len(g.events))
+	for i, ev := range g.events {
+		list[len(list)-1-i] = ev
+	}
+	return list
+}
+
+// Run checks the chains every interval until ctx is done.
+func (g *Guard) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.Check(ctx)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package chainguard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc/wsrpctest"
+)
+
+// node answers eth_chainId with the chain ID it holds.
+type node struct {
+	*httptest.Server
+	chainID atomic.Uint64
+}
+
+func newNode(t *testing.T, chainID uint64) *node {
+	t.Helper()
+	n := &node{}
+	n.chainID.Store(chainID)
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, n.chainID.Load())
+	}))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func TestCheck(t *testing.T) {
+	mainnet := newNode(t, 1)
+	gnosis := newNode(t, 11155111) // a Sepolia endpoint configured for gnosis
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	pauses := control.NewChainPauses()
+	g := New(nil)
+	g.PauseChains(pauses)
+	g.Configure(map[string]types.Chain{
+		"mainnet": {Enabled: true, ChainID: 1, RPCs: []string{mainnet.URL, down.URL}},
+		"gnosis":  {Enabled: true, ChainID: 100, RPCs: []string{gnosis.URL}},
+		"sepolia": {Enabled: false, ChainID: 11155111, RPCs: []string{gnosis.URL}},
+	})
+
+	events := g.Check(context.Background())
+	if len(events) != 1 || events[0].Chain != "gnosis" || !events[0].Quarantined || events[0].Got != 11155111 {
+		t.Fatalf("expected gnosis to be quarantined, got %+v", events)
+	}
+	if !strings.Contains(events[0].Message, "sepolia") {
+		t.Fatalf("the message should name the chain the RPC serves: %s", events[0].Message)
+	}
+	if _, ok := g.Quarantined("mainnet"); ok {
+		t.Fatal("an RPC that does not answer is not a reason to quarantine")
+	}
+	if cause, p, ok := pauses.Paused("gnosis"); !ok || cause != control.CauseQuarantine || p.Reason != events[0].Message {
+		t.Fatalf("a quarantined chain must be paused, got %s %+v %v", cause, p, ok)
+	}
+	if _, _, ok := pauses.Paused("mainnet"); ok {
+		t.Fatal("other chains must not be paused")
+	}
+	if events := g.Check(context.Background()); len(events) != 0 {
+		t.Fatalf("a chain is quarantined once, got %+v", events)
+	}
+
+	// The provider is fixed
+	gnosis.chainID.Store(100)
+	events = g.Check(context.Background())
+	if len(events) != 1 || events[0].Quarantined {
+		t.Fatalf("expected gnosis to be released, got %+v", events)
+	}
+	if _, _, ok := pauses.Paused("gnosis"); ok {
+		t.Fatal("a released chain must be unpaused")
+	}
+	if list := g.Events(); len(list) != 2 || list[0].Quarantined || !list[1].Quarantined {
+		t.Fatalf("expected the release after the quarantine, newest first: %+v", list)
+	}
+}
+
+func TestConfigure_Releases(t *testing.T) {
+	wrong := newNode(t, 5)
+	pauses := control.NewChainPauses()
+	g := New(nil)
+	g.PauseChains(pauses)
+	g.Configure(map[string]types.Chain{"gnosis": {Enabled: true, ChainID: 100, RPCs: []string{wrong.URL}}})
+	g.Check(context.Background())
+	if _, ok := g.Quarantined("gnosis"); !ok {
+		t.Fatal("expected gnosis to be quarantined")
+	}
+	g.Configure(map[string]types.Chain{"gnosis": {Enabled: false, ChainID: 100, RPCs: []string{wrong.URL}}})
+	if _, ok := g.Quarantined("gnosis"); ok {
+		t.Fatal("a disabled chain is not quarantined")
+	}
+	if _, _, ok := pauses.Paused("gnosis"); ok {
+		t.Fatal("a disabled chain is not paused")
+	}
+}
+
+func TestCheck_WebSocket(t *testing.T) {
+	node := newNode(t, 10)
+	ws := wsrpctest.NewNode(10)
+	defer ws.Close()
+
+	g := New(nil)
+	g.Configure(map[string]types.Chain{
+		"optimism": {Enabled: true, ChainID: 10, RPCs: []string{node.URL, ws.URL}},
+	})
+	if events := g.Check(context.Background()); len(events) != 0 {
+		t.Fatalf("expected no events, got %+v", events)
+	}
+
+	ws.SetChainID(8453)
+	events := g.Check(context.Background())
+	if len(events) != 1 || !events[0].Quarantined || events[0].Got != 8453 || events[0].Endpoint == "" {
+		t.Fatalf("expected the WebSocket RPC to quarantine optimism, got %+v", events)
+	}
+}
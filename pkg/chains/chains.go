@@ -0,0 +1,336 @@
+// Package chains is an offline catalog of EVM chains built from the chain list
+// bundled with khedra and a small curated overlay of the chains khedra knows
+// best.
+package chains
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chainList is a snapshot of the public chain list (chainlist.org format).
+//
+//go:embed chainList.json.gz
+var chainList []byte
+
+// curated overrides and extends the chain list for the chains khedra offers
+// in the wizard: khedra names, aliases, preferred explorer, block time and
+// public RPCs.
+//
+//go:embed chains.json
+var curated []byte
+
+// maxSuggestedRpcs caps the public RPCs suggested for one chain.
+const maxSuggestedRpcs = 3
+
+// Explorer is a block explorer for a chain.
+type Explorer struct {
+	Name string
+	URL  string
+}
+
+// Info describes one chain in the catalog.
+type Info struct {
+	Name       string   // canonical khedra name, e.g. "mainnet"
+	ChainID    int      // EIP-155 chain id
+	Title      string   // display name from the chain list, e.g. "Ethereum Mainnet"
+	Aliases    []string // other names accepted by ByName
+	Symbol     string   // native currency symbol
+	Explorers  []Explorer
+	BlockTime  time.Duration // average block time, zero if unknown
+	Testnet    bool
+	Deprecated bool
+	RPCs       []string // suggested public RPCs, none needing an API key
+	Curated    bool     // the chain is in khedra's curated overlay
+}
+
+// Explorer returns the URL of the preferred block explorer, or "" if none is
+// known.
+func (i Info) Explorer() string {
+	if len(i.Explorers) == 0 {
+		return ""
+	}
+	return i.Explorers[0].URL
+}
+
+type catalog struct {
+	byID   map[int]Info
+	byName map[string]int
+	all    []Info
+}
+
+var (
+	loaded   *catalog
+	loadOnce sync.Once
+)
+
+func get() *catalog {
+	loadOnce.Do(func() {
+		c, err := load(chainList, curated)
+		if err != nil {
+			panic(fmt.Sprintf("chains: bundled catalog is invalid: %v", err))
+		}
+		loaded = c
+	})
+	return loaded
+}
+
+// All returns every chain in the catalog ordered by chain id.
+func All() []Info {
+	return append([]Info(nil), get().all...)
+}
+
+// Featured returns the curated chains, mainnet first, then the other
+// production chains and finally the testnets, each group ordered by chain id.
+func Featured() []Info {
+	var out []Info
+	for _, i := range get().all {
+		if i.Curated {
+			out = append(out, i)
+		}
+	}
+	rank := func(i Info) int {
+		switch {
+		case i.ChainID == 1:
+			return 0
+		case i.Testnet:
+			return 2
+		}
+		return 1
+	}
+	sort.SliceStable(out, func(a, b int) bool {
+		return rank(out[a]) < rank(out[b])
+	})
+	return out
+}
+
+// ByID returns the chain with the given chain id.
+func ByID(id int) (Info, bool) {
+	i, ok := get().byID[id]
+	return i, ok
+}
+
+// ByName returns the chain with the given canonical name or alias. The lookup
+// ignores case.
+func ByName(name string) (Info, bool) {
+	id, ok := get().byName[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Info{}, false
+	}
+	return ByID(id)
+}
+
+// Normalize returns the canonical name for name if it is a known name or
+// alias, otherwise name trimmed and lower cased.
+func Normalize(name string) string {
+	if i, ok := ByName(name); ok {
+		return i.Name
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// NameFor returns the canonical name of the chain with the given id, or
+// chain-<id> if the catalog does not know it.
+func NameFor(id int) string {
+	if i, ok := ByID(id); ok {
+		return i.Name
+	}
+	return fmt.Sprintf("chain-%d", id)
+}
+
+// listItem is one entry of the bundled chain list.
+type listItem struct {
+	Name           string `json:"name"`
+	Title          string `json:"title"`
+	ShortName      string `json:"shortName"`
+	ChainID        int    `json:"chainId"`
+	Status         string `json:"status"`
+	NativeCurrency struct {
+		Symbol string `json:"symbol"`
+	} `json:"nativeCurrency"`
+	Explorers []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"explorers"`
+	RPC []string `json:"rpc"`
+}
+
+// overlayItem is one entry of the curated overlay, keyed by khedra name.
+type overlayItem struct {
+	ChainID        string   `json:"chainId"`
+	Aliases        []string `json:"aliases"`
+	RemoteExplorer string   `json:"remoteExplorer"`
+	Symbol         string   `json:"symbol"`
+	BlockTime      float64  `json:"blockTime"` // seconds
+	Testnet        bool     `json:"testnet"`
+	Deprecated     bool     `json:"deprecated"`
+	RPCs           []string `json:"rpcs"`
+}
+
+var nonKeyChars = regexp.MustCompile("[^a-zA-Z0-9_.-]+")
+
+// toKey turns a chain list name into a khedra chain name.
+func toKey(s string) string {
+	return strings.ToLower(nonKeyChars.ReplaceAllString(strings.TrimSpace(s), "_"))
+}
+
+// looksLikeTestnet guesses the testnet flag for chains outside the overlay.
+func looksLikeTestnet(item listItem) bool {
+	s := strings.ToLower(item.Name + " " + item.Title)
+	for _, w := range []string{"testnet", "devnet", "sepolia", "goerli", "holesky"} {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicRpc reports whether u is an http(s) RPC usable without an API key.
+func publicRpc(u string) bool {
+	return (strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://")) && !strings.Contains(u, "${")
+}
+
+func load(listGz, overlayData []byte) (*catalog, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(listGz))
+	if err != nil {
+		return nil, fmt.Errorf("chain list: %w", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("chain list: %w", err)
+	}
+	var list []listItem
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("chain list: %w", err)
+	}
+	var overlay map[string]overlayItem
+	if err := json.Unmarshal(overlayData, &overlay); err != nil {
+		return nil, fmt.Errorf("chains.json: %w", err)
+	}
+
+	c := &catalog{byID: map[int]Info{}, byName: map[string]int{}}
+	for _, item := range list {
+		if item.ChainID <= 0 {
+			continue
+		}
+		if _, dup := c.byID[item.ChainID]; dup {
+			continue
+		}
+		info := Info{
+			Name:       toKey(item.Name),
+			ChainID:    item.ChainID,
+			Title:      item.Name,
+			Symbol:     item.NativeCurrency.Symbol,
+			Testnet:    looksLikeTestnet(item),
+			Deprecated: item.Status == "deprecated",
+		}
+		if item.ShortName != "" && strings.ToLower(item.ShortName) != info.Name {
+			info.Aliases = []string{strings.ToLower(item.ShortName)}
+		}
+		for _, e := range item.Explorers {
+			info.Explorers = append(info.Explorers, Explorer{Name: e.Name, URL: strings.TrimSuffix(e.URL, "/")})
+		}
+		for _, u := range item.RPC {
+			if publicRpc(u) && len(info.RPCs) < maxSuggestedRpcs {
+				info.RPCs = append(info.RPCs, u)
+			}
+		}
+		c.byID[item.ChainID] = info
+	}
+
+	for name, o := range overlay {
+		id, err := strconv.Atoi(o.ChainID)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("chains.json: %s has invalid chainId %q", name, o.ChainID)
+		}
+		info, ok := c.byID[id]
+		if !ok {
+			info = Info{ChainID: id, Title: name}
+		}
+		if info.Name != name && info.Name != "" {
+			info.Aliases = append([]string{info.Name}, info.Aliases...)
+		}
+		info.Name = name
+		info.Aliases = mergeUnique(o.Aliases, info.Aliases, name)
+		if o.Symbol != "" {
+			info.Symbol = o.Symbol
+		}
+		if o.RemoteExplorer != "" {
+			preferred := Explorer{URL: strings.TrimSuffix(o.RemoteExplorer, "/")}
+			rest := []Explorer{}
+			for _, e := range info.Explorers {
+				if e.URL == preferred.URL {
+					preferred.Name = e.Name
+				} else {
+					rest = append(rest, e)
+				}
+			}
+			info.Explorers = append([]Explorer{preferred}, rest...)
+		}
+		info.BlockTime = time.Duration(o.BlockTime * float64(time.Second))
+		info.Testnet = o.Testnet
+		info.Deprecated = o.Deprecated
+		if len(o.RPCs) > 0 {
+			info.RPCs = mergeUnique(o.RPCs, info.RPCs, "")
+			if len(info.RPCs) > maxSuggestedRpcs {
+				info.RPCs = info.RPCs[:maxSuggestedRpcs]
+			}
+		}
+		info.Curated = true
+		c.byID[id] = info
+	}
+
+	for _, info := range c.byID {
+		c.all = append(c.all, info)
+	}
+	sort.Slice(c.all, func(a, b int) bool { return c.all[a].ChainID < c.all[b].ChainID })
+
+	// Curated names win over anything else, then canonical names, then aliases,
+	// so a chain list short name never shadows a khedra name.
+	register := func(name string, id int) {
+		if _, taken := c.byName[name]; !taken && name != "" {
+			c.byName[name] = id
+		}
+	}
+	for _, info := range c.all {
+		if info.Curated {
+			register(info.Name, info.ChainID)
+			for _, a := range info.Aliases {
+				register(a, info.ChainID)
+			}
+		}
+	}
+	for _, info := range c.all {
+		register(info.Name, info.ChainID)
+	}
+	for _, info := range c.all {
+		for _, a := range info.Aliases {
+			register(a, info.ChainID)
+		}
+	}
+	return c, nil
+}
+
+// mergeUnique appends the entries of extra to first, skipping duplicates and
+// skip.
+func mergeUnique(first, extra []string, skip string) []string {
+	seen := map[string]bool{skip: true}
+	var out []string
+	for _, s := range append(append([]string(nil), first...), extra...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
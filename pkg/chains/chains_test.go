@@ -0,0 +1,106 @@
+package chains
+
+import (
+	"testing"
+	"time"
+)
+
+func TestByID(t *testing.T) {
+	i, ok := ByID(1)
+	if !ok {
+		t.Fatal("mainnet missing from the catalog")
+	}
+	if i.Name != "mainnet" || i.Symbol != "ETH" || i.Explorer() != "https://etherscan.io" || !i.Curated {
+		t.Fatalf("unexpected mainnet entry %+v", i)
+	}
+	if i.BlockTime != 12*time.Second || i.Testnet || i.Deprecated {
+		t.Fatalf("unexpected mainnet flags %+v", i)
+	}
+	if len(i.RPCs) == 0 || len(i.RPCs) > maxSuggestedRpcs {
+		t.Fatalf("expected 1..%d suggested rpcs, got %v", maxSuggestedRpcs, i.RPCs)
+	}
+
+	if g, _ := ByID(100); g.Symbol != "xDAI" || g.Name != "gnosis" {
+		t.Fatalf("expected the overlay to win for gnosis, got %+v", g)
+	}
+	if h, _ := ByID(17000); !h.Testnet || !h.Deprecated {
+		t.Fatalf("expected holesky to be a deprecated testnet, got %+v", h)
+	}
+
+	// Chains outside the overlay come straight from the chain list
+	if b, ok := ByID(56); !ok || b.Curated || b.Symbol != "BNB" || b.Name != "bnb_smart_chain_mainnet" {
+		t.Fatalf("unexpected bnb entry %+v", b)
+	}
+	for _, u := range mustID(t, 56).RPCs {
+		if !publicRpc(u) {
+			t.Fatalf("suggested rpc %q needs a key or is not http", u)
+		}
+	}
+	if _, ok := ByID(987654321); ok {
+		t.Fatal("expected unknown chain id to be missing")
+	}
+}
+
+func TestByName(t *testing.T) {
+	tests := map[string]int{
+		"mainnet":          1,
+		"Ethereum":         1,
+		"eth":              1,
+		"ethereum_mainnet": 1,
+		"op_mainnet":       10,
+		"OP":               10,
+		"xdai":             100,
+		"arb1":             42161,
+		"sepolia":          11155111,
+		"bnb":              56,
+	}
+	for name, want := range tests {
+		i, ok := ByName(name)
+		if !ok || i.ChainID != want {
+			t.Fatalf("ByName(%q): expected chain %d, got %+v (%v)", name, want, i, ok)
+		}
+	}
+	if _, ok := ByName("nowhere"); ok {
+		t.Fatal("expected unknown name to be missing")
+	}
+
+	if n := Normalize(" Ethereum "); n != "mainnet" {
+		t.Fatalf("expected mainnet, got %q", n)
+	}
+	if n := Normalize("MyChain"); n != "mychain" {
+		t.Fatalf("expected mychain, got %q", n)
+	}
+	if n := NameFor(10); n != "optimism" {
+		t.Fatalf("expected optimism, got %q", n)
+	}
+	if n := NameFor(987654321); n != "chain-987654321" {
+		t.Fatalf("expected synthetic name, got %q", n)
+	}
+}
+
+func TestFeatured(t *testing.T) {
+	f := Featured()
+	if len(f) == 0 || f[0].Name != "mainnet" {
+		t.Fatalf("expected mainnet first, got %+v", f)
+	}
+	seenTestnet := false
+	for _, i := range f {
+		if !i.Curated {
+			t.Fatalf("featured chain %s is not curated", i.Name)
+		}
+		if i.Testnet {
+			seenTestnet = true
+		} else if seenTestnet {
+			t.Fatalf("production chain %s listed after a testnet", i.Name)
+		}
+	}
+}
+
+func mustID(t *testing.T, id int) Info {
+	t.Helper()
+	i, ok := ByID(id)
+	if !ok {
+		t.Fatalf("chain %d missing", id)
+	}
+	return i
+}
@@ -0,0 +1,262 @@
+// Package chifra reads and writes chifra's trueBlocks.toml. The file is kept
+// as a tree of tables, so keys khedra knows nothing about (API keys, pinning,
+// per-chain scrape settings) survive a rewrite, along with the text it was
+// read from, so a rewrite changes only the lines of the keys that changed.
+package chifra
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// FileName is the name of chifra's config file in its root folder.
+const FileName = "trueBlocks.toml"
+
+// Config is a parsed trueBlocks.toml.
+type Config struct {
+	tree map[string]any
+	src  []byte // the text tree was parsed from, if any
+}
+
+// Change is one key that differs between two configs. Old is empty for an
+// added key and New for a removed one.
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s: added %s", c.Key, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: removed %s", c.Key, c.Old)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Key, c.Old, c.New)
+	}
+}
+
+// secrets are keys whose values are never shown.
+var secrets = map[string]bool{"apiKey": true, "secret": true, "jwt": true, "license": true}
+
+// IsSecret reports whether the dotted key holds a value that must not be
+// shown, such as an API key.
+func IsSecret(key string) bool {
+	return secrets[key[strings.LastIndex(key, ".")+1:]]
+}
+
+// Load reads the file at path. A missing file is an empty config.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{tree: map[string]any{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse reads a config from TOML.
+func Parse(data []byte) (*Config, error) {
+	tree := map[string]any{}
+	if err := toml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return &Config{tree: tree, src: data}, nil
+}
+
+// Get returns the value at path (table names, then the key).
+func (c *Config) Get(path ...string) (any, bool) {
+	var cur any = c.tree
+	for _, p := range path {
+		table, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = table[p]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Set stores value at path, creating tables as needed. A value that is not a
+// table replaces anything in its way.
+func (c *Config) Set(value any, path ...string) {
+	table := c.tree
+	for _, p := range path[:len(path)-1] {
+		next, ok := table[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			table[p] = next
+		}
+		table = next
+	}
+	table[path[len(path)-1]] = value
+}
+
+// SetDefault stores value at path only if nothing is there yet.
+func (c *Config) SetDefault(value any, path ...string) {
+	if _, ok := c.Get(path...); !ok {
+		c.Set(value, path...)
+	}
+}
+
+// Tables returns the names of the tables under path, sorted.
+func (c *Config) Tables(path ...string) []string {
+	v, _ := c.Get(path...)
+	table, _ := v.(map[string]any)
+	var names []string
+	for k, v := range table {
+		if _, ok := v.(map[string]any); ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flatten returns every key as a dotted path with its value rendered as text.
+func (c *Config) Flatten() map[string]string {
+	out := map[string]string{}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		if table, ok := v.(map[string]any); ok {
+			for k, sub := range table {
+				key := k
+				if prefix != "" {
+					key = prefix + "." + k
+				}
+				walk(key, sub)
+			}
+			return
+		}
+		out[prefix] = fmt.Sprint(v)
+	}
+	walk("", c.tree)
+	return out
+}
+
+// Clone returns a deep copy of the config.
+func (c *Config) Clone() *Config {
+	var clone func(v any) any
+	clone = func(v any) any {
+		switch t := v.(type) {
+		case map[string]any:
+			m := make(map[string]any, len(t))
+			for k, sub := range t {
+				m[k] = clone(sub)
+			}
+			return m
+		case []any:
+			return append([]any(nil), t...)
+		default:
+			return v
+		}
+	}
+	return &Config{tree: clone(c.tree).(map[string]any), src: c.src}
+}
+
+// Diff lists the keys that differ from old to c, sorted by key. Secret
+// values are shown only as "(set)".
+func (c *Config) Diff(old *Config) []Change {
+	before, after := old.Flatten(), c.Flatten()
+	var out []Change
+	for k, v := range after {
+		if prev, ok := before[k]; !ok || prev != v {
+			out = append(out, Change{Key: k, Old: before[k], New: v})
+		}
+	}
+	for k, v := range before {
+		if _, ok := after[k]; !ok {
+			out = append(out, Change{Key: k, Old: v})
+		}
+	}
+	for i := range out {
+		if IsSecret(out[i].Key) {
+			out[i].Old, out[i].New = mask(out[i].Old), mask(out[i].New)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+func mask(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "(set)"
+}
+
+// Marshal renders the config as TOML with tables indented as chifra writes
+// them.
+func (c *Config) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.SetIndentTables(true)
+	if err := enc.Encode(c.tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Render returns the config as TOML. A config read from a file is rendered
+// as that file with only the changed keys edited, keeping its comments and
+// order; kept is false if that was not possible and the whole file was
+// rendered anew by Marshal.
+func (c *Config) Render() (data []byte, kept bool, err error) {
+	if len(c.src) == 0 {
+		data, err = c.Marshal()
+		return data, true, err
+	}
+	if old, err := Parse(c.src); err == nil {
+		if data, ok := patch(c.src, old, c); ok {
+			return data, true, nil
+		}
+	}
+	data, err = c.Marshal()
+	return data, false, err
+}
+
+// Save writes the config to path through a temporary file, so a crash leaves
+// either the old file or the new one. An existing file keeps its mode, as it
+// may hold API keys. It reports whether the comments and order of the file
+// the config was read from were kept (see Render).
+func (c *Config) Save(path string) (bool, error) {
+	data, kept, err := c.Render()
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp, mode); err != nil { // WriteFile leaves the mode of a stale temporary file
+		_ = os.Remove(tmp)
+		return false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return false, err
+	}
+	return kept, nil
+}
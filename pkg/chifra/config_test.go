@@ -0,0 +1,179 @@
+package chifra
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfig_SetAndDiff(t *testing.T) {
+	old, err := Parse([]byte(`
+[keys.etherscan]
+  apiKey = "abc"
+
+[chains.mainnet]
+  rpcProvider = "http://old"
+  symbol = "ETH"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := old.Clone()
+	cfg.Set("http://new", "chains", "mainnet", "rpcProvider")
+	cfg.SetDefault("WEI", "chains", "mainnet", "symbol")
+	cfg.Set("def", "keys", "etherscan", "apiKey")
+	cfg.Set("1", "chains", "gnosis", "chainId")
+
+	if v, _ := old.Get("chains", "mainnet", "rpcProvider"); v != "http://old" {
+		t.Fatalf("Clone should not share tables, got %v", v)
+	}
+	if v, _ := cfg.Get("chains", "mainnet", "symbol"); v != "ETH" {
+		t.Fatalf("SetDefault should keep an existing value, got %v", v)
+	}
+	if got := cfg.Tables("chains"); len(got) != 2 || got[0] != "gnosis" || got[1] != "mainnet" {
+		t.Fatalf("unexpected tables %v", got)
+	}
+
+	want := []Change{
+		{Key: "chains.gnosis.chainId", New: "1"},
+		{Key: "chains.mainnet.rpcProvider", Old: "http://old", New: "http://new"},
+		{Key: "keys.etherscan.apiKey", Old: "(set)", New: "(set)"},
+	}
+	got := cfg.Diff(old)
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want[i], got[i])
+		}
+	}
+	if diff := old.Diff(old.Clone()); len(diff) != 0 {
+		t.Fatalf("expected no changes, got %v", diff)
+	}
+}
+
+func TestConfig_SaveAndLoad(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "sub", FileName)
+	empty, err := Load(fn)
+	if err != nil || len(empty.Flatten()) != 0 {
+		t.Fatalf("a missing file should load empty, got %v (%v)", empty.Flatten(), err)
+	}
+
+	empty.Set([]any{"http://a", "http://b"}, "chains", "mainnet", "rpcProviders")
+	empty.Set(int64(2000000), "chains", "mainnet", "scrape", "appsPerChunk")
+	if _, err := empty.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := loaded.Diff(empty); len(diff) != 0 {
+		t.Fatalf("expected a round trip without changes, got %v", diff)
+	}
+
+	// A file kept private stays private
+	if err := os.Chmod(fn, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Set("abc", "keys", "etherscan", "apiKey")
+	if _, err := loaded.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(fn); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the file's mode to be kept, got %v (%v)", info.Mode(), err)
+	}
+
+	if err := os.WriteFile(fn, []byte("[chains\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(fn); err == nil {
+		t.Fatal("expected a parse error")
+	}
+}
+
+func TestConfig_SaveKeepsComments(t *testing.T) {
+	src := `# my chifra config
+[version]
+  current = "v6.0.0"
+
+[settings]
+  # where the index lives
+  indexPath = "/old/index" # moved later
+  defaultChain = "gnosis"
+
+[chains]
+  [chains.mainnet]
+    chain = "mainnet"
+    rpcProviders = [
+      "http://a",
+      "http://b",
+    ]
+    apiKey = "secret" # keep me
+`
+	fn := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(fn, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Set("/new/index", "settings", "indexPath")
+	cfg.Set("/cache", "settings", "cachePath")
+	cfg.Set([]any{"http://c"}, "chains", "mainnet", "rpcProviders")
+	cfg.Set("gnosis", "chains", "gnosis", "chain")
+	kept, err := cfg.Save(fn)
+	if err != nil || !kept {
+		t.Fatalf("expected the file to be patched, got kept=%v (%v)", kept, err)
+	}
+
+	data, _ := os.ReadFile(fn)
+	want := `# my chifra config
+[version]
+  current = "v6.0.0"
+
+[settings]
+  # where the index lives
+  indexPath = '/new/index' # moved later
+  defaultChain = "gnosis"
+  cachePath = '/cache'
+
+[chains]
+  [chains.mainnet]
+    chain = "mainnet"
+    rpcProviders = ['http://c']
+    apiKey = "secret" # keep me
+
+[chains.gnosis]
+  chain = 'gnosis'
+`
+	if string(data) != want {
+		t.Fatalf("got\n%s\nwant\n%s", data, want)
+	}
+	loaded, err := Load(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := loaded.Diff(cfg); len(diff) != 0 {
+		t.Fatalf("expected the patched file to load as saved, got %v", diff)
+	}
+}
+
+func TestConfig_SaveRewritesWhenKeyRemoved(t *testing.T) {
+	cfg, err := Parse([]byte("# note\n[settings]\n  a = 1\n  b = 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(cfg.tree["settings"].(map[string]any), "b")
+	data, kept, err := cfg.Render()
+	if err != nil || kept {
+		t.Fatalf("expected a full rewrite, got kept=%v (%v)", kept, err)
+	}
+	if strings.Contains(string(data), "# note") {
+		t.Fatalf("a rewritten file has no comments, got %s", data)
+	}
+}
@@ -0,0 +1,338 @@
+package chifra
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// leaf is a key that holds a value rather than a table.
+type leaf struct {
+	path  []string
+	value any
+}
+
+// leaves returns every leaf of tree by its path joined with NUL.
+func leaves(tree map[string]any) map[string]leaf {
+	out := map[string]leaf{}
+	var walk func(prefix []string, table map[string]any)
+	walk = func(prefix []string, table map[string]any) {
+		for k, v := range table {
+			path := append(append([]string(nil), prefix...), k)
+			if sub, ok := v.(map[string]any); ok {
+				walk(path, sub)
+				continue
+			}
+			out[strings.Join(path, "\x00")] = leaf{path: path, value: v}
+		}
+	}
+	walk(nil, tree)
+	return out
+}
+
+// span is the lines [first, last] of src that hold one key and its value.
+type span struct {
+	first, last int
+}
+
+// layout is where each key and table of a TOML text is.
+type layout struct {
+	keys      map[string]span // by path joined with NUL
+	headers   map[string]int  // line of each [table] header, by path joined with NUL
+	tableEnds map[string]int  // last line holding a key of each [table]
+	indents   map[string]string
+	dotted    map[string]bool // tables defined by dotted keys, which cannot get a header
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// patch returns src, whose parse is old, with the leaves of c that differ
+// from old edited in place: a changed value is replaced on its line, a new key
+// goes after the last key of its table and a new table at the end. Comments,
+// order and formatting of everything else are kept. It returns false if that
+// is not possible, for example for a removed key or a changed multi-line
+// string, or if the result would not parse back to c.
+func patch(src []byte, old, c *Config) ([]byte, bool) {
+	before, after := leaves(old.tree), leaves(c.tree)
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			return nil, false
+		}
+	}
+	var changed []leaf
+	for id, l := range after {
+		if prev, ok := before[id]; !ok || render(prev.value) != render(l.value) {
+			changed = append(changed, l)
+		}
+	}
+	if len(changed) == 0 {
+		return src, true
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		return strings.Join(changed[i].path, "\x00") < strings.Join(changed[j].path, "\x00")
+	})
+
+	lines := strings.Split(string(src), "\n")
+	lay, ok := scan(lines)
+	if !ok {
+		return nil, false
+	}
+
+	type edit struct {
+		at, drop int
+		lines    []string
+	}
+	var edits []edit
+	inserts := map[int][]string{} // new keys to add after a line
+	var newTables []string
+	newTableKeys := map[string][]leaf{}
+	for _, l := range changed {
+		id := strings.Join(l.path, "\x00")
+		value := render(l.value)
+		if value == "" {
+			return nil, false
+		}
+		if sp, ok := lay.keys[id]; ok {
+			line := lines[sp.first]
+			eq := indexOutside(line, '=')
+			if eq < 0 {
+				return nil, false
+			}
+			comment := ""
+			if sp.first == sp.last {
+				if i := indexOutside(line, '#'); i > eq {
+					comment = " " + line[i:]
+				}
+			}
+			keyText := strings.TrimRight(line[:eq], " \t")
+			edits = append(edits, edit{at: sp.first, drop: sp.last - sp.first + 1, lines: []string{keyText + " = " + value + comment}})
+			continue
+		}
+		table := strings.Join(l.path[:len(l.path)-1], "\x00")
+		key := quoteKey(l.path[len(l.path)-1])
+		if at, ok := lay.tableEnds[table]; ok {
+			inserts[at] = append(inserts[at], lay.indents[table]+key+" = "+value)
+			continue
+		}
+		if lay.dotted[table] {
+			return nil, false
+		}
+		if _, ok := newTableKeys[table]; !ok {
+			newTables = append(newTables, table)
+		}
+		newTableKeys[table] = append(newTableKeys[table], l)
+	}
+	for at, add := range inserts {
+		edits = append(edits, edit{at: at + 1, lines: add})
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].at > edits[j].at })
+	for _, e := range edits {
+		rest := append(append([]string(nil), e.lines...), lines[e.at+e.drop:]...)
+		lines = append(lines[:e.at], rest...)
+	}
+
+	out := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	for _, table := range newTables {
+		var header []string
+		for _, p := range strings.Split(table, "\x00") {
+			header = append(header, quoteKey(p))
+		}
+		out += "\n\n[" + strings.Join(header, ".") + "]"
+		for _, l := range newTableKeys[table] {
+			out += "\n  " + quoteKey(l.path[len(l.path)-1]) + " = " + render(l.value)
+		}
+	}
+	out += "\n"
+
+	check, err := Parse([]byte(out))
+	if err != nil || len(c.Diff(check)) != 0 {
+		return nil, false
+	}
+	return []byte(out), true
+}
+
+// scan finds the keys and tables of a TOML text. It returns false for
+// arrays of tables, which are never patched.
+func scan(lines []string) (layout, bool) {
+	lay := layout{
+		keys:      map[string]span{},
+		headers:   map[string]int{},
+		tableEnds: map[string]int{},
+		indents:   map[string]string{},
+		dotted:    map[string]bool{},
+	}
+	var table []string
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[[") {
+			return lay, false
+		}
+		if strings.HasPrefix(line, "[") {
+			end := indexOutside(line, ']')
+			if end < 0 {
+				return lay, false
+			}
+			table = splitKey(line[1:end])
+			id := strings.Join(table, "\x00")
+			lay.headers[id] = i
+			lay.tableEnds[id] = i
+			lay.indents[id] = leadingSpace(lines[i]) + "  "
+			continue
+		}
+		eq := indexOutside(line, '=')
+		if eq < 0 {
+			return lay, false
+		}
+		key := splitKey(line[:eq])
+		path := append(append([]string(nil), table...), key...)
+		last, ok := valueEnd(lines, i, strings.TrimSpace(line[eq+1:]))
+		if !ok {
+			return lay, false
+		}
+		id := strings.Join(path, "\x00")
+		lay.keys[id] = span{first: i, last: last}
+		tableID := strings.Join(table, "\x00")
+		lay.tableEnds[tableID] = last
+		lay.indents[tableID] = leadingSpace(lines[i])
+		for n := len(table) + 1; n < len(path); n++ {
+			lay.dotted[strings.Join(path[:n], "\x00")] = true
+		}
+		i = last
+	}
+	return lay, true
+}
+
+// valueEnd returns the last line of the value that starts on line i.
+func valueEnd(lines []string, i int, value string) (int, bool) {
+	for _, quote := range []string{`"""`, `'''`} {
+		if strings.HasPrefix(value, quote) {
+			if strings.Contains(value[3:], quote) {
+				return i, true
+			}
+			for j := i + 1; j < len(lines); j++ {
+				if strings.Contains(lines[j], quote) {
+					return j, true
+				}
+			}
+			return i, false
+		}
+	}
+	if !strings.HasPrefix(value, "[") && !strings.HasPrefix(value, "{") {
+		return i, true
+	}
+	depth := 0
+	for j := i; j < len(lines); j++ {
+		text := lines[j]
+		if j == i {
+			text = value
+		}
+		depth += bracketDepth(text)
+		if depth <= 0 {
+			return j, true
+		}
+	}
+	return i, false
+}
+
+// bracketDepth returns how many more brackets and braces s opens than it
+// closes, outside strings and comments.
+func bracketDepth(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#':
+			return depth
+		case ch == '[' || ch == '{':
+			depth++
+		case ch == ']' || ch == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// indexOutside returns the index of the first c in s that is not inside a
+// quoted string, or -1.
+func indexOutside(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitKey splits a dotted key into its parts, unquoting quoted ones.
+func splitKey(s string) []string {
+	var parts []string
+	for s = strings.TrimSpace(s); ; {
+		dot := indexOutside(s, '.')
+		part := s
+		if dot >= 0 {
+			part = s[:dot]
+		}
+		part = strings.TrimSpace(part)
+		if unq, err := strconv.Unquote(part); err == nil && strings.HasPrefix(part, `"`) {
+			part = unq
+		} else {
+			part = strings.Trim(part, `'`)
+		}
+		parts = append(parts, part)
+		if dot < 0 {
+			return parts
+		}
+		s = s[dot+1:]
+	}
+}
+
+// quoteKey returns k as a TOML key.
+func quoteKey(k string) string {
+	if bareKey.MatchString(k) {
+		return k
+	}
+	return strconv.Quote(k)
+}
+
+// render returns v as a TOML value, or "" if it cannot.
+func render(v any) string {
+	b, err := toml.Marshal(map[string]any{"v": v})
+	if err != nil {
+		return ""
+	}
+	s := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(s, "v = ") {
+		return ""
+	}
+	return strings.TrimPrefix(s, "v = ")
+}
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
@@ -0,0 +1,260 @@
+package client
+
+import (
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/budget"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/cache"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chainguard"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/control"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// The types below are the wire format of the control API. The daemon's handlers
+// encode these same types, so a field added here is added on both sides.
+
+// ErrorResponse is the body of every non-200 control API response.
+type ErrorResponse struct {
+	Error         string `json:"error"`
+	RetryAfterSec int    `json:"retryAfterSec,omitempty"` // set when rate limited
+}
+
+// ServiceResult is one entry of a /status, /isPaused, /pause, /unpause or
+// /restart response.
+type ServiceResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// PauseRequest pauses a service through /pause. The pause is saved by the
+// daemon and survives a restart; a non-zero For lifts it after that long.
+type PauseRequest struct {
+	Name   string
+	Reason string
+	For    time.Duration
+}
+
+// DashboardState is returned by /dashboard/state.
+type DashboardState struct {
+	Version         string             `json:"version"`
+	Services        []DashboardService `json:"services"`
+	Chains          []DashboardChain   `json:"chains"`
+	Paths           DashboardPaths     `json:"paths"`
+	LogTail         []string           `json:"logTail"`
+	LogToFile       bool               `json:"logToFile"`
+	LoggingFilename string             `json:"loggingFilename"`
+	PausedSummary   PausedSummary      `json:"pausedSummary"`
+	Cache           DashboardCache     `json:"cache"`
+	Budgets         []budget.Status    `json:"budgets,omitempty"`
+	ChainEvents     []chainguard.Event `json:"chainEvents,omitempty"` // chains quarantined or released, newest first
+	Schema          int                `json:"schema"`
+}
+
+// DashboardService is a configured service as shown on the dashboard.
+type DashboardService struct {
+	Name        string    `json:"name"`
+	State       string    `json:"state"` // running or paused
+	Pausable    bool      `json:"pausable"`
+	Port        int       `json:"port"`
+	PauseReason string    `json:"pauseReason,omitempty"`
+	PausedUntil time.Time `json:"pausedUntil,omitzero"`
+}
+
+// DashboardChain is an enabled chain as shown on the dashboard.
+type DashboardChain struct {
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+	Rpc        string `json:"rpc"`
+	CacheBytes int64  `json:"cacheBytes,omitempty"` // as of the latest measurement of the cache
+	OutOfQuota bool   `json:"outOfQuota,omitempty"` // every RPC is out of its daily quota, so scraping waits
+	Quarantine string `json:"quarantine,omitempty"` // why the chain is quarantined, if it is
+}
+
+// DashboardPaths are the folders the daemon writes to.
+type DashboardPaths struct {
+	Data  string `json:"data"`
+	Cache string `json:"cache"`
+	Logs  string `json:"logs"`
+}
+
+// DashboardCache is the size of the cache and its limits (zero for none).
+// Scanned is zero until the daemon has measured the cache.
+type DashboardCache struct {
+	Bytes        int64     `json:"bytes"`
+	Files        int       `json:"files"`
+	MaxSize      int64     `json:"maxSize,omitempty"`
+	MaxChainSize int64     `json:"maxChainSize,omitempty"`
+	Scanned      time.Time `json:"scanned,omitzero"`
+	LastPrune    time.Time `json:"lastPrune,omitzero"`
+	LastFreed    int64     `json:"lastFreed,omitempty"`
+}
+
+// PausedSummary lists the paused services.
+type PausedSummary struct {
+	Paused        []string `json:"paused"`
+	TotalPausable int      `json:"totalPausable"`
+}
+
+// RpcTestRequest asks /install/rpc-test to probe an RPC. An empty Rpc probes
+// the configured mainnet RPC. Session identifies the caller for rate limiting.
+type RpcTestRequest struct {
+	Rpc     string
+	Session string
+}
+
+// RpcTestResult is returned by /install/rpc-test.
+type RpcTestResult struct {
+	OK            bool   `json:"ok"`
+	ChainID       string `json:"chainId"`
+	ChainName     string `json:"chainName"`
+	ClientVersion string `json:"clientVersion"`
+	Error         string `json:"error"`
+	LatencyMS     int64  `json:"latencyMs"`
+}
+
+// ChainAddResult is returned by /install/chain_add. Capabilities warns about
+// any feature the scraper needs that the RPC lacks; the chain is added anyway.
+type ChainAddResult struct {
+	OK           bool                  `json:"ok"`
+	Chain        *ChainStatus          `json:"chain,omitempty"`
+	Probe        *rpc.PingResult       `json:"probe,omitempty"`
+	Capabilities *install.Capabilities `json:"capabilities,omitempty"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// ChainStatus is a chain as saved to the install draft.
+type ChainStatus struct {
+	Name     string   `json:"name"`
+	ChainID  int      `json:"chainId"`
+	RPCs     []string `json:"rpcs"`
+	Enabled  bool     `json:"enabled"`
+	RpcValid bool     `json:"rpcValid"`
+}
+
+// OKResponse is returned by endpoints that only report success, such as
+// /install/chain_remove.
+type OKResponse struct {
+	OK bool `json:"ok"`
+}
+
+// ControlInfo is returned by /control/info.
+type ControlInfo struct {
+	OK          bool             `json:"ok"`
+	Metadata    control.Metadata `json:"metadata"`
+	Regenerated bool             `json:"regenerated"`
+}
+
+// LogsRequest filters /logs. Since and Until take a duration (1h) or an
+// RFC3339 timestamp, and Until also a page's Next; a zero Limit uses the
+// daemon's default.
+type LogsRequest struct {
+	Since string
+	Until string
+	Level string
+	Grep  string
+	Limit int
+}
+
+// AuditRequest filters /audit. Since and Until take a duration (1h) or an
+// RFC3339 timestamp, and Until also a page's Next; a zero Limit uses the
+// daemon's default.
+type AuditRequest struct {
+	Since  string
+	Until  string
+	Action string
+	Limit  int
+}
+
+// LogLevelRequest changes a level through /log-level. An empty Component
+// changes the global level; Level "default" removes a component's override.
+// A non-zero For reverts the change after that long.
+type LogLevelRequest struct {
+	Component string
+	Level     string
+	For       time.Duration
+}
+
+// LogLevels is returned by /log-level: the global level first, then any
+// component overrides.
+type LogLevels struct {
+	Levels []types.LevelSetting `json:"levels"`
+}
+
+// ConfigHistory is returned by /config/history, newest generation first.
+type ConfigHistory struct {
+	Generations []install.Generation `json:"generations"`
+}
+
+// ConfigDiff is returned by /config/diff: a unified diff from Generation to
+// the current config.yaml, empty if they are the same.
+type ConfigDiff struct {
+	Generation int    `json:"generation"`
+	Diff       string `json:"diff"`
+}
+
+// ConfigRollbackResult is returned by /config/rollback. Generation is the new
+// generation holding the restored config.
+type ConfigRollbackResult struct {
+	Generation install.Generation `json:"generation"`
+}
+
+// ConfigReloadResult is returned by /config/reload. DataFolder is the data
+// folder the daemon uses from now on.
+type ConfigReloadResult struct {
+	DataFolder string `json:"dataFolder"`
+}
+
+// CacheStats is returned by /cache/stats: the daemon's latest measurement of
+// the cache, its limits, and the last prune that ran with limits set.
+type CacheStats struct {
+	Stats     cache.Stats   `json:"stats"`
+	Policy    cache.Policy  `json:"policy"`
+	LastPrune *cache.Result `json:"lastPrune,omitempty"`
+}
+
+// IndexVerifyRequest starts a check of the index through /index/verify. No
+// Chains checks every enabled chain. Repair quarantines bad files and fetches
+// them again from Gateway (the default gateway if empty) unless Offline.
+type IndexVerifyRequest struct {
+	Chains  []string
+	Repair  bool
+	Quick   bool
+	Offline bool
+	Gateway string
+}
+
+// The states of an IndexJob.
+const (
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// IndexJob is returned by /index/verify: the running or last check of the
+// index, with the latest progress of each chain and what happened so far.
+type IndexJob struct {
+	ID       int                  `json:"id"`
+	State    string               `json:"state"`
+	Chains   []string             `json:"chains"`
+	Repair   bool                 `json:"repair"`
+	Quick    bool                 `json:"quick"`
+	Started  time.Time            `json:"started"`
+	Finished time.Time            `json:"finished,omitzero"`
+	Progress []index.Progress     `json:"progress"`
+	Events   []IndexEvent         `json:"events"`
+	Reports  []index.Report       `json:"reports"`
+	Repairs  []index.RepairResult `json:"repairs,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// IndexEvent is one step of an IndexJob.
+type IndexEvent struct {
+	Seq     int       `json:"seq"`
+	Time    time.Time `json:"time"`
+	Chain   string    `json:"chain,omitempty"`
+	Message string    `json:"message"`
+}
@@ -0,0 +1,388 @@
+// Package client talks to a running khedra daemon's control service. The CLI
+// uses it for every command that needs the daemon, and other tools can too.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/audit"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/budget"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/cache"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/install"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/logs"
+)
+
+// DefaultTimeout bounds each request made by a Client created with New.
+const DefaultTimeout = 10 * time.Second
+
+// Ports are the control service ports Discover tries, in order.
+var Ports = []string{"8338", "8337", "8336", "8335"}
+
+// ErrNotRunning is returned by Discover when no control service answers.
+var ErrNotRunning = errors.New("khedra daemon is not running. Start it with 'khedra daemon'")
+
+// Client calls the control API at BaseURL.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// New returns a client for the control service at baseURL (for example
+// http://localhost:8338).
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// Discover returns a client for the first local control service that answers.
+func Discover() (*Client, error) {
+	for _, port := range Ports {
+		u := "http://localhost:" + port
+		if utils.PingServer(u) {
+			return New(u), nil
+		}
+	}
+	return nil, ErrNotRunning
+}
+
+// Error is returned when the control service answers with a non-200 status.
+type Error struct {
+	StatusCode int
+	Message    string        // the error field of the body, or the raw body
+	RetryAfter time.Duration // set when the request was rate limited
+	raw        bool
+}
+
+func (e *Error) Error() string {
+	if e.raw {
+		return fmt.Sprintf("control service returned error: %s (status %d)", e.Message, e.StatusCode)
+	}
+	return fmt.Sprintf("control service returned error: %s", e.Message)
+}
+
+// Status reports whether name (or every service if empty) is paused.
+func (c *Client) Status(ctx context.Context, name string) ([]ServiceResult, error) {
+	return c.serviceOp(ctx, "/status", name)
+}
+
+// Pause pauses a service, or every pausable service if req.Name is "all".
+func (c *Client) Pause(ctx context.Context, req PauseRequest) ([]ServiceResult, error) {
+	params := url.Values{"name": {req.Name}}
+	if req.Reason != "" {
+		params.Set("reason", req.Reason)
+	}
+	if req.For > 0 {
+		params.Set("for", req.For.String())
+	}
+	var results []ServiceResult
+	err := c.do(ctx, http.MethodGet, "/pause", params, nil, &results)
+	return results, err
+}
+
+// Unpause resumes a service, or every pausable service if name is "all".
+func (c *Client) Unpause(ctx context.Context, name string) ([]ServiceResult, error) {
+	return c.serviceOp(ctx, "/unpause", name)
+}
+
+// Restart restarts a service, or every restartable service if name is "all"
+// or empty.
+func (c *Client) Restart(ctx context.Context, name string) ([]ServiceResult, error) {
+	return c.serviceOp(ctx, "/restart", name)
+}
+
+func (c *Client) serviceOp(ctx context.Context, path, name string) ([]ServiceResult, error) {
+	params := url.Values{}
+	if name != "" {
+		params.Set("name", name)
+	}
+	var results []ServiceResult
+	err := c.do(ctx, http.MethodGet, path, params, nil, &results)
+	return results, err
+}
+
+// DashboardState returns the state shown on the dashboard.
+func (c *Client) DashboardState(ctx context.Context) (DashboardState, error) {
+	var st DashboardState
+	err := c.do(ctx, http.MethodGet, "/dashboard/state", nil, nil, &st)
+	return st, err
+}
+
+// InstallState returns the state of the install wizard.
+func (c *Client) InstallState(ctx context.Context) (install.State, error) {
+	var st install.State
+	err := c.do(ctx, http.MethodGet, "/install/state", nil, nil, &st)
+	return st, err
+}
+
+// RpcTest asks the daemon to probe an RPC. A provider that fails the probe is
+// reported through the result's OK and Error fields rather than as an error.
+func (c *Client) RpcTest(ctx context.Context, req RpcTestRequest) (RpcTestResult, error) {
+	params := url.Values{}
+	if req.Rpc != "" {
+		params.Set("rpc", req.Rpc)
+	}
+	header := http.Header{}
+	if req.Session != "" {
+		header.Set("X-Khedra-Session", req.Session)
+	}
+	var res RpcTestResult
+	err := c.do(ctx, http.MethodGet, "/install/rpc-test", params, header, &res, http.StatusBadGateway)
+	return res, err
+}
+
+// RpcCapabilities asks the daemon which features (archive state, traces, wide
+// eth_getLogs ranges, batching...) rpcUrl supports.
+func (c *Client) RpcCapabilities(ctx context.Context, rpcUrl string) (install.Capabilities, error) {
+	var res install.Capabilities
+	err := c.do(ctx, http.MethodGet, "/install/rpc_capabilities", url.Values{"url": {rpcUrl}}, nil, &res)
+	return res, err
+}
+
+// ChainAdd probes rpcUrl and adds (or updates) its chain in the install draft.
+func (c *Client) ChainAdd(ctx context.Context, rpcUrl string) (ChainAddResult, error) {
+	var res ChainAddResult
+	err := c.do(ctx, http.MethodGet, "/install/chain_add", url.Values{"rpc": {rpcUrl}}, nil, &res)
+	return res, err
+}
+
+// ChainRemove removes a chain from the install draft. Mainnet cannot be removed.
+func (c *Client) ChainRemove(ctx context.Context, name string) error {
+	var res OKResponse
+	if err := c.do(ctx, http.MethodGet, "/install/chain_remove", url.Values{"name": {name}}, nil, &res); err != nil {
+		return err
+	}
+	if !res.OK {
+		return fmt.Errorf("control service refused to remove chain %q", name)
+	}
+	return nil
+}
+
+// ControlInfo returns the daemon's control metadata.
+func (c *Client) ControlInfo(ctx context.Context) (ControlInfo, error) {
+	var info ControlInfo
+	err := c.do(ctx, http.MethodGet, "/control/info", nil, nil, &info)
+	return info, err
+}
+
+// Logs returns a page of the daemon's log file.
+func (c *Client) Logs(ctx context.Context, req LogsRequest) (logs.Page, error) {
+	params := url.Values{}
+	if req.Since != "" {
+		params.Set("since", req.Since)
+	}
+	if req.Until != "" {
+		params.Set("until", req.Until)
+	}
+	if req.Level != "" {
+		params.Set("level", req.Level)
+	}
+	if req.Grep != "" {
+		params.Set("grep", req.Grep)
+	}
+	if req.Limit > 0 {
+		params.Set("limit", strconv.Itoa(req.Limit))
+	}
+	var page logs.Page
+	err := c.do(ctx, http.MethodGet, "/logs", params, nil, &page)
+	return page, err
+}
+
+// Audit returns a page of the daemon's audit log.
+func (c *Client) Audit(ctx context.Context, req AuditRequest) (audit.Page, error) {
+	params := url.Values{}
+	if req.Since != "" {
+		params.Set("since", req.Since)
+	}
+	if req.Until != "" {
+		params.Set("until", req.Until)
+	}
+	if req.Action != "" {
+		params.Set("action", req.Action)
+	}
+	if req.Limit > 0 {
+		params.Set("limit", strconv.Itoa(req.Limit))
+	}
+	var page audit.Page
+	err := c.do(ctx, http.MethodGet, "/audit", params, nil, &page)
+	return page, err
+}
+
+// LogLevels returns the daemon's running log levels.
+func (c *Client) LogLevels(ctx context.Context) (LogLevels, error) {
+	var res LogLevels
+	err := c.do(ctx, http.MethodGet, "/log-level", nil, nil, &res)
+	return res, err
+}
+
+// SetLogLevel changes a log level and returns the levels that result.
+func (c *Client) SetLogLevel(ctx context.Context, req LogLevelRequest) (LogLevels, error) {
+	params := url.Values{"level": {req.Level}}
+	if req.Component != "" {
+		params.Set("component", req.Component)
+	}
+	if req.For > 0 {
+		params.Set("for", req.For.String())
+	}
+	var res LogLevels
+	err := c.do(ctx, http.MethodPost, "/log-level", params, nil, &res)
+	return res, err
+}
+
+// ConfigHistory lists the kept generations of the daemon's config.yaml.
+func (c *Client) ConfigHistory(ctx context.Context) (ConfigHistory, error) {
+	var res ConfigHistory
+	err := c.do(ctx, http.MethodGet, "/config/history", nil, nil, &res)
+	return res, err
+}
+
+// ConfigDiff returns the changes from generation gen to the current config.yaml.
+func (c *Client) ConfigDiff(ctx context.Context, gen int) (ConfigDiff, error) {
+	var res ConfigDiff
+	err := c.do(ctx, http.MethodGet, "/config/diff", url.Values{"gen": {strconv.Itoa(gen)}}, nil, &res)
+	return res, err
+}
+
+// ConfigRollback restores generation gen as config.yaml and has the daemon
+// reload it.
+func (c *Client) ConfigRollback(ctx context.Context, gen int) (ConfigRollbackResult, error) {
+	var res ConfigRollbackResult
+	err := c.do(ctx, http.MethodPost, "/config/rollback", url.Values{"gen": {strconv.Itoa(gen)}}, nil, &res)
+	return res, err
+}
+
+// ConfigReload has the daemon load config.yaml again after it was changed on
+// disk, pointing chifra at the configured data folder.
+func (c *Client) ConfigReload(ctx context.Context) (ConfigReloadResult, error) {
+	var res ConfigReloadResult
+	err := c.do(ctx, http.MethodPost, "/config/reload", nil, nil, &res)
+	return res, err
+}
+
+// CacheStats returns the daemon's latest measurement of the cache, measuring
+// it first if refresh is set.
+func (c *Client) CacheStats(ctx context.Context, refresh bool) (CacheStats, error) {
+	params := url.Values{}
+	if refresh {
+		params.Set("refresh", "true")
+	}
+	var res CacheStats
+	err := c.do(ctx, http.MethodGet, "/cache/stats", params, nil, &res)
+	return res, err
+}
+
+// RpcBudgets returns the budget and usage of every RPC of the chains with
+// budgets.
+func (c *Client) RpcBudgets(ctx context.Context) ([]budget.Status, error) {
+	var res []budget.Status
+	err := c.do(ctx, http.MethodGet, "/rpc/budgets", nil, nil, &res)
+	return res, err
+}
+
+// CachePrune has the daemon prune the cache to its limits now, or with dryRun
+// only report what would be removed.
+func (c *Client) CachePrune(ctx context.Context, dryRun bool) (cache.Result, error) {
+	params := url.Values{}
+	if dryRun {
+		params.Set("dry_run", "true")
+	}
+	var res cache.Result
+	err := c.do(ctx, http.MethodPost, "/cache/prune", params, nil, &res)
+	return res, err
+}
+
+// IndexVerify starts a check of the index in the daemon and returns the new
+// job. It fails with status 409 if a check is already running.
+func (c *Client) IndexVerify(ctx context.Context, req IndexVerifyRequest) (IndexJob, error) {
+	params := url.Values{"chain": req.Chains}
+	for name, on := range map[string]bool{"repair": req.Repair, "quick": req.Quick, "offline": req.Offline} {
+		if on {
+			params.Set(name, "true")
+		}
+	}
+	if req.Gateway != "" {
+		params.Set("gateway", req.Gateway)
+	}
+	var job IndexJob
+	err := c.do(ctx, http.MethodPost, "/index/verify", params, nil, &job)
+	return job, err
+}
+
+// IndexJob returns the daemon's running or last check of the index.
+func (c *Client) IndexJob(ctx context.Context) (IndexJob, error) {
+	var job IndexJob
+	err := c.do(ctx, http.MethodGet, "/index/verify", nil, nil, &job)
+	return job, err
+}
+
+// IndexCancel stops the running check of the index.
+func (c *Client) IndexCancel(ctx context.Context) (IndexJob, error) {
+	var job IndexJob
+	err := c.do(ctx, http.MethodPost, "/index/verify/cancel", nil, nil, &job)
+	return job, err
+}
+
+// do sends one request and decodes a 200 response (or one of the extra
+// statuses listed in also) into out.
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, header http.Header, out any, also ...int) error {
+	u, err := url.Parse(c.BaseURL + path)
+	if err != nil {
+		return err
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to control service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	ok := resp.StatusCode == http.StatusOK
+	for _, code := range also {
+		ok = ok || resp.StatusCode == code
+	}
+	if !ok {
+		var apiErr ErrorResponse
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return &Error{
+				StatusCode: resp.StatusCode,
+				Message:    apiErr.Error,
+				RetryAfter: time.Duration(apiErr.RetryAfterSec) * time.Second,
+			}
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body)), raw: true}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/logs"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func TestLogs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("level") == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid level"}`))
+			return
+		}
+		if r.URL.Query().Get("limit") != "5" {
+			t.Errorf("expected limit 5, got %q", r.URL.RawQuery)
+		}
+		_ = json.NewEncoder(w).Encode(logs.Page{Lines: []logs.Line{{Level: "info", Text: "hello"}}})
+	}))
+	defer srv.Close()
+
+	cl := New(srv.URL)
+	page, err := cl.Logs(context.Background(), LogsRequest{Limit: 5})
+	if err != nil || len(page.Lines) != 1 || page.Lines[0].Text != "hello" {
+		t.Fatalf("unexpected page %+v (%v)", page, err)
+	}
+
+	_, err = cl.Logs(context.Background(), LogsRequest{Level: "bad", Limit: 5})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || !strings.Contains(err.Error(), "invalid level") {
+		t.Fatalf("expected invalid level error, got %v", err)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Method != http.MethodPost || q.Get("component") != "rpc" || q.Get("for") != "10m0s" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.RawQuery)
+		}
+		_ = json.NewEncoder(w).Encode(LogLevels{Levels: []types.LevelSetting{{Level: "info"}, {Component: "rpc", Level: q.Get("level")}}})
+	}))
+	defer srv.Close()
+
+	res, err := New(srv.URL).SetLogLevel(context.Background(), LogLevelRequest{Component: "rpc", Level: "debug", For: 10 * time.Minute})
+	if err != nil || len(res.Levels) != 2 || res.Levels[1].Level != "debug" {
+		t.Fatalf("unexpected levels %+v (%v)", res, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/install/rpc-test":
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":"rate_limited","retryAfterSec":3}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("boom\n"))
+		}
+	}))
+	defer srv.Close()
+
+	cl := New(srv.URL)
+	_, err := cl.RpcTest(context.Background(), RpcTestRequest{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != 3*time.Second {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+
+	_, err = cl.DashboardState(context.Background())
+	if err == nil || err.Error() != "control service returned error: boom (status 500)" {
+		t.Fatalf("expected raw body error, got %v", err)
+	}
+}
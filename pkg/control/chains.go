@@ -0,0 +1,105 @@
+package control
+
+import (
+	"sync"
+	"time"
+)
+
+// Causes of a chain pause.
+const (
+	CauseQuota      = "quota"      // every RPC of the chain is out of its daily quota
+	CauseQuarantine = "quarantine" // an RPC of the chain serves another chain
+	CauseCheck      = "check"      // the chain's RPCs have not been checked yet
+)
+
+// ChainPauses holds single chains back from scraping while the scraper goes
+// on with the others. Each cause pauses and unpauses a chain on its own, and
+// the chain stays paused while any cause holds it. Unlike service pauses they
+// are not saved, since their causes are found again after a restart. A nil
+// ChainPauses pauses nothing.
+type ChainPauses struct {
+	mu     sync.Mutex
+	paused map[string]map[string]Pause // by chain, then cause
+	now    func() time.Time
+}
+
+func NewChainPauses() *ChainPauses {
+	return &ChainPauses{paused: map[string]map[string]Pause{}, now: time.Now}
+}
+
+// Pause pauses chain for cause until p.Until (for good if zero), replacing an
+// earlier pause for the same cause. It reports whether the chain was running.
+func (c *ChainPauses) Pause(chain, cause string, p Pause) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p.Since.IsZero() {
+		p.Since = c.now().UTC()
+	}
+	running := c.expire(chain)
+	if c.paused[chain] == nil {
+		c.paused[chain] = map[string]Pause{}
+	}
+	c.paused[chain][cause] = p
+	return running
+}
+
+// Unpause lifts cause's pause of chain. It reports whether the chain runs
+// again.
+func (c *ChainPauses) Unpause(chain, cause string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.paused[chain][cause]; !ok {
+		return false
+	}
+	delete(c.paused[chain], cause)
+	return c.expire(chain)
+}
+
+// Paused returns what holds chain back, if anything: the pause that lasts
+// longest, with its cause.
+func (c *ChainPauses) Paused(chain string) (cause string, p Pause, paused bool) {
+	if c == nil {
+		return "", Pause{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expire(chain) {
+		return "", Pause{}, false
+	}
+	for k, v := range c.paused[chain] {
+		if !paused || longer(v, p) {
+			cause, p, paused = k, v, true
+		}
+	}
+	return cause, p, paused
+}
+
+// expire drops chain's pauses that have expired and reports whether none is
+// left. c.mu must be held.
+func (c *ChainPauses) expire(chain string) bool {
+	now := c.now()
+	for cause, p := range c.paused[chain] {
+		if p.Expired(now) {
+			delete(c.paused[chain], cause)
+		}
+	}
+	if len(c.paused[chain]) == 0 {
+		delete(c.paused, chain)
+		return true
+	}
+	return false
+}
+
+// longer reports whether a lasts longer than b.
+func longer(a, b Pause) bool {
+	if a.Until.IsZero() || b.Until.IsZero() {
+		return a.Until.IsZero() && !b.Until.IsZero()
+	}
+	return a.Until.After(b.Until)
+}
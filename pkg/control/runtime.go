@@ -1,23 +1,124 @@
 package control
 
-import "sync"
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
 
-// RuntimeState tracks ephemeral pause state without mutating persisted config.
+const PausesSchema = 1
+
+// Pause describes why and until when a service is paused. A zero Until means
+// the pause lasts until the service is unpaused.
+type Pause struct {
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until,omitzero"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Expired reports whether the pause has an expiry at or before now.
+func (p Pause) Expired(now time.Time) bool {
+	return !p.Until.IsZero() && !now.Before(p.Until)
+}
+
+type pausesFile struct {
+	Schema int              `json:"schema"`
+	Paused map[string]Pause `json:"paused"`
+}
+
+// RuntimeState tracks pause state without mutating persisted config. A state
+// opened with OpenRuntimeState also writes every change to its file so that
+// pauses survive a daemon restart.
 type RuntimeState struct {
 	mu     sync.RWMutex
-	paused map[string]bool
+	paused map[string]Pause
+	path   string
+	logger *slog.Logger
 }
 
-func NewRuntimeState() *RuntimeState { return &RuntimeState{paused: map[string]bool{}} }
+func NewRuntimeState() *RuntimeState {
+	return &RuntimeState{paused: map[string]Pause{}, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// PausesPath returns the location of the persisted pause state, next to the
+// control metadata file.
+func PausesPath() string {
+	return filepath.Join(filepath.Dir(Path()), "pauses.json")
+}
+
+// BudgetsPath returns the location of the persisted RPC usage, next to the
+// control metadata file.
+func BudgetsPath() string {
+	return filepath.Join(filepath.Dir(Path()), "rpc-usage.json")
+}
+
+// OpenRuntimeState loads the pause state stored at path (a missing file is an
+// empty state) and persists later changes there. Pauses that expired while the
+// daemon was down are dropped. On a read error the returned state is empty but
+// still usable. Changes that cannot be saved are logged to logger.
+func OpenRuntimeState(path string, logger *slog.Logger) (*RuntimeState, error) {
+	r := NewRuntimeState()
+	r.path = path
+	if logger != nil {
+		r.logger = logger
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		return r, err
+	}
+	var f pausesFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return r, err
+	}
+	now := time.Now()
+	for name, p := range f.Paused {
+		if !p.Expired(now) {
+			r.paused[name] = p
+		}
+	}
+	if len(r.paused) != len(f.Paused) {
+		return r, r.save()
+	}
+	return r, nil
+}
 
 func (r *RuntimeState) Pause(names ...string) (changed []string) {
+	return r.PauseWith(Pause{}, names...)
+}
+
+// PauseWith pauses names with the given reason and expiry. Pausing a service
+// that is already paused replaces its reason and expiry but is not reported as
+// a change.
+func (r *RuntimeState) PauseWith(p Pause, names ...string) (changed []string) {
+	if p.Since.IsZero() {
+		p.Since = time.Now().UTC()
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	dirty := false
 	for _, n := range names {
-		if !r.paused[n] {
-			r.paused[n] = true
+		old, ok := r.paused[n]
+		if ok {
+			p.Since = old.Since
+			if old == p {
+				continue
+			}
+		} else {
 			changed = append(changed, n)
 		}
+		r.paused[n] = p
+		dirty = true
+	}
+	if dirty {
+		r.saveOrWarn()
 	}
 	return
 }
@@ -26,26 +127,80 @@ func (r *RuntimeState) Unpause(names ...string) (changed []string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	for _, n := range names {
-		if r.paused[n] {
+		if _, ok := r.paused[n]; ok {
 			delete(r.paused, n)
 			changed = append(changed, n)
 		}
 	}
+	if len(changed) > 0 {
+		r.saveOrWarn()
+	}
 	return
 }
 
 func (r *RuntimeState) IsPaused(name string) bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.paused[name]
+	_, ok := r.paused[name]
+	return ok
 }
 
-func (r *RuntimeState) Snapshot() map[string]bool {
+// Info returns the pause recorded for name, if any.
+func (r *RuntimeState) Info(name string) (Pause, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	cp := make(map[string]bool, len(r.paused))
+	p, ok := r.paused[name]
+	return p, ok
+}
+
+// Pauses returns a copy of every recorded pause.
+func (r *RuntimeState) Pauses() map[string]Pause {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cp := make(map[string]Pause, len(r.paused))
 	for k, v := range r.paused {
 		cp[k] = v
 	}
 	return cp
 }
+
+func (r *RuntimeState) Snapshot() map[string]bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cp := make(map[string]bool, len(r.paused))
+	for k := range r.paused {
+		cp[k] = true
+	}
+	return cp
+}
+
+// saveOrWarn saves the state, logging a failure: the change still applies to
+// the running daemon but will not survive a restart. The caller holds r.mu.
+func (r *RuntimeState) saveOrWarn() {
+	if err := r.save(); err != nil {
+		r.logger.Warn("Could not save pause state; it will not survive a restart", "path", r.path, "error", err)
+	}
+}
+
+// save writes the state to r.path (if any). The caller holds r.mu.
+func (r *RuntimeState) save() error {
+	if r.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(pausesFile{Schema: PausesSchema, Paused: r.paused}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
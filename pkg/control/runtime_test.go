@@ -1,9 +1,15 @@
 package control
 
 import (
+	"bytes"
+	"log/slog"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestRuntimeStateBasicBehavior(t *testing.T) {
@@ -140,3 +146,123 @@ func TestRuntimeStateConcurrencyAndRaces(t *testing.T) {
 		}
 	})
 }
+
+func TestRuntimeStatePersistence(t *testing.T) {
+	t.Run("Round trip with reason and expiry", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "pauses.json")
+		r, err := OpenRuntimeState(fn, nil)
+		if err != nil {
+			t.Fatalf("open missing file: %v", err)
+		}
+		until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		r.PauseWith(Pause{Reason: "maintenance", Until: until}, "scraper")
+		r.Pause("monitor")
+
+		r2, err := OpenRuntimeState(fn, nil)
+		if err != nil {
+			t.Fatalf("reopen: %v", err)
+		}
+		p, ok := r2.Info("scraper")
+		if !ok || p.Reason != "maintenance" || !p.Until.Equal(until) || p.Since.IsZero() {
+			t.Fatalf("unexpected scraper pause %+v ok=%v", p, ok)
+		}
+		if !r2.IsPaused("monitor") {
+			t.Fatalf("expected monitor paused after reopen")
+		}
+
+		r2.Unpause("monitor")
+		r3, _ := OpenRuntimeState(fn, nil)
+		if r3.IsPaused("monitor") || !r3.IsPaused("scraper") {
+			t.Fatalf("unpause not persisted: %v", r3.Snapshot())
+		}
+	})
+
+	t.Run("Expired pauses are dropped on open", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "pauses.json")
+		r, _ := OpenRuntimeState(fn, nil)
+		r.PauseWith(Pause{Until: time.Now().Add(-time.Minute)}, "scraper")
+		r.Pause("monitor")
+
+		r2, err := OpenRuntimeState(fn, nil)
+		if err != nil {
+			t.Fatalf("reopen: %v", err)
+		}
+		if r2.IsPaused("scraper") || !r2.IsPaused("monitor") {
+			t.Fatalf("expected only monitor paused, got %v", r2.Snapshot())
+		}
+	})
+
+	t.Run("Repause keeps since", func(t *testing.T) {
+		r := NewRuntimeState()
+		since := time.Now().Add(-time.Hour)
+		r.PauseWith(Pause{Since: since}, "a")
+		if changed := r.PauseWith(Pause{Reason: "later"}, "a"); len(changed) != 0 {
+			t.Fatalf("expected no change reported, got %v", changed)
+		}
+		if p, _ := r.Info("a"); !p.Since.Equal(since) || p.Reason != "later" {
+			t.Fatalf("unexpected pause %+v", p)
+		}
+	})
+
+	t.Run("A failed save is logged", func(t *testing.T) {
+		blocker := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		r, _ := OpenRuntimeState(filepath.Join(blocker, "pauses.json"), slog.New(slog.NewTextHandler(&buf, nil)))
+		r.Pause("scraper")
+		if !r.IsPaused("scraper") || !strings.Contains(buf.String(), "Could not save pause state") {
+			t.Fatalf("expected the pause to apply and the failure to be logged, got %q", buf.String())
+		}
+	})
+
+	t.Run("Corrupt file", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "pauses.json")
+		if err := os.WriteFile(fn, []byte("{"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := OpenRuntimeState(fn, nil)
+		if err == nil || r == nil || len(r.Snapshot()) != 0 {
+			t.Fatalf("expected error and usable empty state, got %v %v", r, err)
+		}
+	})
+}
+
+func TestChainPauses(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := NewChainPauses()
+	c.now = func() time.Time { return now }
+
+	if !c.Pause("gnosis", CauseQuota, Pause{Until: now.Add(time.Hour), Reason: "out of quota"}) {
+		t.Fatal("expected a running chain to be reported as newly paused")
+	}
+	if c.Pause("gnosis", CauseQuarantine, Pause{Reason: "wrong chain"}) {
+		t.Fatal("a second cause does not newly pause the chain")
+	}
+	if cause, p, ok := c.Paused("gnosis"); !ok || cause != CauseQuarantine || p.Reason != "wrong chain" {
+		t.Fatalf("expected the pause without an end to win, got %s %+v %v", cause, p, ok)
+	}
+	if _, _, ok := c.Paused("mainnet"); ok {
+		t.Fatal("other chains are not paused")
+	}
+	if c.Unpause("gnosis", CauseQuarantine) {
+		t.Fatal("the chain is still out of quota")
+	}
+
+	now = now.Add(time.Hour)
+	if _, _, ok := c.Paused("gnosis"); ok {
+		t.Fatal("expected the quota pause to expire")
+	}
+	if c.Unpause("gnosis", CauseQuota) {
+		t.Fatal("an expired pause is not lifted again")
+	}
+
+	var none *ChainPauses
+	if none.Pause("gnosis", CauseQuota, Pause{}) {
+		t.Fatal("a nil ChainPauses pauses nothing")
+	}
+	if _, _, ok := none.Paused("gnosis"); ok {
+		t.Fatal("a nil ChainPauses pauses nothing")
+	}
+}
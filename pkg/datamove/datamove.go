@@ -0,0 +1,334 @@
+// Package datamove relocates the trees under khedra's data folder (the index
+// and the cache) to a new folder, renaming them when both are on the same
+// filesystem and otherwise copying them with checksums and a journal, so an
+// interrupted move can be resumed.
+package datamove
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/disk"
+)
+
+// Trees are the folders under the data folder that are moved.
+var Trees = []string{"unchained", "cache"}
+
+// JournalName is the file in the destination that records each copied file,
+// so a move that was interrupted skips them when it is run again.
+const JournalName = ".khedra-move.jsonl"
+
+// Tree is one folder to move.
+type Tree struct {
+	Name  string `json:"name"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Plan is what Move will do.
+type Plan struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Trees  []Tree `json:"trees"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+	Rename bool   `json:"rename"` // same filesystem: the trees are renamed, not copied
+	Resume int    `json:"resume"` // files already copied by an earlier run
+	Free   uint64 `json:"free"`   // free bytes where the trees are going
+}
+
+// NewPlan checks that the data under from can be moved to to and works out
+// how. to may not be inside from (or the reverse), and its trees must be
+// empty unless an earlier move to it was interrupted.
+func NewPlan(from, to string) (Plan, error) {
+	var err error
+	if from, err = filepath.Abs(from); err != nil {
+		return Plan{}, err
+	}
+	if to, err = filepath.Abs(to); err != nil {
+		return Plan{}, err
+	}
+	p := Plan{From: from, To: to}
+	switch {
+	case from == to:
+		return p, fmt.Errorf("the data is already in %s", to)
+	case within(to, from):
+		return p, fmt.Errorf("%s is inside the current data folder %s", to, from)
+	case within(from, to):
+		return p, fmt.Errorf("%s is inside the new data folder %s", from, to)
+	}
+
+	journal, _ := readJournal(to)
+	p.Resume = len(journal)
+	for _, name := range Trees {
+		t := Tree{Name: name, From: filepath.Join(from, name), To: filepath.Join(to, name)}
+		_ = filepath.WalkDir(t.From, func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				if fi, err := d.Info(); err == nil {
+					t.Files++
+					t.Bytes += fi.Size()
+				}
+			}
+			return nil
+		})
+		if p.Resume == 0 && !emptyDir(t.To) {
+			return p, fmt.Errorf("%s already exists and is not empty", t.To)
+		}
+		p.Trees = append(p.Trees, t)
+		p.Files += t.Files
+		p.Bytes += t.Bytes
+	}
+
+	src, err1 := disk.MountOf(from)
+	dst, err2 := disk.MountOf(to)
+	p.Rename = err1 == nil && err2 == nil && src.Device == dst.Device && p.Resume == 0
+	if u, err := disk.Stat(to); err == nil {
+		p.Free = u.Free
+		var copied int64
+		for _, e := range journal {
+			copied += e.Size
+		}
+		if !p.Rename && uint64(p.Bytes-copied) > u.Free {
+			return p, fmt.Errorf("%s has %.1f GB free but %.1f GB are needed", to, float64(u.Free)/1e9, float64(p.Bytes-copied)/1e9)
+		}
+	}
+	return p, nil
+}
+
+// Progress is reported while the data is moved.
+type Progress struct {
+	Phase      string `json:"phase"` // rename, copy or remove
+	Files      int    `json:"files"`
+	TotalFiles int    `json:"totalFiles"`
+	Bytes      int64  `json:"bytes"`
+	TotalBytes int64  `json:"totalBytes"`
+	File       string `json:"file,omitempty"`
+}
+
+// Options control Move.
+type Options struct {
+	// Copy copies even when the trees could be renamed.
+	Copy bool
+	// Progress, if set, is called after each file.
+	Progress func(Progress)
+}
+
+// Move puts the trees of the plan in their new place. A rename needs nothing
+// else. A copy hashes each file as it is read, checks the copy against the
+// hash, and records it in the journal; the source is left in place until
+// RemoveSource is called once the new folder is in use.
+func Move(ctx context.Context, p Plan, opts Options) error {
+	if err := os.MkdirAll(p.To, 0o755); err != nil {
+		return err
+	}
+	if p.Rename && !opts.Copy {
+		err := renameTrees(p, opts)
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+	}
+	return copyTrees(ctx, p, opts)
+}
+
+func renameTrees(p Plan, opts Options) error {
+	for i, t := range p.Trees {
+		if _, err := os.Stat(t.From); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		_ = os.Remove(t.To) // an empty folder in the way
+		if err := os.Rename(t.From, t.To); err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			opts.Progress(Progress{Phase: "rename", Files: i + 1, TotalFiles: len(p.Trees), File: t.To})
+		}
+	}
+	return nil
+}
+
+// entry is one line of the journal.
+type entry struct {
+	File   string `json:"file"` // relative to the data folder
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+func readJournal(to string) (map[string]entry, error) {
+	f, err := os.Open(filepath.Join(to, JournalName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := map[string]entry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e entry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil && e.File != "" {
+			out[e.File] = e
+		}
+	}
+	return out, scanner.Err()
+}
+
+func copyTrees(ctx context.Context, p Plan, opts Options) error {
+	done, _ := readJournal(p.To)
+	jf, err := os.OpenFile(filepath.Join(p.To, JournalName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer jf.Close()
+
+	prog := Progress{Phase: "copy", TotalFiles: p.Files, TotalBytes: p.Bytes}
+	for _, t := range p.Trees {
+		err := filepath.WalkDir(t.From, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) && path == t.From {
+					return nil
+				}
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(p.From, path)
+			dest := filepath.Join(p.To, rel)
+			switch {
+			case d.IsDir():
+				return os.MkdirAll(dest, 0o755)
+			case d.Type()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				_ = os.Remove(dest)
+				return os.Symlink(target, dest)
+			case !d.Type().IsRegular():
+				return nil
+			}
+
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if e, ok := done[rel]; !ok || e.Size != fi.Size() || !sameSize(dest, fi.Size()) {
+				sum, err := copyFile(path, dest, fi.Mode().Perm())
+				if err != nil {
+					return fmt.Errorf("cannot copy %s: %w", path, err)
+				}
+				line, _ := json.Marshal(entry{File: rel, Size: fi.Size(), Sha256: sum})
+				if _, err := jf.Write(append(line, '\n')); err != nil {
+					return err
+				}
+			}
+			prog.Files++
+			prog.Bytes += fi.Size()
+			prog.File = rel
+			if opts.Progress != nil {
+				opts.Progress(prog)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return jf.Sync()
+}
+
+// copyFile copies src to dest through a temporary file, hashing src as it
+// is read, and keeps the copy only if reading it back gives the same hash.
+func copyFile(src, dest string, perm fs.FileMode) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+	tmp := dest + ".part"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(out, io.TeeReader(in, h))
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	want := hex.EncodeToString(h.Sum(nil))
+	if err == nil {
+		var got string
+		if got, err = fileSha256(tmp); err == nil && got != want {
+			err = fmt.Errorf("the copy has checksum %s, expected %s", got, want)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return want, os.Rename(tmp, dest)
+}
+
+func fileSha256(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// RemoveSource deletes the copied trees from the old data folder and the
+// journal from the new one. It is called once the new folder is in use.
+func RemoveSource(p Plan, opts Options) error {
+	for i, t := range p.Trees {
+		if err := os.RemoveAll(t.From); err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			opts.Progress(Progress{Phase: "remove", Files: i + 1, TotalFiles: len(p.Trees), File: t.From})
+		}
+	}
+	err := os.Remove(filepath.Join(p.To, JournalName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func sameSize(fn string, size int64) bool {
+	fi, err := os.Stat(fn)
+	return err == nil && fi.Size() == size
+}
+
+func emptyDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err != nil || len(entries) == 0
+}
+
+// within reports whether path is inside (or is) dir.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
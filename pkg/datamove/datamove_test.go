@@ -0,0 +1,154 @@
+package datamove
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fill writes a small data folder and returns its files relative to it.
+func fill(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{
+		"unchained/mainnet/blooms/000-001.bloom":   "bloom",
+		"unchained/mainnet/finalized/000-001.bin":  "chunk",
+		"unchained/mainnet/manifest.json":          "{}",
+		"cache/mainnet/blocks/00/01/000001.bin":    strings.Repeat("b", 70000),
+		"cache/mainnet/transactions/00/000001.bin": "tx",
+	}
+	for rel, body := range files {
+		fn := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func check(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, body := range files {
+		got, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil || string(got) != body {
+			t.Fatalf("%s: got %q (%v)", rel, got, err)
+		}
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	tmp := t.TempDir()
+	from := filepath.Join(tmp, "data")
+	fill(t, from)
+
+	for _, to := range []string{from, filepath.Join(from, "inner"), tmp} {
+		if _, err := NewPlan(from, to); err == nil {
+			t.Fatalf("expected a move to %s to be refused", to)
+		}
+	}
+
+	to := filepath.Join(tmp, "new")
+	p, err := NewPlan(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Files != 5 || len(p.Trees) != 2 || p.Trees[0].Files != 3 || !p.Rename {
+		t.Fatalf("unexpected plan %+v", p)
+	}
+
+	if err := os.MkdirAll(filepath.Join(to, "cache", "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPlan(from, to); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Fatalf("expected a non-empty destination to be refused, got %v", err)
+	}
+}
+
+func TestMove_Rename(t *testing.T) {
+	tmp := t.TempDir()
+	from, to := filepath.Join(tmp, "data"), filepath.Join(tmp, "new")
+	files := fill(t, from)
+	p, err := NewPlan(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Move(context.Background(), p, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, to, files)
+	if _, err := os.Stat(filepath.Join(from, "unchained")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("a rename should leave nothing behind")
+	}
+}
+
+func TestMove_CopyAndResume(t *testing.T) {
+	tmp := t.TempDir()
+	from, to := filepath.Join(tmp, "data"), filepath.Join(tmp, "new")
+	files := fill(t, from)
+	if err := os.Symlink("000-001.bin", filepath.Join(from, "unchained/mainnet/finalized/latest")); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPlan(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupt the copy after two files
+	ctx, cancel := context.WithCancel(context.Background())
+	var first string
+	err = Move(ctx, p, Options{Copy: true, Progress: func(pr Progress) {
+		if pr.Files == 1 {
+			first = pr.File
+		}
+		if pr.Files == 2 {
+			cancel()
+		}
+	}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the copy to be canceled, got %v", err)
+	}
+
+	// A journaled file is not copied again when the move is resumed
+	if err := os.WriteFile(filepath.Join(to, first), []byte(strings.Repeat("x", len(files[first]))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err = NewPlan(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Resume != 2 || p.Rename {
+		t.Fatalf("expected a copy resuming after two files, got %+v", p)
+	}
+	var last Progress
+	if err := Move(context.Background(), p, Options{Progress: func(pr Progress) { last = pr }}); err != nil {
+		t.Fatal(err)
+	}
+	if last.Files != 5 || last.Bytes != p.Bytes {
+		t.Fatalf("unexpected final progress %+v", last)
+	}
+	if got, _ := os.ReadFile(filepath.Join(to, first)); string(got) == files[first] {
+		t.Fatal("the journaled file was copied again")
+	}
+	files[first] = strings.Repeat("x", len(files[first]))
+	check(t, to, files)
+	if target, err := os.Readlink(filepath.Join(to, "unchained/mainnet/finalized/latest")); err != nil || target != "000-001.bin" {
+		t.Fatalf("symlink not copied: %q (%v)", target, err)
+	}
+	if _, err := os.Stat(filepath.Join(from, "cache")); err != nil {
+		t.Fatal("a copy should leave the source until RemoveSource")
+	}
+
+	if err := RemoveSource(p, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range []string{filepath.Join(from, "cache"), filepath.Join(from, "unchained"), filepath.Join(to, JournalName)} {
+		if _, err := os.Stat(fn); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s should be gone", fn)
+		}
+	}
+}
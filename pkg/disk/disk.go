@@ -0,0 +1,73 @@
+// Package disk reports filesystem capacity and folder sizes.
+package disk
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Usage describes the filesystem holding a path.
+type Usage struct {
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"` // available to an unprivileged user
+}
+
+// Stat returns the usage of the filesystem that holds path. If path does not
+// exist yet, its nearest existing parent is used.
+func Stat(path string) (Usage, error) {
+	return statfs(Existing(path))
+}
+
+// Mount describes the filesystem a path lives on.
+type Mount struct {
+	FSType  string `json:"fsType"` // e.g. ext4, apfs or nfs; "unknown" if not recognized
+	Device  uint64 `json:"device"`
+	Network bool   `json:"network"` // NFS, SMB and other remote filesystems
+	Memory  bool   `json:"memory"`  // tmpfs or ramfs, whose contents do not survive a reboot
+}
+
+// MountOf returns the filesystem that holds path. If path does not exist yet,
+// its nearest existing parent is used.
+func MountOf(path string) (Mount, error) {
+	return mountOf(Existing(path))
+}
+
+// Existing returns path, if it is a folder, or its nearest parent that is.
+func Existing(path string) string {
+	p := filepath.Clean(path)
+	for {
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			return p
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p
+		}
+		p = parent
+	}
+}
+
+// DirSize returns the total size in bytes of the regular files under root.
+// Unreadable entries are skipped; a missing root has size zero.
+func DirSize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,76 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStat(t *testing.T) {
+	dir := t.TempDir()
+	u, err := Stat(filepath.Join(dir, "not", "yet", "created"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Total == 0 || u.Free > u.Total {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+}
+
+func TestExisting(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "file"), nil, 0o644)
+	for _, path := range []string{dir, filepath.Join(dir, "not", "yet", "created"), filepath.Join(dir, "file"), filepath.Join(dir, "file", "below")} {
+		if got := Existing(path); got != dir {
+			t.Fatalf("expected %s for %s, got %s", dir, path, got)
+		}
+	}
+}
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "a", "b"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "one"), make([]byte, 100), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "a", "b", "two"), make([]byte, 23), 0o644)
+
+	n, err := DirSize(dir)
+	if err != nil || n != 123 {
+		t.Fatalf("expected 123, got %d (%v)", n, err)
+	}
+	if n, err := DirSize(filepath.Join(dir, "missing")); err != nil || n != 0 {
+		t.Fatalf("expected 0 for missing dir, got %d (%v)", n, err)
+	}
+}
+
+func TestMountOf(t *testing.T) {
+	dir := t.TempDir()
+	m, err := MountOf(filepath.Join(dir, "not", "yet", "created"))
+	if err != nil {
+		t.Skipf("mount details unavailable: %v", err)
+	}
+	if m.FSType == "" {
+		t.Fatalf("expected a filesystem type, got %+v", m)
+	}
+	if m.Memory && m.Network {
+		t.Fatalf("a mount cannot be both memory and network backed: %+v", m)
+	}
+	same, err := MountOf(dir)
+	if err != nil || same.Device != m.Device {
+		t.Fatalf("expected the same device for a folder and its missing child, got %+v and %+v (%v)", m, same, err)
+	}
+}
+
+func TestMeasureThroughput(t *testing.T) {
+	dir := t.TempDir()
+	tp, err := MeasureThroughput(dir, 2<<20, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp.WriteMBps <= 0 || tp.FsyncsPerSec <= 0 {
+		t.Fatalf("unexpected throughput %+v", tp)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected the temporary file to be removed, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,28 @@
+package disk
+
+import "syscall"
+
+var networkFS = map[string]bool{"nfs": true, "smbfs": true, "afpfs": true, "webdav": true}
+
+func mountOf(path string) (Mount, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return Mount{}, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return Mount{}, err
+	}
+	b := make([]byte, 0, len(fs.Fstypename))
+	for _, c := range fs.Fstypename {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	name := string(b)
+	if name == "" {
+		name = "unknown"
+	}
+	return Mount{FSType: name, Device: uint64(st.Dev), Network: networkFS[name]}, nil
+}
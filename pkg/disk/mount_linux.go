@@ -0,0 +1,47 @@
+package disk
+
+import "syscall"
+
+// Filesystem magic numbers from statfs(2).
+var linuxFSTypes = map[uint32]string{
+	0xEF53:     "ext4", // also ext2 and ext3
+	0x58465342: "xfs",
+	0x9123683E: "btrfs",
+	0x2FC12FC1: "zfs",
+	0xF2F52010: "f2fs",
+	0x794C7630: "overlay",
+	0x4D44:     "vfat",
+	0x2011BAB0: "exfat",
+	0x5346544E: "ntfs",
+	0x65735546: "fuse",
+	0x01021994: "tmpfs",
+	0x858458F6: "ramfs",
+	0x6969:     "nfs",
+	0x517B:     "smb",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x01021997: "9p",
+	0x00C36400: "ceph",
+	0x5346414F: "afs",
+}
+
+var (
+	networkFS = map[string]bool{"nfs": true, "smb": true, "cifs": true, "smb2": true, "9p": true, "ceph": true, "afs": true}
+	memoryFS  = map[string]bool{"tmpfs": true, "ramfs": true}
+)
+
+func mountOf(path string) (Mount, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return Mount{}, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return Mount{}, err
+	}
+	name, ok := linuxFSTypes[uint32(fs.Type)]
+	if !ok {
+		name = "unknown"
+	}
+	return Mount{FSType: name, Device: uint64(st.Dev), Network: networkFS[name], Memory: memoryFS[name]}, nil
+}
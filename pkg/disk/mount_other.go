@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package disk
+
+import "errors"
+
+func mountOf(path string) (Mount, error) {
+	_ = path
+	return Mount{}, errors.New("filesystem details are not supported on this platform")
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package disk
+
+import "errors"
+
+func statfs(path string) (Usage, error) {
+	_ = path
+	return Usage{}, errors.New("filesystem usage is not supported on windows")
+}
@@ -0,0 +1,57 @@
+package disk
+
+import (
+	"os"
+	"time"
+)
+
+// Throughput is the measured write performance of a folder.
+type Throughput struct {
+	WriteMBps    float64 `json:"writeMBps"`    // sequential write, synced at the end
+	FsyncsPerSec float64 `json:"fsyncsPerSec"` // small writes each followed by fsync
+}
+
+// fsyncWrite is the size of each synced write, about one index record batch.
+const fsyncWrite = 4096
+
+// MeasureThroughput writes size bytes to a temporary file in dir and syncs it,
+// then times small synced writes for up to d. The file is removed afterwards.
+func MeasureThroughput(dir string, size int, d time.Duration) (Throughput, error) {
+	f, err := os.CreateTemp(dir, ".khedra-preflight-*")
+	if err != nil {
+		return Throughput{}, err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	var t Throughput
+	buf := make([]byte, 1<<20)
+	start := time.Now()
+	for written := 0; written < size; written += len(buf) {
+		if _, err := f.Write(buf[:min(len(buf), size-written)]); err != nil {
+			return Throughput{}, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return Throughput{}, err
+	}
+	t.WriteMBps = float64(size) / 1e6 / time.Since(start).Seconds()
+
+	n := 0
+	start = time.Now()
+	for time.Since(start) < d {
+		if _, err := f.Write(buf[:fsyncWrite]); err != nil {
+			return Throughput{}, err
+		}
+		if err := f.Sync(); err != nil {
+			return Throughput{}, err
+		}
+		n++
+	}
+	if n > 0 {
+		t.FsyncsPerSec = float64(n) / time.Since(start).Seconds()
+	}
+	return t, nil
+}
@@ -0,0 +1,151 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/mr-tron/base58"
+)
+
+// The settings `ipfs add` uses by default, which are the ones the published
+// index was pinned with: 256 KiB chunks in a balanced DAG of at most 174 links
+// per node, with the chunks as UnixFS file leaves and a version 0 CID.
+const (
+	cidChunkSize = 256 * 1024
+	cidMaxLinks  = 174
+)
+
+// FileCID returns the IPFS hash of the file at path as `ipfs add` would
+// compute it, so it can be compared with the hashes in the manifest.
+func FileCID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return ReaderCID(f)
+}
+
+// ReaderCID is FileCID for the contents of r.
+func ReaderCID(r io.Reader) (string, error) {
+	b := &dagBuilder{r: r, buf: make([]byte, cidChunkSize)}
+	b.advance()
+	root := b.layout()
+	if b.err != nil {
+		return "", b.err
+	}
+	return base58.Encode(root.hash), nil
+}
+
+// dagNode is a node of the DAG once it has been encoded.
+type dagNode struct {
+	hash     []byte // sha2-256 multihash of the encoded node
+	size     uint64 // encoded size plus the sizes of everything below it
+	fileSize uint64 // bytes of the file under the node
+}
+
+// dagBuilder mirrors the balanced layout of the IPFS importer. It reads one
+// chunk ahead so it knows when the data has run out.
+type dagBuilder struct {
+	r    io.Reader
+	buf  []byte
+	next []byte
+	done bool
+	err  error
+}
+
+func (b *dagBuilder) advance() {
+	n, err := io.ReadFull(b.r, b.buf)
+	switch {
+	case err == nil || errors.Is(err, io.ErrUnexpectedEOF):
+		b.next = b.buf[:n]
+	case errors.Is(err, io.EOF):
+		b.next, b.done = nil, true
+	default:
+		b.next, b.done, b.err = nil, true, err
+	}
+}
+
+func (b *dagBuilder) layout() dagNode {
+	if b.done {
+		return b.leaf(nil)
+	}
+	root := b.nextLeaf()
+	for depth := 1; !b.done; depth++ {
+		root = b.fill([]dagNode{root}, depth)
+	}
+	return root
+}
+
+// fill adds children of the given depth to a node that already has some
+// until it is full or the data runs out.
+func (b *dagBuilder) fill(children []dagNode, depth int) dagNode {
+	for len(children) < cidMaxLinks && !b.done {
+		if depth == 1 {
+			children = append(children, b.nextLeaf())
+		} else {
+			children = append(children, b.fill(nil, depth-1))
+		}
+	}
+	return b.internal(children)
+}
+
+func (b *dagBuilder) nextLeaf() dagNode {
+	data := append([]byte(nil), b.next...)
+	b.advance()
+	return b.leaf(data)
+}
+
+func (b *dagBuilder) leaf(data []byte) dagNode {
+	// UnixFS Data: Type = File, Data, filesize
+	fs := appendVarintField(nil, 1, 2)
+	if data != nil {
+		fs = appendBytesField(fs, 2, data)
+	}
+	fs = appendVarintField(fs, 3, uint64(len(data)))
+	block := appendBytesField(nil, 1, fs)
+	return dagNode{hash: multihash(block), size: uint64(len(block)), fileSize: uint64(len(data))}
+}
+
+func (b *dagBuilder) internal(children []dagNode) dagNode {
+	var fileSize, size uint64
+	for _, c := range children {
+		fileSize += c.fileSize
+	}
+	// UnixFS Data: Type = File, filesize, blocksizes
+	fs := appendVarintField(nil, 1, 2)
+	fs = appendVarintField(fs, 3, fileSize)
+	for _, c := range children {
+		fs = appendVarintField(fs, 4, c.fileSize)
+	}
+	// dag-pb PBNode: the links (Hash, Name, Tsize) come before the data
+	var block []byte
+	for _, c := range children {
+		link := appendBytesField(nil, 1, c.hash)
+		link = appendBytesField(link, 2, nil)
+		link = appendVarintField(link, 3, c.size)
+		block = appendBytesField(block, 2, link)
+		size += c.size
+	}
+	block = appendBytesField(block, 1, fs)
+	return dagNode{hash: multihash(block), size: size + uint64(len(block)), fileSize: fileSize}
+}
+
+func multihash(block []byte) []byte {
+	sum := sha256.Sum256(block)
+	return append([]byte{0x12, 0x20}, sum[:]...)
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,64 @@
+package index
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReaderCID(t *testing.T) {
+	// The hashes `ipfs add` gives these contents
+	tests := []struct{ data, want string }{
+		{"", "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+		{"hello world\n", "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+	}
+	for _, tt := range tests {
+		got, err := ReaderCID(strings.NewReader(tt.data))
+		if err != nil || got != tt.want {
+			t.Fatalf("%q: expected %s, got %s %v", tt.data, tt.want, got, err)
+		}
+	}
+
+	// The hashes `ipfs add --cid-version=0` gives n bytes of pattern: one
+	// chunk, two leaves under a root, a full root and a second level
+	sized := []struct {
+		n    int
+		want string
+	}{
+		{cidChunkSize, "QmeqfRyS3vkku7n6krqC3DgGMex3x2sCpSeKMDmrG13QQq"},
+		{cidChunkSize + 1, "QmUSjGawaz4ptvREcMKSMJneWCa5j8dAz2wSAAvHtW2rnB"},
+		{cidMaxLinks * cidChunkSize, "QmXCym15aFeWjAWyPFaAgwVmkuKB7EBsV77Skt54KmxChF"},
+		{cidMaxLinks*cidChunkSize + 1, "QmTedsTekQQkgACJXb1sPZSW8bLdS9LPMrT7L4YdjNRd4n"},
+	}
+	for _, tt := range sized {
+		if got, err := ReaderCID(bytes.NewReader(pattern(tt.n))); err != nil || got != tt.want {
+			t.Fatalf("%d bytes: expected %s, got %s %v", tt.n, tt.want, got, err)
+		}
+	}
+
+	// Files of more than one chunk hash to a tree; it must depend on every byte
+	big := bytes.Repeat([]byte{7}, 3*cidChunkSize+10)
+	a, _ := ReaderCID(bytes.NewReader(big))
+	big[len(big)-1] = 8
+	b, _ := ReaderCID(bytes.NewReader(big))
+	if a == b || !strings.HasPrefix(a, "Qm") || len(a) != 46 {
+		t.Fatalf("unexpected hashes %s and %s", a, b)
+	}
+
+	fn := filepath.Join(t.TempDir(), "f")
+	_ = os.WriteFile(fn, big, 0o644)
+	if c, err := FileCID(fn); err != nil || c != b {
+		t.Fatalf("expected the file to hash to %s, got %s %v", b, c, err)
+	}
+}
+
+// pattern returns n bytes counting up modulo 251, so no chunk repeats another.
+func pattern(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
@@ -0,0 +1,52 @@
+// Package index inspects the Unchained Index folders that the scraper writes.
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ChainFolder returns the index folder for a chain under indexPath.
+func ChainFolder(indexPath, chain string) string {
+	return filepath.Join(indexPath, chain)
+}
+
+// LatestBlock returns the highest block covered by a finalized chunk or a
+// staging file for chain. The second return is false if there are neither.
+func LatestBlock(indexPath, chain string) (uint64, bool) {
+	var latest uint64
+	found := false
+	folder := ChainFolder(indexPath, chain)
+	for _, sub := range []struct{ dir, ext string }{{"finalized", ".bin"}, {"staging", ".txt"}} {
+		entries, err := os.ReadDir(filepath.Join(folder, sub.dir))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), sub.ext) {
+				continue
+			}
+			if _, last, ok := ParseRange(e.Name()); ok && (!found || last > latest) {
+				latest, found = last, true
+			}
+		}
+	}
+	return latest, found
+}
+
+// ParseRange parses a chunk file name of the form 000000000-000000099.ext.
+func ParseRange(name string) (first, last uint64, ok bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	a, b, found := strings.Cut(base, "-")
+	if !found {
+		return 0, 0, false
+	}
+	first, err1 := strconv.ParseUint(a, 10, 64)
+	last, err2 := strconv.ParseUint(b, 10, 64)
+	if err1 != nil || err2 != nil || last < first {
+		return 0, 0, false
+	}
+	return first, last, true
+}
@@ -0,0 +1,44 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLatestBlock(t *testing.T) {
+	dir := t.TempDir()
+	if _, ok := LatestBlock(dir, "mainnet"); ok {
+		t.Fatal("expected no block for empty index")
+	}
+
+	write := func(rel string) {
+		p := filepath.Join(dir, "mainnet", rel)
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		_ = os.WriteFile(p, nil, 0o644)
+	}
+	write("finalized/000000000-000000099.bin")
+	write("finalized/000000100-000000250.bin")
+	write("finalized/notachunk.bin")
+	write("blooms/000000100-000000999.bloom")
+
+	if n, ok := LatestBlock(dir, "mainnet"); !ok || n != 250 {
+		t.Fatalf("expected 250, got %d %v", n, ok)
+	}
+
+	write("staging/000000251-000000300.txt")
+	if n, ok := LatestBlock(dir, "mainnet"); !ok || n != 300 {
+		t.Fatalf("expected staging to win with 300, got %d %v", n, ok)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	if f, l, ok := ParseRange("000000100-000000250.bin"); !ok || f != 100 || l != 250 {
+		t.Fatalf("got %d %d %v", f, l, ok)
+	}
+	for _, bad := range []string{"000000100.bin", "a-b.bin", "000000250-000000100.bin"} {
+		if _, _, ok := ParseRange(bad); ok {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package index
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The init modes of the SDK's scrape service: download the full index,
+// download only the blooms, or download nothing and build locally.
+const (
+	InitAll    = "all"
+	InitBlooms = "blooms"
+	InitNone   = "none"
+)
+
+// InitMode returns the scrape service init mode for a strategy and detail.
+func InitMode(strategy, detail string) string {
+	switch {
+	case strategy == "scratch":
+		return InitNone
+	case detail == "bloom":
+		return InitBlooms
+	default:
+		return InitAll
+	}
+}
+
+// Mode is the strategy and detail a chain's index was last set up with.
+type Mode struct {
+	Strategy string    `json:"strategy"`
+	Detail   string    `json:"detail"`
+	Applied  time.Time `json:"applied"`
+}
+
+// Same reports whether m and o have the same strategy and detail.
+func (m Mode) Same(o Mode) bool {
+	return m.Strategy == o.Strategy && m.Detail == o.Detail
+}
+
+func (m Mode) String() string {
+	return m.Strategy + ", " + m.Detail
+}
+
+// modeFile is kept in each chain's index folder, so it moves with the index.
+const modeFile = "khedra-mode.json"
+
+// ReadMode returns the mode recorded for chain. The second return is false if
+// none was recorded.
+func ReadMode(indexPath, chain string) (Mode, bool) {
+	data, err := os.ReadFile(filepath.Join(ChainFolder(indexPath, chain), modeFile))
+	if err != nil {
+		return Mode{}, false
+	}
+	var m Mode
+	if json.Unmarshal(data, &m) != nil || m.Strategy == "" {
+		return Mode{}, false
+	}
+	return m, true
+}
+
+// WriteMode records the mode for chain.
+func WriteMode(indexPath, chain string, m Mode) error {
+	folder := ChainFolder(indexPath, chain)
+	if err := os.MkdirAll(folder, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	fn := filepath.Join(folder, modeFile)
+	if err := os.WriteFile(fn+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(fn+".tmp", fn)
+}
+
+// Inventory counts the finished parts of a chain's index.
+type Inventory struct {
+	Blooms      int    `json:"blooms"`
+	BloomBytes  int64  `json:"bloomBytes"`
+	Chunks      int    `json:"chunks"`
+	ChunkBytes  int64  `json:"chunkBytes"`
+	LatestBlock uint64 `json:"latestBlock"`
+	HasBlocks   bool   `json:"hasBlocks"`
+}
+
+// Scan takes the inventory of chain's index.
+func Scan(indexPath, chain string) Inventory {
+	var inv Inventory
+	folder := ChainFolder(indexPath, chain)
+	count := func(dir, ext string) (n int, size int64) {
+		entries, _ := os.ReadDir(filepath.Join(folder, dir))
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ext) {
+				continue
+			}
+			if fi, err := e.Info(); err == nil {
+				n++
+				size += fi.Size()
+			}
+		}
+		return n, size
+	}
+	inv.Blooms, inv.BloomBytes = count("blooms", ".bloom")
+	inv.Chunks, inv.ChunkBytes = count("finalized", ".bin")
+	inv.LatestBlock, inv.HasBlocks = LatestBlock(indexPath, chain)
+	return inv
+}
+
+// ChunksWithBlooms returns the finalized chunk files that have a matching
+// bloom, which are the ones that can be removed and fetched again later.
+func ChunksWithBlooms(indexPath, chain string) []string {
+	folder := ChainFolder(indexPath, chain)
+	entries, _ := os.ReadDir(filepath.Join(folder, "finalized"))
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".bin") {
+			continue
+		}
+		bloom := filepath.Join(folder, "blooms", strings.TrimSuffix(name, ".bin")+".bloom")
+		if _, err := os.Stat(bloom); err == nil {
+			out = append(out, filepath.Join(folder, "finalized", name))
+		}
+	}
+	return out
+}
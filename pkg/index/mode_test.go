@@ -0,0 +1,72 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInitMode(t *testing.T) {
+	tests := []struct{ strategy, detail, want string }{
+		{"download", "index", InitAll},
+		{"download", "bloom", InitBlooms},
+		{"scratch", "index", InitNone},
+		{"scratch", "bloom", InitNone},
+	}
+	for _, tt := range tests {
+		if got := InitMode(tt.strategy, tt.detail); got != tt.want {
+			t.Fatalf("%s/%s: expected %s, got %s", tt.strategy, tt.detail, tt.want, got)
+		}
+	}
+}
+
+func TestReadWriteMode(t *testing.T) {
+	dir := t.TempDir()
+	if _, ok := ReadMode(dir, "mainnet"); ok {
+		t.Fatal("expected no mode before one is written")
+	}
+	m := Mode{Strategy: "download", Detail: "bloom", Applied: time.Now().UTC().Truncate(time.Second)}
+	if err := WriteMode(dir, "mainnet", m); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := ReadMode(dir, "mainnet")
+	if !ok || !got.Same(m) || !got.Applied.Equal(m.Applied) {
+		t.Fatalf("expected %+v, got %+v %v", m, got, ok)
+	}
+	if got.Same(Mode{Strategy: "download", Detail: "index"}) {
+		t.Fatal("expected a different detail to differ")
+	}
+
+	_ = os.WriteFile(filepath.Join(dir, "mainnet", modeFile), []byte("{not json"), 0o644)
+	if _, ok := ReadMode(dir, "mainnet"); ok {
+		t.Fatal("expected a broken mode file to be ignored")
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel string, size int) {
+		p := filepath.Join(dir, "mainnet", rel)
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		_ = os.WriteFile(p, make([]byte, size), 0o644)
+	}
+	write("blooms/000000000-000000099.bloom", 10)
+	write("blooms/000000100-000000250.bloom", 10)
+	write("finalized/000000000-000000099.bin", 100)
+	write("finalized/000000251-000000300.bin", 100)
+
+	inv := Scan(dir, "mainnet")
+	if inv.Blooms != 2 || inv.BloomBytes != 20 || inv.Chunks != 2 || inv.ChunkBytes != 200 || !inv.HasBlocks || inv.LatestBlock != 300 {
+		t.Fatalf("unexpected inventory %+v", inv)
+	}
+
+	chunks := ChunksWithBlooms(dir, "mainnet")
+	if len(chunks) != 1 || filepath.Base(chunks[0]) != "000000000-000000099.bin" {
+		t.Fatalf("expected only the chunk with a bloom, got %v", chunks)
+	}
+
+	if inv := Scan(dir, "gnosis"); inv != (Inventory{}) {
+		t.Fatalf("expected an empty inventory, got %+v", inv)
+	}
+}
@@ -0,0 +1,435 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultGateway is the IPFS gateway chifra downloads the index from.
+const DefaultGateway = "https://ipfs.unchainedindex.io/ipfs/"
+
+// ManifestChunk is one chunk of the published index: its block range and the
+// IPFS hash and size of its bloom and its chunk file.
+type ManifestChunk struct {
+	Range     string `json:"range"`
+	BloomHash string `json:"bloomHash"`
+	BloomSize int64  `json:"bloomSize"`
+	IndexHash string `json:"indexHash"`
+	IndexSize int64  `json:"indexSize"`
+}
+
+// Manifest is the part of chifra's manifest.json needed to check the index.
+type Manifest struct {
+	Version string          `json:"version"`
+	Chain   string          `json:"chain"`
+	Chunks  []ManifestChunk `json:"chunks"`
+}
+
+// ManifestPath returns where chifra keeps chain's manifest.
+func ManifestPath(indexPath, chain string) string {
+	return filepath.Join(ChainFolder(indexPath, chain), "manifest.json")
+}
+
+// ErrNoManifest is returned by ReadManifest when chain has no manifest.
+var ErrNoManifest = errors.New("no manifest")
+
+// ReadManifest reads chain's manifest.
+func ReadManifest(indexPath, chain string) (Manifest, error) {
+	data, err := os.ReadFile(ManifestPath(indexPath, chain))
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		return Manifest{}, ErrNoManifest
+	} else if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("cannot read %s: %w", ManifestPath(indexPath, chain), err)
+	}
+	return m, nil
+}
+
+// The kinds of Problem Verify reports.
+const (
+	ProblemMissing = "missing" // in the manifest but not on disk
+	ProblemSize    = "size"    // on disk with a size other than the manifest's
+	ProblemHash    = "hash"    // on disk with a hash other than the manifest's
+	ProblemExtra   = "extra"   // on disk, inside the manifest's blocks but not one of its chunks
+	ProblemGap     = "gap"     // a locally built file that does not start where the previous one ended
+	ProblemOrphan  = "orphan"  // a locally built chunk without a bloom
+	ProblemRebuild = "rebuild" // a locally built file after a bad one, removed by Repair so it is built again
+)
+
+// Problem is one file that is not what it should be.
+type Problem struct {
+	Kind   string `json:"kind"`
+	Range  string `json:"range"`
+	File   string `json:"file"`
+	Detail string `json:"detail,omitempty"`
+	Hash   string `json:"hash,omitempty"` // the manifest's hash, used to fetch the file again
+	Local  bool   `json:"local,omitempty"`
+}
+
+// Progress is reported while a chain is verified or repaired.
+type Progress struct {
+	Chain string `json:"chain"`
+	Phase string `json:"phase"` // verify or repair
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	File  string `json:"file,omitempty"`
+}
+
+// VerifyOptions control Verify.
+type VerifyOptions struct {
+	// BloomsOnly does not expect chunk files, as with detail: bloom.
+	BloomsOnly bool
+	// Quick compares sizes only and skips hashing.
+	Quick bool
+	// Progress, if set, is called after each file.
+	Progress func(Progress)
+}
+
+// Report is the result of verifying one chain.
+type Report struct {
+	Chain     string    `json:"chain"`
+	Manifest  bool      `json:"manifest"` // false if there was none; only local checks were made
+	Published int       `json:"published"`
+	Checked   int       `json:"checked"`
+	Local     int       `json:"local"` // files built after the manifest's last block
+	Problems  []Problem `json:"problems"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+}
+
+// OK reports whether no problems were found.
+func (r Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify checks chain's blooms and chunks against its manifest: files the
+// manifest lists must be on disk with its size and hash, and no other file
+// may fall inside the blocks it covers. Files past the manifest's last block
+// were built locally, so they are only checked to follow each other without
+// gaps and to come in bloom and chunk pairs.
+func Verify(ctx context.Context, indexPath, chain string, opts VerifyOptions) (Report, error) {
+	rep := Report{Chain: chain, Started: time.Now().UTC(), Problems: []Problem{}}
+	man, err := ReadManifest(indexPath, chain)
+	if err != nil && !errors.Is(err, ErrNoManifest) {
+		return rep, err
+	}
+	rep.Manifest = err == nil
+	rep.Published = len(man.Chunks)
+
+	folder := ChainFolder(indexPath, chain)
+	blooms := listRanges(filepath.Join(folder, "blooms"), ".bloom")
+	chunks := listRanges(filepath.Join(folder, "finalized"), ".bin")
+
+	var manifestLast uint64
+	published := make(map[string]bool, len(man.Chunks))
+	for _, c := range man.Chunks {
+		published[c.Range] = true
+		if _, last, ok := ParseRange(c.Range); ok && last > manifestLast {
+			manifestLast = last
+		}
+	}
+
+	type check struct {
+		rng, file, hash string
+		size            int64
+	}
+	var checks []check
+	for _, c := range man.Chunks {
+		checks = append(checks, check{c.Range, filepath.Join(folder, "blooms", c.Range+".bloom"), c.BloomHash, c.BloomSize})
+		if !opts.BloomsOnly {
+			checks = append(checks, check{c.Range, filepath.Join(folder, "finalized", c.Range+".bin"), c.IndexHash, c.IndexSize})
+		}
+	}
+
+	total := len(checks)
+	for _, files := range []map[string]string{blooms, chunks} {
+		for rng := range files {
+			if !published[rng] {
+				total++
+			}
+		}
+	}
+	done := 0
+	report := func(file string) {
+		done++
+		if opts.Progress != nil {
+			opts.Progress(Progress{Chain: chain, Phase: "verify", Done: done, Total: total, File: file})
+		}
+	}
+
+	for _, c := range checks {
+		if err := ctx.Err(); err != nil {
+			return rep, err
+		}
+		rep.Checked++
+		fi, err := os.Stat(c.file)
+		switch {
+		case err != nil:
+			rep.Problems = append(rep.Problems, Problem{Kind: ProblemMissing, Range: c.rng, File: c.file, Hash: c.hash})
+		case c.size > 0 && fi.Size() != c.size:
+			rep.Problems = append(rep.Problems, Problem{Kind: ProblemSize, Range: c.rng, File: c.file, Hash: c.hash,
+				Detail: fmt.Sprintf("%d bytes, expected %d", fi.Size(), c.size)})
+		case !opts.Quick && strings.HasPrefix(c.hash, "Qm"):
+			got, err := FileCID(c.file)
+			if err != nil {
+				return rep, err
+			}
+			if got != c.hash {
+				rep.Problems = append(rep.Problems, Problem{Kind: ProblemHash, Range: c.rng, File: c.file, Hash: c.hash,
+					Detail: "hash " + got + ", expected " + c.hash})
+			}
+		}
+		report(c.file)
+	}
+
+	// Files the manifest does not list: extra if inside its blocks, otherwise
+	// built locally and checked for gaps and missing blooms
+	ranges := make(map[string]bool)
+	for _, files := range []map[string]string{blooms, chunks} {
+		for rng := range files {
+			if !published[rng] {
+				ranges[rng] = true
+			}
+		}
+	}
+	next := manifestLast + 1
+	if !rep.Manifest {
+		next = 0
+	}
+	for _, rng := range sortRanges(ranges) {
+		first, _, _ := ParseRange(rng)
+		if rep.Manifest && first <= manifestLast {
+			for _, files := range []map[string]string{blooms, chunks} {
+				if fn, ok := files[rng]; ok {
+					rep.Problems = append(rep.Problems, Problem{Kind: ProblemExtra, Range: rng, File: fn,
+						Detail: "not in the manifest"})
+					report(fn)
+				}
+			}
+			continue
+		}
+		_, last, _ := ParseRange(rng)
+		fn, hasBloom := blooms[rng]
+		if !hasBloom {
+			fn = chunks[rng]
+		}
+		switch {
+		case first != next:
+			rep.Problems = append(rep.Problems, Problem{Kind: ProblemGap, Range: rng, File: fn, Local: true,
+				Detail: fmt.Sprintf("starts at block %d, expected %d", first, next)})
+		case !hasBloom:
+			rep.Problems = append(rep.Problems, Problem{Kind: ProblemOrphan, Range: rng, File: fn, Local: true,
+				Detail: "no bloom"})
+		}
+		for _, files := range []map[string]string{blooms, chunks} {
+			if f, ok := files[rng]; ok {
+				rep.Local++
+				report(f)
+			}
+		}
+		next = last + 1
+	}
+
+	sort.SliceStable(rep.Problems, func(i, j int) bool { return rep.Problems[i].Range < rep.Problems[j].Range })
+	rep.Finished = time.Now().UTC()
+	return rep, nil
+}
+
+// listRanges maps the range of each file in dir with extension ext to its path.
+func listRanges(dir, ext string) map[string]string {
+	out := make(map[string]string)
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, _, ok := ParseRange(name); ok {
+			out[strings.TrimSuffix(name, ext)] = filepath.Join(dir, name)
+		}
+	}
+	return out
+}
+
+func sortRanges(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for rng := range set {
+		out = append(out, rng)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, _, _ := ParseRange(out[i])
+		b, _, _ := ParseRange(out[j])
+		return a < b || a == b && out[i] < out[j]
+	})
+	return out
+}
+
+// RepairOptions control Repair.
+type RepairOptions struct {
+	// Gateway is the IPFS gateway files are fetched from (DefaultGateway if
+	// empty).
+	Gateway string
+	// Offline quarantines bad files but fetches nothing; the scraper fetches
+	// the missing ones the next time it starts.
+	Offline bool
+	Client  *http.Client
+	// Progress, if set, is called after each problem is handled.
+	Progress func(Progress)
+}
+
+// Fix is what Repair did about one problem.
+type Fix struct {
+	Problem
+	Action string `json:"action"` // quarantined, fetched, left, or failed
+	Error  string `json:"error,omitempty"`
+}
+
+// RepairResult is the result of repairing one chain.
+type RepairResult struct {
+	Chain      string `json:"chain"`
+	Quarantine string `json:"quarantine,omitempty"` // where bad files were moved
+	Fixes      []Fix  `json:"fixes"`
+}
+
+// Repair fixes the problems Verify found. Bad and extra files are moved to a
+// quarantine folder in the chain's index folder rather than deleted. Published
+// files are then fetched again from the gateway and checked against their
+// hash. Locally built files can only be built again, so the first bad one and
+// every file after it are quarantined and the scraper rebuilds from there the
+// next time it runs.
+func Repair(ctx context.Context, indexPath string, rep Report, opts RepairOptions) (RepairResult, error) {
+	res := RepairResult{Chain: rep.Chain, Fixes: []Fix{}}
+	folder := ChainFolder(indexPath, rep.Chain)
+	gateway := opts.Gateway
+	if gateway == "" {
+		gateway = DefaultGateway
+	}
+	httpClient := opts.Client
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Minute}
+	}
+
+	problems := append([]Problem(nil), rep.Problems...)
+	var firstLocal uint64
+	hasLocal := false
+	for _, p := range problems {
+		if first, _, ok := ParseRange(p.Range); ok && p.Local && (!hasLocal || first < firstLocal) {
+			firstLocal, hasLocal = first, true
+		}
+	}
+	if hasLocal {
+		// Everything built after the first bad local file goes too
+		seen := make(map[string]bool)
+		for _, p := range problems {
+			seen[p.File] = true
+		}
+		for _, dir := range []struct{ sub, ext string }{{"blooms", ".bloom"}, {"finalized", ".bin"}} {
+			for rng, fn := range listRanges(filepath.Join(folder, dir.sub), dir.ext) {
+				if first, _, _ := ParseRange(rng); first >= firstLocal && !seen[fn] {
+					problems = append(problems, Problem{Kind: ProblemRebuild, Range: rng, File: fn, Local: true,
+						Detail: fmt.Sprintf("built after block %d", firstLocal)})
+					seen[fn] = true
+				}
+			}
+		}
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Range < problems[j].Range })
+	}
+
+	quarantine := func(fn string) error {
+		if res.Quarantine == "" {
+			res.Quarantine = filepath.Join(folder, "quarantine", time.Now().UTC().Format("20060102-150405"))
+		}
+		rel, err := filepath.Rel(folder, fn)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(res.Quarantine, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
+		}
+		return os.Rename(fn, dest)
+	}
+
+	for i, p := range problems {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		r := Fix{Problem: p}
+		if p.Kind != ProblemMissing {
+			if err := quarantine(p.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return res, err
+			}
+			r.Action = "quarantined"
+		}
+		switch {
+		case p.Hash == "" || p.Local:
+		case opts.Offline:
+			if r.Action == "" {
+				r.Action = "left"
+			}
+		default:
+			if err := fetch(ctx, httpClient, gateway, p.Hash, p.File); err != nil {
+				r.Action, r.Error = "failed", err.Error()
+			} else {
+				r.Action = "fetched"
+			}
+		}
+		res.Fixes = append(res.Fixes, r)
+		if opts.Progress != nil {
+			opts.Progress(Progress{Chain: rep.Chain, Phase: "repair", Done: i + 1, Total: len(problems), File: p.File})
+		}
+	}
+	return res, nil
+}
+
+// fetch downloads hash from gateway to fn, keeping it only if its hash matches.
+func fetch(ctx context.Context, httpClient *http.Client, gateway, hash, fn string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(gateway, "/")+"/"+hash, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gateway returned %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		return err
+	}
+	tmp := fn + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, resp.Body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		var got string
+		if got, err = FileCID(tmp); err == nil && got != hash {
+			err = fmt.Errorf("downloaded file has hash %s, expected %s", got, hash)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
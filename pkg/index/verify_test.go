@@ -0,0 +1,167 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// publish writes a bloom and a chunk for each range and a manifest listing
+// them, and returns the contents of each file by hash.
+func publish(t *testing.T, indexPath, chain string, ranges ...string) map[string][]byte {
+	t.Helper()
+	byHash := map[string][]byte{}
+	man := Manifest{Version: "trueblocks-core@v2.0.0-release", Chain: chain}
+	for _, rng := range ranges {
+		c := ManifestChunk{Range: rng}
+		for _, f := range []struct {
+			dir, ext string
+			hash     *string
+			size     *int64
+		}{{"blooms", ".bloom", &c.BloomHash, &c.BloomSize}, {"finalized", ".bin", &c.IndexHash, &c.IndexSize}} {
+			data := []byte(f.ext + " of " + rng)
+			writeFile(t, filepath.Join(indexPath, chain, f.dir, rng+f.ext), data)
+			*f.hash, _ = ReaderCID(strings.NewReader(string(data)))
+			*f.size = int64(len(data))
+			byHash[*f.hash] = data
+		}
+		man.Chunks = append(man.Chunks, c)
+	}
+	data, _ := json.Marshal(man)
+	writeFile(t, ManifestPath(indexPath, chain), data)
+	return byHash
+}
+
+func writeFile(t *testing.T, fn string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fn, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func kinds(problems []Problem) string {
+	var out []string
+	for _, p := range problems {
+		out = append(out, p.Kind+":"+filepath.Base(p.File))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	if _, err := Verify(ctx, dir, "mainnet", VerifyOptions{}); err != nil {
+		t.Fatalf("expected an empty index without a manifest to verify, got %v", err)
+	}
+
+	publish(t, dir, "mainnet", "000000000-000000099", "000000100-000000199", "000000200-000000299")
+	var calls int
+	rep, err := Verify(ctx, dir, "mainnet", VerifyOptions{Progress: func(p Progress) { calls++ }})
+	if err != nil || !rep.OK() || rep.Checked != 6 || calls != 6 || !rep.Manifest {
+		t.Fatalf("expected a clean index, got %+v %v", rep, err)
+	}
+
+	folder := ChainFolder(dir, "mainnet")
+	_ = os.Remove(filepath.Join(folder, "finalized", "000000000-000000099.bin"))
+	writeFile(t, filepath.Join(folder, "blooms", "000000100-000000199.bloom"), []byte(".bloom of 000000100-000000X99"))
+	writeFile(t, filepath.Join(folder, "finalized", "000000200-000000299.bin"), []byte("short"))
+	writeFile(t, filepath.Join(folder, "blooms", "000000150-000000160.bloom"), []byte("extra"))
+	// Built locally after the manifest: one in place, one after a gap, one without a bloom
+	writeFile(t, filepath.Join(folder, "blooms", "000000300-000000349.bloom"), []byte("local"))
+	writeFile(t, filepath.Join(folder, "finalized", "000000300-000000349.bin"), []byte("local"))
+	writeFile(t, filepath.Join(folder, "blooms", "000000400-000000449.bloom"), []byte("local"))
+	writeFile(t, filepath.Join(folder, "finalized", "000000450-000000499.bin"), []byte("local"))
+
+	rep, err = Verify(ctx, dir, "mainnet", VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "missing:000000000-000000099.bin hash:000000100-000000199.bloom extra:000000150-000000160.bloom size:000000200-000000299.bin gap:000000400-000000449.bloom orphan:000000450-000000499.bin"
+	if got := kinds(rep.Problems); got != want || rep.Local != 4 {
+		t.Fatalf("expected %s with 4 local files, got %s (%d local)", want, got, rep.Local)
+	}
+
+	// Quick skips the hashes; blooms only does not expect chunks
+	rep, _ = Verify(ctx, dir, "mainnet", VerifyOptions{Quick: true, BloomsOnly: true})
+	if got := kinds(rep.Problems); strings.Contains(got, "hash") || strings.Contains(got, "missing") || strings.Contains(got, "size") {
+		t.Fatalf("unexpected problems %s", got)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	byHash := publish(t, dir, "mainnet", "000000000-000000099", "000000100-000000199")
+	var served int
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hash := strings.TrimPrefix(r.URL.Path, "/ipfs/")
+		data, ok := byHash[hash]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		served++
+		_, _ = w.Write(data)
+	}))
+	defer gateway.Close()
+
+	folder := ChainFolder(dir, "mainnet")
+	_ = os.Remove(filepath.Join(folder, "blooms", "000000000-000000099.bloom"))
+	writeFile(t, filepath.Join(folder, "finalized", "000000100-000000199.bin"), []byte(".bin of 000000100-000000X99"))
+	writeFile(t, filepath.Join(folder, "blooms", "000000250-000000299.bloom"), []byte("local"))
+	writeFile(t, filepath.Join(folder, "finalized", "000000250-000000299.bin"), []byte("local"))
+	writeFile(t, filepath.Join(folder, "blooms", "000000300-000000349.bloom"), []byte("local"))
+	writeFile(t, filepath.Join(folder, "finalized", "000000300-000000349.bin"), []byte("local"))
+
+	rep, _ := Verify(ctx, dir, "mainnet", VerifyOptions{})
+	if got := kinds(rep.Problems); got != "missing:000000000-000000099.bloom hash:000000100-000000199.bin gap:000000250-000000299.bloom" {
+		t.Fatalf("unexpected problems %s", got)
+	}
+
+	res, err := Repair(ctx, dir, rep, RepairOptions{Gateway: gateway.URL + "/ipfs/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]string{}
+	for _, f := range res.Fixes {
+		actions[filepath.Base(f.File)] = f.Action
+	}
+	if actions["000000000-000000099.bloom"] != "fetched" || actions["000000100-000000199.bin"] != "fetched" || served != 2 {
+		t.Fatalf("expected the published files to be fetched, got %v", actions)
+	}
+	// The gap and everything built after it are quarantined to be built again
+	if len(actions) != 6 || actions["000000300-000000349.bin"] != "quarantined" {
+		t.Fatalf("expected the local files to be quarantined, got %v", actions)
+	}
+	if _, err := os.Stat(filepath.Join(res.Quarantine, "finalized", "000000100-000000199.bin")); err != nil {
+		t.Fatalf("expected the bad chunk in quarantine: %v", err)
+	}
+
+	rep, _ = Verify(ctx, dir, "mainnet", VerifyOptions{})
+	if !rep.OK() || rep.Local != 0 {
+		t.Fatalf("expected a clean index after the repair, got %s", kinds(rep.Problems))
+	}
+
+	// A gateway that serves the wrong contents is not trusted
+	bad := filepath.Join(folder, "blooms", "000000000-000000099.bloom")
+	_ = os.Remove(bad)
+	for hash := range byHash {
+		byHash[hash] = []byte("something else")
+	}
+	rep, _ = Verify(ctx, dir, "mainnet", VerifyOptions{})
+	res, err = Repair(ctx, dir, rep, RepairOptions{Gateway: gateway.URL + "/ipfs/"})
+	if err != nil || len(res.Fixes) != 1 || res.Fixes[0].Action != "failed" || !strings.Contains(res.Fixes[0].Error, "expected") {
+		t.Fatalf("expected the download to be rejected, got %+v %v", res.Fixes, err)
+	}
+	if _, err := os.Stat(bad); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be written for a rejected download")
+	}
+}
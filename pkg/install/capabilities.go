@@ -0,0 +1,170 @@
+package install
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/jsonrpc"
+)
+
+// Results of a capability check.
+const (
+	CapabilityPass = "pass"
+	CapabilityFail = "fail"
+)
+
+// The features ProbeCapabilities checks. The scraper needs the required ones
+// to build the index from an RPC.
+const (
+	FeatureBlockNumber = "block_number" // eth_blockNumber answers
+	FeatureArchive     = "archive"      // state at block 1 is still available
+	FeatureTrace       = "trace"        // trace_block is supported
+	FeatureDebug       = "debug"        // debug_traceBlockByNumber is supported
+	FeatureLogsRange   = "logs_range"   // eth_getLogs accepts a 10,000 block range
+	FeatureBatch       = "batch"        // JSON-RPC batch requests are answered
+)
+
+// logsRangeBlocks is the eth_getLogs range checked by FeatureLogsRange.
+const logsRangeBlocks = 10_000
+
+// Capability is the result of checking one feature of an RPC.
+type Capability struct {
+	Name      string `json:"name"`
+	Required  bool   `json:"required"`
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Capabilities is the capability matrix of one RPC, with a warning for each
+// required feature it lacks.
+type Capabilities struct {
+	URL       string       `json:"url"`
+	CheckedAt int64        `json:"checkedAt"`
+	HeadBlock uint64       `json:"headBlock,omitempty"`
+	Features  []Capability `json:"features"`
+	Warnings  []string     `json:"warnings,omitempty"`
+}
+
+// Missing lists the required features that failed.
+func (c Capabilities) Missing() []string {
+	var out []string
+	for _, f := range c.Features {
+		if f.Required && f.Status != CapabilityPass {
+			out = append(out, f.Name)
+		}
+	}
+	return out
+}
+
+// missingWarnings explains what a missing required feature means for khedra.
+var missingWarnings = map[string]string{
+	FeatureBlockNumber: "the RPC does not answer eth_blockNumber",
+	FeatureArchive:     "the RPC is not an archive node (no state at block 1); the scraper needs full history",
+	FeatureTrace:       "the RPC does not support trace_block; the scraper cannot find every appearance without traces",
+}
+
+var (
+	capabilityCache   = map[string]Capabilities{}
+	capabilityCacheMu sync.Mutex
+)
+
+// ProbeCapabilities checks which features rpcUrl supports. The checks run in
+// parallel and results are cached for a short while, like other RPC probes.
+func ProbeCapabilities(ctx context.Context, rpcUrl string) Capabilities {
+	capabilityCacheMu.Lock()
+	if res, ok := capabilityCache[rpcUrl]; ok && time.Since(time.Unix(res.CheckedAt, 0)) < probeTTL {
+		capabilityCacheMu.Unlock()
+		return res
+	}
+	capabilityCacheMu.Unlock()
+
+	res := Capabilities{URL: rpcUrl, CheckedAt: time.Now().Unix()}
+
+	// The block number bounds the eth_getLogs range, so it is checked first
+	var bn uint64
+	head := checkCapability(FeatureBlockNumber, true, func() (err error) {
+		bn, err = jsonrpc.Uint64(ctx, rpcUrl, "eth_blockNumber")
+		return err
+	})
+	from := uint64(0)
+	if bn >= logsRangeBlocks {
+		from = bn - logsRangeBlocks + 1
+	}
+
+	checks := []struct {
+		name     string
+		required bool
+		run      func() error
+	}{
+		{FeatureArchive, true, func() error {
+			return jsonrpc.Call(ctx, rpcUrl, "eth_getBalance", []any{zeroAddress, "0x1"}, nil)
+		}},
+		{FeatureTrace, true, func() error {
+			return jsonrpc.Call(ctx, rpcUrl, "trace_block", []any{"0x1"}, nil)
+		}},
+		{FeatureDebug, false, func() error {
+			return jsonrpc.Call(ctx, rpcUrl, "debug_traceBlockByNumber", []any{"0x1", map[string]string{"tracer": "callTracer"}}, nil)
+		}},
+		{FeatureLogsRange, false, func() error {
+			filter := map[string]any{
+				"fromBlock": fmt.Sprintf("0x%x", from),
+				"toBlock":   fmt.Sprintf("0x%x", bn),
+				"address":   zeroAddress,
+			}
+			return jsonrpc.Call(ctx, rpcUrl, "eth_getLogs", []any{filter}, nil)
+		}},
+		{FeatureBatch, false, func() error {
+			results, err := jsonrpc.Batch(ctx, rpcUrl, []jsonrpc.Request{{Method: "eth_chainId"}, {Method: "eth_blockNumber"}})
+			if err == nil {
+				for _, r := range results {
+					var hex string
+					if err := json.Unmarshal(r, &hex); err != nil {
+						return fmt.Errorf("invalid batch result %s", r)
+					}
+				}
+			}
+			return err
+		}},
+	}
+
+	features := make([]Capability, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			features[i] = checkCapability(c.name, c.required, c.run)
+		}()
+	}
+	wg.Wait()
+
+	res.HeadBlock = bn
+	res.Features = append([]Capability{head}, features...)
+	for _, name := range res.Missing() {
+		res.Warnings = append(res.Warnings, missingWarnings[name])
+	}
+
+	capabilityCacheMu.Lock()
+	capabilityCache[rpcUrl] = res
+	capabilityCacheMu.Unlock()
+	rpcLog().Info("rpc capability probe", "url", rpcUrl, "missing", res.Missing())
+	return res
+}
+
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// checkCapability runs one check and times it.
+func checkCapability(name string, required bool, run func() error) Capability {
+	start := time.Now()
+	err := run()
+	c := Capability{Name: name, Required: required, Status: CapabilityPass, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		c.Status = CapabilityFail
+		c.Error = err.Error()
+	}
+	return c
+}
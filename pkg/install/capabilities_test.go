@@ -0,0 +1,86 @@
+package install
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeNode answers like a pruned node with traces but no debug namespace, a
+// 1,000 block eth_getLogs limit and batch support.
+func fakeNode(t *testing.T) *httptest.Server {
+	t.Helper()
+	answer := func(method string) string {
+		switch method {
+		case "eth_blockNumber", "eth_chainId":
+			return `"result":"0x1000000"`
+		case "eth_getBalance":
+			return `"error":{"code":-32000,"message":"missing trie node"}`
+		case "trace_block":
+			return `"result":[]`
+		case "eth_getLogs":
+			return `"error":{"code":-32005,"message":"block range too large"}`
+		}
+		return `"error":{"code":-32601,"message":"method not found"}`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		type call struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+			var calls []call
+			_ = json.Unmarshal(body, &calls)
+			var parts []string
+			for _, c := range calls {
+				parts = append(parts, `{"jsonrpc":"2.0","id":`+strconv.Itoa(c.ID)+`,`+answer(c.Method)+`}`)
+			}
+			_, _ = w.Write([]byte("[" + strings.Join(parts, ",") + "]"))
+			return
+		}
+		var c call
+		_ = json.Unmarshal(body, &c)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,` + answer(c.Method) + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	srv := fakeNode(t)
+	caps := ProbeCapabilities(context.Background(), srv.URL)
+
+	got := map[string]string{}
+	for _, f := range caps.Features {
+		got[f.Name] = f.Status
+	}
+	want := map[string]string{
+		FeatureBlockNumber: CapabilityPass,
+		FeatureArchive:     CapabilityFail,
+		FeatureTrace:       CapabilityPass,
+		FeatureDebug:       CapabilityFail,
+		FeatureLogsRange:   CapabilityFail,
+		FeatureBatch:       CapabilityPass,
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Fatalf("feature %s: expected %s, got %s (%+v)", name, status, got[name], caps.Features)
+		}
+	}
+	if caps.Features[0].Name != FeatureBlockNumber {
+		t.Fatalf("expected %s first, got %s", FeatureBlockNumber, caps.Features[0].Name)
+	}
+
+	if missing := caps.Missing(); len(missing) != 1 || missing[0] != FeatureArchive {
+		t.Fatalf("expected only archive to be missing, got %v", missing)
+	}
+	if len(caps.Warnings) != 1 || !strings.Contains(caps.Warnings[0], "archive") {
+		t.Fatalf("expected an archive warning, got %v", caps.Warnings)
+	}
+}
@@ -0,0 +1,249 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/config"
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chifra"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// ChifraUnmapped is a setting in trueBlocks.toml that has no place in
+// khedra's config.
+type ChifraUnmapped struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// ChifraImport reports what ImportChifra took from a trueBlocks.toml.
+type ChifraImport struct {
+	Path       string           `json:"path"`
+	Chains     []string         `json:"chains"`
+	DataFolder string           `json:"dataFolder,omitempty"`
+	Unmapped   []ChifraUnmapped `json:"unmapped,omitempty"`
+}
+
+// DefaultChifraConfig returns the trueBlocks.toml chifra reads by default,
+// which is also the one the daemon uses.
+func DefaultChifraConfig() string {
+	return filepath.Join(config.PathToRootConfig(), "trueBlocks.toml")
+}
+
+// ImportChifra reads chifra's trueBlocks.toml at path and merges its chains
+// (RPCs and chain IDs) and its index and cache folders into d. Anything
+// khedra cannot represent is listed in the report rather than dropped
+// silently. The draft is not validated or saved.
+func ImportChifra(path string, d *Draft) (ChifraImport, error) {
+	rep := ChifraImport{Path: path}
+	if _, err := os.Stat(path); err != nil {
+		return rep, err // chifra.Load takes a missing file for an empty one
+	}
+	cfg, err := chifra.Load(path)
+	if err != nil {
+		return rep, err
+	}
+	raw, _ := cfg.Get()
+	flat := cfg.Flatten()
+	if d.Config.Chains == nil {
+		d.Config.Chains = map[string]types.Chain{}
+	}
+
+	unmapped := func(key string, value any, reason string) {
+		if s, ok := value.(string); ok && strings.TrimSpace(s) == "" {
+			return // an empty setting loses nothing
+		}
+		rep.Unmapped = append(rep.Unmapped, ChifraUnmapped{Key: key, Value: chifraValue(key, value), Reason: reason})
+	}
+
+	for _, section := range sortedKeys(asTable(raw)) {
+		switch section {
+		case "version":
+			// chifra's own file version, nothing to carry over
+		case "settings":
+			settings, _ := cfg.Get(section)
+			importChifraSettings(asTable(settings), flat, d, &rep, unmapped)
+		case "chains":
+			for _, name := range cfg.Tables(section) {
+				table, _ := cfg.Get(section, name)
+				if importChifraChain(name, asTable(table), flat, d, unmapped) {
+					rep.Chains = append(rep.Chains, name)
+				}
+			}
+		case "keys":
+			for key, value := range under(flat, section) {
+				unmapped(key, value, "khedra has no API key settings; chifra keeps reading them from its own trueBlocks.toml")
+			}
+		default:
+			for key, value := range under(flat, section) {
+				unmapped(key, value, "khedra has no equivalent setting")
+			}
+		}
+	}
+
+	sort.Slice(rep.Unmapped, func(i, j int) bool { return rep.Unmapped[i].Key < rep.Unmapped[j].Key })
+	return rep, nil
+}
+
+// importChifraSettings maps [settings]. khedra keeps the index and cache in
+// fixed subfolders of its data folder, so the paths only map when chifra's do
+// the same.
+func importChifraSettings(settings map[string]any, flat map[string]string, d *Draft, rep *ChifraImport, unmapped func(string, any, string)) {
+	indexPath, _ := settings["indexPath"].(string)
+	cachePath, _ := settings["cachePath"].(string)
+	indexPath = cleanChifraPath(indexPath)
+	cachePath = cleanChifraPath(cachePath)
+
+	folder := ""
+	switch {
+	case indexPath != "" && filepath.Base(indexPath) == "unchained":
+		folder = filepath.Dir(indexPath)
+	case indexPath == "" && cachePath != "" && filepath.Base(cachePath) == "cache":
+		folder = filepath.Dir(cachePath)
+	}
+	if folder != "" {
+		d.Config.General.DataFolder = folder
+		rep.DataFolder = folder
+	}
+	if indexPath != "" && folder != filepath.Dir(indexPath) {
+		unmapped("settings.indexPath", indexPath, "khedra keeps the index in <dataFolder>/unchained; move or link the index there")
+	}
+	if cachePath != "" && (folder == "" || cachePath != filepath.Join(folder, "cache")) {
+		unmapped("settings.cachePath", cachePath, "khedra keeps the cache in <dataFolder>/cache; move or link the cache there")
+	}
+
+	for _, key := range sortedKeys(settings) {
+		value := settings[key]
+		switch key {
+		case "indexPath", "cachePath":
+		case "defaultChain":
+			if s, _ := value.(string); s != "" && s != "mainnet" {
+				unmapped("settings."+key, value, "khedra always uses mainnet as the default chain")
+			}
+		default:
+			for k, v := range under(flat, "settings."+key) {
+				unmapped(k, v, "khedra has no equivalent setting")
+			}
+		}
+	}
+}
+
+// importChifraChain maps one [chains.<name>] table onto the draft. It reports
+// false for a table with no RPC, which khedra cannot use.
+func importChifraChain(name string, table map[string]any, flat map[string]string, d *Draft, unmapped func(string, any, string)) bool {
+	prefix := "chains." + name
+	var rpcs []string
+	if list, ok := table["rpcProviders"].([]any); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				rpcs = append(rpcs, strings.TrimSpace(s))
+			}
+		}
+	}
+	if s, _ := table["rpcProvider"].(string); strings.TrimSpace(s) != "" && !slices.Contains(rpcs, strings.TrimSpace(s)) {
+		rpcs = append([]string{strings.TrimSpace(s)}, rpcs...)
+	}
+	if len(rpcs) == 0 {
+		unmapped(prefix+".rpcProvider", "(none)", "no RPC; the chain was not imported")
+		return false
+	}
+
+	chainID := 0
+	if s := fmt.Sprint(table["chainId"]); table["chainId"] != nil {
+		if id, err := strconv.Atoi(strings.TrimSpace(s)); err == nil && id > 0 {
+			chainID = id
+		} else {
+			unmapped(prefix+".chainId", table["chainId"], "not a chain id; taken from the chain catalog instead")
+		}
+	}
+	info, known := chains.ByID(chainID)
+	if chainID == 0 {
+		info, known = chains.ByName(name)
+		chainID = info.ChainID
+	}
+	if chainID == 0 {
+		unmapped(prefix+".chainId", "(none)", "unknown chain; set its chainId in khedra's config")
+	}
+
+	for _, key := range sortedKeys(table) {
+		value := table[key]
+		switch key {
+		case "rpcProvider", "rpcProviders", "chainId":
+		case "chain":
+			if s, _ := value.(string); s != "" && s != name {
+				unmapped(prefix+"."+key, value, fmt.Sprintf("khedra names the chain after its table (%s)", name))
+			}
+		case "symbol":
+			if s, _ := value.(string); s != "" && (!known || s != info.Symbol) {
+				unmapped(prefix+"."+key, value, "khedra takes the symbol from its chain catalog")
+			}
+		case "remoteExplorer":
+			if s, _ := value.(string); s != "" && (!known || strings.TrimRight(s, "/") != strings.TrimRight(info.Explorer(), "/")) {
+				unmapped(prefix+"."+key, value, "khedra takes the explorer from its chain catalog")
+			}
+		case "scrape":
+			for k, v := range under(flat, prefix+"."+key) {
+				unmapped(k, v, "khedra's scraper settings are per service (services.scraper)")
+			}
+		default:
+			for k, v := range under(flat, prefix+"."+key) {
+				unmapped(k, v, "khedra has no equivalent setting")
+			}
+		}
+	}
+
+	d.Config.Chains[name] = types.Chain{Name: name, RPCs: rpcs, ChainID: chainID, Enabled: true}
+	return true
+}
+
+// cleanChifraPath expands ~ and environment variables and cleans the path.
+func cleanChifraPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	return filepath.Clean(utils.ResolvePath(os.ExpandEnv(path)))
+}
+
+// chifraValue renders a value for the report, hiding secrets.
+func chifraValue(key string, value any) string {
+	s := fmt.Sprint(value)
+	if chifra.IsSecret(key) && s != "" {
+		return "(set)"
+	}
+	return s
+}
+
+// under returns the keys of flat (see chifra.Config.Flatten) at or below the
+// dotted key prefix.
+func under(flat map[string]string, prefix string) map[string]string {
+	out := map[string]string{}
+	for k, v := range flat {
+		if k == prefix || strings.HasPrefix(k, prefix+".") {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func asTable(value any) map[string]any {
+	table, _ := value.(map[string]any)
+	return table
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,140 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+const chifraToml = `[version]
+  current = "v5.1.0"
+
+[settings]
+  cachePath = "%s/cache"
+  defaultChain = "gnosis"
+  indexPath = "%s/unchained"
+
+[settings.notify]
+  url = "http://localhost:5555"
+
+[keys]
+  [keys.etherscan]
+    apiKey = "abc123"
+  [keys.pinata]
+    apiKey = ""
+
+[pinning]
+  gatewayUrl = "https://ipfs.unchainedindex.io/ipfs"
+
+[chains]
+  [chains.mainnet]
+    chain = "mainnet"
+    chainId = "1"
+    remoteExplorer = "https://etherscan.io"
+    rpcProvider = "http://localhost:8545"
+    rpcProviders = ["http://localhost:8545", "http://backup:8545"]
+    symbol = "ETH"
+  [chains.mainnet.scrape]
+    appsPerChunk = 2000000
+  [chains.gnosis]
+    chainId = "100"
+    rpcProvider = "https://gnosis.example"
+    symbol = "GNO"
+  [chains.sepolia]
+    chainId = "11155111"
+    rpcProvider = ""
+`
+
+func TestImportChifra(t *testing.T) {
+	tmp := t.TempDir()
+	fn := filepath.Join(tmp, "trueBlocks.toml")
+	data := []byte(strings.ReplaceAll(chifraToml, "%s", tmp))
+	if err := os.WriteFile(fn, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Draft{Config: types.NewConfig()}
+	d.Config.Chains["optimism"] = types.Chain{Name: "optimism", ChainID: 10, RPCs: []string{"https://op.example"}, Enabled: true}
+	rep, err := ImportChifra(fn, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(rep.Chains, []string{"gnosis", "mainnet"}) {
+		t.Fatalf("expected gnosis and mainnet to be imported, got %v", rep.Chains)
+	}
+	if d.Config.General.DataFolder != tmp || rep.DataFolder != tmp {
+		t.Fatalf("expected the data folder %s, got %s", tmp, d.Config.General.DataFolder)
+	}
+	mainnet := d.Config.Chains["mainnet"]
+	if mainnet.ChainID != 1 || !slices.Equal(mainnet.RPCs, []string{"http://localhost:8545", "http://backup:8545"}) || !mainnet.Enabled {
+		t.Fatalf("unexpected mainnet %+v", mainnet)
+	}
+	if g := d.Config.Chains["gnosis"]; g.ChainID != 100 || g.RPCs[0] != "https://gnosis.example" {
+		t.Fatalf("unexpected gnosis %+v", g)
+	}
+	if _, ok := d.Config.Chains["optimism"]; !ok {
+		t.Fatal("expected chains already in the draft to be kept")
+	}
+	if _, ok := d.Config.Chains["sepolia"]; ok {
+		t.Fatal("a chain without an RPC should not be imported")
+	}
+
+	got := map[string]string{}
+	for _, u := range rep.Unmapped {
+		got[u.Key] = u.Value
+	}
+	want := map[string]string{
+		"chains.gnosis.symbol":               "GNO",
+		"chains.mainnet.scrape.appsPerChunk": "2000000",
+		"chains.sepolia.rpcProvider":         "(none)",
+		"keys.etherscan.apiKey":              "(set)",
+		"pinning.gatewayUrl":                 "https://ipfs.unchainedindex.io/ipfs",
+		"settings.defaultChain":              "gnosis",
+		"settings.notify.url":                "http://localhost:5555",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d unmapped settings, got %v", len(want), rep.Unmapped)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("expected %s = %q to be unmapped, got %v", k, v, rep.Unmapped)
+		}
+	}
+
+	if errs := ValidateDraftPhase(d, "final"); len(errs) != 0 {
+		t.Fatalf("expected the imported draft to validate, got %v", errs)
+	}
+}
+
+func TestImportChifra_Paths(t *testing.T) {
+	tmp := t.TempDir()
+	fn := filepath.Join(tmp, "trueBlocks.toml")
+	toml := "[settings]\n  indexPath = \"" + tmp + "/index\"\n  cachePath = \"" + tmp + "/other/cache\"\n"
+	if err := os.WriteFile(fn, []byte(toml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d := &Draft{Config: types.NewConfig()}
+	before := d.Config.General.DataFolder
+	rep, err := ImportChifra(fn, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Config.General.DataFolder != before || rep.DataFolder != "" {
+		t.Fatalf("paths that do not fit a data folder should not change it, got %s", d.Config.General.DataFolder)
+	}
+	if len(rep.Unmapped) != 2 || rep.Unmapped[0].Key != "settings.cachePath" || rep.Unmapped[1].Key != "settings.indexPath" {
+		t.Fatalf("expected both paths to be reported, got %v", rep.Unmapped)
+	}
+
+	if err := os.WriteFile(fn, []byte("[chains\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportChifra(fn, d); err == nil {
+		t.Fatal("expected a parse error")
+	}
+}
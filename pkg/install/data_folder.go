@@ -0,0 +1,181 @@
+package install
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	yamlv2 "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// SetDataFolder points config.yaml at a new data folder, changing only the
+// value of general.dataFolder so the rest of the file, comments included, is
+// left alone (see rewriteConfig). Any unrecorded edit to the current file is
+// kept as a manual generation first, and the new file is recorded from
+// source. It returns the previous contents so a caller that cannot finish the
+// switch can put them back with RestoreConfig.
+func SetDataFolder(folder, source string) ([]byte, Generation, error) {
+	folder = filepath.Clean(folder)
+	keys := []yamlKey{{[]string{"general", "dataFolder"}, folder}}
+	return rewriteConfig(source, "data folder moved to "+folder, keys, func(cfg *types.Config) {
+		cfg.General.DataFolder = folder
+	})
+}
+
+// RelocateConfig points a config.yaml restored from another host at this
+// host's data and log folders, recording the restored file and then the
+// rewritten one as generations.
+func RelocateConfig(dataFolder, logFolder, source string) ([]byte, Generation, error) {
+	dataFolder, logFolder = filepath.Clean(dataFolder), filepath.Clean(logFolder)
+	keys := []yamlKey{{[]string{"general", "dataFolder"}, dataFolder}, {[]string{"logging", "folder"}, logFolder}}
+	return rewriteConfig(source, "restored from a backup, data folder "+dataFolder, keys, func(cfg *types.Config) {
+		cfg.General.DataFolder = dataFolder
+		cfg.Logging.Folder = logFolder
+	})
+}
+
+// RelocateDraft does the same for the wizard's draft, if there is one.
+func RelocateDraft(dataFolder, logFolder string) error {
+	d, err := LoadDraft()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	d.Config.General.DataFolder = filepath.Clean(dataFolder)
+	d.Config.Logging.Folder = filepath.Clean(logFolder)
+	return SaveDraftAtomic(d)
+}
+
+// yamlKey is a string value to set at a path of mapping keys in a YAML file.
+type yamlKey struct {
+	path  []string
+	value string
+}
+
+// rewriteConfig sets keys in config.yaml and returns the previous contents.
+// Only the values of keys are replaced in the text, so comments and layout
+// are kept. If that is not possible, or the result does not read back as
+// edit applied to the old config, the file is rendered anew from its template
+// with a warning; the previous text stays in the generations.
+func rewriteConfig(source, note string, keys []yamlKey, edit func(*types.Config)) ([]byte, Generation, error) {
+	genMu.Lock()
+	defer genMu.Unlock()
+
+	finalPath := types.GetConfigFnNoCreate()
+	original, err := os.ReadFile(finalPath)
+	if err != nil {
+		return nil, Generation{}, err
+	}
+	var cfg types.Config
+	if err := yamlv2.Unmarshal(original, &cfg); err != nil {
+		return nil, Generation{}, fmt.Errorf("cannot read %s: %w", finalPath, err)
+	}
+	if _, _, err := recordGeneration(original, SourceManual, ""); err != nil {
+		return nil, Generation{}, err
+	}
+
+	edit(&cfg)
+	data, ok := original, true
+	for _, k := range keys {
+		if data, ok = setYAMLScalar(data, k.path, k.value); !ok {
+			break
+		}
+	}
+	if ok {
+		var check types.Config
+		ok = yamlv2.Unmarshal(data, &check) == nil && reflect.DeepEqual(check, cfg)
+	}
+	if !ok {
+		if data, err = renderConfig(cfg, finalPath); err != nil {
+			return nil, Generation{}, err
+		}
+		slog.Default().Warn("config.yaml could not be edited in place; it was rewritten without its comments or layout",
+			"path", finalPath, "change", note)
+	}
+	if err := writeFileAtomic(finalPath, data); err != nil {
+		return nil, Generation{}, err
+	}
+	g, _, err := recordGeneration(data, source, note)
+	return original, g, err
+}
+
+// renderConfig renders cfg from the config.yaml template.
+func renderConfig(cfg types.Config, finalPath string) ([]byte, error) {
+	tmp := finalPath + ".tmp-new"
+	defer os.Remove(tmp)
+	if err := cfg.WriteToFile(tmp); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(tmp)
+}
+
+// setYAMLScalar replaces the value at path, a list of mapping keys, in src
+// and leaves every other byte as it was. It returns false if there is no
+// value at path or it is not a scalar on one line.
+func setYAMLScalar(src []byte, path []string, value string) ([]byte, bool) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(src, &doc); err != nil || len(doc.Content) == 0 {
+		return nil, false
+	}
+	node := doc.Content[0]
+	for _, key := range path {
+		if node.Kind != yamlv3.MappingNode {
+			return nil, false
+		}
+		var next *yamlv3.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+			}
+		}
+		if next == nil {
+			return nil, false
+		}
+		node = next
+	}
+	if node.Kind != yamlv3.ScalarNode || node.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0 {
+		return nil, false
+	}
+	rendered, err := yamlv3.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	text := strings.TrimSuffix(string(rendered), "\n")
+	if strings.Contains(text, "\n") {
+		return nil, false
+	}
+
+	lines := bytes.Split(src, []byte("\n"))
+	if node.Line < 1 || node.Line > len(lines) {
+		return nil, false
+	}
+	line, col := lines[node.Line-1], node.Column-1
+	if col < 0 || col > len(line) {
+		return nil, false
+	}
+	line = append(append([]byte(nil), line[:col]...), text...)
+	if node.LineComment != "" {
+		line = append(line, " "+node.LineComment...)
+	}
+	lines[node.Line-1] = line
+	return bytes.Join(lines, []byte("\n")), true
+}
+
+// RestoreConfig puts back config.yaml as SetDataFolder found it.
+func RestoreConfig(original []byte, source string) error {
+	genMu.Lock()
+	defer genMu.Unlock()
+	if err := writeFileAtomic(types.GetConfigFnNoCreate(), original); err != nil {
+		return err
+	}
+	_, _, err := recordGeneration(original, source, "data move undone")
+	return err
+}
@@ -0,0 +1,153 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+func TestSetDataFolder(t *testing.T) {
+	tmp := t.TempDir()
+	fn := filepath.Join(tmp, "config.yaml")
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", fn)
+
+	cfg := types.NewConfig()
+	cfg.General.DataFolder = filepath.Join(tmp, "old")
+	cfg.General.Strategy = "scratch"
+	if err := cfg.WriteToFile(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	original, g, err := SetDataFolder(filepath.Join(tmp, "new")+"/", SourceCLI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Source != SourceCLI || !strings.Contains(g.Note, filepath.Join(tmp, "new")) {
+		t.Fatalf("unexpected generation %+v", g)
+	}
+	var got types.Config
+	data, _ := os.ReadFile(fn)
+	if err := yamlv2.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.General.DataFolder != filepath.Join(tmp, "new") || got.General.Strategy != "scratch" || len(got.Chains) != len(cfg.Chains) {
+		t.Fatalf("unexpected config after the switch: %+v", got.General)
+	}
+	if gens, _ := Generations(); len(gens) != 2 || gens[1].Source != SourceManual {
+		t.Fatalf("expected the old file to be kept as a generation, got %v", gens)
+	}
+
+	if err := RestoreConfig(original, SourceCLI); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(fn); string(data) != string(original) {
+		t.Fatal("RestoreConfig did not put back the original file")
+	}
+}
+
+func TestRelocateConfig(t *testing.T) {
+	tmp := t.TempDir()
+	fn := filepath.Join(tmp, "config.yaml")
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", fn)
+
+	// As restored from another host
+	cfg := types.NewConfig()
+	cfg.General.DataFolder = "/home/other/.khedra/data"
+	cfg.Logging.Folder = "/home/other/.khedra/logs"
+	if err := cfg.WriteToFile(fn); err != nil {
+		t.Fatal(err)
+	}
+	d := &Draft{Config: cfg}
+	if err := SaveDraftAtomic(d); err != nil {
+		t.Fatal(err)
+	}
+
+	data, logs := filepath.Join(tmp, "data"), filepath.Join(tmp, "logs")
+	if _, _, err := RelocateConfig(data, logs, SourceCLI); err != nil {
+		t.Fatal(err)
+	}
+	if err := RelocateDraft(data, logs); err != nil {
+		t.Fatal(err)
+	}
+	var got types.Config
+	raw, _ := os.ReadFile(fn)
+	if err := yamlv2.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.General.DataFolder != data || got.Logging.Folder != logs {
+		t.Fatalf("config not relocated: %s, %s", got.General.DataFolder, got.Logging.Folder)
+	}
+	if d, err := LoadDraft(); err != nil || d.Config.General.DataFolder != data || d.Config.Logging.Folder != logs {
+		t.Fatalf("draft not relocated: %v", err)
+	}
+	if gens, _ := Generations(); len(gens) != 2 || gens[1].Source != SourceManual {
+		t.Fatalf("expected the restored file to be kept as a generation, got %v", gens)
+	}
+}
+
+func TestSetDataFolder_KeepsComments(t *testing.T) {
+	tmp := t.TempDir()
+	fn := filepath.Join(tmp, "config.yaml")
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", fn)
+
+	cfg := types.NewConfig()
+	cfg.General.DataFolder = filepath.Join(tmp, "old")
+	if err := cfg.WriteToFile(fn); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(fn)
+	lines := strings.Split(string(data), "\n")
+	for i, l := range lines {
+		if strings.Contains(l, "dataFolder:") {
+			lines[i] = l + " # moved in June"
+		}
+	}
+	old := "# my notes\n" + strings.Join(lines, "\n")
+	if err := os.WriteFile(fn, []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := SetDataFolder(filepath.Join(tmp, "new"), SourceCLI); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(fn)
+	before, after := strings.Split(old, "\n"), strings.Split(string(got), "\n")
+	if len(before) != len(after) {
+		t.Fatalf("expected the same lines, got\n%s", got)
+	}
+	var changed []string
+	for i := range before {
+		if before[i] != after[i] {
+			changed = append(changed, after[i])
+		}
+	}
+	if len(changed) != 1 || !strings.HasSuffix(changed[0], "dataFolder: "+filepath.Join(tmp, "new")+" # moved in June") {
+		t.Fatalf("expected only the data folder to change, got %q", changed)
+	}
+}
+
+func TestSetDataFolder_RewritesWithoutKey(t *testing.T) {
+	tmp := t.TempDir()
+	fn := filepath.Join(tmp, "config.yaml")
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", fn)
+
+	// No dataFolder to edit: the file is rendered from the template
+	if err := os.WriteFile(fn, []byte("# my notes\ngeneral:\n  strategy: scratch\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := SetDataFolder(filepath.Join(tmp, "new"), SourceCLI); err != nil {
+		t.Fatal(err)
+	}
+	var got types.Config
+	data, _ := os.ReadFile(fn)
+	if err := yamlv2.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.General.DataFolder != filepath.Join(tmp, "new") || got.General.Strategy != "scratch" || strings.Contains(string(data), "# my notes") {
+		t.Fatalf("expected a rewritten file, got %+v", got.General)
+	}
+}
@@ -13,14 +13,15 @@ import (
 	"time"
 
 	coreFile "github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
 	yamlv2 "gopkg.in/yaml.v2"
 )
 
 const (
-	DraftSchema    = 1
-	draftFileName  = "config.draft.json"
-	backupFileName = "config.prev.yaml" // single rolling backup of final yaml
+	DraftSchema   = 1
+	draftFileName = "config.draft.json"
 )
 
 var (
@@ -29,11 +30,13 @@ var (
 
 // DraftMeta carries metadata about the draft file.
 type DraftMeta struct {
-	Schema    int       `json:"schema"`
-	Updated   time.Time `json:"updated"`
-	Session   string    `json:"session"`
-	EstDiskGB int       `json:"estDiskGb,omitempty"`
-	EstHours  int       `json:"estHours,omitempty"`
+	Schema    int            `json:"schema"`
+	Updated   time.Time      `json:"updated"`
+	Session   string         `json:"session"`
+	EstDiskGB int            `json:"estDiskGb,omitempty"`
+	EstHours  int            `json:"estHours,omitempty"`
+	Estimate  *IndexEstimate `json:"estimate,omitempty"` // per-chain breakdown of EstDiskGB and EstHours
+	Step      string         `json:"step,omitempty"`     // first unfinished step, so the browser or terminal wizard can resume there
 }
 
 // Draft holds an in-progress configuration plus metadata.
@@ -93,18 +96,11 @@ func SaveDraftAtomic(d *Draft) error {
 	if d == nil {
 		return errors.New("nil draft")
 	}
-	// Backfill missing chain IDs using known chain list (lightweight) before persisting.
+	// Backfill missing chain IDs from the chain catalog before persisting.
 	for key, ch := range d.Config.Chains {
 		if ch.ChainID == 0 {
-			for _, kc := range KnownChains() {
-				if kc.Name == key {
-					ch.ChainID = kc.ChainID
-					break
-				}
-			}
-			// Ensure mainnet defaults to 1 even if not in KnownChains for some reason
-			if ch.ChainID == 0 && key == "mainnet" {
-				ch.ChainID = 1
+			if info, ok := chains.ByName(key); ok {
+				ch.ChainID = info.ChainID
 			}
 			d.Config.Chains[key] = ch
 		}
@@ -147,30 +143,6 @@ func NewDraftFromConfig(session string) *Draft {
 	return &Draft{Meta: DraftMeta{Schema: DraftSchema, Updated: time.Now().UTC(), Session: session}, Config: cfg}
 }
 
-// BackupFinalConfig creates/overwrites the single rolling backup of the final config file.
-func BackupFinalConfig() (string, error) {
-	_, finalPath, dir := draftPaths()
-	if !coreFile.FileExists(finalPath) {
-		return "", os.ErrNotExist
-	}
-	backupPath := filepath.Join(dir, backupFileName)
-	data := coreFile.AsciiFileToString(finalPath)
-	tmp := backupPath + ".tmp"
-	if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
-		return "", err
-	}
-	if err := fsyncFile(tmp); err != nil {
-		_ = os.Remove(tmp)
-		return "", err
-	}
-	if err := os.Rename(tmp, backupPath); err != nil {
-		_ = os.Remove(tmp)
-		return "", err
-	}
-	_ = fsyncDir(dir)
-	return backupPath, nil
-}
-
 // archiveCorrupt renames a corrupt draft to a timestamped file for diagnostics.
 func archiveCorrupt(path string, contents []byte) {
 	ts := time.Now().Unix()
@@ -203,6 +175,16 @@ func fsyncDir(dir string) error {
 	return df.Sync()
 }
 
+// MarkStep records step as the first unfinished step of the saved draft.
+func MarkStep(step string) error {
+	d, err := LoadDraft()
+	if err != nil {
+		return err
+	}
+	d.Meta.Step = step
+	return SaveDraftAtomic(d)
+}
+
 // RemoveDraft deletes the draft file (used after successful apply).
 func RemoveDraft() error {
 	draftPath, _, _ := draftPaths()
@@ -217,6 +199,28 @@ func SaveDraft(d *Draft) error {
 	return SaveDraftAtomic(d)
 }
 
+// withWebSocketRPC returns rpcs with its first ws:// or wss:// RPC replaced by
+// wsURL, or wsURL appended if it has none. An empty wsURL removes it; a URL
+// that is not a WebSocket leaves rpcs alone.
+func withWebSocketRPC(rpcs []string, wsURL string) []string {
+	if wsURL != "" && !wsrpc.IsWebSocket(wsURL) {
+		return rpcs
+	}
+	for i, rpc := range rpcs {
+		if wsrpc.IsWebSocket(rpc) {
+			if wsURL == "" {
+				return append(rpcs[:i:i], rpcs[i+1:]...)
+			}
+			rpcs[i] = wsURL
+			return rpcs
+		}
+	}
+	if wsURL == "" {
+		return rpcs
+	}
+	return append(rpcs, wsURL)
+}
+
 // ApplyFormToDraft updates a draft config with form values
 func ApplyFormToDraft(d *Draft, form map[string][]string) {
 	if d == nil {
@@ -254,13 +258,14 @@ func ApplyFormToDraft(d *Draft, form map[string][]string) {
 			detail = d.Config.General.Detail
 		}
 		// This updates both the config and the estimates
-		UpdateIndexStrategy(d, strategy, detail)
+		UpdateIndexStrategy(d, strategy, detail, CachedChainInputs(d.Config))
 	}
 
 	// Update Chains - handle enable/disable checkboxes and RPC URLs
 	for name, chain := range d.Config.Chains {
 		enableKey := name + "_enabled"
 		rpcKey := "chain_rpc_" + name
+		wsKey := "chain_ws_" + name
 
 		// Update enabled state if checkbox is present in form
 		if hasKey(enableKey) {
@@ -283,6 +288,11 @@ func ApplyFormToDraft(d *Draft, form map[string][]string) {
 			}
 		}
 
+		// Update the WebSocket RPC if the field is present; clearing it removes it
+		if hasKey(wsKey) {
+			chain.RPCs = withWebSocketRPC(chain.RPCs, getValue(wsKey))
+		}
+
 		d.Config.Chains[name] = chain
 	}
 
@@ -3,6 +3,8 @@ package install
 import (
 	"os"
 	"testing"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 )
 
 func TestLoadDraft_CorruptDetection(t *testing.T) {
@@ -37,3 +39,28 @@ func TestSaveDraftAtomicAndLoadDraft_RoundTrip(t *testing.T) {
 	}
 	_ = RemoveDraft()
 }
+
+func TestApplyFormToDraft_WebSocketRPC(t *testing.T) {
+	d := &Draft{}
+	d.Config.Chains = map[string]types.Chain{
+		"mainnet": {Name: "mainnet", ChainID: 1, Enabled: true, RPCs: []string{"http://localhost:8545"}},
+	}
+	rpcs := func() []string { return d.Config.Chains["mainnet"].RPCs }
+
+	ApplyFormToDraft(d, map[string][]string{"chain_ws_mainnet": {"ws://localhost:8546"}})
+	if got := rpcs(); len(got) != 2 || got[1] != "ws://localhost:8546" {
+		t.Fatalf("expected the WebSocket RPC to be added, got %v", got)
+	}
+	ApplyFormToDraft(d, map[string][]string{"chain_ws_mainnet": {"wss://node.example/ws"}})
+	if got := rpcs(); len(got) != 2 || got[1] != "wss://node.example/ws" {
+		t.Fatalf("expected the WebSocket RPC to be replaced, got %v", got)
+	}
+	ApplyFormToDraft(d, map[string][]string{"chain_ws_mainnet": {"https://not.a.socket"}})
+	if got := rpcs(); len(got) != 2 || got[1] != "wss://node.example/ws" {
+		t.Fatalf("expected an HTTP URL to be ignored, got %v", got)
+	}
+	ApplyFormToDraft(d, map[string][]string{"chain_ws_mainnet": {""}})
+	if got := rpcs(); len(got) != 1 || got[0] != "http://localhost:8545" {
+		t.Fatalf("expected the WebSocket RPC to be removed, got %v", got)
+	}
+}
@@ -1,29 +1,317 @@
 package install
 
-// EstimateIndex returns rough (order-of-magnitude) estimates for disk (GB) and initial hours
-// for a given acquisition strategy and detail level. These are intentionally conservative
-// and should be refined with telemetry later.
-func EstimateIndex(strategy, detail string) (diskGB int, hours int) {
-	// New semantics:
-	// detail = index  -> full index + blooms (heavy)
-	// detail = bloom     -> blooms only (light)
-	// Sizes provided by user: index=168GB, bloom-only=6GB.
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/jsonrpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// Range is an estimate with its confidence range.
+type Range struct {
+	Low      float64 `json:"low"`
+	Expected float64 `json:"expected"`
+	High     float64 `json:"high"`
+}
+
+func spread(v, low, high float64) Range {
+	return Range{Low: v * low, Expected: v, High: v * high}
+}
+
+func (r Range) add(o Range) Range {
+	return Range{Low: r.Low + o.Low, Expected: r.Expected + o.Expected, High: r.High + o.High}
+}
+
+// String renders the range as "expected (low-high)" with whole numbers.
+func (r Range) String() string {
+	return fmt.Sprintf("%s (%s-%s)", roundUp(r.Expected), roundUp(r.Low), roundUp(r.High))
+}
+
+func roundUp(v float64) string {
+	return fmt.Sprintf("%d", int(math.Ceil(v)))
+}
+
+// ChainEstimate is the disk and time needed to get one chain's index.
+type ChainEstimate struct {
+	Chain       string   `json:"chain"`
+	ChainID     int      `json:"chainId"`
+	HeadBlock   uint64   `json:"headBlock"`
+	HeadKnown   bool     `json:"headKnown"`             // HeadBlock came from the chain's RPC
+	CallsPerSec float64  `json:"callsPerSec,omitempty"` // measured RPC throughput
+	Strategy    string   `json:"strategy"`              // how this chain's index is obtained
+	DiskGB      Range    `json:"diskGb"`
+	Hours       Range    `json:"hours"`
+	Notes       []string `json:"notes,omitempty"`
+}
+
+// IndexEstimate is the per-chain and total disk and time needed to get the
+// index of every enabled chain.
+type IndexEstimate struct {
+	Strategy string          `json:"strategy"`
+	Detail   string          `json:"detail"`
+	Chains   []ChainEstimate `json:"chains"`
+	DiskGB   Range           `json:"diskGb"`
+	Hours    Range           `json:"hours"`
+}
+
+// ChainInput is what the estimator knows about one enabled chain. A zero
+// HeadBlock or CallsPerSec means it was not measured.
+type ChainInput struct {
+	Name        string
+	ChainID     int
+	HeadBlock   uint64
+	CallsPerSec float64
+}
+
+// indexFactors describe how a chain's index grows. They are averages over the
+// published index chunks and blooms of each chain.
+type indexFactors struct {
+	IndexBytes  float64 // bytes of index chunks and blooms per block
+	BloomBytes  float64 // bytes of bloom filters per block
+	Appearances float64 // address appearances per block
+	Published   bool    // the Unchained Index is published for the chain, so it can be downloaded
+	RefBlock    uint64  // a known block and its time, to guess the head when the RPC is unreachable
+	RefTime     time.Time
+}
+
+var chainFactors = map[string]indexFactors{
+	"mainnet":  {IndexBytes: 7150, BloomBytes: 255, Appearances: 480, Published: true, RefBlock: 23_500_000, RefTime: time.Date(2025, 10, 3, 0, 0, 0, 0, time.UTC)},
+	"sepolia":  {IndexBytes: 2400, BloomBytes: 110, Appearances: 160, Published: true, RefBlock: 9_300_000, RefTime: time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)},
+	"gnosis":   {IndexBytes: 850, BloomBytes: 55, Appearances: 55, Published: true, RefBlock: 42_300_000, RefTime: time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)},
+	"optimism": {IndexBytes: 650, BloomBytes: 40, Appearances: 42, Published: true, RefBlock: 142_000_000, RefTime: time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+// Model constants. A scraper makes about three RPC calls per block (block,
+// receipts and traces) and spends a little time on each appearance it writes.
+const (
+	callsPerBlock      = 3
+	perAppearance      = 2 * time.Microsecond
+	defaultCallsPerSec = 25 // a remote RPC when nothing was measured
+	downloadMBps       = 10 // expected download rate from IPFS gateways
+	downloadMBpsLow    = 2
+	downloadMBpsHigh   = 40
+)
+
+// factorsFor returns the factors of a chain. Chains without their own factors
+// use mainnet's, scaled by block time since faster chains carry less per
+// block.
+func factorsFor(name string) indexFactors {
+	if f, ok := chainFactors[name]; ok {
+		return f
+	}
+	f := chainFactors["mainnet"]
+	scale := 1.0
+	if info, ok := chains.ByName(name); ok && info.BlockTime > 0 {
+		scale = math.Min(1, math.Max(0.02, info.BlockTime.Seconds()/12))
+	}
+	return indexFactors{IndexBytes: f.IndexBytes * scale, BloomBytes: f.BloomBytes * scale, Appearances: f.Appearances * scale}
+}
+
+// guessHead extrapolates the head block from the reference block and the
+// chain's block time, or returns zero if it cannot.
+func guessHead(name string, f indexFactors, now time.Time) uint64 {
+	info, ok := chains.ByName(name)
+	if f.RefBlock == 0 || !ok || info.BlockTime <= 0 || now.Before(f.RefTime) {
+		return f.RefBlock
+	}
+	return f.RefBlock + uint64(now.Sub(f.RefTime)/info.BlockTime)
+}
+
+// EstimateIndex estimates the disk and time needed to get the index of each
+// chain in inputs with the given strategy and detail. Ranges are wider where
+// the head block or RPC throughput had to be guessed.
+func EstimateIndex(strategy, detail string, inputs []ChainInput) IndexEstimate {
 	if detail == "blooms" { // backward compatibility normalization
 		detail = "bloom"
 	}
-	full := detail == "index"
-	switch strategy {
-	case "download":
-		if full {
-			return 168, 3 // heavy download incl verify (rough)
+	est := IndexEstimate{Strategy: strategy, Detail: detail}
+	for _, in := range inputs {
+		f := factorsFor(in.Name)
+		ce := ChainEstimate{Chain: in.Name, ChainID: in.ChainID, HeadBlock: in.HeadBlock, HeadKnown: in.HeadBlock > 0, CallsPerSec: in.CallsPerSec, Strategy: strategy}
+		if !ce.HeadKnown {
+			ce.HeadBlock = guessHead(in.Name, f, time.Now())
+			if ce.HeadBlock == 0 {
+				ce.Notes = append(ce.Notes, "head block unknown; check the chain's RPC")
+				est.Chains = append(est.Chains, ce)
+				continue
+			}
+			ce.Notes = append(ce.Notes, "RPC unreachable; head block estimated")
 		}
-		return 6, 1 // light download
-	case "scratch":
-		if full {
-			return 168, 100 // building full index locally (very rough placeholder)
+		if strategy == "download" && !f.Published {
+			ce.Strategy = "scratch"
+			ce.Notes = append(ce.Notes, "no published index; built from the RPC")
 		}
-		return 6, 12 // building blooms only takes time but far less disk
-	default:
-		return 0, 0
+
+		blocks := float64(ce.HeadBlock)
+		perBlock := f.IndexBytes
+		if detail == "bloom" && ce.Strategy == "download" {
+			perBlock = f.BloomBytes
+		}
+		gb := blocks * perBlock / 1e9
+		if ce.HeadKnown {
+			ce.DiskGB = spread(gb, 0.9, 1.25)
+		} else {
+			ce.DiskGB = spread(gb, 0.6, 1.6)
+		}
+
+		switch ce.Strategy {
+		case "download":
+			mb := gb * 1000
+			ce.Hours = Range{Low: mb / downloadMBpsHigh / 3600, Expected: mb / downloadMBps / 3600, High: mb / downloadMBpsLow / 3600}
+		default:
+			cps, low, high := in.CallsPerSec, 0.7, 1.5
+			if cps <= 0 {
+				cps, low, high = defaultCallsPerSec, 0.25, 4
+				ce.Notes = append(ce.Notes, "RPC throughput not measured")
+			}
+			secs := blocks*callsPerBlock/cps + blocks*f.Appearances*perAppearance.Seconds()
+			ce.Hours = spread(secs/3600, low, high)
+		}
+		est.DiskGB = est.DiskGB.add(ce.DiskGB)
+		est.Hours = est.Hours.add(ce.Hours)
+		est.Chains = append(est.Chains, ce)
+	}
+	return est
+}
+
+// Benchmark settings. Each RPC is benchmarked for benchDuration with
+// benchWorkers concurrent callers, about what the scraper uses.
+const (
+	benchDuration = 2 * time.Second
+	benchWorkers  = 4
+	benchTTL      = 10 * time.Minute
+)
+
+type measurement struct {
+	head        uint64
+	callsPerSec float64
+	at          time.Time
+}
+
+var (
+	measureCache   = map[string]measurement{}
+	measureCacheMu sync.Mutex
+)
+
+// BenchmarkRpc measures how many eth_getBlockByNumber calls (with full
+// transactions) rpcUrl answers per second, spread over blocks up to head.
+func BenchmarkRpc(ctx context.Context, rpcUrl string, head uint64) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, benchDuration)
+	defer cancel()
+
+	var done atomic.Int64
+	var firstErr atomic.Value
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range benchWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				block := fmt.Sprintf("0x%x", rand.Int63n(int64(head)+1))
+				if err := jsonrpc.Call(ctx, rpcUrl, "eth_getBlockByNumber", []any{block, true}, nil); err != nil {
+					if ctx.Err() == nil {
+						firstErr.CompareAndSwap(nil, err)
+						return
+					}
+					continue
+				}
+				done.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if done.Load() == 0 {
+		if err, ok := firstErr.Load().(error); ok {
+			return 0, err
+		}
+		return 0, fmt.Errorf("no calls completed in %s", benchDuration)
+	}
+	return float64(done.Load()) / time.Since(start).Seconds(), nil
+}
+
+// MeasureChains fetches the head block of each enabled chain and benchmarks
+// its first RPC, in parallel. Results are cached for a few minutes and also
+// feed CachedChainInputs.
+func MeasureChains(ctx context.Context, cfg types.Config) []ChainInput {
+	inputs := CachedChainInputs(cfg)
+	var wg sync.WaitGroup
+	for i := range inputs {
+		rpcUrl := firstChainRpc(cfg.Chains[inputs[i].Name])
+		if rpcUrl == "" || inputs[i].CallsPerSec > 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := measurement{at: time.Now()}
+			head, err := jsonrpc.Uint64(ctx, rpcUrl, "eth_blockNumber")
+			if err != nil {
+				rpcLog().Debug("estimate: head block failed", "chain", inputs[i].Name, "error", err)
+				return
+			}
+			m.head = head
+			if m.callsPerSec, err = BenchmarkRpc(ctx, rpcUrl, head); err != nil {
+				rpcLog().Debug("estimate: benchmark failed", "chain", inputs[i].Name, "error", err)
+			}
+			measureCacheMu.Lock()
+			measureCache[rpcUrl] = m
+			measureCacheMu.Unlock()
+			rpcLog().Info("rpc benchmark", "chain", inputs[i].Name, "head", m.head, "callsPerSec", math.Round(m.callsPerSec))
+			inputs[i].HeadBlock, inputs[i].CallsPerSec = m.head, m.callsPerSec
+		}()
+	}
+	wg.Wait()
+	return inputs
+}
+
+// CachedChainInputs lists the enabled chains, mainnet first then by chain ID,
+// with whatever MeasureChains or a capability probe measured recently. It
+// never touches the network.
+func CachedChainInputs(cfg types.Config) []ChainInput {
+	var inputs []ChainInput
+	for name, ch := range cfg.Chains {
+		if !ch.Enabled {
+			continue
+		}
+		in := ChainInput{Name: name, ChainID: ch.ChainID}
+		if rpcUrl := firstChainRpc(ch); rpcUrl != "" {
+			measureCacheMu.Lock()
+			if m, ok := measureCache[rpcUrl]; ok && time.Since(m.at) < benchTTL {
+				in.HeadBlock, in.CallsPerSec = m.head, m.callsPerSec
+			}
+			measureCacheMu.Unlock()
+			if in.HeadBlock == 0 {
+				capabilityCacheMu.Lock()
+				if c, ok := capabilityCache[rpcUrl]; ok && time.Since(time.Unix(c.CheckedAt, 0)) < benchTTL {
+					in.HeadBlock = c.HeadBlock
+				}
+				capabilityCacheMu.Unlock()
+			}
+		}
+		inputs = append(inputs, in)
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		if (inputs[i].Name == "mainnet") != (inputs[j].Name == "mainnet") {
+			return inputs[i].Name == "mainnet"
+		}
+		return inputs[i].ChainID < inputs[j].ChainID
+	})
+	return inputs
+}
+
+func firstChainRpc(ch types.Chain) string {
+	if len(ch.RPCs) == 0 {
+		return ""
 	}
+	return ch.RPCs[0]
 }
@@ -0,0 +1,86 @@
+package install
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func TestEstimateIndex(t *testing.T) {
+	inputs := []ChainInput{
+		{Name: "mainnet", ChainID: 1, HeadBlock: 20_000_000, CallsPerSec: 300},
+		{Name: "base", ChainID: 8453, HeadBlock: 30_000_000},
+		{Name: "sepolia", ChainID: 11155111},
+		{Name: "nowhere", ChainID: 987654321},
+	}
+	est := EstimateIndex("download", "bloom", inputs)
+	if len(est.Chains) != 4 {
+		t.Fatalf("expected 4 chains, got %d", len(est.Chains))
+	}
+	mainnet, base, sepolia, nowhere := est.Chains[0], est.Chains[1], est.Chains[2], est.Chains[3]
+
+	if mainnet.Strategy != "download" || len(mainnet.Notes) != 0 {
+		t.Fatalf("unexpected mainnet estimate %+v", mainnet)
+	}
+	if r := mainnet.DiskGB; !(r.Low < r.Expected && r.Expected < r.High) || r.Expected < 4 || r.Expected > 6 {
+		t.Fatalf("unexpected mainnet bloom disk %+v", r)
+	}
+
+	// Base has no published index, so it is scraped even for download
+	if base.Strategy != "scratch" || !strings.Contains(strings.Join(base.Notes, " "), "RPC throughput not measured") {
+		t.Fatalf("unexpected base estimate %+v", base)
+	}
+	if base.Hours.High/base.Hours.Expected < 3 {
+		t.Fatalf("expected a wide range without a benchmark, got %+v", base.Hours)
+	}
+
+	// Sepolia's head is extrapolated from its reference block
+	if sepolia.HeadKnown || sepolia.HeadBlock <= chainFactors["sepolia"].RefBlock {
+		t.Fatalf("expected an extrapolated head, got %+v", sepolia)
+	}
+
+	// A chain with no head at all contributes nothing
+	if nowhere.HeadBlock != 0 || nowhere.DiskGB.Expected != 0 || len(nowhere.Notes) != 1 {
+		t.Fatalf("unexpected estimate for an unknown chain %+v", nowhere)
+	}
+
+	want := mainnet.DiskGB.Expected + base.DiskGB.Expected + sepolia.DiskGB.Expected
+	if est.DiskGB.Expected != want {
+		t.Fatalf("expected total disk %f, got %f", want, est.DiskGB.Expected)
+	}
+
+	if full := EstimateIndex("download", "index", inputs[:1]); full.DiskGB.Expected <= est.Chains[0].DiskGB.Expected*10 {
+		t.Fatalf("expected the full index to be much larger than the blooms, got %+v", full.DiskGB)
+	}
+}
+
+func TestMeasureChains(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1000"}`))
+	}))
+	defer srv.Close()
+
+	cfg := types.Config{Chains: map[string]types.Chain{
+		"gnosis":  {Name: "gnosis", ChainID: 100, RPCs: []string{"http://127.0.0.1:1"}, Enabled: true},
+		"mainnet": {Name: "mainnet", ChainID: 1, RPCs: []string{srv.URL}, Enabled: true},
+		"sepolia": {Name: "sepolia", ChainID: 11155111, RPCs: []string{srv.URL + "/off"}},
+	}}
+	inputs := MeasureChains(context.Background(), cfg)
+	if len(inputs) != 2 || inputs[0].Name != "mainnet" || inputs[1].Name != "gnosis" {
+		t.Fatalf("expected mainnet then gnosis, got %+v", inputs)
+	}
+	if inputs[0].HeadBlock != 0x1000 || inputs[0].CallsPerSec <= 0 {
+		t.Fatalf("expected mainnet to be measured, got %+v", inputs[0])
+	}
+	if inputs[1].HeadBlock != 0 || inputs[1].CallsPerSec != 0 {
+		t.Fatalf("expected gnosis to be unmeasured, got %+v", inputs[1])
+	}
+
+	if cached := CachedChainInputs(cfg); cached[0] != inputs[0] {
+		t.Fatalf("expected the measurement to be cached, got %+v", cached[0])
+	}
+}
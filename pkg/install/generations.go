@@ -0,0 +1,240 @@
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/pmezard/go-difflib/difflib"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+const (
+	generationsDir   = "generations"
+	generationsIndex = "index.json"
+
+	// KeepGenerations is how many generations of config.yaml are kept. The
+	// oldest is removed when a new one would exceed it.
+	KeepGenerations = 20
+)
+
+// Sources of a config change, recorded with each generation.
+const (
+	SourceWizard = "wizard" // the browser install wizard
+	SourceCLI    = "cli"    // khedra init, config edit or config rollback
+	SourceAPI    = "api"    // the control API (e.g. a rollback from the dashboard)
+	SourceManual = "manual" // an edit found on disk that no khedra command recorded
+)
+
+// ErrNoGeneration is returned for a generation that does not exist (or was pruned).
+var ErrNoGeneration = errors.New("no such config generation")
+
+// ErrInvalidGeneration is returned for a generation that would not load.
+var ErrInvalidGeneration = errors.New("invalid config generation")
+
+// Generation is one saved version of config.yaml.
+type Generation struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Hash   string    `json:"hash"` // sha256 of the file, hex encoded
+	Size   int       `json:"size"`
+	Source string    `json:"source"`
+	Note   string    `json:"note,omitempty"`
+}
+
+var genMu sync.Mutex
+
+// generationsPath returns the folder holding the generations, beside config.yaml.
+func generationsPath() string {
+	_, _, dir := draftPaths()
+	return filepath.Join(dir, generationsDir)
+}
+
+func generationFile(id int) string {
+	return filepath.Join(generationsPath(), fmt.Sprintf("config.%d.yaml", id))
+}
+
+// loadGenerations reads the index, oldest first. A missing index is empty.
+func loadGenerations() ([]Generation, error) {
+	raw, err := os.ReadFile(filepath.Join(generationsPath(), generationsIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var gens []Generation
+	if err := json.Unmarshal(raw, &gens); err != nil {
+		return nil, fmt.Errorf("corrupt config history %s: %w", generationsIndex, err)
+	}
+	return gens, nil
+}
+
+func saveGenerations(gens []Generation) error {
+	raw, err := json.MarshalIndent(gens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(generationsPath(), generationsIndex), raw)
+}
+
+// Generations lists the kept generations of config.yaml, newest first.
+func Generations() ([]Generation, error) {
+	genMu.Lock()
+	defer genMu.Unlock()
+	gens, err := loadGenerations()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Generation, 0, len(gens))
+	for i := len(gens) - 1; i >= 0; i-- {
+		out = append(out, gens[i])
+	}
+	return out, nil
+}
+
+// RecordGeneration saves the current config.yaml as a new generation, unless
+// it is the same as the newest one. It reports whether one was added.
+func RecordGeneration(source, note string) (Generation, bool, error) {
+	data, err := os.ReadFile(types.GetConfigFnNoCreate())
+	if err != nil {
+		return Generation{}, false, err
+	}
+	genMu.Lock()
+	defer genMu.Unlock()
+	return recordGeneration(data, source, note)
+}
+
+func recordGeneration(data []byte, source, note string) (Generation, bool, error) {
+	gens, err := loadGenerations()
+	if err != nil {
+		return Generation{}, false, err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if n := len(gens); n > 0 && gens[n-1].Hash == hash {
+		return gens[n-1], false, nil
+	}
+
+	g := Generation{ID: 1, Time: time.Now().UTC(), Hash: hash, Size: len(data), Source: source, Note: note}
+	if n := len(gens); n > 0 {
+		g.ID = gens[n-1].ID + 1
+	}
+	if err := os.MkdirAll(generationsPath(), 0o700); err != nil {
+		return Generation{}, false, err
+	}
+	if err := writeFileAtomic(generationFile(g.ID), data); err != nil {
+		return Generation{}, false, err
+	}
+	gens = append(gens, g)
+	var pruned []Generation
+	if len(gens) > KeepGenerations {
+		pruned, gens = gens[:len(gens)-KeepGenerations], gens[len(gens)-KeepGenerations:]
+	}
+	if err := saveGenerations(gens); err != nil {
+		return Generation{}, false, err
+	}
+	for _, old := range pruned {
+		_ = os.Remove(generationFile(old.ID))
+	}
+	return g, true, nil
+}
+
+// GenerationData returns the contents of generation id.
+func GenerationData(id int) ([]byte, error) {
+	genMu.Lock()
+	defer genMu.Unlock()
+	return generationData(id)
+}
+
+func generationData(id int) ([]byte, error) {
+	gens, err := loadGenerations()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range gens {
+		if g.ID == id {
+			return os.ReadFile(generationFile(id))
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrNoGeneration, id)
+}
+
+// DiffGeneration returns a unified diff from generation id to the current
+// config.yaml, or "" if they are the same.
+func DiffGeneration(id int) (string, error) {
+	from, err := GenerationData(id)
+	if err != nil {
+		return "", err
+	}
+	to, err := os.ReadFile(types.GetConfigFnNoCreate())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(from)),
+		B:        difflib.SplitLines(string(to)),
+		FromFile: fmt.Sprintf("generation %d", id),
+		ToFile:   "config.yaml",
+		Context:  3,
+	})
+}
+
+// Rollback makes generation id the current config.yaml. The generation must
+// pass check (if not nil) first, so a config that would not load is never
+// restored. Any unrecorded edit to the current file is kept as a manual
+// generation first, and the restored file becomes the newest generation.
+func Rollback(id int, source string, check func([]byte) error) (Generation, error) {
+	genMu.Lock()
+	defer genMu.Unlock()
+
+	data, err := generationData(id)
+	if err != nil {
+		return Generation{}, err
+	}
+	var cfg types.Config
+	if err := yamlv2.Unmarshal(data, &cfg); err != nil {
+		return Generation{}, fmt.Errorf("%w %d: %w", ErrInvalidGeneration, id, err)
+	}
+	if check != nil {
+		if err := check(data); err != nil {
+			return Generation{}, fmt.Errorf("%w %d: %w", ErrInvalidGeneration, id, err)
+		}
+	}
+
+	finalPath := types.GetConfigFnNoCreate()
+	if current, err := os.ReadFile(finalPath); err == nil {
+		if _, _, err := recordGeneration(current, SourceManual, ""); err != nil {
+			return Generation{}, err
+		}
+	}
+	if err := writeFileAtomic(finalPath, data); err != nil {
+		return Generation{}, err
+	}
+	g, _, err := recordGeneration(data, source, fmt.Sprintf("rollback to generation %d", id))
+	return g, err
+}
+
+// writeFileAtomic replaces path with data through a synced temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := fsyncFile(tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	_ = fsyncDir(filepath.Dir(path))
+	return nil
+}
@@ -0,0 +1,97 @@
+package install
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func TestGenerations(t *testing.T) {
+	tmp := t.TempDir()
+	fn := filepath.Join(tmp, "config.yaml")
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", fn)
+
+	if gens, err := Generations(); err != nil || len(gens) != 0 {
+		t.Fatalf("expected no history before the first write, got %v (%v)", gens, err)
+	}
+
+	cfg := types.NewConfig()
+	cfg.General.DataFolder = filepath.Join(tmp, "one")
+	if err := cfg.WriteToFile(fn); err != nil {
+		t.Fatal(err)
+	}
+	first, added, err := RecordGeneration(SourceWizard, "")
+	if err != nil || !added || first.ID != 1 || first.Source != SourceWizard || len(first.Hash) != 64 {
+		t.Fatalf("unexpected first generation %+v added=%v (%v)", first, added, err)
+	}
+	if _, added, _ := RecordGeneration(SourceCLI, ""); added {
+		t.Fatal("an unchanged file should not add a generation")
+	}
+
+	cfg.General.DataFolder = filepath.Join(tmp, "two")
+	if err := cfg.WriteToFile(fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RecordGeneration(SourceCLI, "config edit"); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := DiffGeneration(1)
+	if err != nil || !strings.Contains(diff, "-  dataFolder: \""+filepath.Join(tmp, "one")) || !strings.Contains(diff, "+  dataFolder: \""+filepath.Join(tmp, "two")) {
+		t.Fatalf("unexpected diff (%v):\n%s", err, diff)
+	}
+	if diff, _ := DiffGeneration(2); diff != "" {
+		t.Fatalf("expected no diff against the current generation, got:\n%s", diff)
+	}
+
+	// A hand edit is kept before rolling back over it
+	if err := os.WriteFile(fn, []byte("# edited by hand\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Rollback(1, SourceAPI, nil)
+	if err != nil || g.ID != 4 || g.Source != SourceAPI || g.Hash != first.Hash {
+		t.Fatalf("unexpected rollback generation %+v (%v)", g, err)
+	}
+	data, _ := os.ReadFile(fn)
+	if want, _ := GenerationData(1); string(data) != string(want) {
+		t.Fatal("rollback did not restore generation 1")
+	}
+
+	gens, err := Generations()
+	if err != nil || len(gens) != 4 {
+		t.Fatalf("expected four generations, got %v (%v)", gens, err)
+	}
+	sources := []string{gens[0].Source, gens[1].Source, gens[2].Source, gens[3].Source}
+	if strings.Join(sources, ",") != "api,manual,cli,wizard" {
+		t.Fatalf("expected newest first, got %v", sources)
+	}
+
+	if _, err := Rollback(99, SourceCLI, nil); !errors.Is(err, ErrNoGeneration) {
+		t.Fatalf("expected ErrNoGeneration, got %v", err)
+	}
+}
+
+func TestGenerations_Pruned(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", fn)
+
+	for i := 0; i < KeepGenerations+3; i++ {
+		if err := os.WriteFile(fn, []byte(strings.Repeat("#\n", i+1)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := RecordGeneration(SourceCLI, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gens, _ := Generations()
+	if len(gens) != KeepGenerations || gens[len(gens)-1].ID != 4 {
+		t.Fatalf("expected the newest %d generations, oldest 4; got %d, oldest %d", KeepGenerations, len(gens), gens[len(gens)-1].ID)
+	}
+	if _, err := os.Stat(generationFile(3)); !os.IsNotExist(err) {
+		t.Fatalf("expected the pruned file to be removed, got %v", err)
+	}
+}
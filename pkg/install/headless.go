@@ -0,0 +1,133 @@
+package install
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// PhaseResult reports one wizard step of a headless install.
+type PhaseResult struct {
+	Phase  string       `json:"phase"`
+	OK     bool         `json:"ok"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Report is the outcome of a headless install, with one result per step in
+// StepOrder. Config holds the path of the written config file on success.
+type Report struct {
+	OK     bool          `json:"ok"`
+	Phases []PhaseResult `json:"phases"`
+	Config string        `json:"config,omitempty"`
+}
+
+// Prober checks that an RPC answers. ProbeRpc is the one the wizard uses.
+type Prober func(rpcUrl string) rpc.PingResult
+
+// ProbeRpc asks rpcUrl for its chain ID.
+func ProbeRpc(rpcUrl string) rpc.PingResult {
+	return jsonProbe(context.Background(), rpcUrl, "")
+}
+
+// Headless runs the install wizard without a browser. It validates d for every
+// step in StepOrder, probes the first RPC of each enabled chain and, if nothing
+// failed, saves d as the draft and applies it. A chain with no chain ID takes
+// the one its RPC reports.
+func Headless(d *Draft, probe Prober) Report {
+	d.Config.General.DataFolder = utils.ResolvePath(strings.TrimSpace(d.Config.General.DataFolder))
+	if folder := strings.TrimSpace(d.Config.Logging.Folder); folder != "" {
+		d.Config.Logging.Folder = utils.ResolvePath(folder)
+	}
+
+	report := Report{OK: true}
+	for _, step := range StepOrder {
+		var errs []FieldError
+		switch step {
+		case "welcome":
+		case "summary":
+			if !report.OK {
+				errs = []FieldError{{Code: "skipped", Message: "not applied because an earlier step failed"}}
+				break
+			}
+			errs = ValidateDraftPhase(d, "final")
+			if len(errs) == 0 {
+				if err := applyHeadless(d); err != nil {
+					errs = []FieldError{{Code: "apply_failed", Message: err.Error()}}
+				} else {
+					report.Config = types.GetConfigFnNoCreate()
+				}
+			}
+		default:
+			errs = ValidateDraftPhase(d, "step:"+step)
+			if step == "chains" && len(errs) == 0 {
+				errs = ProbeChains(d, probe)
+			}
+		}
+		report.Phases = append(report.Phases, PhaseResult{Phase: step, OK: len(errs) == 0, Errors: errs})
+		report.OK = report.OK && len(errs) == 0
+	}
+	return report
+}
+
+// ProbeChains checks the first RPC of each enabled chain (and mainnet, whose
+// RPC is always required) and fills in missing chain IDs.
+func ProbeChains(d *Draft, probe Prober) []FieldError {
+	var out []FieldError
+	for _, name := range sortedChainNames(d) {
+		ch := d.Config.Chains[name]
+		if !ch.Enabled && name != "mainnet" {
+			continue
+		}
+		field := fmt.Sprintf("chains.%s.rpc", name)
+		url := firstRPC(ch.RPCs)
+		pr := probe(url)
+		if !pr.OK {
+			msg := pr.Error
+			if msg == "" {
+				msg = "no response"
+			}
+			out = append(out, FieldError{Field: field, Code: "rpc_unreachable", Message: fmt.Sprintf("chain %s RPC did not answer: %s", name, msg)})
+			continue
+		}
+		got, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(pr.ChainID), "0x"), 16, 64)
+		if err != nil {
+			out = append(out, FieldError{Field: field, Code: "rpc_bad_chain_id", Message: fmt.Sprintf("chain %s RPC returned chain ID %q", name, pr.ChainID)})
+			continue
+		}
+		if ch.ChainID == 0 {
+			ch.ChainID = int(got)
+			d.Config.Chains[name] = ch
+		} else if uint64(ch.ChainID) != got {
+			out = append(out, FieldError{Field: field, Code: "chain_id_mismatch", Message: fmt.Sprintf("chain %s expects chain ID %d but its RPC reports %d", name, ch.ChainID, got)})
+		}
+	}
+	return out
+}
+
+func sortedChainNames(d *Draft) []string {
+	names := make([]string, 0, len(d.Config.Chains))
+	for name := range d.Config.Chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyHeadless stores d as the draft and applies it, as the wizard's summary
+// step does.
+func applyHeadless(d *Draft) error {
+	if err := SaveDraftAtomic(d); err != nil {
+		return err
+	}
+	if err := ApplyDraft(SourceCLI); err != nil {
+		_ = RemoveDraft()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func headlessDraft(t *testing.T) *Draft {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", filepath.Join(tmp, "config.yaml"))
+	cfg := types.NewConfig()
+	cfg.General.DataFolder = filepath.Join(tmp, "data")
+	cfg.Logging.Folder = filepath.Join(tmp, "logs")
+	cfg.Chains["gnosis"] = types.Chain{Name: "gnosis", RPCs: []string{"http://gnosis.example"}, Enabled: true}
+	return &Draft{Meta: DraftMeta{Schema: DraftSchema}, Config: cfg}
+}
+
+func chainIdProber(ids map[string]string) Prober {
+	return func(url string) rpc.PingResult {
+		if id, ok := ids[url]; ok {
+			return rpc.PingResult{URL: url, OK: true, ChainID: id}
+		}
+		return rpc.PingResult{URL: url, Error: "connection refused"}
+	}
+}
+
+func TestHeadless(t *testing.T) {
+	d := headlessDraft(t)
+	report := Headless(d, chainIdProber(map[string]string{"http://localhost:8545": "0x1", "http://gnosis.example": "0x64"}))
+	if !report.OK || len(report.Phases) != len(StepOrder) {
+		t.Fatalf("expected success for every step, got %+v", report)
+	}
+	if report.Config != types.GetConfigFnNoCreate() {
+		t.Fatalf("expected the config path, got %q", report.Config)
+	}
+	if _, err := os.Stat(report.Config); err != nil {
+		t.Fatalf("config not written: %v", err)
+	}
+	if _, err := os.Stat(DraftFilePath()); !os.IsNotExist(err) {
+		t.Fatalf("expected the draft to be removed, got %v", err)
+	}
+	if d.Config.Chains["gnosis"].ChainID != 100 {
+		t.Fatalf("expected gnosis to take the chain ID its RPC reports, got %d", d.Config.Chains["gnosis"].ChainID)
+	}
+}
+
+func TestHeadless_Failures(t *testing.T) {
+	d := headlessDraft(t)
+	d.Config.General.Strategy = "guess"
+	report := Headless(d, chainIdProber(map[string]string{"http://localhost:8545": "0x5"}))
+	if report.OK {
+		t.Fatal("expected failure")
+	}
+
+	codes := map[string][]string{}
+	for _, p := range report.Phases {
+		for _, fe := range p.Errors {
+			codes[p.Phase] = append(codes[p.Phase], fe.Code)
+		}
+	}
+	want := map[string][]string{
+		"chains":  {"rpc_unreachable", "chain_id_mismatch"},
+		"index":   {"invalid_strategy"},
+		"summary": {"skipped"},
+	}
+	for phase, w := range want {
+		got := codes[phase]
+		if len(got) != len(w) {
+			t.Fatalf("phase %s: expected %v, got %v", phase, w, got)
+		}
+		for _, code := range w {
+			found := false
+			for _, c := range got {
+				found = found || c == code
+			}
+			if !found {
+				t.Fatalf("phase %s: expected %s in %v", phase, code, got)
+			}
+		}
+	}
+	if _, err := os.Stat(types.GetConfigFnNoCreate()); !os.IsNotExist(err) {
+		t.Fatalf("expected no config to be written, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package install
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+// IndexPlan is what the daemon will do to one chain's index at its next
+// start to match the configured strategy and detail.
+type IndexPlan struct {
+	Chain       string          `json:"chain"`
+	From        *index.Mode     `json:"from,omitempty"` // nil before the first start
+	To          index.Mode      `json:"to"`
+	InitMode    string          `json:"initMode"` // what the scraper initializes this chain with
+	Have        index.Inventory `json:"have"`
+	FetchGB     Range           `json:"fetchGb"`
+	Delete      []string        `json:"delete,omitempty"` // chunk files removed when the daemon is started with --prune-chunks
+	DeleteBytes int64           `json:"deleteBytes,omitempty"`
+	Steps       []string        `json:"steps"`
+}
+
+// Changed reports whether the plan differs from what the chain's index was
+// last set up with (always true before the first start).
+func (p IndexPlan) Changed() bool {
+	return p.From == nil || !p.From.Same(p.To)
+}
+
+// PlanIndex works out, for each enabled chain, what the daemon will fetch,
+// build or delete to take its index from the recorded mode to the one in cfg.
+// inputs size the downloads (see CachedChainInputs).
+func PlanIndex(cfg types.Config, inputs []ChainInput) []IndexPlan {
+	strategy, detail := orDefault(cfg.General.Strategy, "download"), orDefault(cfg.General.Detail, "index")
+	if detail == "blooms" {
+		detail = "bloom"
+	}
+	est := EstimateIndex(strategy, detail, inputs)
+	indexPath := cfg.IndexPath()
+
+	plans := make([]IndexPlan, 0, len(est.Chains))
+	for _, ce := range est.Chains {
+		chainStrat := chainStrategy(strategy, ce.Chain)
+		p := IndexPlan{
+			Chain:    ce.Chain,
+			To:       index.Mode{Strategy: strategy, Detail: detail},
+			InitMode: index.InitMode(chainStrat, detail),
+			Have:     index.Scan(indexPath, ce.Chain),
+		}
+		if m, ok := index.ReadMode(indexPath, ce.Chain); ok {
+			p.From = &m
+		}
+		haveGB := float64(p.Have.BloomBytes+p.Have.ChunkBytes) / 1e9
+		next := p.Have.LatestBlock + 1
+		if !p.Have.HasBlocks {
+			next = 0
+		}
+
+		switch {
+		case p.From != nil && !p.Changed():
+			p.Steps = append(p.Steps, fmt.Sprintf("no change (%s)", p.To))
+		case chainStrat == "scratch":
+			if strategy == "download" {
+				p.Steps = append(p.Steps, "no published index for "+ce.Chain+"; it is built from the RPC")
+			}
+			if p.Have.HasBlocks {
+				p.Steps = append(p.Steps, fmt.Sprintf("keep the %d chunks on disk and build the index from the RPC from block %d", p.Have.Chunks, next))
+			} else {
+				p.Steps = append(p.Steps, "build the index from the RPC from block 0")
+			}
+		default:
+			target := ce.DiskGB
+			p.FetchGB = Range{Low: math.Max(0, target.Low-haveGB), Expected: math.Max(0, target.Expected-haveGB), High: math.Max(0, target.High-haveGB)}
+			if detail == "bloom" {
+				p.Steps = append(p.Steps, fmt.Sprintf("download the missing blooms from the manifest (about %s GB); chunks are fetched later only when a query needs them", p.FetchGB))
+			} else if p.Have.Blooms > p.Have.Chunks {
+				p.Steps = append(p.Steps, fmt.Sprintf("download the chunks for the %d blooms that have none, and anything newer, from the manifest (about %s GB)", p.Have.Blooms-p.Have.Chunks, p.FetchGB))
+			} else {
+				p.Steps = append(p.Steps, fmt.Sprintf("download the missing blooms and chunks from the manifest (about %s GB)", p.FetchGB))
+			}
+			if p.From != nil && p.From.Detail == "index" && detail == "bloom" {
+				p.Delete = index.ChunksWithBlooms(indexPath, ce.Chain)
+				for _, fn := range p.Delete {
+					if fi, err := os.Stat(fn); err == nil {
+						p.DeleteBytes += fi.Size()
+					}
+				}
+				if len(p.Delete) > 0 {
+					p.Steps = append(p.Steps, fmt.Sprintf("delete %d chunks (%.1f GB) that have blooms when the daemon is started with --prune-chunks; they can be downloaded again", len(p.Delete), float64(p.DeleteBytes)/1e9))
+				}
+			}
+			p.Steps = append(p.Steps, "then keep the index up to date from the RPC")
+		}
+		plans = append(plans, p)
+	}
+	return plans
+}
+
+// InitModes returns the mode the scraper initializes each enabled chain's
+// index with. A chain with no published index is built from the RPC even
+// when the strategy is download.
+func InitModes(cfg types.Config, inputs []ChainInput) map[string]string {
+	strategy, detail := orDefault(cfg.General.Strategy, "download"), orDefault(cfg.General.Detail, "index")
+	if detail == "blooms" {
+		detail = "bloom"
+	}
+	modes := map[string]string{}
+	for _, in := range inputs {
+		modes[in.Name] = index.InitMode(chainStrategy(strategy, in.Name), detail)
+	}
+	return modes
+}
+
+// chainStrategy returns how chain's index is obtained under strategy: a
+// download falls back to scratch for chains with no published index.
+func chainStrategy(strategy, chain string) string {
+	if strategy == "download" && !factorsFor(chain).Published {
+		return "scratch"
+	}
+	return strategy
+}
+
+// IndexChanges returns the plans for chains whose existing index would change,
+// leaving out chains that are set up for the first time or not at all.
+func IndexChanges(cfg types.Config, inputs []ChainInput) []IndexPlan {
+	var out []IndexPlan
+	for _, p := range PlanIndex(cfg, inputs) {
+		if p.From != nil && p.Changed() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ApplyIndexPlan deletes the chunks the plan lists, calling removed with
+// each one, and records its mode, so the next plan starts from it.
+func ApplyIndexPlan(indexPath string, p IndexPlan, removed func(fn string)) error {
+	for _, fn := range p.Delete {
+		if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if removed != nil {
+			removed(fn)
+		}
+	}
+	to := p.To
+	to.Applied = time.Now().UTC()
+	return index.WriteMode(indexPath, p.Chain, to)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
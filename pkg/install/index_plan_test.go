@@ -0,0 +1,99 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/index"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+)
+
+func TestPlanIndex(t *testing.T) {
+	cfg := types.NewConfig()
+	cfg.General.DataFolder = t.TempDir()
+	cfg.General.Strategy, cfg.General.Detail = "download", "index"
+	indexPath := cfg.IndexPath()
+	inputs := []ChainInput{{Name: "mainnet", ChainID: 1, HeadBlock: 20_000_000}}
+
+	write := func(rel string) {
+		p := filepath.Join(indexPath, "mainnet", rel)
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		_ = os.WriteFile(p, make([]byte, 1000), 0o644)
+	}
+	write("blooms/000000000-000000099.bloom")
+	write("finalized/000000000-000000099.bin")
+
+	// First start: nothing recorded, download everything
+	plans := PlanIndex(cfg, inputs)
+	if len(plans) != 1 || plans[0].From != nil || !plans[0].Changed() || plans[0].InitMode != index.InitAll {
+		t.Fatalf("unexpected first plan %+v", plans)
+	}
+	if len(plans[0].Delete) != 0 || plans[0].FetchGB.Expected <= 0 {
+		t.Fatalf("expected a download and no deletes, got %+v", plans[0])
+	}
+	if len(IndexChanges(cfg, inputs)) != 0 {
+		t.Fatal("expected the first start not to be listed as a change")
+	}
+	if err := ApplyIndexPlan(indexPath, plans[0], nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same settings again: nothing to do
+	plans = PlanIndex(cfg, inputs)
+	if plans[0].Changed() || !strings.HasPrefix(plans[0].Steps[0], "no change") {
+		t.Fatalf("expected no change, got %+v", plans[0])
+	}
+
+	// Index to bloom: chunks with blooms are removed
+	cfg.General.Detail = "bloom"
+	changes := IndexChanges(cfg, inputs)
+	if len(changes) != 1 || changes[0].InitMode != index.InitBlooms || len(changes[0].Delete) != 1 || changes[0].DeleteBytes != 1000 {
+		t.Fatalf("expected one chunk to be deleted, got %+v", changes)
+	}
+	var removed []string
+	if err := ApplyIndexPlan(indexPath, changes[0], func(fn string) { removed = append(removed, fn) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0]) != "000000000-000000099.bin" {
+		t.Fatalf("expected the removed chunk to be reported, got %v", removed)
+	}
+	if inv := index.Scan(indexPath, "mainnet"); inv.Chunks != 0 || inv.Blooms != 1 {
+		t.Fatalf("expected the chunk to be gone and the bloom kept, got %+v", inv)
+	}
+	if m, _ := index.ReadMode(indexPath, "mainnet"); m.Detail != "bloom" || m.Applied.IsZero() {
+		t.Fatalf("expected the new mode to be recorded, got %+v", m)
+	}
+
+	// Scratch keeps what is on disk and builds on top of it
+	cfg.General.Strategy = "scratch"
+	write("finalized/000000100-000000199.bin")
+	changes = IndexChanges(cfg, inputs)
+	if len(changes) != 1 || changes[0].InitMode != index.InitNone || len(changes[0].Delete) != 0 {
+		t.Fatalf("unexpected scratch plan %+v", changes)
+	}
+	if !strings.Contains(strings.Join(changes[0].Steps, " "), "from block 200") {
+		t.Fatalf("expected the build to continue after the last block, got %v", changes[0].Steps)
+	}
+}
+
+func TestInitModes(t *testing.T) {
+	cfg := types.NewConfig()
+	cfg.General.Strategy, cfg.General.Detail = "download", "bloom"
+	inputs := []ChainInput{{Name: "mainnet", ChainID: 1, HeadBlock: 20_000_000}, {Name: "polygon", ChainID: 137}}
+
+	modes := InitModes(cfg, inputs)
+	if modes["mainnet"] != index.InitBlooms || modes["polygon"] != index.InitNone {
+		t.Fatalf("expected a chain without a published index to be built from the RPC, got %v", modes)
+	}
+	plans := PlanIndex(cfg, inputs)
+	if plans[1].Chain != "polygon" || plans[1].InitMode != index.InitNone {
+		t.Fatalf("expected the plan to agree, got %+v", plans[1])
+	}
+
+	cfg.General.Strategy = "scratch"
+	if modes := InitModes(cfg, inputs); modes["mainnet"] != index.InitNone {
+		t.Fatalf("expected scratch to download nothing, got %v", modes)
+	}
+}
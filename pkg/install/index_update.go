@@ -1,15 +1,19 @@
 package install
 
+import "math"
+
 // UpdateIndexStrategy updates the draft's index acquisition strategy and detail
-// level and persists the rough estimates directly into the draft metadata. It
-// does not save the draft to disk; caller should invoke SaveDraftAtomic.
-func UpdateIndexStrategy(d *Draft, strategy, detail string) {
+// level and persists the estimates for inputs (usually from MeasureChains or
+// CachedChainInputs) into the draft metadata. It does not save the draft to
+// disk; caller should invoke SaveDraftAtomic.
+func UpdateIndexStrategy(d *Draft, strategy, detail string, inputs []ChainInput) {
 	if d == nil {
 		return
 	}
 	d.Config.General.Strategy = strategy
 	d.Config.General.Detail = detail
-	disk, hrs := EstimateIndex(strategy, detail)
-	d.Meta.EstDiskGB = disk
-	d.Meta.EstHours = hrs
+	est := EstimateIndex(strategy, detail, inputs)
+	d.Meta.EstDiskGB = int(math.Ceil(est.DiskGB.Expected))
+	d.Meta.EstHours = int(math.Ceil(est.Hours.Expected))
+	d.Meta.Estimate = &est
 }
@@ -4,19 +4,23 @@ import "testing"
 
 func TestUpdateIndexStrategy(t *testing.T) {
 	d := NewDraftFromConfig("test-session")
+	inputs := []ChainInput{{Name: "mainnet", ChainID: 1, HeadBlock: 23_500_000, CallsPerSec: 100}}
 
 	// case 1: download + blooms only (detail 'bloom')
-	UpdateIndexStrategy(d, "download", "bloom")
+	UpdateIndexStrategy(d, "download", "bloom", inputs)
 	if d.Config.General.Strategy != "download" || d.Config.General.Detail != "bloom" {
 		t.Fatalf("strategy/detail not set: %+v", d.Config.General)
 	}
-	if d.Meta.EstDiskGB != 6 || d.Meta.EstHours != 1 { // expectation from new EstimateIndex
+	if d.Meta.EstDiskGB != 6 || d.Meta.EstHours != 1 {
 		t.Fatalf("unexpected estimates (download,bloom): disk=%d hours=%d", d.Meta.EstDiskGB, d.Meta.EstHours)
 	}
+	if d.Meta.Estimate == nil || len(d.Meta.Estimate.Chains) != 1 {
+		t.Fatalf("expected a per-chain estimate, got %+v", d.Meta.Estimate)
+	}
 
 	// case 2: scratch + full index (detail 'index')
-	UpdateIndexStrategy(d, "scratch", "index")
-	if d.Meta.EstDiskGB != 168 || d.Meta.EstHours != 100 {
+	UpdateIndexStrategy(d, "scratch", "index", inputs)
+	if d.Meta.EstDiskGB != 169 || d.Meta.EstHours != 203 {
 		t.Fatalf("unexpected estimates (scratch,index): disk=%d hours=%d", d.Meta.EstDiskGB, d.Meta.EstHours)
 	}
 }
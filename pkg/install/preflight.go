@@ -0,0 +1,201 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/disk"
+)
+
+// Severity of a preflight check. Errors block the paths step; warnings are
+// shown but allow it.
+const (
+	SeverityOK      = "ok"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// The checks DiskPreflight runs.
+const (
+	CheckFolder     = "folder"     // the data folder is a directory (or can be created)
+	CheckFreeSpace  = "free_space" // free space against the index estimate
+	CheckFilesystem = "filesystem" // filesystem type
+	CheckMount      = "mount"      // network or memory-backed mount
+	CheckWrite      = "write"      // sequential write throughput
+	CheckFsync      = "fsync"      // small synced writes per second
+	CheckDevices    = "devices"    // whether the index and cache share a device
+)
+
+// Preflight limits. The write test is small enough to run in about a second
+// on a local disk.
+const (
+	preflightWriteSize = 32 << 20
+	preflightFsyncTime = 500 * time.Millisecond
+	minWriteMBps       = 50
+	minFsyncsPerSec    = 50
+)
+
+// PreflightCheck is the result of one preflight check.
+type PreflightCheck struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Preflight is the result of checking a data folder before the index is put
+// there.
+type Preflight struct {
+	Path   string           `json:"path"`
+	NeedGB Range            `json:"needGb"`
+	Checks []PreflightCheck `json:"checks"`
+}
+
+// Blocking reports whether any check failed with an error.
+func (p Preflight) Blocking() bool {
+	return len(p.FieldErrors()) > 0
+}
+
+// FieldErrors returns the failed checks as field errors on the data folder.
+func (p Preflight) FieldErrors() []FieldError {
+	var out []FieldError
+	for _, c := range p.Checks {
+		if c.Severity == SeverityError {
+			out = append(out, FieldError{Field: "general.dataFolder", Code: "preflight_" + c.Name, Message: c.Message})
+		}
+	}
+	return out
+}
+
+func (p *Preflight) add(name, severity, format string, args ...any) {
+	p.Checks = append(p.Checks, PreflightCheck{Name: name, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+// DiskPreflight checks the draft's data folder: free space against the index
+// estimate, the filesystem and mount type, write and fsync throughput, and
+// whether the index and cache share a device. It does not create the folder;
+// the checks run on its nearest existing parent until it exists.
+func DiskPreflight(d *Draft) Preflight {
+	cfg := d.Config
+	cfg.General.DataFolder = utils.ResolvePath(strings.TrimSpace(cfg.General.DataFolder))
+	p := Preflight{Path: cfg.General.DataFolder}
+	if p.Path == "" {
+		p.add(CheckFolder, SeverityError, "data folder is required")
+		return p
+	}
+	if fi, err := os.Stat(p.Path); err == nil && !fi.IsDir() {
+		p.add(CheckFolder, SeverityError, "%s exists and is not a directory", p.Path)
+		return p
+	} else if err != nil {
+		p.add(CheckFolder, SeverityOK, "%s will be created", p.Path)
+	}
+
+	// Free space. Less than the smallest possible index (blooms only,
+	// downloaded) is an error; less than the current choice is a warning.
+	inputs := CachedChainInputs(cfg)
+	current := EstimateIndex(cfg.General.Strategy, cfg.General.Detail, inputs)
+	smallest := EstimateIndex("download", "bloom", inputs)
+	have, _ := disk.DirSize(cfg.IndexPath())
+	haveGB := float64(have) / 1e9
+	p.NeedGB = Range{
+		Low:      math.Max(0, current.DiskGB.Low-haveGB),
+		Expected: math.Max(0, current.DiskGB.Expected-haveGB),
+		High:     math.Max(0, current.DiskGB.High-haveGB),
+	}
+	if u, err := disk.Stat(p.Path); err != nil {
+		p.add(CheckFreeSpace, SeverityWarning, "cannot read free space: %v", err)
+	} else {
+		freeGB := float64(u.Free) / 1e9
+		switch {
+		case freeGB < smallest.DiskGB.Low-haveGB:
+			p.add(CheckFreeSpace, SeverityError, "only %.0f GB free; even the smallest index (blooms only) needs about %s GB", freeGB, smallest.DiskGB)
+		case freeGB < p.NeedGB.High:
+			p.add(CheckFreeSpace, SeverityWarning, "%.0f GB free; the index (%s, %s) needs about %s GB", freeGB, cfg.General.Strategy, cfg.General.Detail, p.NeedGB)
+		default:
+			p.add(CheckFreeSpace, SeverityOK, "%.0f GB free; the index needs about %s GB", freeGB, p.NeedGB)
+		}
+	}
+
+	// Filesystem and mount type
+	if m, err := disk.MountOf(p.Path); err != nil {
+		p.add(CheckFilesystem, SeverityWarning, "cannot read the filesystem type: %v", err)
+	} else {
+		switch m.FSType {
+		case "vfat", "exfat":
+			p.add(CheckFilesystem, SeverityWarning, "%s has no file permissions and is slow with many small files", m.FSType)
+		default:
+			p.add(CheckFilesystem, SeverityOK, "filesystem is %s", m.FSType)
+		}
+		switch {
+		case m.Memory:
+			p.add(CheckMount, SeverityError, "%s is memory backed (%s); the index would be lost at reboot", p.Path, m.FSType)
+		case m.Network:
+			p.add(CheckMount, SeverityWarning, "%s is on a network filesystem (%s); the index will be slow and fsync may not be honored", p.Path, m.FSType)
+		default:
+			p.add(CheckMount, SeverityOK, "local disk")
+		}
+	}
+
+	// Write and fsync throughput
+	if t, err := disk.MeasureThroughput(disk.Existing(p.Path), preflightWriteSize, preflightFsyncTime); err != nil {
+		p.add(CheckWrite, SeverityError, "cannot write to %s: %v", p.Path, err)
+	} else {
+		sev := SeverityOK
+		if t.WriteMBps < minWriteMBps {
+			sev = SeverityWarning
+		}
+		p.add(CheckWrite, sev, "writes at %.0f MB/s", t.WriteMBps)
+		sev = SeverityOK
+		if t.FsyncsPerSec < minFsyncsPerSec {
+			sev = SeverityWarning
+		}
+		p.add(CheckFsync, sev, "%.0f fsyncs per second", t.FsyncsPerSec)
+	}
+
+	// Index and cache devices
+	im, ierr := disk.MountOf(cfg.IndexPath())
+	cm, cerr := disk.MountOf(cfg.CachePath())
+	switch {
+	case ierr != nil || cerr != nil:
+	case im.Device == cm.Device:
+		p.add(CheckDevices, SeverityOK, "index and cache share a device")
+	default:
+		p.add(CheckDevices, SeverityOK, "index (%s) and cache (%s) are on different devices", im.FSType, cm.FSType)
+	}
+	return p
+}
+
+// PreflightHandler runs DiskPreflight on the draft with the data folder posted
+// in the path form value (default: the draft's). As the preflight writes a
+// test file, it only answers POST, and only for a folder that passes the
+// paths step's validation.
+func PreflightHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = w.Write([]byte(`{"error":"POST only"}`))
+		return
+	}
+	if !allowProbe(probeSession(r), time.Now()) {
+		writeRateLimited(w)
+		return
+	}
+	d, _ := LoadDraft()
+	if d == nil {
+		d = NewDraftFromConfig("")
+	}
+	if path := strings.TrimSpace(r.PostFormValue("path")); path != "" {
+		d.Config.General.DataFolder = path
+	}
+	if errs := ValidatePaths(d); len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": errs[0].Message, "code": errs[0].Code})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(DiskPreflight(d))
+}
@@ -0,0 +1,87 @@
+package install
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskPreflight(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDraftFromConfig("test-session")
+	d.Config.General.DataFolder = filepath.Join(dir, "data")
+
+	pf := DiskPreflight(d)
+	got := map[string]string{}
+	for _, c := range pf.Checks {
+		got[c.Name] = c.Severity
+	}
+	for _, name := range []string{CheckFolder, CheckFreeSpace, CheckWrite, CheckFsync} {
+		if got[name] == "" {
+			t.Fatalf("expected a %s check, got %+v", name, pf.Checks)
+		}
+	}
+	if got[CheckWrite] == SeverityError {
+		t.Fatalf("expected the write test to pass, got %+v", pf.Checks)
+	}
+	if _, err := os.Stat(d.Config.General.DataFolder); !os.IsNotExist(err) {
+		t.Fatal("expected the preflight not to create the data folder")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected the write test to clean up, found %d entries", len(entries))
+	}
+
+	// A file where the folder should be is an error that blocks the step
+	file := filepath.Join(dir, "file")
+	_ = os.WriteFile(file, []byte("x"), 0o644)
+	d.Config.General.DataFolder = file
+	pf = DiskPreflight(d)
+	errs := pf.FieldErrors()
+	if !pf.Blocking() || len(errs) != 1 || errs[0].Code != "preflight_"+CheckFolder || errs[0].Field != "general.dataFolder" {
+		t.Fatalf("expected a blocking folder error, got %+v", pf.Checks)
+	}
+}
+
+func TestPreflight_Blocking(t *testing.T) {
+	pf := Preflight{Checks: []PreflightCheck{
+		{Name: CheckFreeSpace, Severity: SeverityWarning, Message: "low"},
+		{Name: CheckMount, Severity: SeverityOK, Message: "local disk"},
+	}}
+	if pf.Blocking() {
+		t.Fatal("warnings must not block")
+	}
+	pf.Checks = append(pf.Checks, PreflightCheck{Name: CheckMount, Severity: SeverityError, Message: "tmpfs"})
+	if !pf.Blocking() || len(pf.FieldErrors()) != 1 {
+		t.Fatalf("expected one blocking error, got %+v", pf.FieldErrors())
+	}
+}
+
+func TestPreflightHandler(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("KHEDRA_TEST_CONFIG_FN", filepath.Join(tmp, "config.yaml"))
+	post := func(method, path, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/install/preflight", strings.NewReader(url.Values{"path": {path}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Khedra-Session", session)
+		rec := httptest.NewRecorder()
+		PreflightHandler(rec, req)
+		return rec
+	}
+
+	if rec := post(http.MethodGet, filepath.Join(tmp, "data"), "preflight-get"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected a GET to be refused, got %d", rec.Code)
+	}
+	for _, path := range []string{"/etc/khedra", "/", "relative/data"} {
+		if rec := post(http.MethodPost, path, "preflight-"+path); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected the folder to be refused, got %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	rec := post(http.MethodPost, filepath.Join(tmp, "data"), "preflight-ok")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"write"`) {
+		t.Fatalf("expected the preflight to run, got %d %s", rec.Code, rec.Body.String())
+	}
+}
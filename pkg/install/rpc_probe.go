@@ -14,7 +14,10 @@ import (
 	"time"
 
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
-	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
 )
 
 var (
@@ -32,6 +35,11 @@ var (
 	globalHits       []time.Time
 )
 
+// rpcLog tags probe messages so they follow the rpc component's log level.
+func rpcLog() *slog.Logger {
+	return slog.Default().With(types.ComponentKey, types.ComponentRpc)
+}
+
 func sanitizeURL(raw string) (string, error) {
 	if raw == "" {
 		return "", errors.New("empty url")
@@ -40,8 +48,10 @@ func sanitizeURL(raw string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("parse: %w", err)
 	}
-	if u.Scheme != "http" && u.Scheme != "https" {
-		return "", errors.New("scheme must be http or https")
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return "", errors.New("scheme must be http, https, ws or wss")
 	}
 	if u.Host == "" {
 		return "", errors.New("missing host")
@@ -78,22 +88,22 @@ func headProbe(ctx context.Context, raw string) rpc.PingResult {
 		}
 		elapsed := time.Since(start).Milliseconds()
 		if pr.OK {
-			slog.Info("rpc head probe ok", "url", raw, "status", resp.StatusCode, "ms", elapsed)
+			rpcLog().Info("rpc head probe ok", "url", raw, "status", resp.StatusCode, "ms", elapsed)
 		} else {
-			slog.Info("rpc head probe not ok", "url", raw, "status", resp.StatusCode, "err", pr.Error, "ms", elapsed)
+			rpcLog().Info("rpc head probe not ok", "url", raw, "status", resp.StatusCode, "err", pr.Error, "ms", elapsed)
 		}
 	} else {
 		pr.Error = err.Error()
-		slog.Info("rpc head probe error", "url", raw, "err", err.Error())
+		rpcLog().Info("rpc head probe error", "url", raw, "err", err.Error())
 	}
 	return pr
 }
 
 func jsonProbe(ctx context.Context, raw string, expected string) rpc.PingResult {
 	_ = ctx
-	result, err := rpc.PingRpc(raw)
+	result, err := metrics.PingRpc(raw)
 	if err != nil {
-		slog.Info("rpc json probe error", "url", raw, "err", err.Error())
+		rpcLog().Info("rpc json probe error", "url", raw, "err", err.Error())
 	}
 	if result == nil {
 		return rpc.PingResult{URL: raw, Mode: "json", CheckedAt: time.Now().Unix(), ExpectedChain: expected}
@@ -101,32 +111,16 @@ func jsonProbe(ctx context.Context, raw string, expected string) rpc.PingResult
 	result.Mode = "json"
 	result.ExpectedChain = expected
 	if result.OK {
-		slog.Info("rpc json probe ok", "url", raw, "chainId", result.ChainID, "expected", expected)
+		rpcLog().Info("rpc json probe ok", "url", raw, "chainId", result.ChainID, "expected", expected)
 	}
 	return *result
 }
 
-// RpcProbeHandler returns minimal information about chain RPC reachability for quick UI validation.
-// Query param: url=... (single). It lightly caches recent results to avoid spamming endpoints.
-func RpcProbeHandler(w http.ResponseWriter, r *http.Request) {
-	raw := r.URL.Query().Get("url")
-	mode := r.URL.Query().Get("mode") // head|json (default head)
-	expected := r.URL.Query().Get("expected")
-	w.Header().Set("Content-Type", "application/json")
-	now := time.Now()
-	slog.Debug("rpc probe request", "url", raw, "mode", mode, "expected", expected)
-	// Explicitly reject websocket schemes with clearer message (UI previously showed generic 'unreachable')
-	if strings.HasPrefix(strings.ToLower(raw), "ws://") || strings.HasPrefix(strings.ToLower(raw), "wss://") {
-		_ = json.NewEncoder(w).Encode(rpc.PingResult{URL: raw, OK: false, Error: "websocket RPC endpoints (ws://, wss://) are not supported; please use http:// or https://", CheckedAt: now.Unix(), Mode: mode})
-		return
-	}
-	// rudimentary session-based rate limiting (session id passed via header or cookie later; fallback remote addr)
-	sessionID := r.Header.Get("X-Khedra-Session")
-	if sessionID == "" {
-		sessionID = r.RemoteAddr
-	}
-	globalExceeded := false
+// allowProbe applies the per-session and global probe rate limits, counting
+// this probe if it is allowed.
+func allowProbe(sessionID string, now time.Time) bool {
 	ratelimitMu.Lock()
+	defer ratelimitMu.Unlock()
 	// prune old global hits
 	cutoff := now.Add(-sessionWindow)
 	var kept []time.Time
@@ -136,29 +130,70 @@ func RpcProbeHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	globalHits = kept
-	if len(globalHits) >= globalLimitTotal {
-		globalExceeded = true
-	}
+	globalExceeded := len(globalHits) >= globalLimitTotal
 	// session hits
 	hits := sessionHits[sessionID]
-	kept = kept[:0]
+	kept = kept[:0:0]
 	for _, t := range hits {
 		if t.After(cutoff) {
 			kept = append(kept, t)
 		}
 	}
 	hits = kept
-	if !globalExceeded && len(hits) < perSessionLimit {
-		hits = append(hits, now)
-		globalHits = append(globalHits, now)
-		sessionHits[sessionID] = hits
-		ratelimitMu.Unlock()
-	} else {
+	if globalExceeded || len(hits) >= perSessionLimit {
 		sessionHits[sessionID] = hits
-		ratelimitMu.Unlock()
-		retry := int(sessionWindow.Seconds())
-		w.WriteHeader(http.StatusTooManyRequests)
-		_ = json.NewEncoder(w).Encode(map[string]any{"error": "rate_limited", "retryAfterSec": retry})
+		return false
+	}
+	sessionHits[sessionID] = append(hits, now)
+	globalHits = append(globalHits, now)
+	return true
+}
+
+func writeRateLimited(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": "rate_limited", "retryAfterSec": int(sessionWindow.Seconds())})
+}
+
+// probeSession identifies the caller of a probe for rate limiting.
+func probeSession(r *http.Request) string {
+	if id := r.Header.Get("X-Khedra-Session"); id != "" {
+		return id
+	}
+	return r.RemoteAddr
+}
+
+// RpcCapabilitiesHandler returns the capability matrix of an RPC (query param url=...),
+// sharing the rate limits of RpcProbeHandler.
+func RpcCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !allowProbe(probeSession(r), time.Now()) {
+		writeRateLimited(w)
+		return
+	}
+	sanitized, err := sanitizeURL(r.URL.Query().Get("url"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	_ = json.NewEncoder(w).Encode(ProbeCapabilities(ctx, sanitized))
+}
+
+// RpcProbeHandler returns minimal information about chain RPC reachability for quick UI validation.
+// Query param: url=... (single). It lightly caches recent results to avoid spamming endpoints.
+func RpcProbeHandler(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("url")
+	mode := r.URL.Query().Get("mode") // head|json (default head)
+	expected := r.URL.Query().Get("expected")
+	w.Header().Set("Content-Type", "application/json")
+	now := time.Now()
+	rpcLog().Debug("rpc probe request", "url", raw, "mode", mode, "expected", expected)
+	// rudimentary session-based rate limiting (session id passed via header or cookie later; fallback remote addr)
+	sessionID := probeSession(r)
+	if !allowProbe(sessionID, now) {
+		writeRateLimited(w)
 		return
 	}
 	if raw == "" {
@@ -167,20 +202,23 @@ func RpcProbeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	sanitized, err := sanitizeURL(raw)
 	if err != nil {
-		slog.Info("rpc probe invalid url", "raw", raw, "err", err.Error(), "mode", mode)
+		rpcLog().Info("rpc probe invalid url", "raw", raw, "err", err.Error(), "mode", mode)
 		_ = json.NewEncoder(w).Encode(rpc.PingResult{URL: raw, OK: false, Error: err.Error(), CheckedAt: now.Unix(), Mode: mode})
 		return
 	}
 	if mode == "" {
 		mode = "head"
 	}
-	slog.Info("rpc probe start", "url", sanitized, "mode", mode, "expected", expected)
+	if wsrpc.IsWebSocket(sanitized) {
+		mode = "json" // a WebSocket has no HEAD; ask for the chain ID over it
+	}
+	rpcLog().Info("rpc probe start", "url", sanitized, "mode", mode, "expected", expected)
 	// cache lookup
 	probeCacheMu.Lock()
 	switch mode {
 	case "head":
 		if res, ok := probeCacheHead[sanitized]; ok && now.Sub(time.Unix(res.CheckedAt, 0)) < probeTTL {
-			slog.Debug("rpc probe cache hit", "url", sanitized, "mode", mode)
+			rpcLog().Debug("rpc probe cache hit", "url", sanitized, "mode", mode)
 			probeCacheMu.Unlock()
 			_ = json.NewEncoder(w).Encode(res)
 			return
@@ -188,7 +226,7 @@ func RpcProbeHandler(w http.ResponseWriter, r *http.Request) {
 	case "json":
 		cacheKey := sanitized // ignore expected chain id for caching; we accept whatever comes back
 		if res, ok := probeCacheJSON[cacheKey]; ok && now.Sub(time.Unix(res.CheckedAt, 0)) < probeTTL {
-			slog.Debug("rpc probe cache hit", "url", sanitized, "mode", mode)
+			rpcLog().Debug("rpc probe cache hit", "url", sanitized, "mode", mode)
 			probeCacheMu.Unlock()
 			_ = json.NewEncoder(w).Encode(res)
 			return
@@ -215,8 +253,8 @@ func RpcProbeHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	pr.LatencyMS = time.Since(startProbe).Milliseconds()
-	slog.Info("rpc probe result", "url", sanitized, "mode", pr.Mode, "ok", pr.OK, "status", pr.StatusCode, "err", pr.Error, "chainId", pr.ChainID, "updated", pr.Updated)
-	slog.Debug("rpc probe result", "url", sanitized, "mode", pr.Mode, "ok", pr.OK, "status", pr.StatusCode, "err", pr.Error, "chainId", pr.ChainID, "updated", pr.Updated)
+	rpcLog().Info("rpc probe result", "url", sanitized, "mode", pr.Mode, "ok", pr.OK, "status", pr.StatusCode, "err", pr.Error, "chainId", pr.ChainID, "updated", pr.Updated)
+	rpcLog().Debug("rpc probe result", "url", sanitized, "mode", pr.Mode, "ok", pr.OK, "status", pr.StatusCode, "err", pr.Error, "chainId", pr.ChainID, "updated", pr.Updated)
 	probeCacheMu.Lock()
 	if pr.Mode == "head" {
 		probeCacheHead[sanitized] = pr
@@ -225,12 +263,12 @@ func RpcProbeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	probeCacheMu.Unlock()
 
-	// Always adopt returned chainId (ignore expected) and derive chain name via ChainList
+	// Always adopt returned chainId (ignore expected) and derive chain name via the chain catalog
 	if pr.Mode == "json" && pr.OK && pr.ChainID != "" {
 		cidStr := strings.TrimPrefix(strings.ToLower(pr.ChainID), "0x")
 		if n, err := strconv.ParseUint(cidStr, 16, 64); err == nil {
-			if item := utils.GetChainListItem("~/.khedra", int(n)); item != nil {
-				pr.ChainName = item.Name
+			if info, ok := chains.ByID(int(n)); ok {
+				pr.ChainName = info.Title
 			}
 			chainKey := r.URL.Query().Get("chain")
 			if chainKey != "" { // update existing draft chain slot if provided
@@ -242,7 +280,7 @@ func RpcProbeHandler(w http.ResponseWriter, r *http.Request) {
 							d.Config.Chains[chainKey] = ch
 							_ = SaveDraftAtomic(d)
 							pr.Updated = true
-							slog.Info("rpc probe chainId updated", "chain", chainKey, "old", oldID, "new", ch.ChainID)
+							rpcLog().Info("rpc probe chainId updated", "chain", chainKey, "old", oldID, "new", ch.ChainID)
 						}
 					}
 				}
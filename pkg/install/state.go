@@ -43,6 +43,24 @@ func (s *SessionStore) Get() (string, time.Time) {
 
 func currentStep() string { return StepOrder[0] }
 
+// StepIndex returns the position of step in StepOrder, or -1.
+func StepIndex(step string) int {
+	for i, s := range StepOrder {
+		if s == step {
+			return i
+		}
+	}
+	return -1
+}
+
+// NextStep returns the step after step in StepOrder ("" after the last).
+func NextStep(step string) string {
+	if i := StepIndex(step); i >= 0 && i+1 < len(StepOrder) {
+		return StepOrder[i+1]
+	}
+	return ""
+}
+
 func Handler(session *SessionStore, version string, configured bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		_ = r
@@ -7,8 +7,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 )
 
@@ -57,10 +59,38 @@ func ValidatePaths(d *Draft) []FieldError {
 	var out []FieldError
 	if d == nil || strings.TrimSpace(d.Config.General.DataFolder) == "" {
 		out = append(out, FieldError{Field: "general.dataFolder", Code: "required", Message: "data folder is required"})
+	} else if fe := dataFolderError(d.Config.General.DataFolder); fe != nil {
+		out = append(out, *fe)
 	}
 	return out
 }
 
+// systemFolders hold the operating system; a data folder may not be in one.
+var systemFolders = []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/proc", "/sbin", "/sys", "/usr", "/System"}
+
+// dataFolderError returns why path cannot be a data folder, or nil if it can:
+// it must be absolute (~/ is the home folder) and outside the system folders.
+func dataFolderError(path string) *FieldError {
+	path = strings.TrimSpace(path)
+	home := path == "~" || strings.HasPrefix(path, "~/")
+	if !home && !filepath.IsAbs(path) {
+		return &FieldError{Field: "general.dataFolder", Code: "not_absolute", Message: "data folder must be an absolute path or start with ~/"}
+	}
+	if path = utils.ResolvePath(path); !filepath.IsAbs(path) {
+		return &FieldError{Field: "general.dataFolder", Code: "not_absolute", Message: "data folder must be an absolute path or start with ~/"}
+	}
+	path = filepath.Clean(path)
+	if path == string(filepath.Separator) {
+		return &FieldError{Field: "general.dataFolder", Code: "system_folder", Message: "data folder may not be the root folder"}
+	}
+	for _, sys := range systemFolders {
+		if path == sys || strings.HasPrefix(path, sys+string(filepath.Separator)) {
+			return &FieldError{Field: "general.dataFolder", Code: "system_folder", Message: fmt.Sprintf("data folder may not be in %s", sys)}
+		}
+	}
+	return nil
+}
+
 func ValidateIndex(d *Draft) []FieldError {
 	var out []FieldError
 	strategy := d.Config.General.Strategy
@@ -167,6 +197,23 @@ func ValidateLogging(d *Draft) []FieldError {
 	if lvl != "" && lvl != "info" && lvl != "debug" && lvl != "warn" && lvl != "error" {
 		out = append(out, FieldError{Field: "logging.level", Code: "invalid_level", Message: fmt.Sprintf("unknown logging level '%s'", lvl)})
 	}
+	if f := lg.ScreenFormat; f != "" && f != types.FormatText && f != types.FormatJson {
+		out = append(out, FieldError{Field: "logging.screenFormat", Code: "invalid_format", Message: fmt.Sprintf("unknown logging format '%s'", f)})
+	}
+	if f := lg.FileFormat; f != "" && f != types.FormatText && f != types.FormatJson {
+		out = append(out, FieldError{Field: "logging.fileFormat", Code: "invalid_format", Message: fmt.Sprintf("unknown logging format '%s'", f)})
+	}
+	comps := lg.Components.Map()
+	names := make([]string, 0, len(comps))
+	for name := range comps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if lvl := comps[name]; lvl != "info" && lvl != "debug" && lvl != "warn" && lvl != "error" {
+			out = append(out, FieldError{Field: "logging.components." + name, Code: "invalid_level", Message: fmt.Sprintf("unknown logging level '%s'", lvl)})
+		}
+	}
 	if lg.ToFile {
 		if strings.TrimSpace(lg.Folder) == "" {
 			out = append(out, FieldError{Field: "logging.folder", Code: "log_folder_required", Message: "folder required when file logging enabled"})
@@ -229,9 +276,10 @@ func EnsureDataFolder(path string) error {
 	return nil
 }
 
-// ApplyDraft validates the draft then writes it as the final config (config.yaml). It backs up
-// any existing final config and removes the draft on success.
-func ApplyDraft() error {
+// ApplyDraft validates the draft then writes it as the final config (config.yaml). The new
+// file is recorded as a config generation from source (after any unrecorded edit to the old
+// one), and the draft is removed on success.
+func ApplyDraft(source string) error {
 	d, err := LoadDraft()
 	if err != nil {
 		return fmt.Errorf("cannot load draft: %w", err)
@@ -257,8 +305,8 @@ func ApplyDraft() error {
 	original := []byte{}
 	if data, err := os.ReadFile(finalPath); err == nil {
 		original = data
+		_, _, _ = RecordGeneration(SourceManual, "")
 	}
-	_, _ = BackupFinalConfig()
 	tmp := finalPath + ".tmp-new"
 	if err := d.Config.WriteToFile(tmp); err != nil {
 		_ = os.Remove(tmp)
@@ -285,7 +333,8 @@ func ApplyDraft() error {
 		}
 		return io.ErrUnexpectedEOF
 	}
-	if err := RemoveDraft(); err != nil { // Remove draft
+	_, _, _ = RecordGeneration(source, "") // best effort; the config itself is in place
+	if err := RemoveDraft(); err != nil {  // Remove draft
 		return err
 	}
 	return nil
@@ -101,6 +101,16 @@ func TestValidateLogging_FileLoggingNoFolder(t *testing.T) {
 	}
 }
 
+func TestValidateLogging_FormatsAndComponents(t *testing.T) {
+	d := newDraft()
+	d.Config.Logging.FileFormat = "xml"
+	d.Config.Logging.Components.Rpc = "loud"
+	ferrs := ValidateDraftPhase(d, "step:logging")
+	if !hasCode(ferrs, "invalid_format") || !hasCode(ferrs, "invalid_level") {
+		t.Fatalf("expected invalid_format and invalid_level, got %+v", ferrs)
+	}
+}
+
 // Helper functions
 func hasCode(ferrs []FieldError, code string) bool { return len(filterCodes(ferrs, code)) > 0 }
 func filterCodes(ferrs []FieldError, code string) []FieldError {
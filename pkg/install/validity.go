@@ -7,7 +7,7 @@ import (
 
 	coreFile "github.com/TrueBlocks/trueblocks-chifra/v6/pkg/file"
 	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/logger"
-	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
 	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/types"
 	yamlv2 "gopkg.in/yaml.v2"
 )
@@ -41,7 +41,7 @@ func checkMainnetAccessible(rpcUrl string) bool {
 	}
 
 	// Perform the actual RPC check
-	probe, err := rpc.PingRpc(rpcUrl)
+	probe, err := metrics.PingRpc(rpcUrl)
 	if err != nil {
 		logger.Info("mainnet RPC ping failed", "url", rpcUrl, "error", err)
 	}
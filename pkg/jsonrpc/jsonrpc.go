@@ -0,0 +1,164 @@
+// Package jsonrpc makes single Ethereum JSON-RPC calls over HTTP. They are
+// sent through http.DefaultTransport, where khedra records them in the
+// metrics registry.
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a call whose context has no deadline.
+const DefaultTimeout = 10 * time.Second
+
+var client = &http.Client{}
+
+// Error is an error object returned by the node.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// Call posts one request to endpoint and decodes its result into result (which
+// may be nil to discard it).
+func Call(ctx context.Context, endpoint, method string, params []any, result any) error {
+	data, err := post(ctx, endpoint, newEnvelope(1, method, params))
+	if err != nil {
+		return err
+	}
+
+	var resp response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Request is one call of a Batch.
+type Request struct {
+	Method string
+	Params []any
+}
+
+// Batch posts calls to endpoint as a single JSON-RPC batch and returns their
+// raw results in the same order. It fails if the node does not answer with one
+// response per call, or if any call returns an error.
+func Batch(ctx context.Context, endpoint string, calls []Request) ([]json.RawMessage, error) {
+	envelopes := make([]map[string]any, len(calls))
+	for i, c := range calls {
+		envelopes[i] = newEnvelope(i+1, c.Method, c.Params)
+	}
+	data, err := post(ctx, endpoint, envelopes)
+	if err != nil {
+		return nil, err
+	}
+
+	var resps []response
+	if err := json.Unmarshal(data, &resps); err != nil {
+		return nil, fmt.Errorf("invalid batch response: %w", err)
+	}
+	if len(resps) != len(calls) {
+		return nil, fmt.Errorf("batch of %d calls returned %d responses", len(calls), len(resps))
+	}
+	results := make([]json.RawMessage, len(calls))
+	for _, r := range resps {
+		if r.ID < 1 || r.ID > len(calls) {
+			return nil, fmt.Errorf("batch response has unknown id %d", r.ID)
+		}
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		results[r.ID-1] = r.Result
+	}
+	return results, nil
+}
+
+// response is the envelope of one JSON-RPC response.
+type response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+func newEnvelope(id int, method string, params []any) map[string]any {
+	if params == nil {
+		params = []any{}
+	}
+	return map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	}
+}
+
+// post sends payload as JSON to endpoint and returns the body of a 200 response.
+func post(ctx context.Context, endpoint string, payload any) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return data, nil
+}
+
+// Uint64 calls a method whose result is a hex quantity such as eth_blockNumber
+// or eth_chainId.
+func Uint64(ctx context.Context, endpoint, method string) (uint64, error) {
+	var hex string
+	if err := Call(ctx, endpoint, method, nil, &hex); err != nil {
+		return 0, err
+	}
+	return ParseQuantity(hex)
+}
+
+// ParseQuantity parses a 0x-prefixed hex quantity.
+func ParseQuantity(hex string) (uint64, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(hex, "0x"), "0X")
+	if s == "" {
+		return 0, fmt.Errorf("invalid quantity %q", hex)
+	}
+	return strconv.ParseUint(s, 16, 64)
+}
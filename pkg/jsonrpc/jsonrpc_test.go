@@ -0,0 +1,80 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch req.Method {
+		case "eth_blockNumber":
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1b4"}`))
+		case "eth_bad":
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	n, err := Uint64(ctx, srv.URL, "eth_blockNumber")
+	if err != nil || n != 436 {
+		t.Fatalf("expected 436, got %d (%v)", n, err)
+	}
+
+	err = Call(ctx, srv.URL, "eth_bad", nil, nil)
+	rpcErr, ok := err.(*Error)
+	if !ok || rpcErr.Code != -32601 {
+		t.Fatalf("expected rpc error, got %v", err)
+	}
+
+	if err := Call(ctx, srv.URL, "eth_other", nil, nil); err == nil {
+		t.Fatal("expected http error")
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	if n, err := ParseQuantity("0x10"); err != nil || n != 16 {
+		t.Fatalf("got %d %v", n, err)
+	}
+	for _, bad := range []string{"", "0x", "0xzz"} {
+		if _, err := ParseQuantity(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// answer in reverse order, as nodes may
+		_, _ = w.Write([]byte(`[{"jsonrpc":"2.0","id":2,"result":"0x1b4"},{"jsonrpc":"2.0","id":1,"result":"0x1"}]`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	results, err := Batch(ctx, srv.URL, []Request{{Method: "eth_chainId"}, {Method: "eth_blockNumber"}})
+	if err != nil || len(results) != 2 || string(results[0]) != `"0x1"` || string(results[1]) != `"0x1b4"` {
+		t.Fatalf("unexpected batch results %s (%v)", results, err)
+	}
+
+	if _, err := Batch(ctx, srv.URL, []Request{{Method: "eth_chainId"}}); err == nil {
+		t.Fatal("expected an error when the response count does not match")
+	}
+}
@@ -0,0 +1,297 @@
+package logs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the timestamp lumberjack embeds in rotated file names.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Query selects log lines. Zero values disable the corresponding filter.
+type Query struct {
+	Since time.Time // only lines at or after this time
+	Until time.Time // only lines strictly before this time (paging cursor)
+	Skip  int       // if set, lines at exactly Until are kept too, except the newest Skip of them
+	Level string    // minimum level (debug, info, warn, error)
+	Grep  string    // case-insensitive substring match
+	Limit int       // maximum number of lines (newest win)
+}
+
+// Line is a single parsed log line.
+type Line struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	Text  string    `json:"text"`
+}
+
+// Page is a slice of matching lines (oldest first) plus a cursor for older results.
+type Page struct {
+	Lines []Line `json:"lines"`
+	More  bool   `json:"more"`
+	Next  string `json:"next,omitempty"`
+}
+
+// Files returns the log file and its lumberjack backups (plain or gzip compressed)
+// ordered oldest first. The active file, if present, is always last.
+func Files(folder, filename string) ([]string, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filename, ext) + "-"
+
+	type backup struct {
+		name string
+		ts   time.Time
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		ts, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: name, ts: ts})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ts.Before(backups[j].ts) })
+
+	var out []string
+	for _, b := range backups {
+		out = append(out, filepath.Join(folder, b.name))
+	}
+	active := filepath.Join(folder, filename)
+	if _, err := os.Stat(active); err == nil {
+		out = append(out, active)
+	}
+	return out, nil
+}
+
+// Read returns the newest lines across the log file and its backups that match q.
+func Read(folder, filename string, q Query) (Page, error) {
+	files, err := Files(folder, filename)
+	if err != nil {
+		return Page{}, err
+	}
+
+	minLevel := levelRank(q.Level)
+	grep := strings.ToLower(q.Grep)
+
+	var newestFirst []Line
+	more := false
+	done := false
+	skipped := 0
+	for i := len(files) - 1; i >= 0 && !done; i-- {
+		lines, err := ReadLines(files[i])
+		if err != nil {
+			return Page{}, fmt.Errorf("reading %s: %w", files[i], err)
+		}
+		for j := len(lines) - 1; j >= 0; j-- {
+			ln := ParseLine(lines[j])
+			if !q.Until.IsZero() && (ln.Time.IsZero() || !Before(ln.Time, q.Until, q.Skip)) {
+				continue
+			}
+			if !q.Since.IsZero() {
+				if ln.Time.IsZero() {
+					continue
+				}
+				if ln.Time.Before(q.Since) {
+					// files are chronological, so nothing older can match
+					done = true
+					break
+				}
+			}
+			if minLevel > 0 && levelRank(ln.Level) < minLevel {
+				continue
+			}
+			if grep != "" && !strings.Contains(strings.ToLower(ln.Text), grep) {
+				continue
+			}
+			if q.Skip > 0 && ln.Time.Equal(q.Until) && skipped < q.Skip {
+				skipped++ // returned on the previous page
+				continue
+			}
+			if q.Limit > 0 && len(newestFirst) >= q.Limit {
+				more = true
+				done = true
+				break
+			}
+			newestFirst = append(newestFirst, ln)
+		}
+	}
+
+	page := Page{Lines: make([]Line, 0, len(newestFirst)), More: more}
+	for i := len(newestFirst) - 1; i >= 0; i-- {
+		page.Lines = append(page.Lines, newestFirst[i])
+	}
+	if more && len(page.Lines) > 0 && !page.Lines[0].Time.IsZero() {
+		oldest := page.Lines[0].Time
+		n := 0
+		for n < len(page.Lines) && page.Lines[n].Time.Equal(oldest) {
+			n++
+		}
+		page.Next = NextCursor(oldest, n, q.Until, q.Skip)
+	}
+	return page, nil
+}
+
+// cursorSep separates the time of a paging cursor from the number of lines
+// at that time already returned.
+const cursorSep = "~"
+
+// NextCursor returns the cursor for the page before one whose oldest n lines
+// are at oldest, and which was read with until and skip. Lines sharing a
+// timestamp may straddle pages, so the cursor counts those already returned.
+func NextCursor(oldest time.Time, n int, until time.Time, skip int) string {
+	if skip > 0 && oldest.Equal(until) {
+		n += skip
+	}
+	return oldest.Format(time.RFC3339Nano) + cursorSep + strconv.Itoa(n)
+}
+
+// ParseUntil accepts what ParseSince does, or a cursor from a page's Next,
+// for which it also returns how many lines at that time to skip.
+func ParseUntil(s string, now time.Time) (time.Time, int, error) {
+	ts, count, ok := strings.Cut(strings.TrimSpace(s), cursorSep)
+	if !ok {
+		t, err := ParseSince(s, now)
+		return t, 0, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	n, nerr := strconv.Atoi(count)
+	if err != nil || nerr != nil || n < 1 {
+		return time.Time{}, 0, fmt.Errorf("invalid cursor %q", s)
+	}
+	return t, n, nil
+}
+
+// Before reports whether t is before until, counting t at exactly until when
+// skip is set: a cursor's time is inclusive.
+func Before(t, until time.Time, skip int) bool {
+	return t.Before(until) || (skip > 0 && t.Equal(until))
+}
+
+// ParseLine extracts the timestamp and level from a line written by slog's text
+// or JSON handler. Unparseable lines are returned with a zero time and empty level.
+func ParseLine(s string) Line {
+	ln := Line{Text: s}
+	if strings.HasPrefix(s, "{") {
+		var rec struct {
+			Time  time.Time `json:"time"`
+			Level string    `json:"level"`
+		}
+		if err := json.Unmarshal([]byte(s), &rec); err == nil {
+			ln.Time = rec.Time
+			ln.Level = normalizeLevel(rec.Level)
+		}
+		return ln
+	}
+	// slog's text handler always writes time= and level= as the first two fields
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields) && i < 2; i++ {
+		key, val, _ := strings.Cut(fields[i], "=")
+		switch key {
+		case "time":
+			if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+				ln.Time = t
+			}
+		case "level":
+			ln.Level = normalizeLevel(val)
+		}
+	}
+	return ln
+}
+
+// ParseSince accepts either a duration relative to now (e.g. 1h, 30m) or an
+// RFC3339 timestamp. An empty string returns the zero time.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use a duration (1h, 30m) or an RFC3339 timestamp", s)
+}
+
+// ValidLevel reports whether s is empty or one of the supported level names.
+func ValidLevel(s string) bool {
+	return s == "" || levelRank(s) > 0
+}
+
+// ReadLines returns the non-empty lines of fn, decompressing .gz files.
+func ReadLines(fn string) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(fn, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if ln := strings.TrimSpace(sc.Text()); ln != "" {
+			lines = append(lines, ln)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// normalizeLevel maps slog level names (including offsets such as INFO+1) to
+// the lowercase names used in config.
+func normalizeLevel(s string) string {
+	s = strings.ToLower(strings.Trim(s, `"`))
+	if i := strings.IndexAny(s, "+-"); i > 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+func levelRank(s string) int {
+	switch normalizeLevel(s) {
+	case "debug":
+		return 1
+	case "info":
+		return 2
+	case "warn":
+		return 3
+	case "error":
+		return 4
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,185 @@
+package logs
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLogSet creates a gzip backup, a plain backup and the active file, each
+// holding lines one minute apart starting at base.
+func writeLogSet(t *testing.T, base time.Time) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	mkLines := func(start, n int) string {
+		var sb strings.Builder
+		levels := []string{"DEBUG", "INFO", "WARN", "ERROR"}
+		for i := start; i < start+n; i++ {
+			ts := base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339Nano)
+			fmt.Fprintf(&sb, "time=%s level=%s msg=\"message %d\"\n", ts, levels[i%4], i)
+		}
+		return sb.String()
+	}
+
+	gzName := filepath.Join(dir, "khedra-"+base.Add(4*time.Minute).Format(backupTimeFormat)+".log.gz")
+	f, err := os.Create(gzName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	_, _ = gz.Write([]byte(mkLines(0, 4)))
+	_ = gz.Close()
+	_ = f.Close()
+
+	plain := filepath.Join(dir, "khedra-"+base.Add(8*time.Minute).Format(backupTimeFormat)+".log")
+	_ = os.WriteFile(plain, []byte(mkLines(4, 4)), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "khedra.log"), []byte(mkLines(8, 4)), 0o644)
+	// noise that must be ignored
+	_ = os.WriteFile(filepath.Join(dir, "other.log"), []byte("junk\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "khedra-notatime.log"), []byte("junk\n"), 0o644)
+	return dir
+}
+
+func TestFilesOrder(t *testing.T) {
+	base := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	dir := writeLogSet(t, base)
+	files, err := Files(dir, "khedra.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v", files)
+	}
+	if !strings.HasSuffix(files[0], ".log.gz") || filepath.Base(files[2]) != "khedra.log" {
+		t.Fatalf("unexpected order: %v", files)
+	}
+}
+
+func TestRead(t *testing.T) {
+	base := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	dir := writeLogSet(t, base)
+
+	msgs := func(p Page) string {
+		var out []string
+		for _, l := range p.Lines {
+			out = append(out, strings.TrimSuffix(strings.SplitN(l.Text, "message ", 2)[1], `"`))
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		want string
+		more bool
+	}{
+		{name: "All lines across rotations", q: Query{}, want: "0,1,2,3,4,5,6,7,8,9,10,11"},
+		{name: "Limit keeps newest", q: Query{Limit: 3}, want: "9,10,11", more: true},
+		{name: "Since", q: Query{Since: base.Add(7 * time.Minute)}, want: "7,8,9,10,11"},
+		{name: "Until pages backwards", q: Query{Until: base.Add(9 * time.Minute), Limit: 3}, want: "6,7,8", more: true},
+		{name: "Level is a minimum", q: Query{Level: "warn"}, want: "2,3,6,7,10,11"},
+		{name: "Grep is case-insensitive", q: Query{Grep: "MESSAGE 1"}, want: "1,10,11"},
+		{name: "Combined", q: Query{Level: "error", Since: base.Add(2 * time.Minute), Limit: 2}, want: "7,11", more: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := Read(dir, "khedra.log", tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := msgs(page); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+			if page.More != tt.more {
+				t.Fatalf("expected more=%v, got %v", tt.more, page.More)
+			}
+			if page.More && page.Next != page.Lines[0].Time.Format(time.RFC3339Nano)+"~1" {
+				t.Fatalf("expected next cursor at oldest line, got %q", page.Next)
+			}
+		})
+	}
+}
+
+func TestRead_PagesThroughSharedTimestamps(t *testing.T) {
+	dir := t.TempDir()
+	var sb strings.Builder
+	stamps := []string{"03:00:00.001", "03:00:00.002", "03:00:00.002", "03:00:00.002", "03:00:00.002", "03:00:00.002", "03:00:00.003"}
+	for i, ts := range stamps {
+		fmt.Fprintf(&sb, "time=2025-01-02T%sZ level=INFO msg=\"message %d\"\n", ts, i)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "khedra.log"), []byte(sb.String()), 0o644)
+
+	now := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)
+	var got []string
+	q := Query{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > len(stamps) {
+			t.Fatal("paging does not end")
+		}
+		page, err := Read(dir, "khedra.log", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := len(page.Lines) - 1; i >= 0; i-- {
+			got = append(got, strings.TrimSuffix(strings.SplitN(page.Lines[i].Text, "message ", 2)[1], `"`))
+		}
+		if !page.More {
+			break
+		}
+		if q.Until, q.Skip, err = ParseUntil(page.Next, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "6,5,4,3,2,1,0"; strings.Join(got, ",") != want {
+		t.Fatalf("expected every line once, newest first (%s), got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestParseUntil(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	if got, skip, err := ParseUntil("2025-01-02T03:04:05.1Z~3", now); err != nil || skip != 3 || got.Second() != 5 {
+		t.Fatalf("cursor: got %v skip %d err %v", got, skip, err)
+	}
+	if got, skip, err := ParseUntil("1h", now); err != nil || skip != 0 || !got.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("duration: got %v skip %d err %v", got, skip, err)
+	}
+	if _, _, err := ParseUntil("2025-01-02T03:04:05Z~0", now); err == nil {
+		t.Fatal("expected error for a cursor that skips nothing")
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	ln := ParseLine(`time=2025-01-02T03:04:05.123Z level=INFO+1 msg="progress"`)
+	if ln.Level != "info" || ln.Time.IsZero() {
+		t.Fatalf("unexpected parse: %+v", ln)
+	}
+	js := ParseLine(`{"time":"2025-01-02T03:04:05.123Z","level":"WARN","msg":"slow","component":"rpc"}`)
+	if js.Level != "warn" || js.Time.IsZero() {
+		t.Fatalf("unexpected json parse: %+v", js)
+	}
+	junk := ParseLine("goroutine 1 [running]:")
+	if !junk.Time.IsZero() || junk.Level != "" {
+		t.Fatalf("expected unparsed line, got %+v", junk)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	if got, err := ParseSince("1h", now); err != nil || !got.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("duration: got %v err %v", got, err)
+	}
+	if got, err := ParseSince("2025-01-01T00:00:00Z", now); err != nil || got.Day() != 1 {
+		t.Fatalf("timestamp: got %v err %v", got, err)
+	}
+	if got, err := ParseSince("", now); err != nil || !got.IsZero() {
+		t.Fatalf("empty: got %v err %v", got, err)
+	}
+	if _, err := ParseSince("yesterday", now); err == nil {
+		t.Fatal("expected error for invalid value")
+	}
+}
@@ -0,0 +1,60 @@
+package logs
+
+import (
+	"os"
+	"strings"
+)
+
+// TailFile returns up to maxLines of the last non-empty lines of fn (oldest first)
+// without loading the entire file. It reads backwards from the end in fixed size
+// chunks, so it is cheap even for large log files.
+func TailFile(fn string, maxLines int) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 8 * 1024
+	pos := stat.Size()
+	var collected []string
+	rem := ""
+	for pos > 0 && len(collected) < maxLines {
+		readSize := int64(chunkSize)
+		if pos-readSize < 0 {
+			readSize = pos
+		}
+		pos -= readSize
+		buf := make([]byte, readSize)
+		if _, err := f.ReadAt(buf, pos); err != nil {
+			break
+		}
+		chunk := string(buf) + rem
+		parts := strings.Split(chunk, "\n")
+		// The first element may be partial; carry it into the next (earlier) chunk
+		rem = parts[0]
+		for i := len(parts) - 1; i >= 1 && len(collected) < maxLines; i-- {
+			if ln := strings.TrimSpace(parts[i]); ln != "" {
+				collected = append(collected, ln)
+			}
+		}
+	}
+	// Whatever remains at the very start of the file is a complete line
+	if pos == 0 && len(collected) < maxLines {
+		if ln := strings.TrimSpace(rem); ln != "" {
+			collected = append(collected, ln)
+		}
+	}
+
+	// collected is newest-first; reverse
+	out := make([]string, 0, len(collected))
+	for i := len(collected) - 1; i >= 0; i-- {
+		out = append(out, collected[i])
+	}
+	return out, nil
+}
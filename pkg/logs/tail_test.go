@@ -0,0 +1,64 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTailFile(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "khedra.log")
+
+	var sb strings.Builder
+	for i := 1; i <= 2000; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+		if i%100 == 0 {
+			sb.WriteString("\n") // blank lines are skipped
+		}
+	}
+	if err := os.WriteFile(fn, []byte(sb.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Last lines in order", func(t *testing.T) {
+		got, err := TailFile(fn, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"line 1998", "line 1999", "line 2000"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("Spans chunks", func(t *testing.T) {
+		got, err := TailFile(fn, 1500)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1500 || got[0] != "line 501" || got[1499] != "line 2000" {
+			t.Fatalf("unexpected tail: len=%d first=%q last=%q", len(got), got[0], got[len(got)-1])
+		}
+	})
+
+	t.Run("Whole small file", func(t *testing.T) {
+		small := filepath.Join(dir, "small.log")
+		_ = os.WriteFile(small, []byte("first\nsecond"), 0o644)
+		got, err := TailFile(small, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+			t.Fatalf("expected both lines, got %v", got)
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		if _, err := TailFile(filepath.Join(dir, "nope.log"), 5); err == nil {
+			t.Fatal("expected error for missing file")
+		}
+	})
+}
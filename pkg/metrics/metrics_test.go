@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTextFormat(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_requests_total", "Requests.", "path", "code")
+	g := r.NewGauge("test_head_block", "Head block.", "chain")
+	h := r.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "endpoint")
+	r.NewGauge("test_unused", "Never set.")
+
+	c.Inc("/logs", "200")
+	c.Add(2, "/logs", "200")
+	c.Inc(`/we"ird`, "404")
+	g.Set(21000000, "mainnet")
+	h.Observe(0.05, "http://a")
+	h.Observe(0.5, "http://a")
+	h.Observe(3, "http://a")
+
+	collected := 0
+	r.OnCollect(func() { collected++ })
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	want := []string{
+		"# HELP test_requests_total Requests.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{path="/logs",code="200"} 3`,
+		`test_requests_total{path="/we\"ird",code="404"} 1`,
+		"# TYPE test_head_block gauge",
+		`test_head_block{chain="mainnet"} 2.1e+07`,
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{endpoint="http://a",le="0.1"} 1`,
+		`test_latency_seconds_bucket{endpoint="http://a",le="1"} 2`,
+		`test_latency_seconds_bucket{endpoint="http://a",le="+Inf"} 3`,
+		`test_latency_seconds_sum{endpoint="http://a"} 3.55`,
+		`test_latency_seconds_count{endpoint="http://a"} 3`,
+	}
+	for _, w := range want {
+		if !strings.Contains(got, w+"\n") {
+			t.Fatalf("missing %q in:\n%s", w, got)
+		}
+	}
+	if strings.Contains(got, "test_unused") {
+		t.Fatalf("families without series should be omitted:\n%s", got)
+	}
+	if collected != 1 {
+		t.Fatalf("expected collector to run once, ran %d times", collected)
+	}
+
+	g.Reset()
+	buf.Reset()
+	_ = r.Write(&buf)
+	if strings.Contains(buf.String(), "test_head_block") {
+		t.Fatalf("expected gauge series to be cleared:\n%s", buf.String())
+	}
+}
+
+func TestRegisterTwiceReturnsSameFamily(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("x_total", "X.", "a").Inc("1")
+	r.NewCounter("x_total", "X.", "a").Inc("1")
+	if v := r.NewCounter("x_total", "X.", "a").Value("1"); v != 2 {
+		t.Fatalf("expected 2, got %v", v)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("up", "Up.").Set(1)
+	rec := httptest.NewRecorder()
+	r.Handler()(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "up 1\n") {
+		t.Fatalf("unexpected body:\n%s", rec.Body.String())
+	}
+}
+
+func TestObserveRPC(t *testing.T) {
+	ObserveRPC("https://mainnet.example.com/v3/SECRETKEY", "eth_blockNumber", time.Now(), nil)
+	ObserveRPC("https://mainnet.example.com/v3/SECRETKEY", "eth_blockNumber", time.Now(), errors.New("boom"))
+
+	var buf bytes.Buffer
+	_ = Default.Write(&buf)
+	got := buf.String()
+	if strings.Contains(got, "SECRETKEY") {
+		t.Fatalf("provider path leaked into metrics:\n%s", got)
+	}
+	if !strings.Contains(got, `khedra_rpc_request_duration_seconds_count{endpoint="https://mainnet.example.com",method="eth_blockNumber"} 2`) {
+		t.Fatalf("missing rpc histogram:\n%s", got)
+	}
+	if !strings.Contains(got, `khedra_rpc_errors_total{endpoint="https://mainnet.example.com",method="eth_blockNumber"} 1`) {
+		t.Fatalf("missing rpc error counter:\n%s", got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: Transport{Base: http.DefaultTransport}}
+
+	call := `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":[]}`
+	for _, path := range []string{"/", "/down"} {
+		resp, err := client.Post(srv.URL+path, "application/json", strings.NewReader(call))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := client.Post(srv.URL, "application/json; charset=utf-8", strings.NewReader("["+call+","+call+"]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// Not a JSON-RPC request
+	resp, err = client.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if len(bodies) != 4 || bodies[0] != call || bodies[3] != "hello" {
+		t.Fatalf("the requests must reach the node unchanged: %q", bodies)
+	}
+	var buf bytes.Buffer
+	_ = Default.Write(&buf)
+	got := buf.String()
+	for _, want := range []string{
+		`khedra_rpc_request_duration_seconds_count{endpoint="` + srv.URL + `",method="eth_getBalance"} 2`,
+		`khedra_rpc_errors_total{endpoint="` + srv.URL + `",method="eth_getBalance"} 1`,
+		`khedra_rpc_request_duration_seconds_count{endpoint="` + srv.URL + `",method="batch"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %s in:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, `_count{endpoint="`+srv.URL) != 2 {
+		t.Fatalf("only the JSON-RPC requests are recorded:\n%s", got)
+	}
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
+)
+
+var (
+	rpcDuration = Default.NewHistogram(
+		"khedra_rpc_request_duration_seconds",
+		"Latency of RPC requests made by khedra and chifra, by endpoint and method.",
+		DefBuckets, "endpoint", "method",
+	)
+	rpcErrors = Default.NewCounter(
+		"khedra_rpc_errors_total",
+		"RPC requests made by khedra and chifra that failed or got an HTTP error, by endpoint and method.",
+		"endpoint", "method",
+	)
+)
+
+// ObserveRPC records the latency (measured from start) and outcome of one RPC
+// request. The endpoint label is reduced to scheme and host so that API keys
+// embedded in provider URLs never reach the metrics output.
+func ObserveRPC(rawURL, method string, start time.Time, err error) {
+	endpoint := Endpoint(rawURL)
+	rpcDuration.Observe(time.Since(start).Seconds(), endpoint, method)
+	if err != nil {
+		rpcErrors.Inc(endpoint, method)
+	}
+}
+
+// Endpoint returns scheme://host for a provider URL, or "invalid" if it cannot
+// be parsed.
+func Endpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "invalid"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Transport records every JSON-RPC request sent through it with ObserveRPC,
+// whoever sends it: khedra, or chifra in the scraper and the API. A batch is
+// recorded as one request with the method "batch". Requests that are not JSON
+// POSTs, such as index downloads, are sent on unrecorded. A request fails if
+// it cannot be sent or is answered with an HTTP error status.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method, req, err := rpcMethod(req)
+	if err != nil {
+		return nil, err
+	}
+	if method == "" {
+		return t.Base.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	failed := err
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		failed = errors.New(resp.Status)
+	}
+	ObserveRPC(req.URL.String(), method, start, failed)
+	return resp, err
+}
+
+// rpcMethod returns the JSON-RPC method of a request, "batch" for a batch, or
+// "" if it is not a JSON POST. As it reads the body, it returns a copy of req
+// to send in its place.
+func rpcMethod(req *http.Request) (string, *http.Request, error) {
+	if req.Method != http.MethodPost || req.Body == nil || req.Body == http.NoBody {
+		return "", req, nil
+	}
+	if mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mt != "application/json" {
+		return "", req, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	out.ContentLength = int64(len(body))
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		return "batch", out, nil
+	}
+	var call struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &call) != nil || call.Method == "" {
+		return "", out, nil
+	}
+	return call.Method, out, nil
+}
+
+// PingRpc is rpc.PingRpc, which sends its eth_chainId request through
+// http.DefaultTransport and so through Transport. A ws:// or wss:// provider
+// is asked over a WebSocket, and that request is recorded here.
+func PingRpc(providerUrl string) (*rpc.PingResult, error) {
+	if !wsrpc.IsWebSocket(providerUrl) {
+		return rpc.PingRpc(providerUrl)
+	}
+	start := time.Now()
+	res, err := pingWebSocket(providerUrl)
+	ObserveRPC(providerUrl, "eth_chainId", start, err)
+	return res, err
+}
+
+// pingWebSocket is rpc.PingRpc for a WebSocket provider.
+func pingWebSocket(providerUrl string) (*rpc.PingResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+	start := time.Now()
+	res := &rpc.PingResult{URL: providerUrl, Mode: "json", CheckedAt: start.Unix()}
+	chainID, err := wsrpc.Ping(ctx, providerUrl)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = err.Error()
+		return res, err
+	}
+	res.ChainID, res.OK = chainID, true
+	return res, nil
+}
@@ -16,11 +16,13 @@ const (
 	// Prefixes
 	PrefixChains   = "TB_KHEDRA_CHAINS_"
 	PrefixServices = "TB_KHEDRA_SERVICES_"
+	PrefixLogComps = "TB_KHEDRA_LOGGING_COMPONENTS_"
 
 	// General Keys
 	KeyDataFolder = "TB_KHEDRA_GENERAL_DATAFOLDER"
 	KeyStrategy   = "TB_KHEDRA_GENERAL_STRATEGY"
 	KeyDetail     = "TB_KHEDRA_GENERAL_DETAIL"
+	KeyMirror     = "TB_KHEDRA_GENERAL_BOOTSTRAPMIRROR"
 
 	// Logging Keys
 	KeyLoggingFolder     = "TB_KHEDRA_LOGGING_FOLDER"
@@ -30,6 +32,21 @@ const (
 	KeyLoggingMaxBackups = "TB_KHEDRA_LOGGING_MAXBACKUPS"
 	KeyLoggingMaxAge     = "TB_KHEDRA_LOGGING_MAXAGE"
 	KeyLoggingCompress   = "TB_KHEDRA_LOGGING_COMPRESS"
+	KeyLoggingLevel      = "TB_KHEDRA_LOGGING_LEVEL"
+	KeyLoggingScreenFmt  = "TB_KHEDRA_LOGGING_SCREENFORMAT"
+	KeyLoggingFileFmt    = "TB_KHEDRA_LOGGING_FILEFORMAT"
+
+	// Audit Log Keys
+	KeyAuditFilename   = "TB_KHEDRA_LOGGING_AUDIT_FILENAME"
+	KeyAuditMaxSize    = "TB_KHEDRA_LOGGING_AUDIT_MAXSIZE"
+	KeyAuditMaxBackups = "TB_KHEDRA_LOGGING_AUDIT_MAXBACKUPS"
+	KeyAuditMaxAge     = "TB_KHEDRA_LOGGING_AUDIT_MAXAGE"
+	KeyAuditCompress   = "TB_KHEDRA_LOGGING_AUDIT_COMPRESS"
+
+	// Cache Keys
+	KeyCacheMaxSize      = "TB_KHEDRA_CACHE_MAXSIZE"
+	KeyCacheMaxChainSize = "TB_KHEDRA_CACHE_MAXCHAINSIZE"
+	KeyCacheMaxAge       = "TB_KHEDRA_CACHE_MAXAGE"
 )
 
 const (
@@ -160,6 +177,8 @@ func applyEnv(keys []string, receiver *Config) error {
 			receiver.General.Strategy = envValue
 		case key == KeyDetail:
 			receiver.General.Detail = envValue
+		case key == KeyMirror:
+			receiver.General.BootstrapMirror = envValue
 
 		// Logging settings
 		case key == KeyLoggingFolder:
@@ -196,6 +215,65 @@ func applyEnv(keys []string, receiver *Config) error {
 				return err
 			}
 			receiver.Logging.Compress = compress
+		case key == KeyLoggingLevel:
+			receiver.Logging.Level = envValue
+		case key == KeyLoggingScreenFmt:
+			receiver.Logging.ScreenFormat = envValue
+		case key == KeyLoggingFileFmt:
+			receiver.Logging.FileFormat = envValue
+		case key == KeyAuditFilename:
+			receiver.Logging.Audit.Filename = envValue
+		case key == KeyAuditMaxSize:
+			size, err := strconv.Atoi(envValue)
+			if err := validateValueParsing(key, err); err != nil {
+				return err
+			}
+			receiver.Logging.Audit.MaxSize = size
+		case key == KeyAuditMaxBackups:
+			backups, err := strconv.Atoi(envValue)
+			if err := validateValueParsing(key, err); err != nil {
+				return err
+			}
+			receiver.Logging.Audit.MaxBackups = backups
+		case key == KeyAuditMaxAge:
+			age, err := strconv.Atoi(envValue)
+			if err := validateValueParsing(key, err); err != nil {
+				return err
+			}
+			receiver.Logging.Audit.MaxAge = age
+		case key == KeyAuditCompress:
+			compress, err := strconv.ParseBool(envValue)
+			if err := validateValueParsing(key, err); err != nil {
+				return err
+			}
+			receiver.Logging.Audit.Compress = compress
+		case key == KeyCacheMaxSize, key == KeyCacheMaxChainSize, key == KeyCacheMaxAge:
+			n, err := strconv.Atoi(envValue)
+			if err := validateValueParsing(key, err); err != nil {
+				return err
+			}
+			switch key {
+			case KeyCacheMaxSize:
+				receiver.Cache.MaxSize = n
+			case KeyCacheMaxChainSize:
+				receiver.Cache.MaxChainSize = n
+			case KeyCacheMaxAge:
+				receiver.Cache.MaxAge = n
+			}
+		case strings.HasPrefix(key, PrefixLogComps):
+			comps := &receiver.Logging.Components
+			switch strings.ToLower(strings.TrimPrefix(key, PrefixLogComps)) {
+			case ComponentControl:
+				comps.Control = envValue
+			case ComponentScraper:
+				comps.Scraper = envValue
+			case ComponentMonitor:
+				comps.Monitor = envValue
+			case ComponentInstall:
+				comps.Install = envValue
+			case ComponentRpc:
+				comps.Rpc = envValue
+			}
 
 		// Chains
 		case strings.HasPrefix(key, PrefixChains):
@@ -130,6 +130,49 @@ func TestApplyEnv(t *testing.T) {
 	}
 	t.Run("Partial Logging Update", func(t *testing.T) { partialLoggingUpdate() })
 
+	loggingFormatsAndComponents := func() {
+		defer setEnv(map[string]string{
+			"TB_KHEDRA_LOGGING_LEVEL":          "warn",
+			"TB_KHEDRA_LOGGING_SCREENFORMAT":   "text",
+			"TB_KHEDRA_LOGGING_FILEFORMAT":     "json",
+			"TB_KHEDRA_LOGGING_COMPONENTS_RPC": "debug",
+		})()
+
+		cfg := Config{
+			Chains:   map[string]Chain{},
+			Services: map[string]Service{},
+			Logging:  Logging{Level: "info"},
+		}
+
+		keys := getEnvironmentKeys(cfg, InEnv)
+		err := applyEnv(keys, &cfg)
+		assert.NoError(t, err)
+
+		expected := Logging{
+			Level:        "warn",
+			ScreenFormat: "text",
+			FileFormat:   "json",
+			Components:   ComponentLevels{Rpc: "debug"},
+		}
+		assert.Equal(t, expected, cfg.Logging)
+	}
+	t.Run("Logging Formats And Components", func(t *testing.T) { loggingFormatsAndComponents() })
+
+	cacheLimits := func() {
+		defer setEnv(map[string]string{
+			"TB_KHEDRA_CACHE_MAXSIZE":      "20000",
+			"TB_KHEDRA_CACHE_MAXCHAINSIZE": "5000",
+			"TB_KHEDRA_CACHE_MAXAGE":       "14",
+		})()
+
+		cfg := NewConfig()
+		keys := getEnvironmentKeys(cfg, InEnv)
+		err := applyEnv(keys, &cfg)
+		assert.NoError(t, err)
+		assert.Equal(t, Cache{MaxSize: 20000, MaxChainSize: 5000, MaxAge: 14}, cfg.Cache)
+	}
+	t.Run("Cache Limits", func(t *testing.T) { cacheLimits() })
+
 	invalidBoolean := func() {
 		defer setEnv(map[string]string{
 			"TB_KHEDRA_CHAINS_MAINNET_ENABLED": "not_a_bool",
@@ -0,0 +1,18 @@
+package types
+
+// Cache limits the size of chifra's cache (Config.CachePath). When a limit is
+// exceeded the daemon removes the least recently used files first. Zero
+// values mean no limit.
+type Cache struct {
+	// MaxSize is the most the whole cache may hold, in megabytes.
+	MaxSize int `koanf:"maxSize" yaml:"maxSize,omitempty" json:"maxSize,omitempty" validate:"omitempty,min=0"`
+	// MaxChainSize is the most any one chain's cache may hold, in megabytes.
+	MaxChainSize int `koanf:"maxChainSize" yaml:"maxChainSize,omitempty" json:"maxChainSize,omitempty" validate:"omitempty,min=0"`
+	// MaxAge is how many days a file may go unused before it is removed.
+	MaxAge int `koanf:"maxAge" yaml:"maxAge,omitempty" json:"maxAge,omitempty" validate:"omitempty,min=0"`
+}
+
+// Limited reports whether any limit is set.
+func (c Cache) Limited() bool {
+	return c.MaxSize > 0 || c.MaxChainSize > 0 || c.MaxAge > 0
+}
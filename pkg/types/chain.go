@@ -1,14 +1,59 @@
 package types
 
 import (
-	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/utils"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/chains"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
 )
 
 type Chain struct {
-	Name    string   `koanf:"name" yaml:"name" json:"name,omitempty" validate:"req_if_enabled"`                 // Must be non-empty
-	RPCs    []string `koanf:"rpcs" yaml:"rpcs" json:"rpcs,omitempty" validate:"req_if_enabled,dive,strict_url"` // Must have at least one reachable RPC URL
-	ChainID int      `koanf:"chainId" yaml:"chainId" json:"chainId,omitempty" validate:"non_zero"`              // Must be non-zero
-	Enabled bool     `koanf:"enabled" yaml:"enabled" json:"enabled,omitempty"`                                  // Defaults to false if not specified
+	Name    string      `koanf:"name" yaml:"name" json:"name,omitempty" validate:"req_if_enabled"`                 // Must be non-empty
+	RPCs    []string    `koanf:"rpcs" yaml:"rpcs" json:"rpcs,omitempty" validate:"req_if_enabled,dive,strict_url"` // Must have at least one reachable RPC URL
+	ChainID int         `koanf:"chainId" yaml:"chainId" json:"chainId,omitempty" validate:"non_zero"`              // Must be non-zero
+	Enabled bool        `koanf:"enabled" yaml:"enabled" json:"enabled,omitempty"`                                  // Defaults to false if not specified
+	Budgets []RPCBudget `koanf:"budgets" yaml:"budgets,omitempty" json:"budgets,omitempty"`                        // Optional limits on what khedra sends to each RPC
+}
+
+// RPCBudget limits the requests khedra sends to one of a chain's RPCs. Zero
+// values mean no limit.
+type RPCBudget struct {
+	RPC        string  `koanf:"rpc" yaml:"rpc" json:"rpc"`                                          // One of the chain's RPCs
+	MaxRPS     float64 `koanf:"maxRps" yaml:"maxRps,omitempty" json:"maxRps,omitempty"`             // Requests per second
+	Burst      int     `koanf:"burst" yaml:"burst,omitempty" json:"burst,omitempty"`                // Requests allowed at once; defaults to MaxRPS rounded up
+	DailyQuota int64   `koanf:"dailyQuota" yaml:"dailyQuota,omitempty" json:"dailyQuota,omitempty"` // Requests per day (UTC)
+}
+
+// Budget returns the budget set for rpc, if any.
+func (ch Chain) Budget(rpc string) (RPCBudget, bool) {
+	for _, b := range ch.Budgets {
+		if b.RPC == rpc {
+			return b, true
+		}
+	}
+	return RPCBudget{}, false
+}
+
+// HttpRPCs returns the chain's http:// and https:// RPCs, the ones chifra
+// scrapes through.
+func (ch Chain) HttpRPCs() []string {
+	var rpcs []string
+	for _, rpc := range ch.RPCs {
+		if !wsrpc.IsWebSocket(rpc) {
+			rpcs = append(rpcs, rpc)
+		}
+	}
+	return rpcs
+}
+
+// WebSocketRPCs returns the chain's ws:// and wss:// RPCs. Khedra only
+// listens to them for new blocks.
+func (ch Chain) WebSocketRPCs() []string {
+	var rpcs []string
+	for _, rpc := range ch.RPCs {
+		if wsrpc.IsWebSocket(rpc) {
+			rpcs = append(rpcs, rpc)
+		}
+	}
+	return rpcs
 }
 
 func NewChain(chain string, chainId int) Chain {
@@ -25,17 +70,15 @@ func (ch Chain) IsEnabled() bool {
 }
 
 func (cc Chain) Symbol() string {
-	if item := utils.GetChainListItem("~/.khedra", cc.ChainID); item != nil {
-		return item.NativeCurrency.Symbol
+	if info, ok := chains.ByID(cc.ChainID); ok && info.Symbol != "" {
+		return info.Symbol
 	}
 	return "Unknown"
 }
 
 func (cc Chain) RemoteExplorer() string {
-	if item := utils.GetChainListItem("~/.khedra", cc.ChainID); item != nil {
-		if len(item.Explorers) > 0 {
-			return item.Explorers[0].URL
-		}
+	if info, ok := chains.ByID(cc.ChainID); ok && info.Explorer() != "" {
+		return info.Explorer()
 	}
 	return "Unknown"
 }
@@ -21,6 +21,7 @@ type Config struct {
 	Chains   map[string]Chain   `koanf:"chains" validate:"dive"`
 	Services map[string]Service `koanf:"services" validate:"dive"`
 	Logging  Logging            `koanf:"logging" validate:"dive"`
+	Cache    Cache              `koanf:"cache"`
 }
 
 func NewConfig() Config {
@@ -199,6 +200,9 @@ general:
   dataFolder: "{{ .General.DataFolder }}"
   strategy: "{{ .General.Strategy }}"
   detail: "{{ .General.Detail }}"
+{{- if .General.BootstrapMirror }}
+  bootstrapMirror: "{{ .General.BootstrapMirror }}"
+{{- end }}
 
 chains:
 {{- range $key, $value := .Chains }}
@@ -210,6 +214,15 @@ chains:
 {{- end }}
     enabled: {{ $value.Enabled }}
     chainId: {{ $value.ChainID }}
+{{- if $value.Budgets }}
+    budgets:
+{{- range $b := $value.Budgets }}
+      - rpc: "{{ $b.RPC }}"
+        maxRps: {{ $b.MaxRPS }}
+        burst: {{ $b.Burst }}
+        dailyQuota: {{ $b.DailyQuota }}
+{{- end }}
+{{- end }}
 {{- end }}
 
 services:
@@ -231,6 +244,31 @@ logging:
   maxAge: {{ .Logging.MaxAge }}
   compress: {{ .Logging.Compress }}
   level: "{{ .Logging.Level }}"
+{{- if .Logging.ScreenFormat }}
+  screenFormat: "{{ .Logging.ScreenFormat }}"
+{{- end }}
+{{- if .Logging.FileFormat }}
+  fileFormat: "{{ .Logging.FileFormat }}"
+{{- end }}
+{{- with .Logging.Components.Map }}
+  components:
+{{- range $key, $value := . }}
+    {{ $key }}: "{{ $value }}"
+{{- end }}
+{{- end }}
+  audit:
+    filename: "{{ .Logging.Audit.Resolved.Filename }}"
+    maxSize: {{ .Logging.Audit.Resolved.MaxSize }}
+    maxBackups: {{ .Logging.Audit.Resolved.MaxBackups }}
+    maxAge: {{ .Logging.Audit.Resolved.MaxAge }}
+    compress: {{ .Logging.Audit.Compress }}
+{{- if .Cache.Limited }}
+
+cache:
+  maxSize: {{ .Cache.MaxSize }}
+  maxChainSize: {{ .Cache.MaxChainSize }}
+  maxAge: {{ .Cache.MaxAge }}
+{{- end }}
 `
 
 // ConfigTemplate returns the YAML template for the config file.
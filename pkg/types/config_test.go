@@ -229,3 +229,43 @@ func TestConfig_WriteToFile_PathCleaning(t *testing.T) {
 		t.Fatalf("expected cleaned logs folder path %s in output:\n%s", cleanedLogs, content)
 	}
 }
+
+// The cache section is written only when a limit is set
+func TestConfig_WriteToFile_Cache(t *testing.T) {
+	cfg := NewConfig()
+	fn := filepath.Join(t.TempDir(), "out.yaml")
+	if err := cfg.WriteToFile(fn); err != nil {
+		t.Fatalf("WriteToFile error: %v", err)
+	}
+	if bytes, _ := os.ReadFile(fn); strings.Contains(string(bytes), "cache:") {
+		t.Fatalf("unexpected cache section without limits:\n%s", bytes)
+	}
+
+	cfg.Cache = Cache{MaxSize: 50000, MaxAge: 30}
+	if err := cfg.WriteToFile(fn); err != nil {
+		t.Fatalf("WriteToFile error: %v", err)
+	}
+	bytes, _ := os.ReadFile(fn)
+	content := string(bytes)
+	if !strings.Contains(content, "cache:\n  maxSize: 50000\n  maxAge: 30\n") {
+		t.Fatalf("expected the cache limits in output:\n%s", content)
+	}
+}
+
+func TestConfig_WriteToFile_Budgets(t *testing.T) {
+	cfg := NewConfig()
+	ch := cfg.Chains["mainnet"]
+	ch.RPCs = []string{"https://paid.example/key", "https://free.example"}
+	ch.Budgets = []RPCBudget{{RPC: "https://paid.example/key", MaxRPS: 2.5, DailyQuota: 100000}}
+	cfg.Chains["mainnet"] = ch
+
+	fn := filepath.Join(t.TempDir(), "out.yaml")
+	if err := cfg.WriteToFile(fn); err != nil {
+		t.Fatalf("WriteToFile error: %v", err)
+	}
+	bytes, _ := os.ReadFile(fn)
+	want := "    budgets:\n      - rpc: \"https://paid.example/key\"\n        maxRps: 2.5\n        dailyQuota: 100000\n"
+	if !strings.Contains(string(bytes), want) {
+		t.Fatalf("expected the budget in output:\n%s", bytes)
+	}
+}
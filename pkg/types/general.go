@@ -13,6 +13,9 @@ type General struct {
 	DataFolder string `koanf:"dataFolder" yaml:"dataFolder" json:"dataFolder,omitempty" validate:"required,folder_exists"`
 	Strategy   string `koanf:"strategy" yaml:"strategy" json:"strategy,omitempty" validate:"oneof=download scratch"`
 	Detail     string `koanf:"detail" yaml:"detail" json:"detail,omitempty" validate:"oneof=index bloom"`
+	// BootstrapMirror is a folder or http(s) base URL holding <chain>/allocs.csv,
+	// used before the bundled copies and GitHub.
+	BootstrapMirror string `koanf:"bootstrapMirror" yaml:"bootstrapMirror,omitempty" json:"bootstrapMirror,omitempty"`
 }
 
 func NewGeneral() General {
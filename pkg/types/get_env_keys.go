@@ -24,6 +24,7 @@ func getEnvironmentKeys(inputStruct interface{}, kt KeyType) []string {
 	skip := func(key string) bool {
 		filters := []string{
 			"_NAME",
+			"_BUDGETS", // a list of settings, only in config.yaml
 			"_API_BATCHSIZE",
 			"_API_SLEEP",
 			"_IPFS_BATCHSIZE",
@@ -18,6 +18,7 @@ func TestGetEnvironmentKeys(t *testing.T) {
 			"TB_KHEDRA_GENERAL_DATAFOLDER",
 			"TB_KHEDRA_GENERAL_STRATEGY",
 			"TB_KHEDRA_GENERAL_DETAIL",
+			"TB_KHEDRA_GENERAL_BOOTSTRAPMIRROR",
 			"TB_KHEDRA_CHAINS_MAINNET_ENABLED",
 			"TB_KHEDRA_CHAINS_MAINNET_RPCS",
 			"TB_KHEDRA_CHAINS_MAINNET_CHAINID",
@@ -29,6 +30,21 @@ func TestGetEnvironmentKeys(t *testing.T) {
 			"TB_KHEDRA_LOGGING_MAXAGE",
 			"TB_KHEDRA_LOGGING_MAXBACKUPS",
 			"TB_KHEDRA_LOGGING_MAXSIZE",
+			"TB_KHEDRA_LOGGING_SCREENFORMAT",
+			"TB_KHEDRA_LOGGING_FILEFORMAT",
+			"TB_KHEDRA_LOGGING_COMPONENTS_CONTROL",
+			"TB_KHEDRA_LOGGING_COMPONENTS_SCRAPER",
+			"TB_KHEDRA_LOGGING_COMPONENTS_MONITOR",
+			"TB_KHEDRA_LOGGING_COMPONENTS_INSTALL",
+			"TB_KHEDRA_LOGGING_COMPONENTS_RPC",
+			"TB_KHEDRA_LOGGING_AUDIT_FILENAME",
+			"TB_KHEDRA_LOGGING_AUDIT_MAXSIZE",
+			"TB_KHEDRA_LOGGING_AUDIT_MAXBACKUPS",
+			"TB_KHEDRA_LOGGING_AUDIT_MAXAGE",
+			"TB_KHEDRA_LOGGING_AUDIT_COMPRESS",
+			"TB_KHEDRA_CACHE_MAXSIZE",
+			"TB_KHEDRA_CACHE_MAXCHAINSIZE",
+			"TB_KHEDRA_CACHE_MAXAGE",
 			"TB_KHEDRA_SERVICES_API_ENABLED",
 			"TB_KHEDRA_SERVICES_API_PORT",
 			"TB_KHEDRA_SERVICES_IPFS_ENABLED",
@@ -0,0 +1,252 @@
+package types
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Components lists the component names that accept level overrides.
+var Components = []string{ComponentControl, ComponentScraper, ComponentMonitor, ComponentInstall, ComponentRpc}
+
+// IsValidComponent reports whether name is one of Components.
+func IsValidComponent(name string) bool {
+	for _, c := range Components {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidLevel reports whether level is one of debug, info, warn or error.
+func IsValidLevel(level string) bool {
+	switch level {
+	case "debug", "info", "warn", "error":
+		return true
+	}
+	return false
+}
+
+// LevelSetting describes the level in effect for the global logger (Component
+// empty) or for one component override.
+type LevelSetting struct {
+	Component string    `json:"component,omitempty"`
+	Level     string    `json:"level"`
+	Expires   time.Time `json:"expires,omitzero"`
+}
+
+// levelState holds the levels shared by every handler derived from one
+// CustomLogger so they can be changed while the daemon is running.
+type levelState struct {
+	global slog.LevelVar
+
+	mu      sync.RWMutex
+	levels  map[string]slog.Level
+	reverts map[string]*levelRevert
+}
+
+// levelRevert is a pending return to a previous setting after a timed change.
+type levelRevert struct {
+	timer   *time.Timer
+	expires time.Time
+	level   string // empty means no override (components only)
+}
+
+func newLevelState(global slog.Level, levels map[string]slog.Level) *levelState {
+	s := &levelState{
+		levels:  levels,
+		reverts: map[string]*levelRevert{},
+	}
+	s.global.Set(global)
+	return s
+}
+
+func (s *levelState) threshold(component string) slog.Level {
+	if component != "" {
+		s.mu.RLock()
+		lvl, ok := s.levels[component]
+		s.mu.RUnlock()
+		if ok {
+			return lvl
+		}
+	}
+	return s.global.Level()
+}
+
+// lowest returns the lowest level any record could be accepted at.
+func (s *levelState) lowest() slog.Level {
+	lvl := s.global.Level()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, l := range s.levels {
+		if l < lvl {
+			lvl = l
+		}
+	}
+	return lvl
+}
+
+// current returns the level name for the global logger or a component. The
+// second return is false for a component without an override.
+func (s *levelState) current(component string) (string, bool) {
+	if component == "" {
+		return strings.ToLower(s.global.Level().String()), true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	lvl, ok := s.levels[component]
+	return strings.ToLower(lvl.String()), ok
+}
+
+// apply sets (or, for a component with an empty level, clears) a level.
+func (s *levelState) apply(component, level string) {
+	if component == "" {
+		s.global.Set(convertLevel(level))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if level == "" {
+		delete(s.levels, component)
+	} else {
+		s.levels[component] = convertLevel(level)
+	}
+}
+
+// reset sets the levels to a config's, global and components, dropping the
+// overrides it does not name. A level under a timed change keeps it and
+// reverts to the config's level instead.
+func (s *levelState) reset(global string, levels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.reverts[""]; ok {
+		r.level = global
+	} else {
+		s.global.Set(convertLevel(global))
+	}
+	for name := range s.levels {
+		if _, ok := levels[name]; !ok && s.reverts[name] == nil {
+			delete(s.levels, name)
+		}
+	}
+	for name, r := range s.reverts {
+		if name != "" {
+			r.level = levels[name]
+		}
+	}
+	for name, level := range levels {
+		if s.reverts[name] == nil {
+			s.levels[name] = convertLevel(level)
+		}
+	}
+}
+
+func (s *levelState) settings() []LevelSetting {
+	lvl, _ := s.current("")
+	ret := []LevelSetting{{Level: lvl}}
+
+	s.mu.RLock()
+	for name, l := range s.levels {
+		ret = append(ret, LevelSetting{Component: name, Level: strings.ToLower(l.String())})
+	}
+	for i := range ret {
+		if r, ok := s.reverts[ret[i].Component]; ok {
+			ret[i].Expires = r.expires
+		}
+	}
+	s.mu.RUnlock()
+
+	comps := ret[1:]
+	sort.Slice(comps, func(i, j int) bool { return comps[i].Component < comps[j].Component })
+	return ret
+}
+
+// LogLevels returns the global level followed by any component overrides.
+func (c *CustomLogger) LogLevels() []LevelSetting {
+	return c.levels.settings()
+}
+
+// SetLogLevel changes the level of the running logger. An empty component
+// changes the global level. For a component, an empty level removes its
+// override. If d is positive the previous setting is restored after d. Every
+// change, including the revert, is logged.
+func (c *CustomLogger) SetLogLevel(component, level string, d time.Duration) error {
+	if component != "" && !IsValidComponent(component) {
+		return fmt.Errorf("invalid component %q (use one of %s)", component, strings.Join(Components, ", "))
+	}
+	if !IsValidLevel(level) && (component == "" || level != "") {
+		return fmt.Errorf("invalid level %q (use debug, info, warn or error)", level)
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid duration %s", d)
+	}
+
+	s := c.levels
+	prev, hadPrev := s.current(component)
+	if !hadPrev {
+		prev = ""
+	}
+
+	s.mu.Lock()
+	pending := s.reverts[component]
+	if pending != nil {
+		pending.timer.Stop()
+		delete(s.reverts, component)
+	}
+	if d > 0 {
+		// A timed change made on top of another keeps the original target.
+		target := prev
+		if pending != nil {
+			target = pending.level
+		}
+		r := &levelRevert{expires: time.Now().Add(d), level: target}
+		r.timer = time.AfterFunc(d, func() { c.revertLogLevel(component, r) })
+		s.reverts[component] = r
+	}
+	s.mu.Unlock()
+
+	s.apply(component, level)
+	args := []any{"from", displayLevel(prev), "to", displayLevel(level)}
+	if component != "" {
+		args = append(args, "target", component)
+	}
+	if d > 0 {
+		args = append(args, "for", d.String())
+	}
+	c.changes.Info("log level changed", args...)
+	return nil
+}
+
+func (c *CustomLogger) revertLogLevel(component string, r *levelRevert) {
+	s := c.levels
+	s.mu.Lock()
+	if s.reverts[component] != r {
+		// superseded by a later change
+		s.mu.Unlock()
+		return
+	}
+	delete(s.reverts, component)
+	s.mu.Unlock()
+
+	prev, hadPrev := s.current(component)
+	if !hadPrev {
+		prev = ""
+	}
+	s.apply(component, r.level)
+	args := []any{"from", displayLevel(prev), "to", displayLevel(r.level)}
+	if component != "" {
+		args = append(args, "target", component)
+	}
+	c.changes.Info("log level reverted", args...)
+}
+
+func displayLevel(level string) string {
+	if level == "" {
+		return "default"
+	}
+	return level
+}
@@ -0,0 +1,124 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func newFileOnlyLogger(t *testing.T, logging Logging) (*CustomLogger, func() string) {
+	t.Helper()
+	dir := t.TempDir()
+	logging.Folder = dir
+	logging.Filename = "test.log"
+	logging.MaxSize, logging.MaxBackups, logging.MaxAge = 5, 1, 1
+
+	// keep the screen output out of the test log
+	origStderr := os.Stderr
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	t.Cleanup(func() { devNull.Close() })
+	os.Stderr = devNull
+	logger := NewLogger(logging)
+	os.Stderr = origStderr
+
+	read := func() string {
+		data, _ := os.ReadFile(filepath.Join(dir, "test.log"))
+		return string(data)
+	}
+	return logger, read
+}
+
+func TestSetLogLevel_Global(t *testing.T) {
+	logger, read := newFileOnlyLogger(t, Logging{Level: "error"})
+
+	logger.Info("before change")
+	assert.NoError(t, logger.SetLogLevel("", "debug", 0))
+	logger.Debug("after change")
+
+	out := read()
+	assert.NotContains(t, out, "before change")
+	assert.Contains(t, out, "after change")
+	// the change is recorded even though the original level was error
+	assert.Contains(t, out, `msg="log level changed" from=error to=debug`)
+	assert.Equal(t, []LevelSetting{{Level: "debug"}}, logger.LogLevels())
+}
+
+func TestSetLogLevel_Component(t *testing.T) {
+	logger, read := newFileOnlyLogger(t, Logging{Level: "warn"})
+
+	assert.NoError(t, logger.SetLogLevel(ComponentRpc, "debug", 0))
+	logger.Component(ComponentRpc).Debug("rpc debug")
+	logger.Component(ComponentScraper).Info("scraper info")
+
+	assert.Equal(t, []LevelSetting{{Level: "warn"}, {Component: ComponentRpc, Level: "debug"}}, logger.LogLevels())
+
+	assert.NoError(t, logger.SetLogLevel(ComponentRpc, "", 0))
+	logger.Component(ComponentRpc).Debug("rpc after clear")
+
+	out := read()
+	assert.Contains(t, out, "rpc debug")
+	assert.NotContains(t, out, "scraper info")
+	assert.NotContains(t, out, "rpc after clear")
+	assert.Contains(t, out, "from=debug to=default target=rpc")
+	assert.Equal(t, 1, len(logger.LogLevels()))
+}
+
+func TestSetLogLevel_Expires(t *testing.T) {
+	logger, read := newFileOnlyLogger(t, Logging{Level: "info"})
+
+	assert.NoError(t, logger.SetLogLevel("", "debug", 30*time.Millisecond))
+	// a second timed change keeps the original level as its revert target
+	assert.NoError(t, logger.SetLogLevel("", "warn", 50*time.Millisecond))
+	levels := logger.LogLevels()
+	assert.Equal(t, "warn", levels[0].Level)
+	assert.False(t, levels[0].Expires.IsZero())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for logger.LogLevels()[0].Level != "info" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	levels = logger.LogLevels()
+	assert.Equal(t, "info", levels[0].Level)
+	assert.True(t, levels[0].Expires.IsZero())
+	assert.Equal(t, 1, strings.Count(read(), "log level reverted"))
+}
+
+func TestReload(t *testing.T) {
+	logger, read := newFileOnlyLogger(t, Logging{Level: "info", Components: ComponentLevels{Rpc: "debug"}})
+	scraper := logger.Component(ComponentScraper)
+
+	assert.NoError(t, logger.SetLogLevel(ComponentMonitor, "debug", 50*time.Millisecond))
+	reloaded := logger.Reload(Logging{Level: "warn", Folder: t.TempDir(), Filename: "test.log", Components: ComponentLevels{Scraper: "debug"}})
+
+	// the new config's levels reach loggers handed out before the reload
+	scraper.Debug("scraper debug")
+	assert.Contains(t, read(), "scraper debug")
+	assert.Equal(t, []LevelSetting{{Level: "warn"}, {Component: ComponentMonitor, Level: "debug"}, {Component: ComponentScraper, Level: "debug"}}, clearExpires(reloaded.LogLevels()))
+	assert.Equal(t, logger.LogLevels(), reloaded.LogLevels())
+
+	// the timed change survives and then reverts to the new config
+	deadline := time.Now().Add(2 * time.Second)
+	for len(reloaded.LogLevels()) > 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, []LevelSetting{{Level: "warn"}, {Component: ComponentScraper, Level: "debug"}}, reloaded.LogLevels())
+}
+
+func clearExpires(levels []LevelSetting) []LevelSetting {
+	for i := range levels {
+		levels[i].Expires = time.Time{}
+	}
+	return levels
+}
+
+func TestSetLogLevel_Invalid(t *testing.T) {
+	logger, _ := newFileOnlyLogger(t, Logging{Level: "info"})
+	assert.Error(t, logger.SetLogLevel("", "loud", 0))
+	assert.Error(t, logger.SetLogLevel("", "", 0))
+	assert.Error(t, logger.SetLogLevel("database", "debug", 0))
+	assert.Error(t, logger.SetLogLevel("", "debug", -time.Second))
+}
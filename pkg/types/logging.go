@@ -15,14 +15,102 @@ import (
 )
 
 type Logging struct {
-	Folder     string `koanf:"folder" json:"folder,omitempty" validate:"required,folder_exists"`
-	Filename   string `koanf:"filename" json:"filename,omitempty" validate:"required,endswith=.log"`
-	ToFile     bool   `koanf:"toFile" json:"toFile,omitempty"`
-	MaxSize    int    `koanf:"maxSize" yaml:"maxSize" json:"maxSize,omitempty" validate:"required,min=5"`
-	MaxBackups int    `koanf:"maxBackups" yaml:"maxBackups" json:"maxBackups,omitempty" validate:"required,min=1"`
-	MaxAge     int    `koanf:"maxAge" yaml:"maxAge" json:"maxAge,omitempty" validate:"required,min=1"`
-	Compress   bool   `koanf:"compress" json:"compress,omitempty"`
-	Level      string `koanf:"level" yaml:"level" json:"level,omitempty" validate:"oneof=debug info warn error"`
+	Folder       string          `koanf:"folder" json:"folder,omitempty" validate:"required,folder_exists"`
+	Filename     string          `koanf:"filename" json:"filename,omitempty" validate:"required,endswith=.log"`
+	ToFile       bool            `koanf:"toFile" json:"toFile,omitempty"`
+	MaxSize      int             `koanf:"maxSize" yaml:"maxSize" json:"maxSize,omitempty" validate:"required,min=5"`
+	MaxBackups   int             `koanf:"maxBackups" yaml:"maxBackups" json:"maxBackups,omitempty" validate:"required,min=1"`
+	MaxAge       int             `koanf:"maxAge" yaml:"maxAge" json:"maxAge,omitempty" validate:"required,min=1"`
+	Compress     bool            `koanf:"compress" json:"compress,omitempty"`
+	Level        string          `koanf:"level" yaml:"level" json:"level,omitempty" validate:"oneof=debug info warn error"`
+	ScreenFormat string          `koanf:"screenFormat" yaml:"screenFormat,omitempty" json:"screenFormat,omitempty" validate:"omitempty,oneof=text json"`
+	FileFormat   string          `koanf:"fileFormat" yaml:"fileFormat,omitempty" json:"fileFormat,omitempty" validate:"omitempty,oneof=text json"`
+	Components   ComponentLevels `koanf:"components" yaml:"components,omitempty" json:"components,omitempty"`
+	Audit        AuditLog        `koanf:"audit" yaml:"audit,omitempty" json:"audit,omitempty"`
+}
+
+// AuditLog configures the JSONL record of control actions, kept in
+// Logging.Folder and rotated independently of the main log. Zero values fall
+// back to the defaults in NewLogging.
+type AuditLog struct {
+	Filename   string `koanf:"filename" yaml:"filename,omitempty" json:"filename,omitempty" validate:"omitempty,endswith=.jsonl"`
+	MaxSize    int    `koanf:"maxSize" yaml:"maxSize,omitempty" json:"maxSize,omitempty" validate:"omitempty,min=1"`
+	MaxBackups int    `koanf:"maxBackups" yaml:"maxBackups,omitempty" json:"maxBackups,omitempty" validate:"omitempty,min=0"`
+	MaxAge     int    `koanf:"maxAge" yaml:"maxAge,omitempty" json:"maxAge,omitempty" validate:"omitempty,min=0"`
+	Compress   bool   `koanf:"compress" yaml:"compress,omitempty" json:"compress,omitempty"`
+}
+
+// Resolved returns a copy of a with defaults in place of zero values.
+func (a AuditLog) Resolved() AuditLog {
+	def := newAuditLog()
+	if a.Filename == "" {
+		a.Filename = def.Filename
+	}
+	if a.MaxSize == 0 {
+		a.MaxSize = def.MaxSize
+	}
+	if a.MaxBackups == 0 {
+		a.MaxBackups = def.MaxBackups
+	}
+	if a.MaxAge == 0 {
+		a.MaxAge = def.MaxAge
+	}
+	return a
+}
+
+func newAuditLog() AuditLog {
+	return AuditLog{
+		Filename:   "audit.jsonl",
+		MaxSize:    10,
+		MaxBackups: 5,
+		MaxAge:     90,
+		Compress:   true,
+	}
+}
+
+// Log formats for the screen and the file. An empty format means text.
+const (
+	FormatText = "text"
+	FormatJson = "json"
+)
+
+// ComponentKey is the slog attribute that names the part of khedra a record
+// came from. Records carrying one of the component names below are filtered
+// by that component's level (if set) instead of the global Level.
+const (
+	ComponentKey     = "component"
+	ComponentControl = "control"
+	ComponentScraper = "scraper"
+	ComponentMonitor = "monitor"
+	ComponentInstall = "install"
+	ComponentRpc     = "rpc"
+)
+
+// ComponentLevels holds optional per-component level overrides. Empty values
+// fall back to Logging.Level.
+type ComponentLevels struct {
+	Control string `koanf:"control" yaml:"control,omitempty" json:"control,omitempty" validate:"omitempty,oneof=debug info warn error"`
+	Scraper string `koanf:"scraper" yaml:"scraper,omitempty" json:"scraper,omitempty" validate:"omitempty,oneof=debug info warn error"`
+	Monitor string `koanf:"monitor" yaml:"monitor,omitempty" json:"monitor,omitempty" validate:"omitempty,oneof=debug info warn error"`
+	Install string `koanf:"install" yaml:"install,omitempty" json:"install,omitempty" validate:"omitempty,oneof=debug info warn error"`
+	Rpc     string `koanf:"rpc" yaml:"rpc,omitempty" json:"rpc,omitempty" validate:"omitempty,oneof=debug info warn error"`
+}
+
+// Map returns the non-empty overrides keyed by component name.
+func (c ComponentLevels) Map() map[string]string {
+	ret := map[string]string{}
+	for name, level := range map[string]string{
+		ComponentControl: c.Control,
+		ComponentScraper: c.Scraper,
+		ComponentMonitor: c.Monitor,
+		ComponentInstall: c.Install,
+		ComponentRpc:     c.Rpc,
+	} {
+		if level != "" {
+			ret[name] = level
+		}
+	}
+	return ret
 }
 
 func NewLogging() Logging {
@@ -31,14 +119,17 @@ func NewLogging() Logging {
 		logger.Panic("could not determine user home directory")
 	}
 	return Logging{
-		Folder:     filepath.Join(homeDir, ".khedra", "logs"),
-		Filename:   "khedra.log",
-		ToFile:     false,
-		MaxSize:    10,
-		MaxBackups: 3,
-		MaxAge:     10,
-		Compress:   true,
-		Level:      "info",
+		Folder:       filepath.Join(homeDir, ".khedra", "logs"),
+		Filename:     "khedra.log",
+		ToFile:       false,
+		MaxSize:      10,
+		MaxBackups:   3,
+		MaxAge:       10,
+		Compress:     true,
+		Level:        "info",
+		ScreenFormat: FormatText,
+		FileFormat:   FormatText,
+		Audit:        newAuditLog(),
 	}
 }
 
@@ -108,24 +199,90 @@ func (m *multiHandler) Handle(ctx context.Context, r slog.Record) error {
 }
 
 func (m *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &multiHandler{
+	ret := &multiHandler{
 		screenHandler: m.screenHandler.WithAttrs(attrs),
-		fileHandler:   m.fileHandler.WithAttrs(attrs),
 		writeBoth:     m.writeBoth,
 	}
+	if m.fileHandler != nil {
+		ret.fileHandler = m.fileHandler.WithAttrs(attrs)
+	}
+	return ret
 }
 
 func (m *multiHandler) WithGroup(name string) slog.Handler {
-	return &multiHandler{
+	ret := &multiHandler{
 		screenHandler: m.screenHandler.WithGroup(name),
-		fileHandler:   m.fileHandler.WithGroup(name),
 		writeBoth:     m.writeBoth,
 	}
+	if m.fileHandler != nil {
+		ret.fileHandler = m.fileHandler.WithGroup(name)
+	}
+	return ret
+}
+
+// componentHandler applies the global level, or a component's override, to
+// each record before passing it on. The levels live in a levelState shared by
+// every derived handler so they can be changed at runtime; the wrapped handlers
+// accept everything and leave the filtering to this one.
+type componentHandler struct {
+	next      slog.Handler
+	levels    *levelState
+	component string
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	// Without a bound component the record's own attrs may still name one, so
+	// only the lowest level can be ruled out here; Handle makes the final call.
+	if h.component != "" {
+		return level >= h.levels.threshold(h.component) && h.next.Enabled(ctx, level)
+	}
+	return level >= h.levels.lowest() && h.next.Enabled(ctx, level)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	component := h.component
+	if component == "" {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == ComponentKey {
+				component = a.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	if r.Level < h.levels.threshold(component) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := h.component
+	for _, a := range attrs {
+		if a.Key == ComponentKey {
+			component = a.Value.String()
+		}
+	}
+	return &componentHandler{
+		next:      h.next.WithAttrs(attrs),
+		levels:    h.levels,
+		component: component,
+	}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{
+		next:      h.next.WithGroup(name),
+		levels:    h.levels,
+		component: h.component,
+	}
 }
 
 type CustomLogger struct {
 	*slog.Logger
 	screenHandler slog.Handler
+	levels        *levelState
+	changes       *slog.Logger // unfiltered, records level changes
 }
 
 func (c *CustomLogger) Panic(msg string, args ...any) {
@@ -139,14 +296,21 @@ func (c *CustomLogger) Fatal(msg string, args ...any) {
 }
 
 func (c *CustomLogger) Progress(msg string, args ...any) {
-	if c.screenHandler.Enabled(context.Background(), LevelProgress) {
+	if c.screenHandler.Enabled(context.Background(), LevelProgress) && LevelProgress >= c.levels.threshold("") {
 		c.Logger.Log(context.Background(), LevelProgress, msg, args...)
 	}
 }
 
+// Component returns a logger whose records carry the given component name and
+// are filtered by that component's level override, if any.
+func (c *CustomLogger) Component(name string) *slog.Logger {
+	return c.Logger.With(ComponentKey, name)
+}
+
 type ColorTextHandler struct {
 	Writer io.Writer
 	Level  slog.Level
+	attrs  []slog.Attr
 }
 
 func (h *ColorTextHandler) Handle(ctx context.Context, r slog.Record) error {
@@ -168,6 +332,9 @@ func (h *ColorTextHandler) Handle(ctx context.Context, r slog.Record) error {
 
 	fixedMsg := ""
 	attrs := ""
+	for _, a := range h.attrs {
+		attrs += fmt.Sprintf("%s%s%s=%v ", colors.Green, a.Key, colors.Off, a.Value)
+	}
 	r.Attrs(func(a slog.Attr) bool {
 		if a.Key == "time" {
 			return true
@@ -199,8 +366,11 @@ func (h *ColorTextHandler) Enabled(ctx context.Context, level slog.Level) bool {
 }
 
 func (h *ColorTextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	_ = attrs
-	return h
+	return &ColorTextHandler{
+		Writer: h.Writer,
+		Level:  h.Level,
+		attrs:  append(append([]slog.Attr{}, h.attrs...), attrs...),
+	}
 }
 
 func (h *ColorTextHandler) WithGroup(name string) slog.Handler {
@@ -209,9 +379,40 @@ func (h *ColorTextHandler) WithGroup(name string) slog.Handler {
 }
 
 func NewLogger(logging Logging) *CustomLogger {
-	screenHandler := &ColorTextHandler{
-		Writer: os.Stderr,
-		Level:  convertLevel(logging.Level),
+	global := convertLevel(logging.Level)
+	levels := map[string]slog.Level{}
+	for name, level := range logging.Components.Map() {
+		levels[name] = convertLevel(level)
+	}
+	return newLogger(logging, newLevelState(global, levels))
+}
+
+// Reload returns a logger for a changed logging config that shares c's
+// levels, so loggers already handed out (to the scraper, the monitor and the
+// RPC budgets) follow the new config's levels too. A timed change still in
+// effect is kept and, when it expires, returns to the new config's level.
+func (c *CustomLogger) Reload(logging Logging) *CustomLogger {
+	c.levels.reset(logging.Level, logging.Components.Map())
+	return newLogger(logging, c.levels)
+}
+
+func newLogger(logging Logging, state *levelState) *CustomLogger {
+	// Filtering happens in componentHandler; the screen and file handlers accept everything.
+	floor := slog.LevelDebug
+	// The same options for the screen and the file, so both name levels alike
+	opts := &slog.HandlerOptions{
+		Level:       floor,
+		ReplaceAttr: replaceLevelAttr,
+	}
+
+	var screenHandler slog.Handler
+	if logging.ScreenFormat == FormatJson {
+		screenHandler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		screenHandler = &ColorTextHandler{
+			Writer: os.Stderr,
+			Level:  floor,
+		}
 	}
 
 	var fileHandler slog.Handler
@@ -223,9 +424,11 @@ func NewLogger(logging Logging) *CustomLogger {
 			MaxAge:     logging.MaxAge,
 			Compress:   logging.Compress,
 		}
-		fileHandler = slog.NewTextHandler(fileWriter, &slog.HandlerOptions{
-			Level: convertLevel(logging.Level),
-		})
+		if logging.FileFormat == FormatJson {
+			fileHandler = slog.NewJSONHandler(fileWriter, opts)
+		} else {
+			fileHandler = slog.NewTextHandler(fileWriter, opts)
+		}
 	}
 
 	handler := &multiHandler{
@@ -235,9 +438,21 @@ func NewLogger(logging Logging) *CustomLogger {
 	}
 
 	return &CustomLogger{
-		Logger:        slog.New(handler),
+		Logger:        slog.New(&componentHandler{next: handler, levels: state}),
 		screenHandler: screenHandler,
+		levels:        state,
+		changes:       slog.New(handler),
+	}
+}
+
+// replaceLevelAttr writes khedra's level names (including PROG) in JSON output.
+func replaceLevelAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.LevelKey {
+		if lvl, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(levelToString(lvl))
+		}
 	}
+	return a
 }
 
 func (c *CustomLogger) GetLogger() *slog.Logger {
@@ -3,6 +3,7 @@ package types
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"log/slog"
 	"os"
@@ -82,6 +83,47 @@ func TestLoggingValidation(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Invalid ScreenFormat",
+			logging: Logging{
+				Folder:       tempDir,
+				Filename:     "app.log",
+				MaxSize:      10,
+				MaxBackups:   3,
+				MaxAge:       7,
+				Level:        "info",
+				ScreenFormat: "xml",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Valid json formats and component level",
+			logging: Logging{
+				Folder:       tempDir,
+				Filename:     "app.log",
+				MaxSize:      10,
+				MaxBackups:   3,
+				MaxAge:       7,
+				Level:        "info",
+				ScreenFormat: "json",
+				FileFormat:   "json",
+				Components:   ComponentLevels{Scraper: "debug"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid component level",
+			logging: Logging{
+				Folder:     tempDir,
+				Filename:   "app.log",
+				MaxSize:    10,
+				MaxBackups: 3,
+				MaxAge:     7,
+				Level:      "info",
+				Components: ComponentLevels{Rpc: "loud"},
+			},
+			wantErr: true,
+		},
 		{
 			name: "Missing Folder",
 			logging: Logging{
@@ -322,3 +364,67 @@ func TestColorTextHandler_Format(t *testing.T) {
 	assert.Contains(t, stripped, "message body")
 	assert.Contains(t, stripped, "key=value")
 }
+
+func TestNewLogger_JsonFile(t *testing.T) {
+	tempDir := t.TempDir()
+	logging := Logging{Folder: tempDir, Filename: "test.log", Level: "info", FileFormat: FormatJson, MaxSize: 5, MaxBackups: 1, MaxAge: 1}
+	logger := NewLogger(logging)
+	logger.Component(ComponentScraper).Info("json message", "chain", "mainnet")
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "test.log"))
+	assert.NoError(t, err)
+	var rec map[string]any
+	assert.NoError(t, json.Unmarshal(bytes.TrimSpace(content), &rec))
+	assert.Equal(t, "json message", rec["msg"])
+	assert.Equal(t, "INFO", rec["level"])
+	assert.Equal(t, ComponentScraper, rec[ComponentKey])
+	assert.Equal(t, "mainnet", rec["chain"])
+}
+
+func TestNewLogger_ComponentLevels(t *testing.T) {
+	tempDir := t.TempDir()
+	logging := Logging{
+		Folder:     tempDir,
+		Filename:   "test.log",
+		Level:      "warn",
+		Components: ComponentLevels{Rpc: "debug", Scraper: "error"},
+		MaxSize:    5,
+		MaxBackups: 1,
+		MaxAge:     1,
+	}
+
+	origStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	logger := NewLogger(logging)
+	logger.Info("global info hidden")
+	logger.Warn("global warn shown")
+	logger.Component(ComponentRpc).Debug("rpc debug shown")
+	logger.Info("rpc attr shown", ComponentKey, ComponentRpc)
+	logger.Component(ComponentScraper).Warn("scraper warn hidden")
+	logger.Component(ComponentScraper).Error("scraper error shown")
+	logger.Component(ComponentMonitor).Info("monitor info hidden")
+	logger.Progress("progress hidden")
+	w.Close()
+	os.Stderr = origStderr
+	screen, _ := io.ReadAll(r)
+
+	file, err := os.ReadFile(filepath.Join(tempDir, "test.log"))
+	assert.NoError(t, err)
+
+	for _, out := range []string{string(screen), string(file)} {
+		for _, msg := range []string{"global warn shown", "rpc debug shown", "rpc attr shown", "scraper error shown"} {
+			assert.Contains(t, out, msg)
+		}
+		assert.NotContains(t, out, "hidden")
+	}
+}
+
+func TestColorTextHandler_WithAttrs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := (&ColorTextHandler{Writer: buf, Level: slog.LevelDebug}).WithAttrs([]slog.Attr{slog.String(ComponentKey, ComponentControl)})
+	rec := slog.NewRecord(time.Now(), slog.LevelInfo, "message body", 0)
+	_ = h.Handle(context.Background(), rec)
+	stripped := regexp.MustCompile(`\x1b\[[0-9;]*m`).ReplaceAllString(buf.String(), "")
+	assert.Contains(t, stripped, "component=control")
+}
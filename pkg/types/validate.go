@@ -3,7 +3,11 @@ package types
 import (
 	"fmt"
 	"net/url"
+	"slices"
+	"sort"
 	"strings"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
 )
 
 // Validate is the main entry point for configuration validation.
@@ -53,6 +57,11 @@ func (c *Config) Validate() error {
 		errs = append(errs, err.Error())
 	}
 
+	// Validate cache limits
+	if err := c.Cache.validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
 	if len(errs) > 0 {
 		return newValidationError(errs)
 	}
@@ -90,6 +99,26 @@ func (ch Chain) validate(name string) error {
 				errs = append(errs, fmt.Sprintf("Chain[%s].RPCs[%d] is not a valid URL: %q", name, i, rpc))
 			}
 		}
+		// chifra scrapes over HTTP; WebSocket RPCs only announce new blocks
+		if wsrpc.IsWebSocket(ch.RPCs[0]) {
+			errs = append(errs, fmt.Sprintf("Chain[%s].RPCs[0] must be an http:// or https:// RPC: %q", name, ch.RPCs[0]))
+		}
+	}
+
+	// Each budget must name one of the chain's RPCs, once
+	seen := map[string]bool{}
+	for i, b := range ch.Budgets {
+		if !slices.Contains(ch.RPCs, b.RPC) {
+			errs = append(errs, fmt.Sprintf("Chain[%s].Budgets[%d].RPC is not one of the chain's RPCs: %q", name, i, b.RPC))
+		} else if wsrpc.IsWebSocket(b.RPC) {
+			errs = append(errs, fmt.Sprintf("Chain[%s].Budgets[%d].RPC is a WebSocket RPC, which has no budget: %q", name, i, b.RPC))
+		} else if seen[b.RPC] {
+			errs = append(errs, fmt.Sprintf("Chain[%s].Budgets[%d].RPC has more than one budget: %q", name, i, b.RPC))
+		}
+		seen[b.RPC] = true
+		if b.MaxRPS < 0 || b.Burst < 0 || b.DailyQuota < 0 {
+			errs = append(errs, fmt.Sprintf("Chain[%s].Budgets[%d] must not have negative limits", name, i))
+		}
 	}
 
 	if len(errs) > 0 {
@@ -165,6 +194,24 @@ func (g *General) validate() error {
 	return nil
 }
 
+// validate validates a Cache configuration object.
+func (c *Cache) validate() error {
+	var errs []string
+	if c.MaxSize < 0 {
+		errs = append(errs, fmt.Sprintf("Cache.MaxSize must not be negative, got %d", c.MaxSize))
+	}
+	if c.MaxChainSize < 0 {
+		errs = append(errs, fmt.Sprintf("Cache.MaxChainSize must not be negative, got %d", c.MaxChainSize))
+	}
+	if c.MaxAge < 0 {
+		errs = append(errs, fmt.Sprintf("Cache.MaxAge must not be negative, got %d", c.MaxAge))
+	}
+	if len(errs) > 0 {
+		return newValidationError(errs)
+	}
+	return nil
+}
+
 // validate validates a Logging configuration object.
 func (l *Logging) validate() error {
 	var errs []string
@@ -183,6 +230,27 @@ func (l *Logging) validate() error {
 		errs = append(errs, fmt.Sprintf("Logging.Level must be 'debug', 'info', 'warn', or 'error', got %q", l.Level))
 	}
 
+	// Validate formats (empty means text)
+	if l.ScreenFormat != "" && l.ScreenFormat != FormatText && l.ScreenFormat != FormatJson {
+		errs = append(errs, fmt.Sprintf("Logging.ScreenFormat must be 'text' or 'json', got %q", l.ScreenFormat))
+	}
+	if l.FileFormat != "" && l.FileFormat != FormatText && l.FileFormat != FormatJson {
+		errs = append(errs, fmt.Sprintf("Logging.FileFormat must be 'text' or 'json', got %q", l.FileFormat))
+	}
+
+	// Validate per-component levels (empty means the global level)
+	comps := l.Components.Map()
+	names := make([]string, 0, len(comps))
+	for name := range comps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if lvl := comps[name]; lvl != "debug" && lvl != "info" && lvl != "warn" && lvl != "error" {
+			errs = append(errs, fmt.Sprintf("Logging.Components.%s must be 'debug', 'info', 'warn', or 'error', got %q", name, lvl))
+		}
+	}
+
 	// Validate MaxSize
 	if l.MaxSize <= 0 {
 		errs = append(errs, fmt.Sprintf("Logging.MaxSize must be greater than 0, got %d", l.MaxSize))
@@ -198,6 +266,20 @@ func (l *Logging) validate() error {
 		errs = append(errs, fmt.Sprintf("Logging.MaxAge must be non-negative, got %d", l.MaxAge))
 	}
 
+	// Validate the audit log (zero values mean the defaults)
+	if l.Audit.Filename != "" && !strings.HasSuffix(l.Audit.Filename, ".jsonl") {
+		errs = append(errs, fmt.Sprintf("Logging.Audit.Filename must end with '.jsonl', got %q", l.Audit.Filename))
+	}
+	if l.Audit.MaxSize < 0 {
+		errs = append(errs, fmt.Sprintf("Logging.Audit.MaxSize must be non-negative, got %d", l.Audit.MaxSize))
+	}
+	if l.Audit.MaxBackups < 0 {
+		errs = append(errs, fmt.Sprintf("Logging.Audit.MaxBackups must be non-negative, got %d", l.Audit.MaxBackups))
+	}
+	if l.Audit.MaxAge < 0 {
+		errs = append(errs, fmt.Sprintf("Logging.Audit.MaxAge must be non-negative, got %d", l.Audit.MaxAge))
+	}
+
 	if len(errs) > 0 {
 		return newValidationError(errs)
 	}
@@ -1,26 +1,33 @@
 package types
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
 )
 
 // ValidateRpcEndpointRT performs real-time validation of an RPC endpoint,
 // checking both formatting and connectivity.
 func ValidateRpcEndpointRT(endpoint string) (string, error) {
 	// Basic format validation
-	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") &&
-		!strings.HasPrefix(endpoint, "ws://") && !strings.HasPrefix(endpoint, "wss://") {
-		return "", fmt.Errorf("RPC endpoint must start with http:// or https:// (websocket URLs not supported)")
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") && !wsrpc.IsWebSocket(endpoint) {
+		return "", fmt.Errorf("RPC endpoint must start with http://, https://, ws:// or wss://")
 	}
 
-	// Explicitly reject websocket endpoints
-	if strings.HasPrefix(strings.ToLower(endpoint), "ws://") || strings.HasPrefix(strings.ToLower(endpoint), "wss://") {
-		return "", fmt.Errorf("WebSocket RPC endpoints (ws://, wss://) are not supported; use http:// or https://")
+	// For WebSocket endpoints, connect and ask for the chain ID
+	if wsrpc.IsWebSocket(endpoint) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := wsrpc.Ping(ctx, endpoint); err != nil {
+			return "", fmt.Errorf("connection failed: %s", err.Error())
+		}
+		return "", nil
 	}
 
 	// For HTTP endpoints, attempt to connect
@@ -406,3 +406,57 @@ func TestValidationError_PreservesContext(t *testing.T) {
 	assert.Contains(t, errStr, "Port", "Error should mention Port field")
 	assert.Contains(t, errStr, "api", "Error should mention api service context")
 }
+
+func TestValidateConfig_NegativeCacheLimit(t *testing.T) {
+	defer SetupTest([]string{})()
+	cfg := NewConfig()
+	cfg.Cache.MaxChainSize = -1
+	err := Validate(&cfg)
+	assert.ErrorContains(t, err, "Cache.MaxChainSize must not be negative")
+}
+
+func TestValidateConfig_Budgets(t *testing.T) {
+	defer SetupTest([]string{})()
+	tests := []struct {
+		name    string
+		budgets []RPCBudget
+		wantErr string
+	}{
+		{"valid", []RPCBudget{{RPC: "http://localhost:8545", MaxRPS: 10, Burst: 20, DailyQuota: 1000}}, ""},
+		{"unknown rpc", []RPCBudget{{RPC: "http://other:8545", MaxRPS: 10}}, "is not one of the chain's RPCs"},
+		{"twice", []RPCBudget{{RPC: "http://localhost:8545"}, {RPC: "http://localhost:8545"}}, "has more than one budget"},
+		{"negative", []RPCBudget{{RPC: "http://localhost:8545", DailyQuota: -1}}, "must not have negative limits"},
+		{"websocket", []RPCBudget{{RPC: "ws://localhost:8546", MaxRPS: 10}}, "is a WebSocket RPC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			ch := cfg.Chains["mainnet"]
+			ch.RPCs = append(ch.RPCs, "ws://localhost:8546")
+			ch.Budgets = tt.budgets
+			cfg.Chains["mainnet"] = ch
+			err := Validate(&cfg)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateChain_WebSocketRPCs(t *testing.T) {
+	defer SetupTest([]string{})()
+	chain := Chain{
+		Name:    "mainnet",
+		RPCs:    []string{"http://localhost:8545", "wss://localhost:8546"},
+		ChainID: 1,
+		Enabled: true,
+	}
+	assert.NoError(t, Validate(&chain), "A WebSocket RPC alongside an HTTP one should be valid")
+	assert.Equal(t, []string{"http://localhost:8545"}, chain.HttpRPCs())
+	assert.Equal(t, []string{"wss://localhost:8546"}, chain.WebSocketRPCs())
+
+	chain.RPCs = []string{"ws://localhost:8546", "http://localhost:8545"}
+	assert.ErrorContains(t, Validate(&chain), "RPCs[0] must be an http:// or https:// RPC")
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,7 +10,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/TrueBlocks/trueblocks-chifra/v6/pkg/rpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/metrics"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
 )
 
 // RpcTestResult contains the result of an RPC endpoint connectivity test
@@ -29,14 +31,11 @@ func TestRpcEndpoint(endpoint string) RpcTestResult {
 		Reachable: false,
 	}
 
-	// Skip testing for non-HTTP endpoints
+	if wsrpc.IsWebSocket(endpoint) {
+		return testWebSocketEndpoint(endpoint)
+	}
 	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
-		if strings.HasPrefix(endpoint, "ws://") || strings.HasPrefix(endpoint, "wss://") {
-			result.Reachable = true
-			result.ErrorMessage = "WebSocket endpoints cannot be fully tested"
-		} else {
-			result.ErrorMessage = "Invalid endpoint URL format"
-		}
+		result.ErrorMessage = "Invalid endpoint URL format"
 		return result
 	}
 
@@ -114,6 +113,37 @@ func TestRpcEndpoint(endpoint string) RpcTestResult {
 	return result
 }
 
+// testWebSocketEndpoint is TestRpcEndpoint for a ws:// or wss:// endpoint:
+// the same two calls, over one connection.
+func testWebSocketEndpoint(endpoint string) RpcTestResult {
+	var result RpcTestResult
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	startTime := time.Now()
+	conn, err := wsrpc.Dial(ctx, endpoint)
+	if err != nil {
+		result.ErrorMessage = fmt.Sprintf("Connection failed: %s", err.Error())
+		return result
+	}
+	defer conn.Close()
+
+	var blockNumber string
+	if err := conn.Call(ctx, "eth_blockNumber", nil, &blockNumber); err != nil {
+		result.ErrorMessage = fmt.Sprintf("RPC error: %s", err.Error())
+		return result
+	}
+	result.ResponseTime = time.Since(startTime)
+	result.BlockNumber = blockNumber
+
+	var chainID string
+	if conn.Call(ctx, "eth_chainId", nil, &chainID) == nil {
+		result.ChainID = chainID
+	}
+	result.Reachable = true
+	return result
+}
+
 // FormatRpcTestResult formats an RPC test result as a user-friendly string
 func FormatRpcTestResult(result RpcTestResult) string {
 	if !result.Reachable {
@@ -154,11 +184,11 @@ func ParseHexNumber(hexString string) (string, error) {
 
 func TryConnect(chain, providerUrl string, maxAttempts int) error {
 	for i := 1; i <= maxAttempts; i++ {
-		_, err := rpc.PingRpc(providerUrl)
+		_, err := metrics.PingRpc(providerUrl)
 		if err == nil {
 			return nil
 		} else {
-			slog.Warn("retrying RPC", "chain", chain, "provider", providerUrl)
+			slog.Default().With(ComponentKey, ComponentRpc).Warn("retrying RPC", "chain", chain, "provider", providerUrl)
 			if i < maxAttempts {
 				time.Sleep(1 * time.Second)
 			}
@@ -0,0 +1,11 @@
+package wsrpc
+
+import "time"
+
+// SetPingInterval changes how often connections ping the node and returns a
+// func that restores it.
+func SetPingInterval(d time.Duration) func() {
+	prev := pingInterval
+	pingInterval = d
+	return func() { pingInterval = prev }
+}
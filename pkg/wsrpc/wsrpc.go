@@ -0,0 +1,322 @@
+// Package wsrpc speaks Ethereum JSON-RPC over a WebSocket (ws:// or wss://):
+// calls, as over HTTP, and the eth_subscribe notifications HTTP cannot carry,
+// such as a node announcing each new block.
+package wsrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DialTimeout bounds the opening handshake when ctx has no deadline.
+const DialTimeout = 10 * time.Second
+
+// pingInterval is how often an open connection pings the node. A connection
+// that reads nothing, not even a pong, for two intervals is taken for dead,
+// so a half-open one does not leave its subscriptions waiting forever.
+var pingInterval = 30 * time.Second
+
+// ErrClosed is returned by calls on a connection that has gone away.
+var ErrClosed = errors.New("websocket connection closed")
+
+// IsWebSocket reports whether rawURL is a ws:// or wss:// URL.
+func IsWebSocket(rawURL string) bool {
+	u := strings.ToLower(strings.TrimSpace(rawURL))
+	return strings.HasPrefix(u, "ws://") || strings.HasPrefix(u, "wss://")
+}
+
+// Error is an error object returned by the node.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// message is any message from the node: a response to a call, or a
+// subscription notification.
+type message struct {
+	ID     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+	Method string          `json:"method"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// pending is a call waiting for its response. For an eth_subscribe, sub is
+// the channel its notifications go to.
+type pending struct {
+	resp chan message
+	sub  chan json.RawMessage
+}
+
+// Conn is a JSON-RPC connection to a node. It is safe for concurrent use.
+type Conn struct {
+	ws       *websocket.Conn
+	writeMu  sync.Mutex
+	interval time.Duration // between pings
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]pending
+	subs    map[string]chan json.RawMessage
+	err     error
+	done    chan struct{}
+}
+
+// Dial opens a connection to the node at rawURL.
+func Dial(ctx context.Context, rawURL string) (*Conn, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DialTimeout)
+		defer cancel()
+	}
+	ws, resp, err := websocket.DefaultDialer.DialContext(ctx, rawURL, nil)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("websocket handshake failed with status %d: %w", resp.StatusCode, err)
+		}
+		return nil, err
+	}
+	c := &Conn{
+		ws:       ws,
+		pending:  map[int]pending{},
+		subs:     map[string]chan json.RawMessage{},
+		done:     make(chan struct{}),
+		interval: pingInterval,
+	}
+	c.alive()
+	ws.SetPongHandler(func(string) error {
+		c.alive()
+		return nil
+	})
+	go c.read()
+	go c.ping()
+	return c, nil
+}
+
+// alive pushes the read deadline two ping intervals ahead.
+func (c *Conn) alive() {
+	_ = c.ws.SetReadDeadline(time.Now().Add(2 * c.interval))
+}
+
+// ping pings the node every interval until the connection goes away.
+func (c *Conn) ping() {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.interval)); err != nil {
+				c.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// read delivers responses to their calls and notifications to their
+// subscriptions until the connection fails or is closed. A subscription is
+// registered as its response is read, so no notification the node sends
+// right after it is lost.
+func (c *Conn) read() {
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.alive()
+		var m message
+		if json.Unmarshal(data, &m) != nil {
+			continue
+		}
+		c.mu.Lock()
+		switch {
+		case m.Method == "eth_subscription":
+			if ch, ok := c.subs[m.Params.Subscription]; ok {
+				select {
+				case ch <- m.Params.Result:
+				default: // the reader is behind; it only needs the latest
+				}
+			}
+		case m.ID != nil:
+			if p, ok := c.pending[*m.ID]; ok {
+				delete(c.pending, *m.ID)
+				var id string
+				if p.sub != nil && m.Error == nil && json.Unmarshal(m.Result, &id) == nil {
+					c.subs[id] = p.sub
+				}
+				p.resp <- m
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// fail records why the connection ended and closes its subscriptions.
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for id := range c.pending {
+		delete(c.pending, id)
+	}
+	for id, ch := range c.subs {
+		close(ch)
+		delete(c.subs, id)
+	}
+	close(c.done)
+}
+
+// Done is closed when the connection has gone away.
+func (c *Conn) Done() <-chan struct{} { return c.done }
+
+// Err returns why the connection went away, or nil while it is open.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.fail(ErrClosed)
+	return c.ws.Close()
+}
+
+// Call calls method with params and decodes its result into result, which
+// may be nil.
+func (c *Conn) Call(ctx context.Context, method string, params []any, result any) error {
+	return c.call(ctx, method, params, result, nil)
+}
+
+// call is Call; if sub is not nil, the call is a subscription whose
+// notifications go to sub.
+func (c *Conn) call(ctx context.Context, method string, params []any, result any, sub chan json.RawMessage) error {
+	if params == nil {
+		params = []any{}
+	}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan message, 1)
+	c.pending[id] = pending{resp: ch, sub: sub}
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	err := c.ws.WriteJSON(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	c.writeMu.Unlock()
+	if err != nil {
+		c.fail(err)
+		return err
+	}
+
+	select {
+	case m := <-ch:
+		if m.Error != nil {
+			return m.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(m.Result, result)
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Uint64 calls a method whose result is a hex quantity such as eth_blockNumber
+// or eth_chainId.
+func (c *Conn) Uint64(ctx context.Context, method string) (uint64, error) {
+	var hex string
+	if err := c.Call(ctx, method, nil, &hex); err != nil {
+		return 0, err
+	}
+	s := strings.TrimPrefix(strings.TrimPrefix(hex, "0x"), "0X")
+	if s == "" {
+		return 0, fmt.Errorf("invalid quantity %q", hex)
+	}
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// Head is a block announced by a newHeads subscription.
+type Head struct {
+	Number string `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+// NewHeads subscribes to new blocks. The channel gets each block as the node
+// announces it (or the latest, if the reader falls behind) and is closed when
+// the connection goes away.
+func (c *Conn) NewHeads(ctx context.Context) (<-chan Head, error) {
+	raw := make(chan json.RawMessage, 1)
+	if err := c.call(ctx, "eth_subscribe", []any{"newHeads"}, nil, raw); err != nil {
+		return nil, err
+	}
+
+	heads := make(chan Head, 1)
+	go func() {
+		defer close(heads)
+		for data := range raw {
+			var h Head
+			if json.Unmarshal(data, &h) == nil {
+				select {
+				case heads <- h:
+				default: // the reader has one waiting already
+				}
+			}
+		}
+	}()
+	return heads, nil
+}
+
+// Ping connects to rawURL and asks the node for its chain ID, returned as
+// the hex quantity the node sent.
+func Ping(ctx context.Context, rawURL string) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DialTimeout)
+		defer cancel()
+	}
+	c, err := Dial(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	var chainID string
+	if err := c.Call(ctx, "eth_chainId", nil, &chainID); err != nil {
+		return "", err
+	}
+	if chainID == "" {
+		return "", errors.New("empty result")
+	}
+	return chainID, nil
+}
@@ -0,0 +1,162 @@
+package wsrpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc"
+	"github.com/TrueBlocks/trueblocks-khedra/v6/pkg/wsrpc/wsrpctest"
+)
+
+func TestPing(t *testing.T) {
+	node := wsrpctest.NewNode(100)
+	defer node.Close()
+
+	got, err := wsrpc.Ping(context.Background(), node.URL)
+	if err != nil || got != "0x64" {
+		t.Fatalf("expected 0x64, got %q (%v)", got, err)
+	}
+
+	node.Close()
+	if _, err := wsrpc.Ping(context.Background(), node.URL); err == nil {
+		t.Fatal("expected a stopped node to fail")
+	}
+}
+
+func TestCall(t *testing.T) {
+	node := wsrpctest.NewNode(1)
+	defer node.Close()
+	ctx := context.Background()
+
+	c, err := wsrpc.Dial(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	node.Head(0x1234)
+	if n, err := c.Uint64(ctx, "eth_blockNumber"); err != nil || n != 0x1234 {
+		t.Fatalf("expected block 0x1234, got %d (%v)", n, err)
+	}
+	var rpcErr *wsrpc.Error
+	if err := c.Call(ctx, "eth_nothing", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Fatalf("expected the node's error, got %v", err)
+	}
+}
+
+func TestNewHeads(t *testing.T) {
+	node := wsrpctest.NewNode(1)
+	defer node.Close()
+	ctx := context.Background()
+
+	c, err := wsrpc.Dial(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	heads, err := c.NewHeads(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node.Head(7)
+	select {
+	case h := <-heads:
+		if h.Number != "0x7" {
+			t.Fatalf("expected block 0x7, got %s", h.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no head announced")
+	}
+
+	node.Drop()
+	select {
+	case _, ok := <-heads:
+		for ok {
+			_, ok = <-heads
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscription should end when the connection drops")
+	}
+	if c.Err() == nil {
+		t.Fatal("expected the connection to report why it ended")
+	}
+	if err := c.Call(ctx, "eth_chainId", nil, nil); !errors.Is(err, wsrpc.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestNewHeads_RightAfterReply(t *testing.T) {
+	node := wsrpctest.NewNode(1)
+	defer node.Close()
+	node.Head(9) // no subscribers yet; only sets the latest block
+	node.AnnounceOnSubscribe()
+	ctx := context.Background()
+
+	c, err := wsrpc.Dial(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	heads, err := c.NewHeads(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case h := <-heads:
+		if h.Number != "0x9" {
+			t.Fatalf("expected block 0x9, got %s", h.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a block announced right after the subscription's reply was lost")
+	}
+}
+
+func TestHalfOpen(t *testing.T) {
+	defer wsrpc.SetPingInterval(20 * time.Millisecond)()
+
+	// A node that accepts the connection and then reads nothing, pings included
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		<-stalled
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	c, err := wsrpc.Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	select {
+	case <-c.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("a connection that never answers a ping should be taken for dead")
+	}
+
+	// A live node answers the pings, so the connection stays open
+	node := wsrpctest.NewNode(1)
+	defer node.Close()
+	c, err = wsrpc.Dial(context.Background(), node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	select {
+	case <-c.Done():
+		t.Fatalf("a live connection went away: %v", c.Err())
+	case <-time.After(200 * time.Millisecond):
+	}
+}
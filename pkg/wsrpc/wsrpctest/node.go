@@ -0,0 +1,190 @@
+// Package wsrpctest provides a stand-in node that speaks JSON-RPC over a
+// WebSocket, for tests of code that probes or subscribes to one.
+package wsrpctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Node answers eth_chainId, eth_blockNumber and eth_subscribe("newHeads"),
+// and announces the blocks given to Head to its subscribers.
+type Node struct {
+	URL string // ws://127.0.0.1:port
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	chainID uint64
+	block   uint64
+	conns   map[*websocket.Conn]*sync.Mutex // with the lock for writing to it
+	subs    map[*websocket.Conn]string      // newHeads subscriptions by connection
+	nextSub int
+	methods []string // of every request received, in order
+	eager   bool     // announce the latest block right after a subscription
+}
+
+// NewNode starts a node serving chainID. Call Close when done.
+func NewNode(chainID uint64) *Node {
+	n := &Node{
+		chainID: chainID,
+		conns:   map[*websocket.Conn]*sync.Mutex{},
+		subs:    map[*websocket.Conn]string{},
+	}
+	n.srv = httptest.NewServer(http.HandlerFunc(n.serve))
+	n.URL = "ws" + strings.TrimPrefix(n.srv.URL, "http")
+	return n
+}
+
+func (n *Node) serve(w http.ResponseWriter, r *http.Request) {
+	ws, err := n.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	lock := &sync.Mutex{}
+	n.mu.Lock()
+	n.conns[ws] = lock
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.conns, ws)
+		delete(n.subs, ws)
+		n.mu.Unlock()
+		ws.Close()
+	}()
+
+	for {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params []any  `json:"params"`
+		}
+		if err := ws.ReadJSON(&req); err != nil {
+			return
+		}
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		var announce map[string]any
+		n.mu.Lock()
+		n.methods = append(n.methods, req.Method)
+		switch req.Method {
+		case "eth_chainId":
+			resp["result"] = fmt.Sprintf("0x%x", n.chainID)
+		case "eth_blockNumber":
+			resp["result"] = fmt.Sprintf("0x%x", n.block)
+		case "eth_subscribe":
+			if len(req.Params) == 1 && req.Params[0] == "newHeads" {
+				n.nextSub++
+				n.subs[ws] = fmt.Sprintf("0x%x", n.nextSub)
+				resp["result"] = n.subs[ws]
+				if n.eager {
+					announce = notification(n.subs[ws], n.block)
+				}
+			} else {
+				resp["error"] = map[string]any{"code": -32602, "message": "unsupported subscription"}
+			}
+		default:
+			resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+		n.mu.Unlock()
+		lock.Lock()
+		err := ws.WriteJSON(resp)
+		if err == nil && announce != nil {
+			err = ws.WriteJSON(announce)
+		}
+		lock.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// SetChainID changes the chain ID the node reports.
+func (n *Node) SetChainID(id uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.chainID = id
+}
+
+// Subscribers returns how many connections have a newHeads subscription.
+func (n *Node) Subscribers() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.subs)
+}
+
+// Methods returns the method of every request the node has received, in
+// order.
+func (n *Node) Methods() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.methods...)
+}
+
+// Head makes number the latest block and announces it to every subscriber.
+func (n *Node) Head(number uint64) {
+	n.mu.Lock()
+	n.block = number
+	type target struct {
+		ws   *websocket.Conn
+		lock *sync.Mutex
+		sub  string
+	}
+	var targets []target
+	for ws, sub := range n.subs {
+		targets = append(targets, target{ws, n.conns[ws], sub})
+	}
+	n.mu.Unlock()
+
+	for _, t := range targets {
+		t.lock.Lock()
+		_ = t.ws.WriteJSON(notification(t.sub, number))
+		t.lock.Unlock()
+	}
+}
+
+// notification is the message announcing block number to subscription sub.
+func notification(sub string, number uint64) map[string]any {
+	result, _ := json.Marshal(map[string]any{
+		"number": fmt.Sprintf("0x%x", number),
+		"hash":   fmt.Sprintf("0x%064x", number),
+	})
+	return map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscription",
+		"params":  map[string]any{"subscription": sub, "result": json.RawMessage(result)},
+	}
+}
+
+// AnnounceOnSubscribe makes the node announce its latest block right after
+// each newHeads subscription it accepts, in the same write burst as the
+// reply, as a busy node may.
+func (n *Node) AnnounceOnSubscribe() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.eager = true
+}
+
+// Drop closes every open connection, as a node restarting would. The node
+// keeps accepting new ones.
+func (n *Node) Drop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ws := range n.conns {
+		ws.Close()
+		delete(n.conns, ws)
+		delete(n.subs, ws)
+	}
+}
+
+// Close drops every connection and stops the node.
+func (n *Node) Close() {
+	n.Drop()
+	n.srv.Close()
+}